@@ -0,0 +1,45 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// LocalOrphanedVolume records an LV which was left on the node after its volume had been deleted
+// with the retain on-delete policy.
+type LocalOrphanedVolume struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              LocalOrphanedVolumeSpec `json:"spec"`
+}
+
+// LocalOrphanedVolumeList contains a list of orphaned volumes
+type LocalOrphanedVolumeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []LocalOrphanedVolume `json:"items"`
+}
+
+type LocalOrphanedVolumeSpec struct {
+	VolumeID              string `json:"volumeID"`
+	NodeName              string `json:"nodeName"`
+	LVMVolumeGroupName    string `json:"lvmVolumeGroupName"`
+	ActualVGNameOnTheNode string `json:"actualVGNameOnTheNode"`
+	ActualLVNameOnTheNode string `json:"actualLVNameOnTheNode"`
+	Type                  string `json:"type"`
+	Size                  string `json:"size"`
+	ThinPoolName          string `json:"thinPoolName,omitempty"`
+}
@@ -37,17 +37,71 @@ type LocalStorageClassSpec struct {
 	VolumeBindingMode string                    `json:"volumeBindingMode"`
 	LVM               *LocalStorageClassLVMSpec `json:"lvm,omitempty"`
 	FSType            string                    `json:"fsType,omitempty"`
+	// PropagateReclaimPolicy makes the controller set the changed reclaim policy to the already provisioned PVs as well
+	PropagateReclaimPolicy bool `json:"propagateReclaimPolicy,omitempty"`
+	// IsDefault makes the storage class the default one or not, the default class annotation is left as is if it is nil
+	IsDefault *bool `json:"isDefault,omitempty"`
+	// Quota limits the total size of the volumes provisioned from the storage class
+	Quota *LocalStorageClassQuotaSpec `json:"quota,omitempty"`
+	// RawDevice makes the storage class provision the whole block devices as the volumes instead of the LVM ones
+	RawDevice *LocalStorageClassRawDeviceSpec `json:"rawDevice,omitempty"`
+	// Snapshots makes the controller create the VolumeSnapshotClass for the volumes of the storage class
+	Snapshots *LocalStorageClassSnapshotsSpec `json:"snapshots,omitempty"`
+	// NodeSelector restricts the storage class to the nodes with the labels, e.g. to the nodes of a node group
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// AllowedNamespaces limits the namespaces the volumes of the storage class might be provisioned for
+	AllowedNamespaces *LocalStorageClassAllowedNamespacesSpec `json:"allowedNamespaces,omitempty"`
+}
+
+// LocalStorageClassAllowedNamespacesSpec allows the namespaces listed by their names or matching the selector.
+type LocalStorageClassAllowedNamespacesSpec struct {
+	Names    []string              `json:"names,omitempty"`
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+type LocalStorageClassSnapshotsSpec struct {
+	Enabled bool `json:"enabled"`
+	// DeletionPolicy is the deletion policy of the VolumeSnapshotClass, Delete or Retain
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// SizePercent is the thin pool space reserved for a snapshot in percent of the volume size
+	SizePercent int `json:"sizePercent,omitempty"`
+	// FSFreeze makes the filesystem of the volume frozen while its snapshot is taken
+	FSFreeze bool `json:"fsFreeze,omitempty"`
+}
+
+type LocalStorageClassRawDeviceSpec struct {
+	// BlockDeviceSelector selects the BlockDevices the volumes might be provisioned on by their labels
+	BlockDeviceSelector *metav1.LabelSelector `json:"blockDeviceSelector,omitempty"`
+	// MinSize and MaxSize limit the size of the selected BlockDevices
+	MinSize string `json:"minSize,omitempty"`
+	MaxSize string `json:"maxSize,omitempty"`
+}
+
+type LocalStorageClassQuotaSpec struct {
+	MaxTotalSize string `json:"maxTotalSize,omitempty"`
 }
 
 type LocalStorageClassLVMSpec struct {
 	Type            string                         `json:"type"`
 	Thick           *LocalStorageClassLVMThickSpec `json:"thick,omitempty"`
-	LVMVolumeGroups []LocalStorageClassLVG         `json:"lvmVolumeGroups"`
+	LVMVolumeGroups []LocalStorageClassLVG         `json:"lvmVolumeGroups,omitempty"`
+	// LVMVolumeGroupSelector selects the LVMVolumeGroups by their labels instead of the LVMVolumeGroups list
+	LVMVolumeGroupSelector *metav1.LabelSelector `json:"lvmVolumeGroupSelector,omitempty"`
+	// Thin is the thin provisioning settings of the Thin type
+	Thin *LocalStorageClassLVMThinSpec `json:"thin,omitempty"`
 }
 
 type LocalStorageClassStatus struct {
 	Phase  string `json:"phase,omitempty"`
 	Reason string `json:"reason,omitempty"`
+	// Conditions are the Ready, Validated, StorageClassCreated and Degraded conditions of the LocalStorageClass
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ProvisionedSize is the total size of the volumes provisioned from the storage class
+	ProvisionedSize string `json:"provisionedSize,omitempty"`
+	// RenderedStorageClass is the manifest of the storage class the controller creates for the current spec
+	RenderedStorageClass string `json:"renderedStorageClass,omitempty"`
+	// AppliedReclaimPolicy is the reclaim policy last propagated to the provisioned PVs
+	AppliedReclaimPolicy string `json:"appliedReclaimPolicy,omitempty"`
 }
 
 type LocalStorageClassLVG struct {
@@ -59,6 +113,16 @@ type LocalStorageClassLVMThinPoolSpec struct {
 	PoolName string `json:"poolName"`
 }
 
+type LocalStorageClassLVMThinSpec struct {
+	// PoolName is the thin pool of the LVMVolumeGroups selected by the LVMVolumeGroupSelector
+	PoolName string `json:"poolName,omitempty"`
+	// OverprovisioningFactor limits the total size of the thin volumes to the size of the thin pool multiplied by it
+	OverprovisioningFactor float64 `json:"overprovisioningFactor,omitempty"`
+	// MinFreePercent is the free space the thin pools must have for the storage class to be valid, in percent of
+	// the thin pool size
+	MinFreePercent int `json:"minFreePercent,omitempty"`
+}
+
 type LocalStorageClassLVMThickSpec struct {
 	Contiguous bool `json:"contiguous"`
 }
@@ -42,6 +42,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&LocalStorageClass{},
 		&LocalStorageClassList{},
+		&LocalOrphanedVolume{},
+		&LocalOrphanedVolumeList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
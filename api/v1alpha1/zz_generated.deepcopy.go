@@ -16,13 +16,148 @@ limitations under the License.
 
 package v1alpha1
 
-import "k8s.io/apimachinery/pkg/runtime"
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LocalStorageClass) DeepCopyInto(out *LocalStorageClass) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		*out = new(LocalStorageClassStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalStorageClassSpec) DeepCopyInto(out *LocalStorageClassSpec) {
+	*out = *in
+	if in.LVM != nil {
+		in, out := &in.LVM, &out.LVM
+		*out = new(LocalStorageClassLVMSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IsDefault != nil {
+		in, out := &in.IsDefault, &out.IsDefault
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(LocalStorageClassQuotaSpec)
+		**out = **in
+	}
+	if in.RawDevice != nil {
+		in, out := &in.RawDevice, &out.RawDevice
+		*out = new(LocalStorageClassRawDeviceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Snapshots != nil {
+		in, out := &in.Snapshots, &out.Snapshots
+		*out = new(LocalStorageClassSnapshotsSpec)
+		**out = **in
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(LocalStorageClassAllowedNamespacesSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalStorageClassAllowedNamespacesSpec) DeepCopyInto(out *LocalStorageClassAllowedNamespacesSpec) {
+	*out = *in
+	if in.Names != nil {
+		in, out := &in.Names, &out.Names
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalStorageClassRawDeviceSpec) DeepCopyInto(out *LocalStorageClassRawDeviceSpec) {
+	*out = *in
+	if in.BlockDeviceSelector != nil {
+		in, out := &in.BlockDeviceSelector, &out.BlockDeviceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalStorageClassLVMSpec) DeepCopyInto(out *LocalStorageClassLVMSpec) {
+	*out = *in
+	if in.Thick != nil {
+		in, out := &in.Thick, &out.Thick
+		*out = new(LocalStorageClassLVMThickSpec)
+		**out = **in
+	}
+	if in.LVMVolumeGroups != nil {
+		in, out := &in.LVMVolumeGroups, &out.LVMVolumeGroups
+		*out = make([]LocalStorageClassLVG, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LVMVolumeGroupSelector != nil {
+		in, out := &in.LVMVolumeGroupSelector, &out.LVMVolumeGroupSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Thin != nil {
+		in, out := &in.Thin, &out.Thin
+		*out = new(LocalStorageClassLVMThinSpec)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalStorageClassLVG) DeepCopyInto(out *LocalStorageClassLVG) {
+	*out = *in
+	if in.Thin != nil {
+		in, out := &in.Thin, &out.Thin
+		*out = new(LocalStorageClassLVMThinPoolSpec)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalStorageClassStatus) DeepCopyInto(out *LocalStorageClassStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalStorageClassStatus.
+func (in *LocalStorageClassStatus) DeepCopy() *LocalStorageClassStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalStorageClassStatus)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmptyBlockDevice.
@@ -74,3 +209,60 @@ func (in *LocalStorageClassList) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalOrphanedVolume) DeepCopyInto(out *LocalOrphanedVolume) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalOrphanedVolume.
+func (in *LocalOrphanedVolume) DeepCopy() *LocalOrphanedVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalOrphanedVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LocalOrphanedVolume) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalOrphanedVolumeList) DeepCopyInto(out *LocalOrphanedVolumeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LocalOrphanedVolume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalOrphanedVolumeList.
+func (in *LocalOrphanedVolumeList) DeepCopy() *LocalOrphanedVolumeList {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalOrphanedVolumeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LocalOrphanedVolumeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
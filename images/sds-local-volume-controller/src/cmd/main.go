@@ -67,6 +67,11 @@ func main() {
 	log.Info("[main] CfgParams has been successfully created")
 	log.Info(fmt.Sprintf("[main] %s = %s", config.LogLevel, cfgParams.Loglevel))
 	log.Info(fmt.Sprintf("[main] %s = %d", config.RequeueInterval, cfgParams.RequeueStorageClassInterval))
+	log.Info(fmt.Sprintf("[main] %s = %d", config.RequeueMaxInterval, cfgParams.RequeueStorageClassMaxInterval))
+	log.Info(fmt.Sprintf("[main] %s = %d", config.MaxConcurrentReconciles, cfgParams.MaxConcurrentReconciles))
+	log.Info(fmt.Sprintf("[main] %s = %d", config.RateLimiterQPS, cfgParams.RateLimiterQPS))
+	log.Info(fmt.Sprintf("[main] %s = %d", config.RateLimiterBurst, cfgParams.RateLimiterBurst))
+	log.Info(fmt.Sprintf("[main] %s = %d", config.OrphanedSCCleanupInterval, cfgParams.OrphanedStorageClassCleanupInterval))
 
 	kConfig, err := kubutils.KubernetesDefaultConfigCreate()
 	if err != nil {
@@ -112,11 +117,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = controller.RunOrphanedStorageClassCollector(mgr, *cfgParams, *log); err != nil {
+		log.Error(err, fmt.Sprintf("[main] unable to run %s", controller.OrphanedStorageClassCollectorName))
+		os.Exit(1)
+	}
+
 	if _, err = controller.RunLocalCSINodeWatcherController(mgr, *cfgParams, *log); err != nil {
 		log.Error(err, fmt.Sprintf("[main] unable to run %s", controller.LocalCSINodeWatcherCtrl))
 		os.Exit(1)
 	}
 
+	if _, err = controller.RunStaticVolumeWatcherController(mgr, *cfgParams, *log); err != nil {
+		log.Error(err, fmt.Sprintf("[main] unable to run %s", controller.StaticVolumeWatcherCtrlName))
+		os.Exit(1)
+	}
+
 	if err = mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		log.Error(err, "[main] unable to mgr.AddHealthzCheck")
 		os.Exit(1)
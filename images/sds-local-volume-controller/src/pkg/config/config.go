@@ -16,6 +16,7 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"sds-local-volume-controller/pkg/logger"
@@ -24,6 +25,11 @@ import (
 const (
 	LogLevel                             = "LOG_LEVEL"
 	RequeueInterval                      = "REQUEUE_INTERVAL"
+	RequeueMaxInterval                   = "REQUEUE_MAX_INTERVAL"
+	MaxConcurrentReconciles              = "MAX_CONCURRENT_RECONCILES"
+	RateLimiterQPS                       = "RATE_LIMITER_QPS"
+	RateLimiterBurst                     = "RATE_LIMITER_BURST"
+	OrphanedSCCleanupInterval            = "ORPHANED_STORAGE_CLASS_CLEANUP_INTERVAL"
 	ConfigSecretName                     = "d8-sds-local-volume-controller-config"
 	ControllerNamespaceEnv               = "CONTROLLER_NAMESPACE"
 	HardcodedControllerNS                = "d8-sds-local-volume"
@@ -39,6 +45,15 @@ type Options struct {
 	ConfigSecretName            string
 	ControllerNamespace         string
 	HealthProbeBindAddress      string
+	// RequeueStorageClassMaxInterval limits the backoff of the failed LocalStorageClasses requeue
+	RequeueStorageClassMaxInterval time.Duration
+	// MaxConcurrentReconciles is the number of the LocalStorageClasses reconciled in parallel
+	MaxConcurrentReconciles int
+	// RateLimiterQPS and RateLimiterBurst limit the overall rate of the LocalStorageClasses reconciliation
+	RateLimiterQPS   int
+	RateLimiterBurst int
+	// OrphanedStorageClassCleanupInterval is the period of the sweep of the storage classes without LocalStorageClasses
+	OrphanedStorageClassCleanupInterval time.Duration
 }
 
 func NewConfig() *Options {
@@ -69,13 +84,35 @@ func NewConfig() *Options {
 		}
 	}
 
-	opts.RequeueStorageClassInterval = 10
+	opts.RequeueStorageClassInterval = time.Duration(getPositiveIntEnv(RequeueInterval, 10))
+	opts.RequeueStorageClassMaxInterval = time.Duration(getPositiveIntEnv(RequeueMaxInterval, 300))
+	opts.MaxConcurrentReconciles = getPositiveIntEnv(MaxConcurrentReconciles, 1)
+	opts.RateLimiterQPS = getPositiveIntEnv(RateLimiterQPS, 10)
+	opts.RateLimiterBurst = getPositiveIntEnv(RateLimiterBurst, 100)
+	opts.OrphanedStorageClassCleanupInterval = time.Duration(getPositiveIntEnv(OrphanedSCCleanupInterval, 600))
 	opts.RequeueSecretInterval = 10
 	opts.ConfigSecretName = ConfigSecretName
 
 	return &opts
 }
 
+// getPositiveIntEnv returns the positive integer value of the environment variable or the default one
+// if the variable is not set or invalid.
+func getPositiveIntEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Invalid value %q of %s, using the default one: %d", value, name, defaultValue)
+		return defaultValue
+	}
+
+	return parsed
+}
+
 type SdsLocalVolumeConfig struct {
 	NodeSelector map[string]string `yaml:"nodeSelector"`
 }
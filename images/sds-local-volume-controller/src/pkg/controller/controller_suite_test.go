@@ -26,12 +26,17 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	sv1 "k8s.io/api/storage/v1"
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sds-local-volume-controller/pkg/controller"
 )
 
 func TestController(t *testing.T) {
@@ -57,7 +62,14 @@ func NewFakeClient() client.Client {
 		}
 	}
 
-	builder := fake.NewClientBuilder().WithScheme(scheme)
+	// the VolumeSnapshotClasses are handled as the unstructured objects by the controller
+	volumeSnapshotClassGV := schema.GroupVersion{Group: controller.VolumeSnapshotClassGroup, Version: "v1"}
+	scheme.AddKnownTypeWithName(volumeSnapshotClassGV.WithKind(controller.VolumeSnapshotClassKind), &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(volumeSnapshotClassGV.WithKind(controller.VolumeSnapshotClassKind+"List"), &unstructured.UnstructuredList{})
+
+	builder := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&slv.LocalStorageClass{}).
+		WithIndex(&sv1.StorageClass{}, controller.StorageClassIsDefaultIndexKey, controller.IndexStorageClassIsDefault).
+		WithIndex(&corev1.PersistentVolume{}, controller.PVStorageClassIndexKey, controller.IndexPVStorageClass)
 	cl := builder.Build()
 	return cl
 }
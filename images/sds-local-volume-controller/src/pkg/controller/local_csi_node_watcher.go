@@ -346,9 +346,15 @@ func clearManualEvictionLabelsIfNeeded(ctx context.Context, cl client.Client, lo
 			continue
 		}
 
+		lscLVGs, err := getLSCLVMVolumeGroups(lvgList, &lsc)
+		if err != nil {
+			log.Error(err, fmt.Sprintf("[clearManualEvictionLabelsIfNeeded] unable to get the LVMVolumeGroups of the LocalStorageClass %s", lsc.Name))
+			continue
+		}
+
 		healthy := true
 		badLVGs := strings.Builder{}
-		for _, lvg := range lsc.Spec.LVM.LVMVolumeGroups {
+		for _, lvg := range lscLVGs {
 			kubeLvg := lvgs[lvg.Name]
 
 			if _, exist := kubeLvg.Labels[candidateManualEvictionLabel]; exist {
@@ -400,7 +406,12 @@ func getManuallyEvictedLVGsAndLSCs(ctx context.Context, cl client.Client, node v
 
 	// This case is a base case, when the controller did not label any resource.
 	for _, lsc := range lscList.Items {
-		for _, lvg := range lsc.Spec.LVM.LVMVolumeGroups {
+		lscLVGs, err := getLSCLVMVolumeGroups(lvgList, &lsc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, lvg := range lscLVGs {
 			if _, match := usedLvgs[lvg.Name]; match {
 				unhealthyLvgs[lvg.Name] = usedLvgs[lvg.Name]
 				unhealthyLscs[lsc.Name] = lsc
@@ -24,8 +24,13 @@ import (
 	"time"
 
 	slv "github.com/deckhouse/sds-local-volume/api/v1alpha1"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/storage/v1"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -47,31 +52,92 @@ const (
 	LVMThickType = "Thick"
 
 	LocalStorageClassLvmType = "lvm"
+	LocalStorageClassRawType = "raw"
 
 	StorageClassKind       = "StorageClass"
 	StorageClassAPIVersion = "storage.k8s.io/v1"
 
+	LocalStorageClassKind    = "LocalStorageClass"
+	VolumeSnapshotClassKind  = "VolumeSnapshotClass"
+	VolumeSnapshotClassGroup = "snapshot.storage.k8s.io"
+
 	LocalStorageClassProvisioner = "local.csi.storage.deckhouse.io"
 	TypeParamKey                 = LocalStorageClassProvisioner + "/type"
 	LVMTypeParamKey              = LocalStorageClassProvisioner + "/lvm-type"
 	LVMVolumeBindingModeParamKey = LocalStorageClassProvisioner + "/volume-binding-mode"
 	LVMVolumeGroupsParamKey      = LocalStorageClassProvisioner + "/lvm-volume-groups"
 	LVMVThickContiguousParamKey  = LocalStorageClassProvisioner + "/lvm-thick-contiguous"
+	LVMThinOverprovisionParamKey = LocalStorageClassProvisioner + "/lvm-thin-overprovisioning-factor"
+	QuotaMaxTotalSizeParamKey    = LocalStorageClassProvisioner + "/quota-max-total-size"
+	RawDeviceSelectorParamKey    = LocalStorageClassProvisioner + "/raw-device-selector"
+	RawDeviceMinSizeParamKey     = LocalStorageClassProvisioner + "/raw-device-min-size"
+	RawDeviceMaxSizeParamKey     = LocalStorageClassProvisioner + "/raw-device-max-size"
+	SnapshotSizePercentParamKey  = LocalStorageClassProvisioner + "/snapshot-size-percent"
+	SnapshotFSFreezeParamKey     = LocalStorageClassProvisioner + "/snapshot-fsfreeze"
+	AllowedNamespacesParamKey    = LocalStorageClassProvisioner + "/allowed-namespaces"
+	AllowedNSSelectorParamKey    = LocalStorageClassProvisioner + "/allowed-namespaces-selector"
 
 	FSTypeParamKey = "csi.storage.k8s.io/fstype"
 	DefaultFSType  = "ext4"
 
+	DefaultReclaimPolicy     = "Delete"
+	DefaultVolumeBindingMode = "WaitForFirstConsumer"
+	DefaultDeletionPolicy    = "Delete"
+
 	LocalStorageClassFinalizerName    = "storage.deckhouse.io/local-storage-class-controller"
 	LocalStorageClassFinalizerNameOld = "localstorageclass.storage.deckhouse.io"
 
 	StorageClassDefaultAnnotationKey     = "storageclass.kubernetes.io/is-default-class"
 	StorageClassDefaultAnnotationValTrue = "true"
 
+	// DryRunAnnotationKey makes the controller only render the storage class of the LocalStorageClass to its status
+	DryRunAnnotationKey = "storage.deckhouse.io/dry-run"
+
+	// StorageClassIsDefaultIndexKey is the cache index of the storage classes by their default annotation
+	StorageClassIsDefaultIndexKey = "storageClassIsDefault"
+	// PVStorageClassIndexKey is the cache index of the PersistentVolumes by their storage class
+	PVStorageClassIndexKey = "spec.storageClassName"
+
 	AllowVolumeExpansionDefaultValue = true
 
 	FailedStatusPhase  = "Failed"
 	CreatedStatusPhase = "Created"
 
+	ReadyConditionType               = "Ready"
+	ValidatedConditionType           = "Validated"
+	StorageClassCreatedConditionType = "StorageClassCreated"
+	DegradedConditionType            = "Degraded"
+
+	ReconcileSucceededReason     = "ReconcileSucceeded"
+	ReconcileFailedReason        = "ReconcileFailed"
+	ValidationPassedReason       = "ValidationPassed"
+	ValidationFailedReason       = "ValidationFailed"
+	StorageClassSyncedReason     = "StorageClassSynced"
+	StorageClassSyncFailedReason = "StorageClassSyncFailed"
+	StorageClassMissingReason    = "StorageClassMissing"
+
+	// the reasons of the Ready condition of the LocalStorageClass failed the validation: the spec must be fixed or
+	// the resources it refers to are awaited
+	SpecInvalidReason          = "SpecInvalid"
+	DependenciesNotReadyReason = "DependenciesNotReady"
+
+	// the reasons of the Validated condition of the LocalStorageClass failed the validation, the retriable ones
+	LVMVolumeGroupNotFoundReason      = "LVMVolumeGroupNotFound"
+	NoLVMVolumeGroupsSelectedReason   = "NoLVMVolumeGroupsSelected"
+	ThinPoolNotFoundReason            = "ThinPoolNotFound"
+	ThinPoolNotReadyReason            = "ThinPoolNotReady"
+	ThinPoolLowFreeSpaceReason        = "ThinPoolLowFreeSpace"
+	StorageClassConflictReason        = "StorageClassConflict"
+	DefaultStorageClassConflictReason = "DefaultStorageClassConflict"
+	LVMVolumeGroupNotOnNodesReason    = "LVMVolumeGroupNotOnSelectedNodes"
+	NoNodesSelectedReason             = "NoNodesSelected"
+	LVMVolumeGroupsWithoutNodesReason = "LVMVolumeGroupsWithoutNodes"
+	// and the terminal ones
+	InvalidParameterReason          = "InvalidParameter"
+	ThinPoolNotSpecifiedReason      = "ThinPoolNotSpecified"
+	ThinPoolOnThickClassReason      = "ThinPoolOnThickClass"
+	LVMVolumeGroupsOnSameNodeReason = "LVMVolumeGroupsOnSameNode"
+
 	CreateReconcile reconcileType = "Create"
 	UpdateReconcile reconcileType = "Update"
 	DeleteReconcile reconcileType = "Delete"
@@ -88,9 +154,34 @@ func RunLocalStorageClassWatcherController(
 ) (controller.Controller, error) {
 	cl := mgr.GetClient()
 
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1.StorageClass{}, StorageClassIsDefaultIndexKey, IndexStorageClassIsDefault)
+	if err != nil {
+		log.Error(err, "[RunLocalStorageClassWatcherController] unable to index the storage classes")
+		return nil, err
+	}
+
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.PersistentVolume{}, PVStorageClassIndexKey, IndexPVStorageClass)
+	if err != nil {
+		log.Error(err, "[RunLocalStorageClassWatcherController] unable to index the PersistentVolumes")
+		return nil, err
+	}
+
 	c, err := controller.New(LocalStorageClassCtrlName, mgr, controller.Options{
+		// the failed LocalStorageClass is requeued with the exponential backoff until it is reconciled successfully,
+		// so it recovers from the transient failures without an edit and does not load the apiserver meanwhile
+		// the overall rate limit keeps the requeue of many LocalStorageClasses at once from flooding the apiserver
+		RateLimiter: workqueue.NewTypedMaxOfRateLimiter(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](
+				cfg.RequeueStorageClassInterval*time.Second,
+				cfg.RequeueStorageClassMaxInterval*time.Second,
+			),
+			&workqueue.TypedBucketRateLimiter[reconcile.Request]{
+				Limiter: rate.NewLimiter(rate.Limit(cfg.RateLimiterQPS), cfg.RateLimiterBurst),
+			},
+		),
+		MaxConcurrentReconciles: cfg.MaxConcurrentReconciles,
 		Reconciler: reconcile.Func(func(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
-			log.Info("[LocalStorageClassReconciler] starts Reconcile for the LocalStorageClass %q", request.Name)
+			log.Info(fmt.Sprintf("[LocalStorageClassReconciler] starts Reconcile for the LocalStorageClass %q", request.Name))
 			lsc := &slv.LocalStorageClass{}
 			err := cl.Get(ctx, request.NamespacedName, lsc)
 			if err != nil && !errors2.IsNotFound(err) {
@@ -103,10 +194,9 @@ func RunLocalStorageClassWatcherController(
 				return reconcile.Result{}, nil
 			}
 
-			scList := &v1.StorageClassList{}
-			err = cl.List(ctx, scList)
+			scList, err := GetLSCStorageClasses(ctx, cl, lsc)
 			if err != nil {
-				log.Error(err, "[LocalStorageClassReconciler] unable to list Storage Classes")
+				log.Error(err, "[LocalStorageClassReconciler] unable to get Storage Classes")
 				return reconcile.Result{}, err
 			}
 
@@ -116,13 +206,11 @@ func RunLocalStorageClassWatcherController(
 			}
 
 			if shouldRequeue {
-				log.Warning(fmt.Sprintf("[LocalStorageClassReconciler] Reconciler will requeue the request, name: %s", request.Name))
-				return reconcile.Result{
-					RequeueAfter: cfg.RequeueStorageClassInterval * time.Second,
-				}, nil
+				log.Warning(fmt.Sprintf("[LocalStorageClassReconciler] Reconciler will requeue the request with backoff, name: %s", request.Name))
+				return reconcile.Result{Requeue: true}, nil
 			}
 
-			log.Info("[LocalStorageClassReconciler] ends Reconcile for the LocalStorageClass %q", request.Name)
+			log.Info(fmt.Sprintf("[LocalStorageClassReconciler] ends Reconcile for the LocalStorageClass %q", request.Name))
 			return reconcile.Result{}, nil
 		}),
 	})
@@ -143,7 +231,7 @@ func RunLocalStorageClassWatcherController(
 			oldLsc := e.ObjectOld
 			newLsc := e.ObjectNew
 
-			if reflect.DeepEqual(oldLsc.Spec, newLsc.Spec) && newLsc.DeletionTimestamp == nil {
+			if reflect.DeepEqual(oldLsc.Spec, newLsc.Spec) && isDryRun(oldLsc) == isDryRun(newLsc) && newLsc.DeletionTimestamp == nil {
 				log.Info(fmt.Sprintf("[UpdateFunc] an update event for the LocalStorageClass %s has no Spec field updates. It will not be reconciled", newLsc.Name))
 				return
 			}
@@ -160,12 +248,308 @@ func RunLocalStorageClassWatcherController(
 		return nil, err
 	}
 
+	// the allowed topologies of the storage classes follow the nodes of their LVMVolumeGroups, the selected
+	// LVMVolumeGroups follow their labels, and the Failed LocalStorageClasses are validated again once the LVMVolumeGroups
+	// or the thin pools they refer to appear
+	err = c.Watch(source.Kind(mgr.GetCache(), &snc.LVMVolumeGroup{}, handler.TypedFuncs[*snc.LVMVolumeGroup, reconcile.Request]{
+		CreateFunc: func(ctx context.Context, e event.TypedCreateEvent[*snc.LVMVolumeGroup], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueLSCsForLVG(ctx, cl, log, q, e.Object)
+		},
+		UpdateFunc: func(ctx context.Context, e event.TypedUpdateEvent[*snc.LVMVolumeGroup], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			if reflect.DeepEqual(getLVGNodeNames(e.ObjectOld), getLVGNodeNames(e.ObjectNew)) &&
+				reflect.DeepEqual(getLVGThinPoolNames(e.ObjectOld), getLVGThinPoolNames(e.ObjectNew)) &&
+				reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) {
+				return
+			}
+
+			log.Info(fmt.Sprintf("[UpdateFunc] the nodes, the thin pools or the labels of the LVMVolumeGroup %q have changed", e.ObjectNew.GetName()))
+			// the LocalStorageClasses the LVMVolumeGroup is no longer selected by are reconciled as well
+			enqueueLSCsForLVG(ctx, cl, log, q, e.ObjectOld, e.ObjectNew)
+		},
+		DeleteFunc: func(ctx context.Context, e event.TypedDeleteEvent[*snc.LVMVolumeGroup], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueLSCsForLVG(ctx, cl, log, q, e.Object)
+		},
+	},
+	),
+	)
+	if err != nil {
+		log.Error(err, "[RunLocalStorageClassWatcherController] unable to watch the LVMVolumeGroup events")
+		return nil, err
+	}
+
+	// the allowed topologies of the storage classes restricted by the node selector follow the labels of the nodes
+	err = c.Watch(source.Kind(mgr.GetCache(), &corev1.Node{}, handler.TypedFuncs[*corev1.Node, reconcile.Request]{
+		CreateFunc: func(ctx context.Context, e event.TypedCreateEvent[*corev1.Node], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueLSCsForNode(ctx, cl, log, q, e.Object)
+		},
+		UpdateFunc: func(ctx context.Context, e event.TypedUpdateEvent[*corev1.Node], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			if reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) {
+				return
+			}
+			// the LocalStorageClasses the node is no longer selected by are reconciled as well
+			enqueueLSCsForNode(ctx, cl, log, q, e.ObjectOld, e.ObjectNew)
+		},
+		DeleteFunc: func(ctx context.Context, e event.TypedDeleteEvent[*corev1.Node], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueLSCsForNode(ctx, cl, log, q, e.Object)
+		},
+	},
+	),
+	)
+	if err != nil {
+		log.Error(err, "[RunLocalStorageClassWatcherController] unable to watch the Node events")
+		return nil, err
+	}
+
+	// the provisioned size in the status of the LocalStorageClasses follows their PersistentVolumes
+	err = c.Watch(source.Kind(mgr.GetCache(), &corev1.PersistentVolume{}, handler.TypedFuncs[*corev1.PersistentVolume, reconcile.Request]{
+		CreateFunc: func(_ context.Context, e event.TypedCreateEvent[*corev1.PersistentVolume], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueLSCForPV(q, e.Object)
+		},
+		UpdateFunc: func(_ context.Context, e event.TypedUpdateEvent[*corev1.PersistentVolume], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			if e.ObjectOld.Spec.Capacity.Storage().Equal(*e.ObjectNew.Spec.Capacity.Storage()) {
+				return
+			}
+			enqueueLSCForPV(q, e.ObjectNew)
+		},
+		DeleteFunc: func(_ context.Context, e event.TypedDeleteEvent[*corev1.PersistentVolume], q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueLSCForPV(q, e.Object)
+		},
+	},
+	),
+	)
+	if err != nil {
+		log.Error(err, "[RunLocalStorageClassWatcherController] unable to watch the PersistentVolume events")
+		return nil, err
+	}
+
 	return c, nil
 }
 
+// enqueueLSCForPV adds the LocalStorageClass of the storage class the PersistentVolume is provisioned from to the queue.
+func enqueueLSCForPV(q workqueue.TypedRateLimitingInterface[reconcile.Request], pv *corev1.PersistentVolume) {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != LocalStorageClassProvisioner || pv.Spec.StorageClassName == "" {
+		return
+	}
+
+	q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: pv.Spec.StorageClassName}})
+}
+
+// IndexStorageClassIsDefault indexes the storage class by its default annotation.
+func IndexStorageClassIsDefault(obj client.Object) []string {
+	if obj.GetAnnotations()[StorageClassDefaultAnnotationKey] != StorageClassDefaultAnnotationValTrue {
+		return nil
+	}
+
+	return []string{StorageClassDefaultAnnotationValTrue}
+}
+
+// IndexPVStorageClass indexes the PersistentVolume by its storage class.
+func IndexPVStorageClass(obj client.Object) []string {
+	pv, ok := obj.(*corev1.PersistentVolume)
+	if !ok || pv.Spec.StorageClassName == "" {
+		return nil
+	}
+
+	return []string{pv.Spec.StorageClassName}
+}
+
+// GetLSCStorageClasses returns the storage classes the reconciliation of the LocalStorageClass depends on: the one
+// with its name and the default ones. They are fetched from the cache by the name and the index, so the reconciliation
+// does not scan every storage class of the cluster.
+func GetLSCStorageClasses(ctx context.Context, cl client.Client, lsc *slv.LocalStorageClass) (*v1.StorageClassList, error) {
+	scList := &v1.StorageClassList{}
+	err := cl.List(ctx, scList, client.MatchingFields{StorageClassIsDefaultIndexKey: StorageClassDefaultAnnotationValTrue})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sc := range scList.Items {
+		if sc.Name == lsc.Name {
+			return scList, nil
+		}
+	}
+
+	sc := &v1.StorageClass{}
+	err = cl.Get(ctx, client.ObjectKey{Name: lsc.Name}, sc)
+	if err != nil {
+		if errors2.IsNotFound(err) {
+			return scList, nil
+		}
+		return nil, err
+	}
+	scList.Items = append(scList.Items, *sc)
+
+	return scList, nil
+}
+
+// enqueueLSCsForNode adds the LocalStorageClasses with the node selector matching any of the nodes to the queue.
+func enqueueLSCsForNode(ctx context.Context, cl client.Client, log logger.Logger, q workqueue.TypedRateLimitingInterface[reconcile.Request], nodes ...*corev1.Node) {
+	lscList := &slv.LocalStorageClassList{}
+	err := cl.List(ctx, lscList)
+	if err != nil {
+		log.Error(err, fmt.Sprintf("[enqueueLSCsForNode] unable to list the LocalStorageClasses for the node %s", nodes[0].Name))
+		return
+	}
+
+	for _, lsc := range lscList.Items {
+		if len(lsc.Spec.NodeSelector) == 0 {
+			continue
+		}
+
+		for _, node := range nodes {
+			if labels.SelectorFromSet(lsc.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+				log.Info(fmt.Sprintf("[enqueueLSCsForNode] the LocalStorageClass %s selects the node %s. Add to the queue", lsc.Name, node.Name))
+				q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: lsc.Name}})
+				break
+			}
+		}
+	}
+}
+
+// enqueueLSCsForLVG adds the LocalStorageClasses referring to or selecting any of the LVMVolumeGroups to the queue.
+func enqueueLSCsForLVG(ctx context.Context, cl client.Client, log logger.Logger, q workqueue.TypedRateLimitingInterface[reconcile.Request], lvgs ...*snc.LVMVolumeGroup) {
+	lscList := &slv.LocalStorageClassList{}
+	err := cl.List(ctx, lscList)
+	if err != nil {
+		log.Error(err, fmt.Sprintf("[enqueueLSCsForLVG] unable to list the LocalStorageClasses for the LVMVolumeGroup %s", lvgs[0].Name))
+		return
+	}
+
+	for _, lsc := range lscList.Items {
+		for _, lvg := range lvgs {
+			if lscUsesLVG(&lsc, lvg) {
+				log.Info(fmt.Sprintf("[enqueueLSCsForLVG] the LocalStorageClass %q refers to the LVMVolumeGroup %q. Add to the queue", lsc.Name, lvg.Name))
+				q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: lsc.Namespace, Name: lsc.Name}})
+				break
+			}
+		}
+	}
+}
+
+// lscUsesLVG reports if the LocalStorageClass lists the LVMVolumeGroup or selects it by its labels.
+func lscUsesLVG(lsc *slv.LocalStorageClass, lvg *snc.LVMVolumeGroup) bool {
+	if lsc.Spec.LVM == nil {
+		return false
+	}
+
+	if lsc.Spec.LVM.LVMVolumeGroupSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(lsc.Spec.LVM.LVMVolumeGroupSelector)
+		if err != nil {
+			// the invalid selector is reported by the reconciliation of the LocalStorageClass
+			return false
+		}
+		return selector.Matches(labels.Set(lvg.Labels))
+	}
+
+	for _, lscLVG := range lsc.Spec.LVM.LVMVolumeGroups {
+		if lscLVG.Name == lvg.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getLVGNodeNames(lvg *snc.LVMVolumeGroup) []string {
+	nodes := make([]string, 0, len(lvg.Status.Nodes))
+	for _, node := range lvg.Status.Nodes {
+		nodes = append(nodes, node.Name)
+	}
+
+	return nodes
+}
+
+func getLVGThinPoolNames(lvg *snc.LVMVolumeGroup) []string {
+	thinPools := make([]string, 0, len(lvg.Status.ThinPools))
+	for _, tp := range lvg.Status.ThinPools {
+		thinPools = append(thinPools, tp.Name)
+	}
+
+	return thinPools
+}
+
 func RunEventReconcile(ctx context.Context, cl client.Client, log logger.Logger, scList *v1.StorageClassList, lsc *slv.LocalStorageClass) (bool, error) {
-	recType, err := identifyReconcileFunc(scList, lsc)
+	setLSCDefaults(lsc)
+
+	if lsc.DeletionTimestamp == nil {
+		err := updateLSCProvisionedSize(ctx, cl, lsc)
+		if err != nil {
+			err = fmt.Errorf("[runEventReconcile] unable to update the provisioned size of the LocalStorageClass %s: %w", lsc.Name, err)
+			upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
+			if upError != nil {
+				upError = fmt.Errorf("[runEventReconcile] unable to update the LocalStorageClass %s status: %w", lsc.Name, upError)
+				err = errors.Join(err, upError)
+			}
+			return true, err
+		}
+	}
+
+	lvgList := &snc.LVMVolumeGroupList{}
+	err := cl.List(ctx, lvgList)
+	if err != nil {
+		err = fmt.Errorf("[runEventReconcile] unable to list the LVMVolumeGroups: %w", err)
+		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
+		if upError != nil {
+			upError = fmt.Errorf("[runEventReconcile] unable to update the LocalStorageClass %s status: %w", lsc.Name, upError)
+			err = errors.Join(err, upError)
+		}
+		return true, err
+	}
+	lscLVGs, err := getLSCLVMVolumeGroups(lvgList, lsc)
+	if err != nil {
+		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
+		if upError != nil {
+			upError = fmt.Errorf("[runEventReconcile] unable to update the LocalStorageClass %s status: %w", lsc.Name, upError)
+			err = errors.Join(err, upError)
+		}
+		return true, err
+	}
+	nodes := getLSCNodes(lvgList, lscLVGs)
+	if len(lsc.Spec.NodeSelector) != 0 {
+		selectedNodes, err := getLSCSelectedNodes(ctx, cl, lsc)
+		if err != nil {
+			err = fmt.Errorf("[runEventReconcile] unable to get the nodes selected by the LocalStorageClass %s: %w", lsc.Name, err)
+			upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
+			if upError != nil {
+				upError = fmt.Errorf("[runEventReconcile] unable to update the LocalStorageClass %s status: %w", lsc.Name, upError)
+				err = errors.Join(err, upError)
+			}
+			return true, err
+		}
+		nodes = restrictLSCNodes(lsc, nodes, selectedNodes)
+	}
+
+	if lsc.DeletionTimestamp == nil {
+		err = updateLSCRenderedStorageClass(ctx, cl, scList, lsc, lscLVGs, nodes)
+		if err != nil {
+			err = fmt.Errorf("[runEventReconcile] unable to update the rendered storage class of the LocalStorageClass %s: %w", lsc.Name, err)
+			upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
+			if upError != nil {
+				upError = fmt.Errorf("[runEventReconcile] unable to update the LocalStorageClass %s status: %w", lsc.Name, upError)
+				err = errors.Join(err, upError)
+			}
+			return true, err
+		}
+
+		if isDryRun(lsc) {
+			log.Info(fmt.Sprintf("[runEventReconcile] the LocalStorageClass %s has the %s annotation, its storage class is rendered to the status only", lsc.Name, DryRunAnnotationKey))
+			return false, nil
+		}
+	}
+
+	recType, err := identifyReconcileFunc(scList, lsc, lscLVGs, nodes)
 	if err != nil {
+		// the failure is classified as the ones of the validation, so the terminal one is not requeued
+		var failure validationFailure
+		if errors.As(err, &failure) {
+			retriable, _, upError := updateLocalStorageClassValidationFailed(ctx, cl, lsc, []validationFailure{failure})
+			if upError != nil {
+				upError = fmt.Errorf("[runEventReconcile] unable to update the LocalStorageClass %s status: %w", lsc.Name, upError)
+				err = errors.Join(err, upError)
+			}
+			return retriable, err
+		}
+
 		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
 		if upError != nil {
 			upError = fmt.Errorf("[runEventReconcile] unable to update the LocalStorageClass %s status: %w", lsc.Name, upError)
@@ -175,19 +559,29 @@ func RunEventReconcile(ctx context.Context, cl client.Client, log logger.Logger,
 	}
 
 	log.Debug(fmt.Sprintf("[runEventReconcile] reconcile operation: %s", recType))
+	var shouldRequeue bool
 	switch recType {
 	case CreateReconcile:
 		log.Debug(fmt.Sprintf("[runEventReconcile] CreateReconcile starts reconciliataion for the LocalStorageClass, name: %s", lsc.Name))
-		return reconcileLSCCreateFunc(ctx, cl, log, scList, lsc)
+		shouldRequeue, err = reconcileLSCCreateFunc(ctx, cl, log, scList, lsc, lscLVGs, nodes)
 	case UpdateReconcile:
 		log.Debug(fmt.Sprintf("[runEventReconcile] UpdateReconcile starts reconciliataion for the LocalStorageClass, name: %s", lsc.Name))
-		return reconcileLSCUpdateFunc(ctx, cl, log, scList, lsc)
+		shouldRequeue, err = reconcileLSCUpdateFunc(ctx, cl, log, scList, lsc, lscLVGs, nodes)
 	case DeleteReconcile:
 		log.Debug(fmt.Sprintf("[runEventReconcile] DeleteReconcile starts reconciliataion for the LocalStorageClass, name: %s", lsc.Name))
+		// the VolumeSnapshotClass is deleted first, as the LocalStorageClass is gone once its finalizer is removed
+		shouldRequeue, err = reconcileLSCVolumeSnapshotClass(ctx, cl, log, lsc)
+		if shouldRequeue || err != nil {
+			return shouldRequeue, err
+		}
 		return reconcileLSCDeleteFunc(ctx, cl, log, scList, lsc)
 	default:
-		log.Debug(fmt.Sprintf("[runEventReconcile] the LocalStorageClass %s should not be reconciled", lsc.Name))
+		log.Debug(fmt.Sprintf("[runEventReconcile] the storage class of the LocalStorageClass %s should not be reconciled", lsc.Name))
+	}
+	if shouldRequeue || err != nil {
+		return shouldRequeue, err
 	}
 
-	return false, nil
+	// the VolumeSnapshotClass is synced on every reconciliation, as it does not affect the storage class
+	return reconcileLSCVolumeSnapshotClass(ctx, cl, log, lsc)
 }
@@ -18,16 +18,29 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
 	slv "github.com/deckhouse/sds-local-volume/api/v1alpha1"
 	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/storage/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/utils/strings/slices"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/yaml"
 
 	"sds-local-volume-controller/pkg/logger"
@@ -96,20 +109,26 @@ func reconcileLSCUpdateFunc(
 	log logger.Logger,
 	scList *v1.StorageClassList,
 	lsc *slv.LocalStorageClass,
+	lscLVGs []slv.LocalStorageClassLVG,
+	nodes []string,
 ) (bool, error) {
 	log.Debug(fmt.Sprintf("[reconcileLSCUpdateFunc] starts the LocalStorageClass %s validation", lsc.Name))
-	valid, msg := validateLocalStorageClass(ctx, cl, scList, lsc)
-	if !valid {
+	failures := validateLocalStorageClass(ctx, cl, scList, lsc, lscLVGs, nodes)
+	if len(failures) != 0 {
+		retriable, msg, upError := updateLocalStorageClassValidationFailed(ctx, cl, lsc, failures)
 		err := fmt.Errorf("validation failed: %s", msg)
 		log.Error(err, fmt.Sprintf("[reconcileLSCUpdateFunc] Unable to reconcile the LocalStorageClass, name: %s", lsc.Name))
-		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, msg)
 		if upError != nil {
 			log.Error(upError, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to update the LocalStorageClass %s", lsc.Name))
 		}
+		if !retriable {
+			log.Warning(fmt.Sprintf("[reconcileLSCUpdateFunc] the spec of the LocalStorageClass %s is invalid. It will be reconciled again once the spec is changed", lsc.Name))
+		}
 
-		return true, err
+		return retriable, err
 	}
 	log.Debug(fmt.Sprintf("[reconcileLSCUpdateFunc] successfully validated the LocalStorageClass, name: %s", lsc.Name))
+	setLSCCondition(lsc, ValidatedConditionType, metav1.ConditionTrue, ValidationPassedReason, "")
 
 	var oldSC *v1.StorageClass
 	for _, s := range scList.Items {
@@ -120,6 +139,7 @@ func reconcileLSCUpdateFunc(
 	}
 	if oldSC == nil {
 		err := fmt.Errorf("a storage class %s does not exist", lsc.Name)
+		setLSCCondition(lsc, StorageClassCreatedConditionType, metav1.ConditionFalse, StorageClassMissingReason, err.Error())
 		log.Error(err, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to find a storage class for the LocalStorageClass, name: %s", lsc.Name))
 		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
 		if upError != nil {
@@ -132,20 +152,11 @@ func reconcileLSCUpdateFunc(
 
 	log.Trace(fmt.Sprintf("[reconcileLSCUpdateFunc] storage class %s params: %+v", oldSC.Name, oldSC.Parameters))
 	log.Trace(fmt.Sprintf("[reconcileLSCUpdateFunc] LocalStorageClass %s Spec.LVM: %+v", lsc.Name, lsc.Spec.LVM))
-	hasDiff, err := hasLVGDiff(oldSC, lsc)
-	if err != nil {
-		log.Error(err, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to identify the LVMVolumeGroup difference for the LocalStorageClass %s", lsc.Name))
-		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
-		if upError != nil {
-			log.Error(upError, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to update the LocalStorageClass %s", lsc.Name))
-		}
-		return true, err
-	}
-
-	if hasDiff {
-		log.Info(fmt.Sprintf("[reconcileLSCUpdateFunc] current Storage Class LVMVolumeGroups do not match LocalStorageClass ones. The Storage Class %s will be recreated with new ones", lsc.Name))
-		newSC, err := updateStorageClass(lsc, oldSC)
+	if hasStorageClassDiff(oldSC, lsc, lscLVGs, nodes) {
+		log.Info(fmt.Sprintf("[reconcileLSCUpdateFunc] the Storage Class %s does not match the one rendered for the LocalStorageClass. It will be recreated with the new one", lsc.Name))
+		newSC, err := updateStorageClass(lsc, oldSC, lscLVGs, nodes)
 		if err != nil {
+			setLSCCondition(lsc, StorageClassCreatedConditionType, metav1.ConditionFalse, StorageClassSyncFailedReason, err.Error())
 			log.Error(err, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to configure a Storage Class for the LocalStorageClass %s", lsc.Name))
 			upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
 			if upError != nil {
@@ -157,6 +168,7 @@ func reconcileLSCUpdateFunc(
 
 		err = recreateStorageClass(ctx, cl, oldSC, newSC)
 		if err != nil {
+			setLSCCondition(lsc, StorageClassCreatedConditionType, metav1.ConditionFalse, StorageClassSyncFailedReason, err.Error())
 			log.Error(err, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to recreate a Storage Class %s", newSC.Name))
 			upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
 			if upError != nil {
@@ -166,9 +178,35 @@ func reconcileLSCUpdateFunc(
 		}
 
 		log.Info(fmt.Sprintf("[reconcileLSCUpdateFunc] a Storage Class %s was successfully recreated", newSC.Name))
+	} else if hasDefaultDiff(oldSC, lsc) {
+		log.Info(fmt.Sprintf("[reconcileLSCUpdateFunc] the default class annotation of the Storage Class %s does not match the LocalStorageClass isDefault. It will be updated", lsc.Name))
+		err := updateStorageClassDefault(ctx, cl, oldSC, lsc)
+		if err != nil {
+			setLSCCondition(lsc, StorageClassCreatedConditionType, metav1.ConditionFalse, StorageClassSyncFailedReason, err.Error())
+			log.Error(err, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to update the default class annotation of the Storage Class %s", oldSC.Name))
+			upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
+			if upError != nil {
+				log.Error(upError, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to update the LocalStorageClass %s", lsc.Name))
+			}
+			return true, err
+		}
 	}
 
-	err = updateLocalStorageClassPhase(ctx, cl, lsc, CreatedStatusPhase, "")
+	setLSCCondition(lsc, StorageClassCreatedConditionType, metav1.ConditionTrue, StorageClassSyncedReason, "")
+
+	if shouldPropagateReclaimPolicy(lsc) {
+		err := updatePVsReclaimPolicy(ctx, cl, log, lsc)
+		if err != nil {
+			log.Error(err, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to update the reclaim policy of the PersistentVolumes of the LocalStorageClass %s", lsc.Name))
+			upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
+			if upError != nil {
+				log.Error(upError, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to update the LocalStorageClass %s", lsc.Name))
+			}
+			return true, err
+		}
+	}
+
+	err := updateLocalStorageClassPhase(ctx, cl, lsc, CreatedStatusPhase, "")
 	if err != nil {
 		log.Error(err, fmt.Sprintf("[reconcileLSCUpdateFunc] unable to update the LocalStorageClass, name: %s", lsc.Name))
 		return true, err
@@ -178,7 +216,21 @@ func reconcileLSCUpdateFunc(
 	return false, nil
 }
 
-func identifyReconcileFunc(scList *v1.StorageClassList, lsc *slv.LocalStorageClass) (reconcileType, error) {
+// setLSCDefaults sets the defaults of the omitted fields of the LocalStorageClass. They are the same as the CRD ones,
+// so the LocalStorageClass is reconciled the same way if the CRD defaults have not been applied to it.
+func setLSCDefaults(lsc *slv.LocalStorageClass) {
+	if lsc.Spec.ReclaimPolicy == "" {
+		lsc.Spec.ReclaimPolicy = DefaultReclaimPolicy
+	}
+	if lsc.Spec.VolumeBindingMode == "" {
+		lsc.Spec.VolumeBindingMode = DefaultVolumeBindingMode
+	}
+	if lsc.Spec.FSType == "" {
+		lsc.Spec.FSType = DefaultFSType
+	}
+}
+
+func identifyReconcileFunc(scList *v1.StorageClassList, lsc *slv.LocalStorageClass, lscLVGs []slv.LocalStorageClassLVG, nodes []string) (reconcileType, error) {
 	if shouldReconcileByDeleteFunc(lsc) {
 		return DeleteReconcile, nil
 	}
@@ -187,7 +239,7 @@ func identifyReconcileFunc(scList *v1.StorageClassList, lsc *slv.LocalStorageCla
 		return CreateReconcile, nil
 	}
 
-	should, err := shouldReconcileByUpdateFunc(scList, lsc)
+	should, err := shouldReconcileByUpdateFunc(scList, lsc, lscLVGs, nodes)
 	if err != nil {
 		return "none", err
 	}
@@ -202,7 +254,7 @@ func shouldReconcileByDeleteFunc(lsc *slv.LocalStorageClass) bool {
 	return lsc.DeletionTimestamp != nil
 }
 
-func shouldReconcileByUpdateFunc(scList *v1.StorageClassList, lsc *slv.LocalStorageClass) (bool, error) {
+func shouldReconcileByUpdateFunc(scList *v1.StorageClassList, lsc *slv.LocalStorageClass, lscLVGs []slv.LocalStorageClassLVG, nodes []string) (bool, error) {
 	if lsc.DeletionTimestamp != nil {
 		return false, nil
 	}
@@ -210,12 +262,7 @@ func shouldReconcileByUpdateFunc(scList *v1.StorageClassList, lsc *slv.LocalStor
 	for _, sc := range scList.Items {
 		if sc.Name == lsc.Name {
 			if sc.Provisioner == LocalStorageClassProvisioner {
-				diff, err := hasLVGDiff(&sc, lsc)
-				if err != nil {
-					return false, err
-				}
-
-				if diff {
+				if hasStorageClassDiff(&sc, lsc, lscLVGs, nodes) || hasDefaultDiff(&sc, lsc) || shouldPropagateReclaimPolicy(lsc) {
 					return true, nil
 				}
 
@@ -226,8 +273,11 @@ func shouldReconcileByUpdateFunc(scList *v1.StorageClassList, lsc *slv.LocalStor
 				return false, nil
 			}
 
-			err := fmt.Errorf("a storage class %s already exists and does not belong to %s provisioner", sc.Name, LocalStorageClassProvisioner)
-			return false, err
+			return false, validationFailure{
+				reason:    StorageClassConflictReason,
+				message:   fmt.Sprintf("a storage class %s already exists and does not belong to %s provisioner", sc.Name, LocalStorageClassProvisioner),
+				retriable: true,
+			}
 		}
 	}
 
@@ -235,35 +285,545 @@ func shouldReconcileByUpdateFunc(scList *v1.StorageClassList, lsc *slv.LocalStor
 	return false, err
 }
 
-func hasLVGDiff(sc *v1.StorageClass, lsc *slv.LocalStorageClass) (bool, error) {
-	currentLVGs, err := getLVGFromSCParams(sc)
+// hasStorageClassDiff reports if the storage class does not match the one rendered for the LocalStorageClass. Its
+// parameters, reclaim policy, volume binding mode, mount options and allowed topologies are immutable, so the storage
+// class is recreated on any difference of them. The LocalStorageClass the storage class can not be rendered for is
+// reported by its validation.
+func hasStorageClassDiff(sc *v1.StorageClass, lsc *slv.LocalStorageClass, lscLVGs []slv.LocalStorageClassLVG, nodes []string) bool {
+	newSC, err := configureStorageClass(lsc, lscLVGs, nodes)
 	if err != nil {
-		return false, err
+		return true
 	}
 
-	if len(currentLVGs) != len(lsc.Spec.LVM.LVMVolumeGroups) {
-		return true, nil
+	return !maps.Equal(sc.Parameters, newSC.Parameters) ||
+		!reflect.DeepEqual(sc.ReclaimPolicy, newSC.ReclaimPolicy) ||
+		!reflect.DeepEqual(sc.VolumeBindingMode, newSC.VolumeBindingMode) ||
+		!slices.Equal(sc.MountOptions, newSC.MountOptions) ||
+		!slices.Equal(getSCTopologyNodes(sc), getSCTopologyNodes(newSC))
+}
+
+// getOverprovisioningFactorParam returns the storage class parameter of the thin overprovisioning factor of
+// the LocalStorageClass, it is empty if the factor is not set.
+func getOverprovisioningFactorParam(lsc *slv.LocalStorageClass) string {
+	if lsc.Spec.LVM == nil || lsc.Spec.LVM.Type != LVMThinType || lsc.Spec.LVM.Thin == nil || lsc.Spec.LVM.Thin.OverprovisioningFactor == 0 {
+		return ""
 	}
 
-	for i := range currentLVGs {
-		if currentLVGs[i].Name != lsc.Spec.LVM.LVMVolumeGroups[i].Name {
-			return true, nil
+	return strconv.FormatFloat(lsc.Spec.LVM.Thin.OverprovisioningFactor, 'g', -1, 64)
+}
+
+// getQuotaParam returns the storage class parameter of the quota of the LocalStorageClass, it is empty if the quota
+// is not set.
+func getQuotaParam(lsc *slv.LocalStorageClass) string {
+	if lsc.Spec.Quota == nil {
+		return ""
+	}
+
+	return lsc.Spec.Quota.MaxTotalSize
+}
+
+// getRawDeviceParams returns the storage class parameters of the raw device settings of the LocalStorageClass.
+// The BlockDevice selector is passed in the label selector string format, it is omitted if it selects every device.
+func getRawDeviceParams(lsc *slv.LocalStorageClass) (map[string]string, error) {
+	params := make(map[string]string, 3)
+	if lsc.Spec.RawDevice == nil {
+		return params, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(lsc.Spec.RawDevice.BlockDeviceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the BlockDevice selector of the LocalStorageClass %s: %w", lsc.Name, err)
+	}
+	if !selector.Empty() {
+		params[RawDeviceSelectorParamKey] = selector.String()
+	}
+	if lsc.Spec.RawDevice.MinSize != "" {
+		params[RawDeviceMinSizeParamKey] = lsc.Spec.RawDevice.MinSize
+	}
+	if lsc.Spec.RawDevice.MaxSize != "" {
+		params[RawDeviceMaxSizeParamKey] = lsc.Spec.RawDevice.MaxSize
+	}
+
+	return params, nil
+}
+
+// getAllowedNamespacesParams returns the storage class parameters of the allowed namespaces of the LocalStorageClass:
+// the sorted comma-separated names without the blank ones and the selector of the namespaces. They are empty if
+// the namespaces are not limited.
+func getAllowedNamespacesParams(lsc *slv.LocalStorageClass) (map[string]string, error) {
+	params := make(map[string]string, 2)
+	if lsc.Spec.AllowedNamespaces == nil {
+		return params, nil
+	}
+
+	names := make([]string, 0, len(lsc.Spec.AllowedNamespaces.Names))
+	for _, name := range lsc.Spec.AllowedNamespaces.Names {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
 		}
-		if lsc.Spec.LVM.Type == LVMThinType {
-			if currentLVGs[i].Thin == nil && lsc.Spec.LVM.LVMVolumeGroups[i].Thin != nil {
-				return true, nil
+	}
+	if len(names) != 0 {
+		sort.Strings(names)
+		params[AllowedNamespacesParamKey] = strings.Join(names, ",")
+	}
+
+	if lsc.Spec.AllowedNamespaces.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(lsc.Spec.AllowedNamespaces.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the namespace selector of the LocalStorageClass %s: %w", lsc.Name, err)
+		}
+		params[AllowedNSSelectorParamKey] = selector.String()
+	}
+
+	return params, nil
+}
+
+// updateLSCProvisionedSize sets the total capacity of the PersistentVolumes provisioned from the storage class of
+// the LocalStorageClass to its status. The status is patched right away, as the LocalStorageClass is not reconciled
+// any further if only its volumes have changed.
+func updateLSCProvisionedSize(ctx context.Context, cl client.Client, lsc *slv.LocalStorageClass) error {
+	pvList := &corev1.PersistentVolumeList{}
+	err := cl.List(ctx, pvList, client.MatchingFields{PVStorageClassIndexKey: lsc.Name})
+	if err != nil {
+		return fmt.Errorf("unable to list the PersistentVolumes: %w", err)
+	}
+
+	provisionedSize := resource.NewQuantity(0, resource.BinarySI)
+	for _, pv := range pvList.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != LocalStorageClassProvisioner {
+			continue
+		}
+		provisionedSize.Add(*pv.Spec.Capacity.Storage())
+	}
+
+	provisioned := provisionedSize.String()
+	if lsc.Status != nil && lsc.Status.ProvisionedSize == provisioned {
+		return nil
+	}
+
+	return patchWithRetry(ctx, cl, lsc, true, func(obj client.Object) {
+		freshLSC := obj.(*slv.LocalStorageClass)
+		if freshLSC.Status == nil {
+			freshLSC.Status = new(slv.LocalStorageClassStatus)
+		}
+		freshLSC.Status.ProvisionedSize = provisioned
+	})
+}
+
+// isDryRun reports if the storage class of the LocalStorageClass is only rendered to its status.
+func isDryRun(lsc *slv.LocalStorageClass) bool {
+	return lsc.Annotations[DryRunAnnotationKey] == "true"
+}
+
+// renderStorageClass returns the storage class the controller creates for the LocalStorageClass, or the one it recreates
+// the existing storage class with.
+func renderStorageClass(scList *v1.StorageClassList, lsc *slv.LocalStorageClass, lscLVGs []slv.LocalStorageClassLVG, nodes []string) (*v1.StorageClass, error) {
+	for _, sc := range scList.Items {
+		if sc.Name == lsc.Name && sc.Provisioner == LocalStorageClassProvisioner {
+			return updateStorageClass(lsc, &sc, lscLVGs, nodes)
+		}
+	}
+
+	return configureStorageClass(lsc, lscLVGs, nodes)
+}
+
+// updateLSCRenderedStorageClass sets the manifest of the storage class rendered for the current spec of
+// the LocalStorageClass to its status. The manifest is empty if the storage class can not be rendered, the reason
+// is reported once the storage class is created or updated.
+func updateLSCRenderedStorageClass(ctx context.Context, cl client.Client, scList *v1.StorageClassList, lsc *slv.LocalStorageClass, lscLVGs []slv.LocalStorageClassLVG, nodes []string) error {
+	var rendered string
+	sc, err := renderStorageClass(scList, lsc, lscLVGs, nodes)
+	if err == nil {
+		manifest, err := yaml.Marshal(sc)
+		if err != nil {
+			return fmt.Errorf("unable to marshal the storage class: %w", err)
+		}
+		rendered = string(manifest)
+	}
+
+	if lsc.Status != nil && lsc.Status.RenderedStorageClass == rendered {
+		return nil
+	}
+
+	return patchWithRetry(ctx, cl, lsc, true, func(obj client.Object) {
+		freshLSC := obj.(*slv.LocalStorageClass)
+		if freshLSC.Status == nil {
+			freshLSC.Status = new(slv.LocalStorageClassStatus)
+		}
+		freshLSC.Status.RenderedStorageClass = rendered
+	})
+}
+
+// volumeSnapshotClassGVK is the kind of the VolumeSnapshotClass. The VolumeSnapshotClasses are handled as the unstructured
+// objects, as their API is installed by the snapshot-controller module and might be missing in the cluster.
+var volumeSnapshotClassGVK = schema.GroupVersionKind{Group: VolumeSnapshotClassGroup, Version: "v1", Kind: VolumeSnapshotClassKind}
+
+// reconcileLSCVolumeSnapshotClass creates the VolumeSnapshotClass of the LocalStorageClass with the snapshots enabled and
+// keeps it in sync with the snapshot settings. It is deleted once the snapshots are disabled or the LocalStorageClass
+// is being deleted. The VolumeSnapshotClass with the same name not owned by the LocalStorageClass is never changed.
+func reconcileLSCVolumeSnapshotClass(ctx context.Context, cl client.Client, log logger.Logger, lsc *slv.LocalStorageClass) (bool, error) {
+	enabled := lsc.DeletionTimestamp == nil && lsc.Spec.Snapshots != nil && lsc.Spec.Snapshots.Enabled
+
+	vsc := &unstructured.Unstructured{}
+	vsc.SetGroupVersionKind(volumeSnapshotClassGVK)
+	err := cl.Get(ctx, client.ObjectKey{Name: lsc.Name}, vsc)
+	exists := err == nil
+	// there is nothing to delete without the snapshot API
+	if err != nil && !errors2.IsNotFound(err) && (enabled || !meta.IsNoMatchError(err)) {
+		return failLSCVolumeSnapshotClass(ctx, cl, log, lsc, fmt.Errorf("unable to get the VolumeSnapshotClass %s: %w", lsc.Name, err))
+	}
+
+	if !enabled {
+		if !exists || !isVolumeSnapshotClassOwnedBy(vsc, lsc) {
+			return false, nil
+		}
+
+		log.Info(fmt.Sprintf("[reconcileLSCVolumeSnapshotClass] the snapshots of the LocalStorageClass %s are disabled, the VolumeSnapshotClass will be deleted", lsc.Name))
+		err = cl.Delete(ctx, vsc)
+		if err != nil && !errors2.IsNotFound(err) {
+			return failLSCVolumeSnapshotClass(ctx, cl, log, lsc, fmt.Errorf("unable to delete the VolumeSnapshotClass %s: %w", lsc.Name, err))
+		}
+		log.Info(fmt.Sprintf("[reconcileLSCVolumeSnapshotClass] successfully deleted the VolumeSnapshotClass %s", lsc.Name))
+		return false, nil
+	}
+
+	newVSC := configureVolumeSnapshotClass(lsc)
+	if !exists {
+		log.Info(fmt.Sprintf("[reconcileLSCVolumeSnapshotClass] the VolumeSnapshotClass of the LocalStorageClass %s will be created", lsc.Name))
+		err = cl.Create(ctx, newVSC)
+		if err != nil {
+			return failLSCVolumeSnapshotClass(ctx, cl, log, lsc, fmt.Errorf("unable to create the VolumeSnapshotClass %s: %w", lsc.Name, err))
+		}
+		log.Info(fmt.Sprintf("[reconcileLSCVolumeSnapshotClass] successfully created the VolumeSnapshotClass %s", lsc.Name))
+		return false, nil
+	}
+
+	if !isVolumeSnapshotClassOwnedBy(vsc, lsc) {
+		return failLSCVolumeSnapshotClass(ctx, cl, log, lsc, fmt.Errorf("a VolumeSnapshotClass %s already exists and is not managed by the LocalStorageClass controller", lsc.Name))
+	}
+
+	if !hasVolumeSnapshotClassDiff(vsc, newVSC) {
+		return false, nil
+	}
+
+	log.Info(fmt.Sprintf("[reconcileLSCVolumeSnapshotClass] the VolumeSnapshotClass %s does not match the snapshot settings of the LocalStorageClass. It will be updated", lsc.Name))
+	err = patchWithRetry(ctx, cl, vsc, false, func(obj client.Object) {
+		u := obj.(*unstructured.Unstructured)
+		u.Object["deletionPolicy"] = newVSC.Object["deletionPolicy"]
+		if params, ok := newVSC.Object["parameters"]; ok {
+			u.Object["parameters"] = params
+		} else {
+			delete(u.Object, "parameters")
+		}
+		u.SetOwnerReferences(newVSC.GetOwnerReferences())
+	})
+	if err != nil {
+		return failLSCVolumeSnapshotClass(ctx, cl, log, lsc, fmt.Errorf("unable to update the VolumeSnapshotClass %s: %w", lsc.Name, err))
+	}
+	log.Info(fmt.Sprintf("[reconcileLSCVolumeSnapshotClass] successfully updated the VolumeSnapshotClass %s", lsc.Name))
+
+	return false, nil
+}
+
+func failLSCVolumeSnapshotClass(ctx context.Context, cl client.Client, log logger.Logger, lsc *slv.LocalStorageClass, err error) (bool, error) {
+	log.Error(err, fmt.Sprintf("[reconcileLSCVolumeSnapshotClass] unable to reconcile the VolumeSnapshotClass of the LocalStorageClass %s", lsc.Name))
+	upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
+	if upError != nil {
+		upError = fmt.Errorf("[reconcileLSCVolumeSnapshotClass] unable to update the LocalStorageClass %s status: %w", lsc.Name, upError)
+		err = errors.Join(err, upError)
+	}
+
+	return true, err
+}
+
+// configureVolumeSnapshotClass returns the VolumeSnapshotClass of the LocalStorageClass. It is owned by
+// the LocalStorageClass, so it is collected with the LocalStorageClass deleted bypassing the controller as well.
+func configureVolumeSnapshotClass(lsc *slv.LocalStorageClass) *unstructured.Unstructured {
+	deletionPolicy := lsc.Spec.Snapshots.DeletionPolicy
+	if deletionPolicy == "" {
+		deletionPolicy = DefaultDeletionPolicy
+	}
+
+	vsc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"driver":         LocalStorageClassProvisioner,
+		"deletionPolicy": deletionPolicy,
+	}}
+	vsc.SetGroupVersionKind(volumeSnapshotClassGVK)
+	vsc.SetName(lsc.Name)
+	vsc.SetOwnerReferences([]metav1.OwnerReference{
+		{
+			APIVersion: slv.SchemeGroupVersion.String(),
+			Kind:       LocalStorageClassKind,
+			Name:       lsc.Name,
+			UID:        lsc.UID,
+		},
+	})
+
+	params := make(map[string]interface{})
+	if lsc.Spec.Snapshots.SizePercent > 0 {
+		params[SnapshotSizePercentParamKey] = strconv.Itoa(lsc.Spec.Snapshots.SizePercent)
+	}
+	if lsc.Spec.Snapshots.FSFreeze {
+		params[SnapshotFSFreezeParamKey] = "true"
+	}
+	if len(params) != 0 {
+		vsc.Object["parameters"] = params
+	}
+
+	return vsc
+}
+
+// isVolumeSnapshotClassOwnedBy reports if the VolumeSnapshotClass has been created for the LocalStorageClass. The owner
+// is matched by the name, so the VolumeSnapshotClass is adopted by the LocalStorageClass created again with the name.
+func isVolumeSnapshotClassOwnedBy(vsc *unstructured.Unstructured, lsc *slv.LocalStorageClass) bool {
+	for _, owner := range vsc.GetOwnerReferences() {
+		if owner.Kind == LocalStorageClassKind && owner.Name == lsc.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasVolumeSnapshotClassDiff(vsc, newVSC *unstructured.Unstructured) bool {
+	if vsc.Object["deletionPolicy"] != newVSC.Object["deletionPolicy"] {
+		return true
+	}
+
+	params, _, _ := unstructured.NestedStringMap(vsc.Object, "parameters")
+	newParams, _, _ := unstructured.NestedStringMap(newVSC.Object, "parameters")
+	if !maps.Equal(params, newParams) {
+		return true
+	}
+
+	return !reflect.DeepEqual(vsc.GetOwnerReferences(), newVSC.GetOwnerReferences())
+}
+
+// shouldPropagateReclaimPolicy reports if the reclaim policy of the LocalStorageClass with the propagation enabled has
+// not been propagated to its PersistentVolumes yet.
+func shouldPropagateReclaimPolicy(lsc *slv.LocalStorageClass) bool {
+	return lsc.Spec.PropagateReclaimPolicy && (lsc.Status == nil || lsc.Status.AppliedReclaimPolicy != lsc.Spec.ReclaimPolicy)
+}
+
+// updatePVsReclaimPolicy sets the reclaim policy of the LocalStorageClass to the PersistentVolumes already provisioned
+// from its storage class, as the recreated storage class applies the new policy to the new PersistentVolumes only.
+// The released PersistentVolumes are skipped, as the changed policy would delete or keep their volumes right away,
+// and so are the static ones, whose policy is set by the administrator. The applied policy is recorded in the status,
+// so the PersistentVolumes are patched once per change of the policy.
+func updatePVsReclaimPolicy(ctx context.Context, cl client.Client, log logger.Logger, lsc *slv.LocalStorageClass) error {
+	pvList := &corev1.PersistentVolumeList{}
+	err := cl.List(ctx, pvList, client.MatchingFields{PVStorageClassIndexKey: lsc.Name})
+	if err != nil {
+		return fmt.Errorf("unable to list the PersistentVolumes: %w", err)
+	}
+
+	reclaimPolicy := corev1.PersistentVolumeReclaimPolicy(lsc.Spec.ReclaimPolicy)
+	for i := range pvList.Items {
+		pv := &pvList.Items[i]
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != LocalStorageClassProvisioner {
+			continue
+		}
+		if pv.Spec.PersistentVolumeReclaimPolicy == reclaimPolicy || pv.Status.Phase == corev1.VolumeReleased || isStaticPV(pv) {
+			continue
+		}
+
+		patch := client.MergeFrom(pv.DeepCopy())
+		pv.Spec.PersistentVolumeReclaimPolicy = reclaimPolicy
+		err = cl.Patch(ctx, pv, patch)
+		if err != nil {
+			return fmt.Errorf("unable to update the reclaim policy of the PersistentVolume %s: %w", pv.Name, err)
+		}
+		log.Info(fmt.Sprintf("[updatePVsReclaimPolicy] the reclaim policy of the PersistentVolume %s was set to %s", pv.Name, reclaimPolicy))
+	}
+
+	return patchWithRetry(ctx, cl, lsc, true, func(obj client.Object) {
+		freshLSC := obj.(*slv.LocalStorageClass)
+		if freshLSC.Status == nil {
+			freshLSC.Status = new(slv.LocalStorageClassStatus)
+		}
+		freshLSC.Status.AppliedReclaimPolicy = lsc.Spec.ReclaimPolicy
+	})
+}
+
+// hasDefaultDiff reports if the default class annotation of the storage class does not match the isDefault of
+// the LocalStorageClass. The annotation is not managed if isDefault is not set.
+func hasDefaultDiff(sc *v1.StorageClass, lsc *slv.LocalStorageClass) bool {
+	if lsc.Spec.IsDefault == nil {
+		return false
+	}
+
+	return (sc.Annotations[StorageClassDefaultAnnotationKey] == StorageClassDefaultAnnotationValTrue) != *lsc.Spec.IsDefault
+}
+
+// setDefaultAnnotation sets or clears the default class annotation of the storage class by the isDefault of
+// the LocalStorageClass.
+func setDefaultAnnotation(sc *v1.StorageClass, lsc *slv.LocalStorageClass) {
+	if lsc.Spec.IsDefault == nil {
+		return
+	}
+
+	if *lsc.Spec.IsDefault {
+		if sc.Annotations == nil {
+			sc.Annotations = make(map[string]string, 1)
+		}
+		sc.Annotations[StorageClassDefaultAnnotationKey] = StorageClassDefaultAnnotationValTrue
+		return
+	}
+
+	delete(sc.Annotations, StorageClassDefaultAnnotationKey)
+}
+
+// updateStorageClassDefault updates the default class annotation of the storage class in place, as the annotations
+// are mutable unlike the rest of the storage class.
+func updateStorageClassDefault(ctx context.Context, cl client.Client, sc *v1.StorageClass, lsc *slv.LocalStorageClass) error {
+	patch := client.MergeFrom(sc.DeepCopy())
+	setDefaultAnnotation(sc, lsc)
+
+	return cl.Patch(ctx, sc, patch)
+}
+
+// findOtherDefaultSCs returns the names of the default storage classes other than the one of the LocalStorageClass.
+func findOtherDefaultSCs(scList *v1.StorageClassList, lsc *slv.LocalStorageClass) []string {
+	var defaultSCs []string
+	for _, sc := range scList.Items {
+		if sc.Name != lsc.Name && sc.Annotations[StorageClassDefaultAnnotationKey] == StorageClassDefaultAnnotationValTrue {
+			defaultSCs = append(defaultSCs, sc.Name)
+		}
+	}
+
+	return defaultSCs
+}
+
+// getLSCLVMVolumeGroups returns the LVMVolumeGroups of the LocalStorageClass, either the listed ones or the ones
+// matching its selector. The selected LVMVolumeGroups are sorted by name, so the storage class parameter changes only
+// if the selection does, and they all use the thin pool of the LocalStorageClass for the Thin type.
+func getLSCLVMVolumeGroups(lvgList *snc.LVMVolumeGroupList, lsc *slv.LocalStorageClass) ([]slv.LocalStorageClassLVG, error) {
+	if lsc.Spec.LVM == nil {
+		return nil, nil
+	}
+	if lsc.Spec.LVM.LVMVolumeGroupSelector == nil {
+		return lsc.Spec.LVM.LVMVolumeGroups, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(lsc.Spec.LVM.LVMVolumeGroupSelector)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the LVMVolumeGroup selector of the LocalStorageClass %s: %w", lsc.Name, err)
+	}
+
+	lscLVGs := make([]slv.LocalStorageClassLVG, 0, len(lvgList.Items))
+	for _, lvg := range lvgList.Items {
+		if !selector.Matches(labels.Set(lvg.Labels)) {
+			continue
+		}
+
+		lscLVG := slv.LocalStorageClassLVG{Name: lvg.Name}
+		if lsc.Spec.LVM.Type == LVMThinType && lsc.Spec.LVM.Thin != nil {
+			lscLVG.Thin = &slv.LocalStorageClassLVMThinPoolSpec{PoolName: lsc.Spec.LVM.Thin.PoolName}
+		}
+		lscLVGs = append(lscLVGs, lscLVG)
+	}
+	sort.Slice(lscLVGs, func(i, j int) bool {
+		return lscLVGs[i].Name < lscLVGs[j].Name
+	})
+
+	return lscLVGs, nil
+}
+
+// getLSCNodes returns the sorted names of the nodes of the LVMVolumeGroups of the LocalStorageClass.
+func getLSCNodes(lvgList *snc.LVMVolumeGroupList, lscLVGs []slv.LocalStorageClassLVG) []string {
+	usedLVGs := make(map[string]struct{}, len(lscLVGs))
+	for _, lvg := range lscLVGs {
+		usedLVGs[lvg.Name] = struct{}{}
+	}
+
+	nodes := make([]string, 0, len(lscLVGs))
+	for _, lvg := range lvgList.Items {
+		if _, used := usedLVGs[lvg.Name]; !used {
+			continue
+		}
+		for _, node := range lvg.Status.Nodes {
+			if !slices.Contains(nodes, node.Name) {
+				nodes = append(nodes, node.Name)
 			}
-			if currentLVGs[i].Thin == nil && lsc.Spec.LVM.LVMVolumeGroups[i].Thin == nil {
-				err := fmt.Errorf("LocalStorageClass type=%q: unable to identify the Thin pool differences for the LocalStorageClass %q. The current LVMVolumeGroup %q does not have a Thin pool configured in either the StorageClass or the LocalStorageClass", lsc.Spec.LVM.Type, lsc.Name, currentLVGs[i].Name)
-				return false, err
+		}
+	}
+	sort.Strings(nodes)
+
+	return nodes
+}
+
+// getLSCSelectedNodes returns the sorted names of the nodes matching the node selector of the LocalStorageClass.
+func getLSCSelectedNodes(ctx context.Context, cl client.Client, lsc *slv.LocalStorageClass) ([]string, error) {
+	nodeList := &corev1.NodeList{}
+	err := cl.List(ctx, nodeList, client.MatchingLabels(lsc.Spec.NodeSelector))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]string, 0, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		nodes = append(nodes, node.Name)
+	}
+	sort.Strings(nodes)
+
+	return nodes, nil
+}
+
+// restrictLSCNodes returns the nodes the storage class of the LocalStorageClass with the node selector is allowed on:
+// the selected nodes of its LVMVolumeGroups or, for the raw device one, all the selected nodes.
+func restrictLSCNodes(lsc *slv.LocalStorageClass, nodes, selectedNodes []string) []string {
+	if lsc.Spec.LVM == nil {
+		return selectedNodes
+	}
+
+	restricted := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if slices.Contains(selectedNodes, node) {
+			restricted = append(restricted, node)
+		}
+	}
+
+	return restricted
+}
+
+// findLVGsOutsideNodes returns the names of the LVMVolumeGroups of the LocalStorageClass on any node not selected by
+// its node selector.
+func findLVGsOutsideNodes(lvgList *snc.LVMVolumeGroupList, lscLVGs []slv.LocalStorageClassLVG, selectedNodes []string) []string {
+	usedLVGs := make(map[string]struct{}, len(lscLVGs))
+	for _, lvg := range lscLVGs {
+		usedLVGs[lvg.Name] = struct{}{}
+	}
+
+	badLVGs := make([]string, 0, len(lscLVGs))
+	for _, lvg := range lvgList.Items {
+		if _, used := usedLVGs[lvg.Name]; !used {
+			continue
+		}
+		for _, node := range lvg.Status.Nodes {
+			if !slices.Contains(selectedNodes, node.Name) {
+				badLVGs = append(badLVGs, lvg.Name)
+				break
 			}
-			if currentLVGs[i].Thin.PoolName != lsc.Spec.LVM.LVMVolumeGroups[i].Thin.PoolName {
-				return true, nil
+		}
+	}
+
+	return badLVGs
+}
+
+// getSCTopologyNodes returns the sorted names of the nodes the storage class is allowed on by the node topology key of
+// the CSI driver.
+func getSCTopologyNodes(sc *v1.StorageClass) []string {
+	for _, term := range sc.AllowedTopologies {
+		for _, expr := range term.MatchLabelExpressions {
+			if expr.Key == csiNodeTopologyKey {
+				nodes := slices.Clone(expr.Values)
+				sort.Strings(nodes)
+				return nodes
 			}
 		}
 	}
 
-	return false, nil
+	return nil
 }
 
 func getLVGFromSCParams(sc *v1.StorageClass) ([]slv.LocalStorageClassLVG, error) {
@@ -298,6 +858,8 @@ func reconcileLSCCreateFunc(
 	log logger.Logger,
 	scList *v1.StorageClassList,
 	lsc *slv.LocalStorageClass,
+	lscLVGs []slv.LocalStorageClassLVG,
+	nodes []string,
 ) (bool, error) {
 	log.Debug(fmt.Sprintf("[reconcileLSCCreateFunc] starts the LocalStorageClass %s validation", lsc.Name))
 	added, err := addFinalizerIfNotExistsForLSC(ctx, cl, lsc)
@@ -307,22 +869,27 @@ func reconcileLSCCreateFunc(
 	}
 	log.Debug(fmt.Sprintf("[reconcileLSCCreateFunc] finalizer %s was added to the LocalStorageClass %s: %t", LocalStorageClassFinalizerName, lsc.Name, added))
 
-	valid, msg := validateLocalStorageClass(ctx, cl, scList, lsc)
-	if !valid {
+	failures := validateLocalStorageClass(ctx, cl, scList, lsc, lscLVGs, nodes)
+	if len(failures) != 0 {
+		retriable, msg, upError := updateLocalStorageClassValidationFailed(ctx, cl, lsc, failures)
 		err := fmt.Errorf("validation failed: %s", msg)
 		log.Error(err, fmt.Sprintf("[reconcileLSCCreateFunc] Unable to reconcile the LocalStorageClass, name: %s", lsc.Name))
-		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, msg)
 		if upError != nil {
 			log.Error(upError, fmt.Sprintf("[reconcileLSCCreateFunc] unable to update the LocalStorageClass %s", lsc.Name))
 		}
+		if !retriable {
+			log.Warning(fmt.Sprintf("[reconcileLSCCreateFunc] the spec of the LocalStorageClass %s is invalid. It will be reconciled again once the spec is changed", lsc.Name))
+		}
 
-		return true, err
+		return retriable, err
 	}
 	log.Debug(fmt.Sprintf("[reconcileLSCCreateFunc] successfully validated the LocalStorageClass, name: %s", lsc.Name))
+	setLSCCondition(lsc, ValidatedConditionType, metav1.ConditionTrue, ValidationPassedReason, "")
 
 	log.Debug(fmt.Sprintf("[reconcileLSCCreateFunc] starts storage class configuration for the LocalStorageClass, name: %s", lsc.Name))
-	sc, err := configureStorageClass(lsc)
+	sc, err := configureStorageClass(lsc, lscLVGs, nodes)
 	if err != nil {
+		setLSCCondition(lsc, StorageClassCreatedConditionType, metav1.ConditionFalse, StorageClassSyncFailedReason, err.Error())
 		log.Error(err, fmt.Sprintf("[reconcileLSCCreateFunc] unable to configure Storage Class for LocalStorageClass, name: %s", lsc.Name))
 		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
 		if upError != nil {
@@ -335,6 +902,7 @@ func reconcileLSCCreateFunc(
 
 	created, err := createStorageClassIfNotExists(ctx, cl, scList, sc)
 	if err != nil {
+		setLSCCondition(lsc, StorageClassCreatedConditionType, metav1.ConditionFalse, StorageClassSyncFailedReason, err.Error())
 		log.Error(err, fmt.Sprintf("[reconcileLSCCreateFunc] unable to create a Storage Class, name: %s", sc.Name))
 		upError := updateLocalStorageClassPhase(ctx, cl, lsc, FailedStatusPhase, err.Error())
 		if upError != nil {
@@ -357,6 +925,7 @@ func reconcileLSCCreateFunc(
 		return true, err
 	}
 	log.Debug(fmt.Sprintf("[reconcileLSCCreateFunc] finalizer %s was added to the StorageClass %s: %t", LocalStorageClassFinalizerName, sc.Name, added))
+	setLSCCondition(lsc, StorageClassCreatedConditionType, metav1.ConditionTrue, StorageClassSyncedReason, "")
 
 	err = updateLocalStorageClassPhase(ctx, cl, lsc, CreatedStatusPhase, "")
 	if err != nil {
@@ -389,11 +958,21 @@ func createStorageClassIfNotExists(
 }
 
 func addFinalizerIfNotExistsForLSC(ctx context.Context, cl client.Client, lsc *slv.LocalStorageClass) (bool, error) {
-	if !slices.Contains(lsc.Finalizers, LocalStorageClassFinalizerName) {
-		lsc.Finalizers = append(lsc.Finalizers, LocalStorageClassFinalizerName)
+	return addFinalizerIfNotExists(ctx, cl, lsc, LocalStorageClassFinalizerName)
+}
+
+func addFinalizerIfNotExistsForSC(ctx context.Context, cl client.Client, sc *v1.StorageClass) (bool, error) {
+	return addFinalizerIfNotExists(ctx, cl, sc, LocalStorageClassFinalizerName)
+}
+
+func addFinalizerIfNotExists(ctx context.Context, cl client.Client, obj client.Object, finalizerName string) (bool, error) {
+	if controllerutil.ContainsFinalizer(obj, finalizerName) {
+		return false, nil
 	}
 
-	err := cl.Update(ctx, lsc)
+	err := patchWithRetry(ctx, cl, obj, false, func(obj client.Object) {
+		controllerutil.AddFinalizer(obj, finalizerName)
+	})
 	if err != nil {
 		return false, err
 	}
@@ -401,51 +980,104 @@ func addFinalizerIfNotExistsForLSC(ctx context.Context, cl client.Client, lsc *s
 	return true, nil
 }
 
-func addFinalizerIfNotExistsForSC(ctx context.Context, cl client.Client, sc *v1.StorageClass) (bool, error) {
-	if !slices.Contains(sc.Finalizers, LocalStorageClassFinalizerName) {
-		sc.Finalizers = append(sc.Finalizers, LocalStorageClassFinalizerName)
-	}
+// patchWithRetry applies the change to the current object by the merge patch of its metadata and spec or, if status
+// is set, of its status subresource. The patch is made against the resource version the object has been read with,
+// and on conflict the object is read and changed again, so neither the change nor the concurrent ones are lost.
+// The object passed is changed the same way, while its fields set in memory only are kept.
+func patchWithRetry(ctx context.Context, cl client.Client, obj client.Object, status bool, change func(obj client.Object)) error {
+	current := obj.DeepCopyObject().(client.Object)
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		err := cl.Get(ctx, client.ObjectKeyFromObject(obj), current)
+		if err != nil {
+			return err
+		}
 
-	err := cl.Update(ctx, sc)
+		patch := client.MergeFromWithOptions(current.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+		change(current)
+		if status {
+			return cl.Status().Patch(ctx, current, patch)
+		}
+
+		return cl.Patch(ctx, current, patch)
+	})
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	return true, nil
+	change(obj)
+	obj.SetResourceVersion(current.GetResourceVersion())
+
+	return nil
 }
 
-func configureStorageClass(lsc *slv.LocalStorageClass) (*v1.StorageClass, error) {
+// configureStorageClass returns the storage class of the LocalStorageClass. The storage class is allowed on the nodes
+// of its LVMVolumeGroups only, so no volume is provisioned on a node the class has no space on, even with
+// the Immediate binding mode. The raw device volumes take the whole devices, so their storage class does not allow
+// the volume expansion.
+func configureStorageClass(lsc *slv.LocalStorageClass, lscLVGs []slv.LocalStorageClassLVG, nodes []string) (*v1.StorageClass, error) {
 	reclaimPolicy := corev1.PersistentVolumeReclaimPolicy(lsc.Spec.ReclaimPolicy)
 	volumeBindingMode := v1.VolumeBindingMode(lsc.Spec.VolumeBindingMode)
 	AllowVolumeExpansion := AllowVolumeExpansionDefaultValue
 
-	if lsc.Spec.LVM == nil {
-		//TODO: add support for other LSC types
-		return nil, fmt.Errorf("unable to identify the LocalStorageClass type")
+	fsType := lsc.Spec.FSType
+	if fsType == "" {
+		fsType = DefaultFSType
 	}
 
-	lvgsParam, err := yaml.Marshal(lsc.Spec.LVM.LVMVolumeGroups)
-	if err != nil {
-		return nil, err
+	var params map[string]string
+	switch {
+	case lsc.Spec.LVM != nil:
+		lvgsParam, err := yaml.Marshal(lscLVGs)
+		if err != nil {
+			return nil, err
+		}
+
+		params = map[string]string{
+			TypeParamKey:                 LocalStorageClassLvmType,
+			LVMTypeParamKey:              lsc.Spec.LVM.Type,
+			LVMVolumeBindingModeParamKey: lsc.Spec.VolumeBindingMode,
+			LVMVolumeGroupsParamKey:      string(lvgsParam),
+			FSTypeParamKey:               fsType,
+		}
+
+		if lsc.Spec.LVM.Thick != nil {
+			if lsc.Spec.LVM.Thick.Contiguous {
+				params[LVMVThickContiguousParamKey] = "true"
+			}
+		}
+	case lsc.Spec.RawDevice != nil:
+		rawDeviceParams, err := getRawDeviceParams(lsc)
+		if err != nil {
+			return nil, err
+		}
+
+		params = map[string]string{
+			TypeParamKey:                 LocalStorageClassRawType,
+			LVMVolumeBindingModeParamKey: lsc.Spec.VolumeBindingMode,
+			FSTypeParamKey:               fsType,
+		}
+		for k, v := range rawDeviceParams {
+			params[k] = v
+		}
+		AllowVolumeExpansion = false
+	default:
+		return nil, fmt.Errorf("unable to identify the LocalStorageClass type")
 	}
 
-	fsType := lsc.Spec.FSType
-	if fsType == "" {
-		fsType = DefaultFSType
+	if overprovisioningFactor := getOverprovisioningFactorParam(lsc); overprovisioningFactor != "" {
+		params[LVMThinOverprovisionParamKey] = overprovisioningFactor
 	}
 
-	params := map[string]string{
-		TypeParamKey:                 LocalStorageClassLvmType,
-		LVMTypeParamKey:              lsc.Spec.LVM.Type,
-		LVMVolumeBindingModeParamKey: lsc.Spec.VolumeBindingMode,
-		LVMVolumeGroupsParamKey:      string(lvgsParam),
-		FSTypeParamKey:               fsType,
+	if maxTotalSize := getQuotaParam(lsc); maxTotalSize != "" {
+		params[QuotaMaxTotalSizeParamKey] = maxTotalSize
 	}
 
-	if lsc.Spec.LVM.Thick != nil {
-		if lsc.Spec.LVM.Thick.Contiguous {
-			params[LVMVThickContiguousParamKey] = "true"
-		}
+	allowedNamespacesParams, err := getAllowedNamespacesParams(lsc)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range allowedNamespacesParams {
+		params[k] = v
 	}
 
 	sc := &v1.StorageClass{
@@ -465,6 +1097,18 @@ func configureStorageClass(lsc *slv.LocalStorageClass) (*v1.StorageClass, error)
 		VolumeBindingMode:    &volumeBindingMode,
 	}
 
+	setDefaultAnnotation(sc, lsc)
+
+	// only the raw device storage class without the node selector is allowed on every node
+	if len(nodes) != 0 {
+		sc.AllowedTopologies = []corev1.TopologySelectorTerm{{
+			MatchLabelExpressions: []corev1.TopologySelectorLabelRequirement{{
+				Key:    csiNodeTopologyKey,
+				Values: nodes,
+			}},
+		}}
+	}
+
 	return sc, nil
 }
 
@@ -474,24 +1118,118 @@ func updateLocalStorageClassPhase(
 	lsc *slv.LocalStorageClass,
 	phase,
 	reason string,
+) error {
+	readyReason := ReconcileSucceededReason
+	if phase == FailedStatusPhase {
+		readyReason = ReconcileFailedReason
+	}
+
+	return updateLocalStorageClassStatus(ctx, cl, lsc, phase, readyReason, reason)
+}
+
+// updateLocalStorageClassValidationFailed reports the validation failures in the status of the LocalStorageClass. It
+// returns if the failures are retriable and their message.
+func updateLocalStorageClassValidationFailed(ctx context.Context, cl client.Client, lsc *slv.LocalStorageClass, failures []validationFailure) (bool, string, error) {
+	validatedReason, retriable, msg := summarizeValidationFailures(failures)
+	setLSCCondition(lsc, ValidatedConditionType, metav1.ConditionFalse, validatedReason, msg)
+
+	readyReason := SpecInvalidReason
+	if retriable {
+		readyReason = DependenciesNotReadyReason
+	}
+
+	return retriable, msg, updateLocalStorageClassStatus(ctx, cl, lsc, FailedStatusPhase, readyReason, msg)
+}
+
+func updateLocalStorageClassStatus(
+	ctx context.Context,
+	cl client.Client,
+	lsc *slv.LocalStorageClass,
+	phase,
+	readyReason,
+	reason string,
 ) error {
 	if lsc.Status == nil {
 		lsc.Status = new(slv.LocalStorageClassStatus)
 	}
 	lsc.Status.Phase = phase
 	lsc.Status.Reason = reason
+	setSummaryConditions(lsc, phase, readyReason, reason)
 
-	if !slices.Contains(lsc.Finalizers, LocalStorageClassFinalizerName) {
-		lsc.Finalizers = append(lsc.Finalizers, LocalStorageClassFinalizerName)
-	}
-
-	// TODO: add retry logic
-	err := cl.Update(ctx, lsc)
+	_, err := addFinalizerIfNotExistsForLSC(ctx, cl, lsc)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// the status is owned by the controller only, so it replaces the current one on conflict
+	lscStatus := lsc.Status.DeepCopy()
+	return patchWithRetry(ctx, cl, lsc, true, func(obj client.Object) {
+		obj.(*slv.LocalStorageClass).Status = lscStatus.DeepCopy()
+	})
+}
+
+// setLSCCondition sets the condition of the LocalStorageClass observed at its current generation. The transition time
+// is changed only if the status of the condition is.
+func setLSCCondition(lsc *slv.LocalStorageClass, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	if lsc.Status == nil {
+		lsc.Status = new(slv.LocalStorageClassStatus)
+	}
+
+	meta.SetStatusCondition(&lsc.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: lsc.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setSummaryConditions sets the Ready and Degraded conditions by the phase of the LocalStorageClass. The LocalStorageClass
+// is degraded if it has failed while its storage class exists, so the volumes are still provisioned by the storage
+// class with the previous configuration.
+func setSummaryConditions(lsc *slv.LocalStorageClass, phase, readyReason, reason string) {
+	if phase != FailedStatusPhase {
+		setLSCCondition(lsc, ReadyConditionType, metav1.ConditionTrue, readyReason, "")
+		setLSCCondition(lsc, DegradedConditionType, metav1.ConditionFalse, ReconcileSucceededReason, "")
+		return
+	}
+
+	setLSCCondition(lsc, ReadyConditionType, metav1.ConditionFalse, readyReason, reason)
+	if meta.IsStatusConditionTrue(lsc.Status.Conditions, StorageClassCreatedConditionType) {
+		setLSCCondition(lsc, DegradedConditionType, metav1.ConditionTrue, ReconcileFailedReason, reason)
+	} else {
+		setLSCCondition(lsc, DegradedConditionType, metav1.ConditionFalse, StorageClassMissingReason, "")
+	}
+}
+
+// validationFailure is a problem of the LocalStorageClass found by its validation. The retriable problems are caused by
+// the state of the cluster, e.g. a missing LVMVolumeGroup, and might be gone without a change of the LocalStorageClass,
+// while the terminal ones are caused by its spec and are gone only once the spec is fixed.
+type validationFailure struct {
+	reason    string
+	message   string
+	retriable bool
+}
+
+func (f validationFailure) Error() string {
+	return f.message
+}
+
+// summarizeValidationFailures returns the reason of the Validated condition, if the failures are retriable and
+// the message of the failures. The failures are terminal if any of them is, and the reason of the first terminal one
+// is reported then.
+func summarizeValidationFailures(failures []validationFailure) (string, bool, string) {
+	var msgBuilder strings.Builder
+	reason, retriable := failures[0].reason, true
+	for _, failure := range failures {
+		if !failure.retriable && retriable {
+			reason, retriable = failure.reason, false
+		}
+		msgBuilder.WriteString(failure.message)
+		msgBuilder.WriteString("\n")
+	}
+
+	return reason, retriable, msgBuilder.String()
 }
 
 func validateLocalStorageClass(
@@ -499,59 +1237,144 @@ func validateLocalStorageClass(
 	cl client.Client,
 	scList *v1.StorageClassList,
 	lsc *slv.LocalStorageClass,
-) (bool, string) {
-	var (
-		failedMsgBuilder strings.Builder
-		valid            = true
-	)
+	lscLVGs []slv.LocalStorageClassLVG,
+	nodes []string,
+) []validationFailure {
+	var failures []validationFailure
+	retriable := func(reason, msg string) {
+		failures = append(failures, validationFailure{reason: reason, message: msg, retriable: true})
+	}
+	terminal := func(reason, msg string) {
+		failures = append(failures, validationFailure{reason: reason, message: msg})
+	}
 
 	unmanagedScName := findUnmanagedDuplicatedSC(scList, lsc)
 	if unmanagedScName != "" {
-		valid = false
-		failedMsgBuilder.WriteString(fmt.Sprintf("There already is a storage class with the same name: %s but it is not managed by the LocalStorageClass controller\n", unmanagedScName))
+		retriable(StorageClassConflictReason, fmt.Sprintf("There already is a storage class with the same name: %s but it is not managed by the LocalStorageClass controller", unmanagedScName))
 	}
 
 	lvgList := &snc.LVMVolumeGroupList{}
 	err := cl.List(ctx, lvgList)
 	if err != nil {
-		valid = false
-		failedMsgBuilder.WriteString(fmt.Sprintf("Unable to validate selected LVMVolumeGroups, err: %s\n", err.Error()))
-		return valid, failedMsgBuilder.String()
+		retriable(ValidationFailedReason, fmt.Sprintf("Unable to validate selected LVMVolumeGroups, err: %s", err.Error()))
+		return failures
+	}
+
+	if maxTotalSize := getQuotaParam(lsc); maxTotalSize != "" {
+		quota, err := resource.ParseQuantity(maxTotalSize)
+		if err != nil || quota.Sign() <= 0 {
+			terminal(InvalidParameterReason, fmt.Sprintf("The quota maxTotalSize %s must be a positive quantity", maxTotalSize))
+		}
+	}
+
+	if _, err := getAllowedNamespacesParams(lsc); err != nil {
+		terminal(InvalidParameterReason, err.Error())
+	}
+
+	if lsc.Spec.IsDefault != nil && *lsc.Spec.IsDefault {
+		defaultSCs := findOtherDefaultSCs(scList, lsc)
+		if len(defaultSCs) != 0 {
+			retriable(DefaultStorageClassConflictReason, fmt.Sprintf("There already is a default storage class: %s. Unset its %s annotation or the isDefault field of its LocalStorageClass first", strings.Join(defaultSCs, ","), StorageClassDefaultAnnotationKey))
+		}
+	}
+
+	if len(lsc.Spec.NodeSelector) != 0 {
+		selectedNodes, err := getLSCSelectedNodes(ctx, cl, lsc)
+		switch {
+		case err != nil:
+			retriable(ValidationFailedReason, fmt.Sprintf("Unable to validate the nodes selected by the nodeSelector, err: %s", err.Error()))
+		case len(selectedNodes) == 0:
+			retriable(NoNodesSelectedReason, "No nodes match the nodeSelector")
+		case lsc.Spec.LVM != nil:
+			LVGsOutsideNodes := findLVGsOutsideNodes(lvgList, lscLVGs, selectedNodes)
+			if len(LVGsOutsideNodes) != 0 {
+				retriable(LVMVolumeGroupNotOnNodesReason, fmt.Sprintf("Some LVMVolumeGroups are on the nodes not matching the nodeSelector, LVG names: %s", strings.Join(LVGsOutsideNodes, ",")))
+			}
+		}
 	}
 
 	if lsc.Spec.LVM != nil {
-		LVGsFromTheSameNode := findLVMVolumeGroupsOnTheSameNode(lvgList, lsc)
+		if lsc.Spec.LVM.LVMVolumeGroupSelector != nil && len(lscLVGs) == 0 {
+			retriable(NoLVMVolumeGroupsSelectedReason, "No LVMVolumeGroups match the lvmVolumeGroupSelector")
+		}
+
+		// the LVMVolumeGroups matching the selector might be relabeled without a change of the LocalStorageClass
+		LVGsFromTheSameNode := findLVMVolumeGroupsOnTheSameNode(lvgList, lscLVGs)
 		if len(LVGsFromTheSameNode) != 0 {
-			valid = false
-			failedMsgBuilder.WriteString(fmt.Sprintf("Some LVMVolumeGroups use the same node (|node: LVG names): %s\n", strings.Join(LVGsFromTheSameNode, "")))
+			msg := fmt.Sprintf("Some LVMVolumeGroups use the same node (|node: LVG names): %s", strings.Join(LVGsFromTheSameNode, ""))
+			if lsc.Spec.LVM.LVMVolumeGroupSelector != nil {
+				retriable(LVMVolumeGroupsOnSameNodeReason, msg)
+			} else {
+				terminal(LVMVolumeGroupsOnSameNodeReason, msg)
+			}
 		}
 
-		nonexistentLVGs := findNonexistentLVGs(lvgList, lsc)
+		nonexistentLVGs := findNonexistentLVGs(lvgList, lscLVGs)
 		if len(nonexistentLVGs) != 0 {
-			valid = false
-			failedMsgBuilder.WriteString(fmt.Sprintf("Some of selected LVMVolumeGroups are nonexistent, LVG names: %s\n", strings.Join(nonexistentLVGs, ",")))
+			retriable(LVMVolumeGroupNotFoundReason, fmt.Sprintf("Some of selected LVMVolumeGroups are nonexistent, LVG names: %s", strings.Join(nonexistentLVGs, ",")))
+		}
+
+		// the storage class without the allowed topologies would let the volumes be provisioned on any node
+		if len(lscLVGs) != 0 && len(nodes) == 0 {
+			retriable(LVMVolumeGroupsWithoutNodesReason, "None of the selected LVMVolumeGroups is on any of the allowed nodes")
 		}
 
 		if lsc.Spec.LVM.Type == LVMThinType {
-			LVGSWithNonexistentTps := findNonexistentThinPools(lvgList, lsc)
+			LVGsWithoutTps := findLVGsWithoutThinPool(lscLVGs)
+			if len(LVGsWithoutTps) != 0 {
+				terminal(ThinPoolNotSpecifiedReason, fmt.Sprintf("Some LVMVolumeGroups have no thin pool specified though device type is Thin, LVG names: %s", strings.Join(LVGsWithoutTps, ",")))
+			}
+
+			LVGSWithNonexistentTps := findNonexistentThinPools(lvgList, lscLVGs)
 			if len(LVGSWithNonexistentTps) != 0 {
-				valid = false
-				failedMsgBuilder.WriteString(fmt.Sprintf("Some LVMVolumeGroups use nonexistent thin pools, LVG names: %s\n", strings.Join(LVGSWithNonexistentTps, ",")))
+				retriable(ThinPoolNotFoundReason, fmt.Sprintf("Some LVMVolumeGroups use nonexistent thin pools, LVG names: %s", strings.Join(LVGSWithNonexistentTps, ",")))
+			}
+
+			notReadyTps, lowFreeSpaceTps := findUnhealthyThinPools(lvgList, lscLVGs, getThinMinFreePercent(lsc))
+			if len(notReadyTps) != 0 {
+				retriable(ThinPoolNotReadyReason, fmt.Sprintf("Some thin pools are not ready: %s", strings.Join(notReadyTps, "; ")))
+			}
+			if len(lowFreeSpaceTps) != 0 {
+				retriable(ThinPoolLowFreeSpaceReason, fmt.Sprintf("Some thin pools have not enough free space: %s", strings.Join(lowFreeSpaceTps, "; ")))
 			}
 		} else {
-			LVGsWithTps := findAnyThinPool(lsc)
+			LVGsWithTps := findAnyThinPool(lscLVGs)
 			if len(LVGsWithTps) != 0 {
-				valid = false
-				failedMsgBuilder.WriteString(fmt.Sprintf("Some LVMVolumeGroups use thin pools though device type is Thick, LVG names: %s\n", strings.Join(LVGsWithTps, ",")))
+				terminal(ThinPoolOnThickClassReason, fmt.Sprintf("Some LVMVolumeGroups use thin pools though device type is Thick, LVG names: %s", strings.Join(LVGsWithTps, ",")))
+			}
+		}
+	} else if lsc.Spec.RawDevice != nil {
+		if _, err := getRawDeviceParams(lsc); err != nil {
+			terminal(InvalidParameterReason, err.Error())
+		}
+
+		var minSize, maxSize resource.Quantity
+		for _, size := range []struct {
+			name  string
+			value string
+			q     *resource.Quantity
+		}{
+			{name: "minSize", value: lsc.Spec.RawDevice.MinSize, q: &minSize},
+			{name: "maxSize", value: lsc.Spec.RawDevice.MaxSize, q: &maxSize},
+		} {
+			if size.value == "" {
+				continue
+			}
+			q, err := resource.ParseQuantity(size.value)
+			if err != nil || q.Sign() <= 0 {
+				terminal(InvalidParameterReason, fmt.Sprintf("The rawDevice %s %s must be a positive quantity", size.name, size.value))
+				continue
 			}
+			*size.q = q
+		}
+		if !minSize.IsZero() && !maxSize.IsZero() && minSize.Cmp(maxSize) > 0 {
+			terminal(InvalidParameterReason, fmt.Sprintf("The rawDevice minSize %s must not be greater than the maxSize %s", lsc.Spec.RawDevice.MinSize, lsc.Spec.RawDevice.MaxSize))
 		}
 	} else {
-		// TODO: add support for other types
-		valid = false
-		failedMsgBuilder.WriteString(fmt.Sprintf("Unable to identify a type of LocalStorageClass %s", lsc.Name))
+		terminal(InvalidParameterReason, fmt.Sprintf("Unable to identify a type of LocalStorageClass %s", lsc.Name))
 	}
 
-	return valid, failedMsgBuilder.String()
+	return failures
 }
 
 func findUnmanagedDuplicatedSC(scList *v1.StorageClassList, lsc *slv.LocalStorageClass) string {
@@ -564,9 +1387,9 @@ func findUnmanagedDuplicatedSC(scList *v1.StorageClassList, lsc *slv.LocalStorag
 	return ""
 }
 
-func findAnyThinPool(lsc *slv.LocalStorageClass) []string {
-	badLvgs := make([]string, 0, len(lsc.Spec.LVM.LVMVolumeGroups))
-	for _, lvs := range lsc.Spec.LVM.LVMVolumeGroups {
+func findAnyThinPool(lscLVGs []slv.LocalStorageClassLVG) []string {
+	badLvgs := make([]string, 0, len(lscLVGs))
+	for _, lvs := range lscLVGs {
 		if lvs.Thin != nil {
 			badLvgs = append(badLvgs, lvs.Name)
 		}
@@ -575,16 +1398,27 @@ func findAnyThinPool(lsc *slv.LocalStorageClass) []string {
 	return badLvgs
 }
 
-func findNonexistentThinPools(lvgList *snc.LVMVolumeGroupList, lsc *slv.LocalStorageClass) []string {
+func findLVGsWithoutThinPool(lscLVGs []slv.LocalStorageClassLVG) []string {
+	badLvgs := make([]string, 0, len(lscLVGs))
+	for _, lscLvg := range lscLVGs {
+		if lscLvg.Thin == nil {
+			badLvgs = append(badLvgs, lscLvg.Name)
+		}
+	}
+
+	return badLvgs
+}
+
+func findNonexistentThinPools(lvgList *snc.LVMVolumeGroupList, lscLVGs []slv.LocalStorageClassLVG) []string {
 	lvgs := make(map[string]snc.LVMVolumeGroup, len(lvgList.Items))
 	for _, lvg := range lvgList.Items {
 		lvgs[lvg.Name] = lvg
 	}
 
-	badLvgs := make([]string, 0, len(lsc.Spec.LVM.LVMVolumeGroups))
-	for _, lscLvg := range lsc.Spec.LVM.LVMVolumeGroups {
+	badLvgs := make([]string, 0, len(lscLVGs))
+	for _, lscLvg := range lscLVGs {
+		// the LVMVolumeGroups without the thin pool are found by findLVGsWithoutThinPool
 		if lscLvg.Thin == nil {
-			badLvgs = append(badLvgs, lscLvg.Name)
 			continue
 		}
 
@@ -606,14 +1440,68 @@ func findNonexistentThinPools(lvgList *snc.LVMVolumeGroupList, lsc *slv.LocalSto
 	return badLvgs
 }
 
-func findNonexistentLVGs(lvgList *snc.LVMVolumeGroupList, lsc *slv.LocalStorageClass) []string {
+// getThinMinFreePercent returns the minimum free space of the thin pools of the LocalStorageClass in percent, it is 0
+// if the minimum is not set.
+func getThinMinFreePercent(lsc *slv.LocalStorageClass) int {
+	if lsc.Spec.LVM == nil || lsc.Spec.LVM.Thin == nil {
+		return 0
+	}
+
+	return lsc.Spec.LVM.Thin.MinFreePercent
+}
+
+// findUnhealthyThinPools describes the thin pools of the LocalStorageClass that are not ready and the ones with less
+// free space than the minimum percentage, or with no free space at all if the minimum is not set. The description
+// has the utilization of the thin pool. The nonexistent thin pools are found by findNonexistentThinPools.
+func findUnhealthyThinPools(lvgList *snc.LVMVolumeGroupList, lscLVGs []slv.LocalStorageClassLVG, minFreePercent int) (notReady, lowFreeSpace []string) {
+	lvgs := make(map[string]snc.LVMVolumeGroup, len(lvgList.Items))
+	for _, lvg := range lvgList.Items {
+		lvgs[lvg.Name] = lvg
+	}
+
+	for _, lscLvg := range lscLVGs {
+		if lscLvg.Thin == nil {
+			continue
+		}
+
+		for _, tp := range lvgs[lscLvg.Name].Status.ThinPools {
+			if tp.Name != lscLvg.Thin.PoolName {
+				continue
+			}
+
+			utilization := fmt.Sprintf("%s/%s", lscLvg.Name, tp.Name)
+			var usedPercent float64
+			if tp.ActualSize.Sign() > 0 {
+				usedPercent = float64(tp.UsedSize.Value()) * 100 / float64(tp.ActualSize.Value())
+				utilization = fmt.Sprintf("%s used %s of %s (%.1f%%)", utilization, tp.UsedSize.String(), tp.ActualSize.String(), usedPercent)
+			}
+
+			switch {
+			case !tp.Ready:
+				if tp.Message != "" {
+					utilization = fmt.Sprintf("%s: %s", utilization, tp.Message)
+				}
+				notReady = append(notReady, utilization)
+			case tp.ActualSize.Sign() <= 0:
+				// the size of the thin pool is unknown yet
+			case tp.UsedSize.Cmp(tp.ActualSize) >= 0 || 100-usedPercent < float64(minFreePercent):
+				lowFreeSpace = append(lowFreeSpace, utilization)
+			}
+			break
+		}
+	}
+
+	return notReady, lowFreeSpace
+}
+
+func findNonexistentLVGs(lvgList *snc.LVMVolumeGroupList, lscLVGs []slv.LocalStorageClassLVG) []string {
 	lvgs := make(map[string]struct{}, len(lvgList.Items))
 	for _, lvg := range lvgList.Items {
 		lvgs[lvg.Name] = struct{}{}
 	}
 
-	nonexistent := make([]string, 0, len(lsc.Spec.LVM.LVMVolumeGroups))
-	for _, lvg := range lsc.Spec.LVM.LVMVolumeGroups {
+	nonexistent := make([]string, 0, len(lscLVGs))
+	for _, lvg := range lscLVGs {
 		if _, exist := lvgs[lvg.Name]; !exist {
 			nonexistent = append(nonexistent, lvg.Name)
 		}
@@ -622,14 +1510,14 @@ func findNonexistentLVGs(lvgList *snc.LVMVolumeGroupList, lsc *slv.LocalStorageC
 	return nonexistent
 }
 
-func findLVMVolumeGroupsOnTheSameNode(lvgList *snc.LVMVolumeGroupList, lsc *slv.LocalStorageClass) []string {
-	nodesWithLVGs := make(map[string][]string, len(lsc.Spec.LVM.LVMVolumeGroups))
-	usedLVGs := make(map[string]struct{}, len(lsc.Spec.LVM.LVMVolumeGroups))
-	for _, lvg := range lsc.Spec.LVM.LVMVolumeGroups {
+func findLVMVolumeGroupsOnTheSameNode(lvgList *snc.LVMVolumeGroupList, lscLVGs []slv.LocalStorageClassLVG) []string {
+	nodesWithLVGs := make(map[string][]string, len(lscLVGs))
+	usedLVGs := make(map[string]struct{}, len(lscLVGs))
+	for _, lvg := range lscLVGs {
 		usedLVGs[lvg.Name] = struct{}{}
 	}
 
-	badLVGs := make([]string, 0, len(lsc.Spec.LVM.LVMVolumeGroups))
+	badLVGs := make([]string, 0, len(lscLVGs))
 	for _, lvg := range lvgList.Items {
 		if _, used := usedLVGs[lvg.Name]; used {
 			for _, node := range lvg.Status.Nodes {
@@ -690,37 +1578,50 @@ func deleteStorageClass(ctx context.Context, cl client.Client, sc *v1.StorageCla
 	return nil
 }
 
-func removeFinalizerIfExists(ctx context.Context, cl client.Client, obj metav1.Object, finalizerName string) (bool, error) {
-	removed := false
-	finalizers := obj.GetFinalizers()
-	for i, f := range finalizers {
-		if f == finalizerName || f == LocalStorageClassFinalizerNameOld {
-			finalizers = append(finalizers[:i], finalizers[i+1:]...)
-			removed = true
-			break
-		}
+func removeFinalizerIfExists(ctx context.Context, cl client.Client, obj client.Object, finalizerName string) (bool, error) {
+	if !controllerutil.ContainsFinalizer(obj, finalizerName) && !controllerutil.ContainsFinalizer(obj, LocalStorageClassFinalizerNameOld) {
+		return false, nil
 	}
 
-	if removed {
-		obj.SetFinalizers(finalizers)
-		err := cl.Update(ctx, obj.(client.Object))
-		if err != nil {
-			return false, err
-		}
+	err := patchWithRetry(ctx, cl, obj, false, func(obj client.Object) {
+		controllerutil.RemoveFinalizer(obj, finalizerName)
+		controllerutil.RemoveFinalizer(obj, LocalStorageClassFinalizerNameOld)
+	})
+	if err != nil {
+		return false, err
 	}
 
-	return removed, nil
+	return true, nil
 }
 
-func updateStorageClass(lsc *slv.LocalStorageClass, oldSC *v1.StorageClass) (*v1.StorageClass, error) {
-	newSC, err := configureStorageClass(lsc)
+func updateStorageClass(lsc *slv.LocalStorageClass, oldSC *v1.StorageClass, lscLVGs []slv.LocalStorageClassLVG, nodes []string) (*v1.StorageClass, error) {
+	newSC, err := configureStorageClass(lsc, lscLVGs, nodes)
 	if err != nil {
 		return nil, err
 	}
 
-	if oldSC.Annotations != nil {
-		newSC.Annotations = oldSC.Annotations
-	}
+	// the labels and annotations other controllers and users have set survive the recreation, while the ones
+	// the controller sets are taken from the new storage class
+	newSC.Labels = mergeMetadata(oldSC.Labels, newSC.Labels)
+	newSC.Annotations = mergeMetadata(oldSC.Annotations, newSC.Annotations)
+	setDefaultAnnotation(newSC, lsc)
 
 	return newSC, nil
 }
+
+// mergeMetadata returns a copy of the current labels or annotations overridden by the desired ones.
+func mergeMetadata(current, desired map[string]string) map[string]string {
+	if len(current) == 0 && len(desired) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string, len(current)+len(desired))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range desired {
+		merged[k] = v
+	}
+
+	return merged
+}
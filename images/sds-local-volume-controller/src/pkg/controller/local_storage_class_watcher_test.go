@@ -27,9 +27,12 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/storage/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 
 	"sds-local-volume-controller/pkg/controller"
 	"sds-local-volume-controller/pkg/logger"
@@ -181,6 +184,115 @@ var _ = Describe(controller.LocalStorageClassCtrlName, func() {
 
 	})
 
+	It("Update_local_sc_reclaim_policy_with_existing_pvs", func() {
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: existingThickLVG1Name},
+			{Name: existingThickLVG2Name},
+			{Name: newThickLVGName},
+		}
+
+		pvs := []*corev1.PersistentVolume{
+			generatePersistentVolume("pv-bound", nameForLocalStorageClass, corev1.VolumeBound),
+			generatePersistentVolume("pv-released", nameForLocalStorageClass, corev1.VolumeReleased),
+			generatePersistentVolume("pv-other-sc", "other-sc", corev1.VolumeBound),
+		}
+		for _, pv := range pvs {
+			err := cl.Create(ctx, pv)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		lsc := &slv.LocalStorageClass{}
+		err := cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc.Spec.ReclaimPolicy = reclaimPolicyRetain
+		lsc.Spec.PropagateReclaimPolicy = true
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyRetain, volumeBindingModeWFFC, controller.DefaultFSType)
+		Expect(sc.Annotations).To(HaveKeyWithValue(controller.StorageClassDefaultAnnotationKey, controller.StorageClassDefaultAnnotationValTrue))
+
+		expectedPolicies := map[string]corev1.PersistentVolumeReclaimPolicy{
+			"pv-bound":    corev1.PersistentVolumeReclaimRetain,
+			"pv-released": corev1.PersistentVolumeReclaimDelete,
+			"pv-other-sc": corev1.PersistentVolumeReclaimDelete,
+		}
+		for name, policy := range expectedPolicies {
+			pv := &corev1.PersistentVolume{}
+			err = cl.Get(ctx, client.ObjectKey{Name: name}, pv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pv.Spec.PersistentVolumeReclaimPolicy).To(Equal(policy))
+		}
+
+		// the applied policy is not propagated again until it is changed
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.AppliedReclaimPolicy).To(Equal(reclaimPolicyRetain))
+
+		boundPV := &corev1.PersistentVolume{}
+		err = cl.Get(ctx, client.ObjectKey{Name: "pv-bound"}, boundPV)
+		Expect(err).NotTo(HaveOccurred())
+		boundPV.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimDelete
+		err = cl.Update(ctx, boundPV)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: "pv-bound"}, boundPV)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(boundPV.Spec.PersistentVolumeReclaimPolicy).To(Equal(corev1.PersistentVolumeReclaimDelete))
+
+		boundPV.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+		err = cl.Update(ctx, boundPV)
+		Expect(err).NotTo(HaveOccurred())
+
+		// without the propagation only the storage class gets the new policy
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		lsc.Spec.ReclaimPolicy = reclaimPolicyDelete
+		lsc.Spec.PropagateReclaimPolicy = false
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+
+		pv := &corev1.PersistentVolume{}
+		err = cl.Get(ctx, client.ObjectKey{Name: "pv-bound"}, pv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pv.Spec.PersistentVolumeReclaimPolicy).To(Equal(corev1.PersistentVolumeReclaimRetain))
+
+		for _, pv := range pvs {
+			err = cl.Delete(ctx, pv)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
 	It("Update_local_sc_remove_existing_lvg", func() {
 		lvgSpec := []slv.LocalStorageClassLVG{
 			{Name: existingThickLVG1Name},
@@ -252,6 +364,10 @@ var _ = Describe(controller.LocalStorageClassCtrlName, func() {
 		Expect(lsc.Finalizers).To(ContainElement(controller.LocalStorageClassFinalizerName))
 		Expect(lsc.Spec.LVM.LVMVolumeGroups).To(Equal(lvgSpec))
 		Expect(lsc.Status.Phase).To(Equal(controller.FailedStatusPhase))
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.DependenciesNotReadyReason)
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.LVMVolumeGroupNotFoundReason)
+		performConditionChecksForLSC(lsc, controller.StorageClassCreatedConditionType, metav1.ConditionTrue, controller.StorageClassSyncedReason)
+		performConditionChecksForLSC(lsc, controller.DegradedConditionType, metav1.ConditionTrue, controller.ReconcileFailedReason)
 
 		sc := &v1.StorageClass{}
 		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
@@ -445,6 +561,8 @@ var _ = Describe(controller.LocalStorageClassCtrlName, func() {
 		Expect(lsc.Finalizers).To(HaveLen(1))
 		Expect(lsc.Finalizers).To(ContainElement(controller.LocalStorageClassFinalizerName))
 		Expect(lsc.Status.Phase).To(Equal(controller.FailedStatusPhase))
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.DependenciesNotReadyReason)
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.StorageClassConflictReason)
 
 		sc = &v1.StorageClass{}
 		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
@@ -686,7 +804,7 @@ var _ = Describe(controller.LocalStorageClassCtrlName, func() {
 
 		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
 		Expect(err).To(HaveOccurred())
-		Expect(shouldRequeue).To(BeTrue())
+		Expect(shouldRequeue).To(BeFalse())
 
 		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
 		Expect(err).NotTo(HaveOccurred())
@@ -694,6 +812,8 @@ var _ = Describe(controller.LocalStorageClassCtrlName, func() {
 		Expect(lsc.Finalizers).To(ContainElement(controller.LocalStorageClassFinalizerName))
 		Expect(lsc.Spec.LVM.LVMVolumeGroups).To(Equal(lvgSpec))
 		Expect(lsc.Status.Phase).To(Equal(controller.FailedStatusPhase))
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.SpecInvalidReason)
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.ThinPoolNotSpecifiedReason)
 
 		sc := &v1.StorageClass{}
 		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
@@ -739,107 +859,1515 @@ var _ = Describe(controller.LocalStorageClassCtrlName, func() {
 		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
 	})
 
-})
+	It("Create_and_update_local_sc_allowed_topologies_by_lvg_nodes", func() {
+		const (
+			lvg1Name = "test-topology-vg1"
+			lvg2Name = "test-topology-vg2"
+		)
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvg1Name},
+			{Name: lvg2Name},
+		}
 
-func generateLVMVolumeGroup(name string, thinPoolNames []string) *snc.LVMVolumeGroup {
-	lvmType := controller.LVMThickType
+		lvg1 := generateLVMVolumeGroup(lvg1Name, []string{})
+		lvg1.Status.Nodes = []snc.LVMVolumeGroupNode{{Name: "node-2"}}
+		err := cl.Create(ctx, lvg1)
+		Expect(err).NotTo(HaveOccurred())
 
-	if len(thinPoolNames) > 0 {
-		lvmType = controller.LVMThinType
-	}
+		lvg2 := generateLVMVolumeGroup(lvg2Name, []string{})
+		lvg2.Status.Nodes = []snc.LVMVolumeGroupNode{{Name: "node-1"}}
+		err = cl.Create(ctx, lvg2)
+		Expect(err).NotTo(HaveOccurred())
 
-	thinPoolsSpec := make([]snc.LVMVolumeGroupThinPoolSpec, 0)
-	thinPoolsStatus := make([]snc.LVMVolumeGroupThinPoolStatus, 0)
-	for i := 0; i < len(thinPoolNames); i++ {
-		thinPoolsSpec = append(thinPoolsSpec, snc.LVMVolumeGroupThinPoolSpec{
-			Name: thinPoolNames[i],
-			Size: "10Gi",
-		})
-		thinPoolsStatus = append(thinPoolsStatus, snc.LVMVolumeGroupThinPoolStatus{
-			Name:       thinPoolNames[i],
-			ActualSize: resource.MustParse("10Gi"),
-			UsedSize:   resource.MustParse("0Gi"),
-		})
-	}
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeIM, controller.LVMThickType, lvgSpec)
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
 
-	return &snc.LVMVolumeGroup{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
-		},
-		Spec: snc.LVMVolumeGroupSpec{
-			ActualVGNameOnTheNode: "vg1",
-			ThinPools:             thinPoolsSpec,
-			Type:                  lvmType,
-		},
-		Status: snc.LVMVolumeGroupStatus{
-			ThinPools: thinPoolsStatus,
-		},
-	}
-}
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
 
-//nolint:unparam
-func generateLocalStorageClass(lscName, reclaimPolicy, volumeBindingMode, lvmType string, lvgs []slv.LocalStorageClassLVG) *slv.LocalStorageClass {
-	return &slv.LocalStorageClass{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: lscName,
-		},
-		Spec: slv.LocalStorageClassSpec{
-			ReclaimPolicy:     reclaimPolicy,
-			VolumeBindingMode: volumeBindingMode,
-			LVM: &slv.LocalStorageClassLVMSpec{
-				Type:            lvmType,
-				LVMVolumeGroups: lvgs,
-			},
-		},
-	}
-}
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
 
-//nolint:unparam
-func performStandartChecksForSC(
-	sc *v1.StorageClass,
-	lvgSpec []slv.LocalStorageClassLVG,
-	nameForLocalStorageClass,
-	lscType,
-	lvmType,
-	reclaimPolicy,
-	volumeBindingMode,
-	fsType string,
-) {
-	expectString := ""
-	for i, lvg := range lvgSpec {
-		if i != 0 {
-			expectString += "\n"
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyDelete, volumeBindingModeIM, controller.DefaultFSType)
+		performAllowedTopologiesChecksForSC(sc, "node-1", "node-2")
+
+		// the LVMVolumeGroup moved to another node
+		err = cl.Get(ctx, client.ObjectKey{Name: lvg2Name}, lvg2)
+		Expect(err).NotTo(HaveOccurred())
+		lvg2.Status.Nodes = []snc.LVMVolumeGroupNode{{Name: "node-3"}}
+		err = cl.Update(ctx, lvg2)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyDelete, volumeBindingModeIM, controller.DefaultFSType)
+		performAllowedTopologiesChecksForSC(sc, "node-2", "node-3")
+
+		// the LVMVolumeGroups are on no node, so the storage class is not recreated without the allowed topologies
+		for _, lvg := range []*snc.LVMVolumeGroup{lvg1, lvg2} {
+			err = cl.Get(ctx, client.ObjectKey{Name: lvg.Name}, lvg)
+			Expect(err).NotTo(HaveOccurred())
+			lvg.Status.Nodes = nil
+			err = cl.Update(ctx, lvg)
+			Expect(err).NotTo(HaveOccurred())
 		}
-		if lvg.Thin != nil {
-			expectString += "- name: " + lvg.Name + "\n  thin:\n    poolName: " + lvg.Thin.PoolName
-		} else {
-			expectString += "- name: " + lvg.Name
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).To(HaveOccurred())
+		Expect(shouldRequeue).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.FailedStatusPhase))
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.DependenciesNotReadyReason)
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.LVMVolumeGroupsWithoutNodesReason)
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performAllowedTopologiesChecksForSC(sc, "node-2", "node-3")
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Create_default_local_sc_when_another_default_sc_exists", func() {
+		const (
+			lvgName          = "test-default-vg"
+			otherDefaultName = "test-other-default-sc"
+		)
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName},
 		}
-	}
-	expectString += "\n"
 
-	expectedFSType := fsType
-	if fsType == "" {
-		expectedFSType = controller.DefaultFSType
-	}
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{}))
+		Expect(err).NotTo(HaveOccurred())
 
-	Expect(sc).NotTo(BeNil())
-	Expect(sc.Name).To(Equal(nameForLocalStorageClass))
-	Expect(sc.Finalizers).To(HaveLen(1))
-	Expect(sc.Finalizers).To(ContainElement(controller.LocalStorageClassFinalizerName))
+		otherDefaultSC := &v1.StorageClass{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        otherDefaultName,
+				Annotations: map[string]string{controller.StorageClassDefaultAnnotationKey: controller.StorageClassDefaultAnnotationValTrue},
+			},
+			Provisioner: "test-provisioner",
+		}
+		err = cl.Create(ctx, otherDefaultSC)
+		Expect(err).NotTo(HaveOccurred())
 
-	Expect(sc.Parameters).To(HaveLen(5))
-	Expect(sc.Parameters).To(HaveKeyWithValue(controller.TypeParamKey, lscType))
-	Expect(sc.Parameters).To(HaveKeyWithValue(controller.LVMTypeParamKey, lvmType))
-	Expect(sc.Parameters).To(HaveKeyWithValue(controller.LVMVolumeBindingModeParamKey, volumeBindingMode))
-	Expect(sc.Parameters).To(HaveKeyWithValue(controller.FSTypeParamKey, expectedFSType))
-	Expect(sc.Parameters).To(HaveKey(controller.LVMVolumeGroupsParamKey))
-	Expect(sc.Parameters[controller.LVMVolumeGroupsParamKey]).To(Equal(expectString))
+		isDefault := true
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThickType, lvgSpec)
+		lsc.Spec.IsDefault = &isDefault
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
 
-	Expect(sc.Provisioner).To(Equal(controller.LocalStorageClassProvisioner))
-	Expect(string(*sc.ReclaimPolicy)).To(Equal(reclaimPolicy))
-	Expect(string(*sc.VolumeBindingMode)).To(Equal(volumeBindingMode))
-	Expect(*sc.AllowVolumeExpansion).To(BeTrue())
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).To(HaveOccurred())
+		Expect(shouldRequeue).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.FailedStatusPhase))
+		Expect(lsc.Status.Reason).To(ContainSubstring(otherDefaultName))
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.DependenciesNotReadyReason)
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.DefaultStorageClassConflictReason)
+		performConditionChecksForLSC(lsc, controller.DegradedConditionType, metav1.ConditionFalse, controller.StorageClassMissingReason)
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		err = cl.Delete(ctx, otherDefaultSC)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+		Expect(sc.Annotations).To(HaveKeyWithValue(controller.StorageClassDefaultAnnotationKey, controller.StorageClassDefaultAnnotationValTrue))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.CreatedStatusPhase))
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionTrue, controller.ReconcileSucceededReason)
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionTrue, controller.ValidationPassedReason)
+		performConditionChecksForLSC(lsc, controller.StorageClassCreatedConditionType, metav1.ConditionTrue, controller.StorageClassSyncedReason)
+		performConditionChecksForLSC(lsc, controller.DegradedConditionType, metav1.ConditionFalse, controller.ReconcileSucceededReason)
+
+		// the storage class is not the default one anymore
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		isDefault = false
+		lsc.Spec.IsDefault = &isDefault
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Annotations).NotTo(HaveKey(controller.StorageClassDefaultAnnotationKey))
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+	})
+
+	It("Create_local_sc_with_omitted_fields", func() {
+		const lvgName = "test-minimal-vg"
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{}))
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, "", "", controller.LVMThickType, lvgSpec)
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, controller.DefaultReclaimPolicy, controller.DefaultVolumeBindingMode, "")
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.CreatedStatusPhase))
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		// nothing is changed by the reconcile of the defaulted LocalStorageClass
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, controller.DefaultReclaimPolicy, controller.DefaultVolumeBindingMode, "")
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Create_and_update_local_thin_sc_by_lvg_selector", func() {
+		const (
+			lvg1Name      = "test-selector-vg1"
+			lvg2Name      = "test-selector-vg2"
+			lvg3Name      = "test-selector-vg3"
+			thinPoolName  = "test-selector-tp"
+			selectorLabel = "test-selector"
+		)
+
+		lvg1 := generateLVMVolumeGroup(lvg1Name, []string{thinPoolName})
+		lvg1.Labels = map[string]string{selectorLabel: "true"}
+		lvg1.Status.Nodes = []snc.LVMVolumeGroupNode{{Name: "node-1"}}
+		err := cl.Create(ctx, lvg1)
+		Expect(err).NotTo(HaveOccurred())
+
+		lvg2 := generateLVMVolumeGroup(lvg2Name, []string{thinPoolName})
+		lvg2.Status.Nodes = []snc.LVMVolumeGroupNode{{Name: "node-2"}}
+		err = cl.Create(ctx, lvg2)
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThinType, nil)
+		lsc.Spec.LVM.LVMVolumeGroupSelector = &metav1.LabelSelector{MatchLabels: map[string]string{selectorLabel: "true"}}
+		lsc.Spec.LVM.Thin = &slv.LocalStorageClassLVMThinSpec{PoolName: thinPoolName}
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvg1Name, Thin: &slv.LocalStorageClassLVMThinPoolSpec{PoolName: thinPoolName}},
+		}
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThinType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+		performAllowedTopologiesChecksForSC(sc, "node-1")
+
+		// the labeled LVMVolumeGroup joins the storage class
+		err = cl.Get(ctx, client.ObjectKey{Name: lvg2Name}, lvg2)
+		Expect(err).NotTo(HaveOccurred())
+		lvg2.Labels = map[string]string{selectorLabel: "true"}
+		err = cl.Update(ctx, lvg2)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		lvgSpec = append(lvgSpec, slv.LocalStorageClassLVG{Name: lvg2Name, Thin: &slv.LocalStorageClassLVMThinPoolSpec{PoolName: thinPoolName}})
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThinType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+		performAllowedTopologiesChecksForSC(sc, "node-1", "node-2")
+
+		// the unlabeled LVMVolumeGroup leaves the storage class
+		err = cl.Get(ctx, client.ObjectKey{Name: lvg1Name}, lvg1)
+		Expect(err).NotTo(HaveOccurred())
+		lvg1.Labels = nil
+		err = cl.Update(ctx, lvg1)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		lvgSpec = delFromSlice(lvgSpec, lvg1Name)
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThinType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+		performAllowedTopologiesChecksForSC(sc, "node-2")
+
+		// the LVMVolumeGroups on the same node are awaited to be relabeled, as the LocalStorageClass might not change
+		lvg3 := generateLVMVolumeGroup(lvg3Name, []string{thinPoolName})
+		lvg3.Labels = map[string]string{selectorLabel: "true"}
+		lvg3.Status.Nodes = []snc.LVMVolumeGroupNode{{Name: "node-2"}}
+		err = cl.Create(ctx, lvg3)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).To(HaveOccurred())
+		Expect(shouldRequeue).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.FailedStatusPhase))
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.DependenciesNotReadyReason)
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.LVMVolumeGroupsOnSameNodeReason)
+
+		err = cl.Delete(ctx, lvg3)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.CreatedStatusPhase))
+		Expect(lsc.Spec.LVM.LVMVolumeGroups).To(BeEmpty())
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Reconcile_stale_local_sc", func() {
+		const lvgName = "test-stale-vg"
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{}))
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThickType, lvgSpec)
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the LocalStorageClass is changed after the controller has read it
+		freshLSC := &slv.LocalStorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, freshLSC)
+		Expect(err).NotTo(HaveOccurred())
+		freshLSC.Labels = map[string]string{"test-label": "true"}
+		err = cl.Update(ctx, freshLSC)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Labels).To(HaveKeyWithValue("test-label", "true"))
+		Expect(lsc.Finalizers).To(ContainElement(controller.LocalStorageClassFinalizerName))
+		Expect(lsc.Status.Phase).To(Equal(controller.CreatedStatusPhase))
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Get_storage_classes_of_local_sc", func() {
+		const (
+			lvgName              = "test-indexed-vg"
+			defaultSCName        = "test-default-sc"
+			unrelatedSCName      = "test-unrelated-sc"
+			unrelatedProvisioner = "test.csi.storage.io"
+		)
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{}))
+		Expect(err).NotTo(HaveOccurred())
+
+		otherSCs := []*v1.StorageClass{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        defaultSCName,
+					Annotations: map[string]string{controller.StorageClassDefaultAnnotationKey: controller.StorageClassDefaultAnnotationValTrue},
+				},
+				Provisioner: unrelatedProvisioner,
+			},
+			{
+				ObjectMeta:  metav1.ObjectMeta{Name: unrelatedSCName},
+				Provisioner: unrelatedProvisioner,
+			},
+		}
+		for _, sc := range otherSCs {
+			err = cl.Create(ctx, sc)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThickType, lvgSpec)
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList, err := controller.GetLSCStorageClasses(ctx, cl, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scList.Items).To(HaveLen(1))
+		Expect(scList.Items[0].Name).To(Equal(defaultSCName))
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		scList, err = controller.GetLSCStorageClasses(ctx, cl, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scList.Items).To(HaveLen(2))
+		scNames := []string{scList.Items[0].Name, scList.Items[1].Name}
+		Expect(scNames).To(ConsistOf(defaultSCName, nameForLocalStorageClass))
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList, err = controller.GetLSCStorageClasses(ctx, cl, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		for _, sc := range otherSCs {
+			err = cl.Delete(ctx, sc)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("Create_and_update_local_thin_sc_with_overprovisioning_factor", func() {
+		const (
+			lvgName      = "test-overprovisioned-vg"
+			thinPoolName = "thin-pool-1"
+		)
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName, Thin: &slv.LocalStorageClassLVMThinPoolSpec{PoolName: thinPoolName}},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{thinPoolName}))
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThinType, lvgSpec)
+		lsc.Spec.LVM.Thin = &slv.LocalStorageClassLVMThinSpec{OverprovisioningFactor: 1.5}
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.LVMThinOverprovisionParamKey, "1.5"))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		lsc.Spec.LVM.Thin.OverprovisioningFactor = 2
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.LVMThinOverprovisionParamKey, "2"))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		lsc.Spec.LVM.Thin = nil
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThinType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Create_and_update_local_sc_with_quota", func() {
+		const (
+			lvgName = "test-quota-vg"
+			pvName  = "test-quota-pv"
+		)
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{}))
+		Expect(err).NotTo(HaveOccurred())
+
+		pv := &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: pvName},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName: nameForLocalStorageClass,
+				Capacity:         corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: controller.LocalStorageClassProvisioner, VolumeHandle: pvName},
+				},
+			},
+		}
+		err = cl.Create(ctx, pv)
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThickType, lvgSpec)
+		lsc.Spec.Quota = &slv.LocalStorageClassQuotaSpec{MaxTotalSize: "100Gi"}
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.ProvisionedSize).To(Equal("10Gi"))
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.QuotaMaxTotalSizeParamKey, "100Gi"))
+
+		// the storage class matching the LocalStorageClass is not recreated
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		freshSC := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, freshSC)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(freshSC.ResourceVersion).To(Equal(sc.ResourceVersion))
+
+		// the storage class changed by hand is recreated with the rendered one
+		sc.MountOptions = []string{"noatime"}
+		err = cl.Update(ctx, sc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.MountOptions).To(BeEmpty())
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.QuotaMaxTotalSizeParamKey, "100Gi"))
+
+		// the volume of the storage class is deleted
+		err = cl.Delete(ctx, pv)
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc.Spec.Quota = nil
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.ProvisionedSize).To(Equal("0"))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Update_local_sc_preserves_sc_metadata", func() {
+		const (
+			lvgName         = "test-metadata-vg"
+			labelKey        = "backup.example.com/include"
+			annotationKey   = "backup.example.com/hint"
+			annotationValue = "snapshot"
+		)
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{}))
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThickType, lvgSpec)
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		// another controller marks the storage class
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		sc.Labels = map[string]string{labelKey: "true"}
+		sc.Annotations = map[string]string{annotationKey: annotationValue}
+		err = cl.Update(ctx, sc)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the storage class is recreated with the new reclaim policy
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		lsc.Spec.ReclaimPolicy = reclaimPolicyRetain
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		sc = &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyRetain, volumeBindingModeWFFC, controller.DefaultFSType)
+		Expect(sc.Labels).To(HaveKeyWithValue(labelKey, "true"))
+		Expect(sc.Annotations).To(HaveKeyWithValue(annotationKey, annotationValue))
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Create_and_update_local_raw_sc", func() {
+		lsc := &slv.LocalStorageClass{
+			ObjectMeta: metav1.ObjectMeta{Name: nameForLocalStorageClass},
+			Spec: slv.LocalStorageClassSpec{
+				ReclaimPolicy:     reclaimPolicyDelete,
+				VolumeBindingMode: volumeBindingModeWFFC,
+				RawDevice: &slv.LocalStorageClassRawDeviceSpec{
+					BlockDeviceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"disk-type": "nvme"}},
+					MinSize:             "100Gi",
+				},
+			},
+		}
+		err := cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.CreatedStatusPhase))
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Provisioner).To(Equal(controller.LocalStorageClassProvisioner))
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.TypeParamKey, controller.LocalStorageClassRawType))
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.RawDeviceSelectorParamKey, "disk-type=nvme"))
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.RawDeviceMinSizeParamKey, "100Gi"))
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.FSTypeParamKey, controller.DefaultFSType))
+		Expect(sc.Parameters).NotTo(HaveKey(controller.RawDeviceMaxSizeParamKey))
+		Expect(sc.Parameters).NotTo(HaveKey(controller.LVMVolumeGroupsParamKey))
+		Expect(sc.Parameters).NotTo(HaveKey(controller.LVMTypeParamKey))
+		Expect(*sc.AllowVolumeExpansion).To(BeFalse())
+
+		// the invalid size limits are reported, the storage class is kept
+		lsc.Spec.RawDevice.MaxSize = "10Gi"
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).To(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.FailedStatusPhase))
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.SpecInvalidReason)
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.InvalidParameterReason)
+
+		lsc.Spec.RawDevice.MaxSize = "1Ti"
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.RawDeviceMaxSizeParamKey, "1Ti"))
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Render_local_sc_in_dry_run", func() {
+		const lvgName = "test-dry-run-vg"
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{}))
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThickType, lvgSpec)
+		lsc.Annotations = map[string]string{controller.DryRunAnnotationKey: "true"}
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		// the storage class is only rendered
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status).NotTo(BeNil())
+		Expect(lsc.Status.Phase).To(BeEmpty())
+
+		rendered := &v1.StorageClass{}
+		err = yaml.Unmarshal([]byte(lsc.Status.RenderedStorageClass), rendered)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(rendered, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+
+		// the storage class is created as rendered once the annotation is removed
+		delete(lsc.Annotations, controller.DryRunAnnotationKey)
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Parameters).To(Equal(rendered.Parameters))
+		Expect(sc.AllowedTopologies).To(Equal(rendered.AllowedTopologies))
+
+		// the change made in the dry run is rendered, the storage class is not recreated
+		lsc.Annotations = map[string]string{controller.DryRunAnnotationKey: "true"}
+		lsc.Spec.ReclaimPolicy = reclaimPolicyRetain
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		err = yaml.Unmarshal([]byte(lsc.Status.RenderedStorageClass), rendered)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(*rendered.ReclaimPolicy)).To(Equal(reclaimPolicyRetain))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(*sc.ReclaimPolicy)).To(Equal(reclaimPolicyDelete))
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Create_update_and_delete_local_sc_volume_snapshot_class", func() {
+		const lvgName = "test-snapshots-vg"
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName, Thin: &slv.LocalStorageClassLVMThinPoolSpec{PoolName: "thin-pool-1"}},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{"thin-pool-1"}))
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThinType, lvgSpec)
+		lsc.Spec.Snapshots = &slv.LocalStorageClassSnapshotsSpec{Enabled: true, SizePercent: 50}
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		getVSC := func() (*unstructured.Unstructured, error) {
+			vsc := &unstructured.Unstructured{}
+			vsc.SetAPIVersion(controller.VolumeSnapshotClassGroup + "/v1")
+			vsc.SetKind(controller.VolumeSnapshotClassKind)
+			err := cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, vsc)
+			return vsc, err
+		}
+
+		reconcile := func() {
+			scList := &v1.StorageClassList{}
+			err := cl.List(ctx, scList)
+			Expect(err).NotTo(HaveOccurred())
+
+			shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shouldRequeue).To(BeFalse())
+		}
+
+		reconcile()
+
+		vsc, err := getVSC()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vsc.Object["driver"]).To(Equal(controller.LocalStorageClassProvisioner))
+		Expect(vsc.Object["deletionPolicy"]).To(Equal(controller.DefaultDeletionPolicy))
+		params, _, _ := unstructured.NestedStringMap(vsc.Object, "parameters")
+		Expect(params).To(Equal(map[string]string{controller.SnapshotSizePercentParamKey: "50"}))
+		Expect(vsc.GetOwnerReferences()).To(HaveLen(1))
+		Expect(vsc.GetOwnerReferences()[0].Kind).To(Equal(controller.LocalStorageClassKind))
+		Expect(vsc.GetOwnerReferences()[0].Name).To(Equal(nameForLocalStorageClass))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.CreatedStatusPhase))
+
+		// the snapshot settings are synced without the storage class recreation
+		lsc.Spec.Snapshots = &slv.LocalStorageClassSnapshotsSpec{Enabled: true, DeletionPolicy: "Retain", FSFreeze: true}
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		reconcile()
+
+		vsc, err = getVSC()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vsc.Object["deletionPolicy"]).To(Equal("Retain"))
+		params, _, _ = unstructured.NestedStringMap(vsc.Object, "parameters")
+		Expect(params).To(Equal(map[string]string{controller.SnapshotFSFreezeParamKey: "true"}))
+
+		lsc.Spec.Snapshots.Enabled = false
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		reconcile()
+
+		_, err = getVSC()
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		lsc.Spec.Snapshots.Enabled = true
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		reconcile()
+
+		_, err = getVSC()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		reconcile()
+
+		_, err = getVSC()
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Restrict_local_sc_by_node_selector", func() {
+		const (
+			lvg1Name   = "test-node-selector-vg1"
+			lvg2Name   = "test-node-selector-vg2"
+			node1Name  = "test-node-selector-node1"
+			node2Name  = "test-node-selector-node2"
+			node3Name  = "test-node-selector-node3"
+			groupLabel = "node.deckhouse.io/group"
+		)
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvg1Name},
+			{Name: lvg2Name},
+		}
+
+		for _, name := range []string{node1Name, node2Name, node3Name} {
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+			if name != node3Name {
+				node.Labels = map[string]string{groupLabel: "storage"}
+			}
+			err := cl.Create(ctx, node)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		lvg1 := generateLVMVolumeGroup(lvg1Name, []string{})
+		lvg1.Status.Nodes = []snc.LVMVolumeGroupNode{{Name: node1Name}}
+		err := cl.Create(ctx, lvg1)
+		Expect(err).NotTo(HaveOccurred())
+
+		lvg2 := generateLVMVolumeGroup(lvg2Name, []string{})
+		lvg2.Status.Nodes = []snc.LVMVolumeGroupNode{{Name: node2Name}}
+		err = cl.Create(ctx, lvg2)
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThickType, lvgSpec)
+		lsc.Spec.NodeSelector = map[string]string{groupLabel: "storage"}
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThickType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+		performAllowedTopologiesChecksForSC(sc, node1Name, node2Name)
+
+		// the LVMVolumeGroup on the node left the node group fails the validation
+		node2 := &corev1.Node{}
+		err = cl.Get(ctx, client.ObjectKey{Name: node2Name}, node2)
+		Expect(err).NotTo(HaveOccurred())
+		node2.Labels = nil
+		err = cl.Update(ctx, node2)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).To(HaveOccurred())
+		Expect(shouldRequeue).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lsc.Status.Phase).To(Equal(controller.FailedStatusPhase))
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.LVMVolumeGroupNotOnNodesReason)
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.DependenciesNotReadyReason)
+
+		// the storage class is restricted to the node group once the LVMVolumeGroup is removed
+		lsc.Spec.LVM.LVMVolumeGroups = lvgSpec[:1]
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performAllowedTopologiesChecksForSC(sc, node1Name)
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Create_and_update_local_sc_with_allowed_namespaces", func() {
+		const lvgName = "test-allowed-namespaces-vg"
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName},
+		}
+
+		err := cl.Create(ctx, generateLVMVolumeGroup(lvgName, []string{}))
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThickType, lvgSpec)
+		lsc.Spec.AllowedNamespaces = &slv.LocalStorageClassAllowedNamespacesSpec{
+			Names:    []string{"tenant-b", " tenant-a ", ""},
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "premium"}},
+		}
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.AllowedNamespacesParamKey, "tenant-a,tenant-b"))
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.AllowedNSSelectorParamKey, "tier=premium"))
+
+		// the storage class is recreated without the selector
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		lsc.Spec.AllowedNamespaces.Selector = nil
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Parameters).To(HaveKeyWithValue(controller.AllowedNamespacesParamKey, "tenant-a,tenant-b"))
+		Expect(sc.Parameters).NotTo(HaveKey(controller.AllowedNSSelectorParamKey))
+
+		// the invalid selector fails the validation for good
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		lsc.Spec.AllowedNamespaces.Selector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Unknown"}}}
+		err = cl.Update(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).To(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.InvalidParameterReason)
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.SpecInvalidReason)
+
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Validate_local_thin_sc_thin_pool_health", func() {
+		const (
+			lvgName      = "test-thin-pool-health-vg"
+			thinPoolName = "test-thin-pool-health-tp"
+		)
+		lvgSpec := []slv.LocalStorageClassLVG{
+			{Name: lvgName, Thin: &slv.LocalStorageClassLVMThinPoolSpec{PoolName: thinPoolName}},
+		}
+
+		lvg := generateLVMVolumeGroup(lvgName, []string{thinPoolName})
+		lvg.Status.ThinPools[0].Ready = false
+		lvg.Status.ThinPools[0].Message = "the thin pool is not active"
+		err := cl.Create(ctx, lvg)
+		Expect(err).NotTo(HaveOccurred())
+
+		lsc := generateLocalStorageClass(nameForLocalStorageClass, reclaimPolicyDelete, volumeBindingModeWFFC, controller.LVMThinType, lvgSpec)
+		lsc.Spec.LVM.Thin = &slv.LocalStorageClassLVMThinSpec{MinFreePercent: 10}
+		err = cl.Create(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		scList := &v1.StorageClassList{}
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err := controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).To(HaveOccurred())
+		Expect(shouldRequeue).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.ThinPoolNotReadyReason)
+		performConditionChecksForLSC(lsc, controller.ReadyConditionType, metav1.ConditionFalse, controller.DependenciesNotReadyReason)
+		Expect(meta.FindStatusCondition(lsc.Status.Conditions, controller.ValidatedConditionType).Message).To(ContainSubstring("the thin pool is not active"))
+
+		// the ready thin pool has less free space than the minimum
+		err = cl.Get(ctx, client.ObjectKey{Name: lvgName}, lvg)
+		Expect(err).NotTo(HaveOccurred())
+		lvg.Status.ThinPools[0].Ready = true
+		lvg.Status.ThinPools[0].UsedSize = resource.MustParse("9.5Gi")
+		err = cl.Update(ctx, lvg)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).To(HaveOccurred())
+		Expect(shouldRequeue).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		performConditionChecksForLSC(lsc, controller.ValidatedConditionType, metav1.ConditionFalse, controller.ThinPoolLowFreeSpaceReason)
+		Expect(meta.FindStatusCondition(lsc.Status.Conditions, controller.ValidatedConditionType).Message).To(ContainSubstring("used 9728Mi of 10Gi (95.0%)"))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: lvgName}, lvg)
+		Expect(err).NotTo(HaveOccurred())
+		lvg.Status.ThinPools[0].UsedSize = resource.MustParse("5Gi")
+		err = cl.Update(ctx, lvg)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		performStandartChecksForSC(sc, lvgSpec, nameForLocalStorageClass, controller.LocalStorageClassLvmType, controller.LVMThinType, reclaimPolicyDelete, volumeBindingModeWFFC, controller.DefaultFSType)
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.List(ctx, scList)
+		Expect(err).NotTo(HaveOccurred())
+
+		shouldRequeue, err = controller.RunEventReconcile(ctx, cl, log, scList, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shouldRequeue).To(BeFalse())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: nameForLocalStorageClass}, lsc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+})
+
+func generateLVMVolumeGroup(name string, thinPoolNames []string) *snc.LVMVolumeGroup {
+	lvmType := controller.LVMThickType
+
+	if len(thinPoolNames) > 0 {
+		lvmType = controller.LVMThinType
+	}
+
+	thinPoolsSpec := make([]snc.LVMVolumeGroupThinPoolSpec, 0)
+	thinPoolsStatus := make([]snc.LVMVolumeGroupThinPoolStatus, 0)
+	for i := 0; i < len(thinPoolNames); i++ {
+		thinPoolsSpec = append(thinPoolsSpec, snc.LVMVolumeGroupThinPoolSpec{
+			Name: thinPoolNames[i],
+			Size: "10Gi",
+		})
+		thinPoolsStatus = append(thinPoolsStatus, snc.LVMVolumeGroupThinPoolStatus{
+			Name:       thinPoolNames[i],
+			ActualSize: resource.MustParse("10Gi"),
+			UsedSize:   resource.MustParse("0Gi"),
+			Ready:      true,
+		})
+	}
+
+	return &snc.LVMVolumeGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: snc.LVMVolumeGroupSpec{
+			ActualVGNameOnTheNode: "vg1",
+			ThinPools:             thinPoolsSpec,
+			Type:                  lvmType,
+		},
+		Status: snc.LVMVolumeGroupStatus{
+			Nodes:     []snc.LVMVolumeGroupNode{{Name: name + "-node"}},
+			ThinPools: thinPoolsStatus,
+		},
+	}
+}
+
+//nolint:unparam
+func generateLocalStorageClass(lscName, reclaimPolicy, volumeBindingMode, lvmType string, lvgs []slv.LocalStorageClassLVG) *slv.LocalStorageClass {
+	return &slv.LocalStorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: lscName,
+		},
+		Spec: slv.LocalStorageClassSpec{
+			ReclaimPolicy:     reclaimPolicy,
+			VolumeBindingMode: volumeBindingMode,
+			LVM: &slv.LocalStorageClassLVMSpec{
+				Type:            lvmType,
+				LVMVolumeGroups: lvgs,
+			},
+		},
+	}
+}
+
+func generatePersistentVolume(name, storageClassName string, phase corev1.PersistentVolumePhase) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			StorageClassName:              storageClassName,
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimDelete,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       controller.LocalStorageClassProvisioner,
+					VolumeHandle: name,
+				},
+			},
+		},
+		Status: corev1.PersistentVolumeStatus{
+			Phase: phase,
+		},
+	}
+}
+
+//nolint:unparam
+func performStandartChecksForSC(
+	sc *v1.StorageClass,
+	lvgSpec []slv.LocalStorageClassLVG,
+	nameForLocalStorageClass,
+	lscType,
+	lvmType,
+	reclaimPolicy,
+	volumeBindingMode,
+	fsType string,
+) {
+	expectString := ""
+	for i, lvg := range lvgSpec {
+		if i != 0 {
+			expectString += "\n"
+		}
+		if lvg.Thin != nil {
+			expectString += "- name: " + lvg.Name + "\n  thin:\n    poolName: " + lvg.Thin.PoolName
+		} else {
+			expectString += "- name: " + lvg.Name
+		}
+	}
+	expectString += "\n"
+
+	expectedFSType := fsType
+	if fsType == "" {
+		expectedFSType = controller.DefaultFSType
+	}
+
+	Expect(sc).NotTo(BeNil())
+	Expect(sc.Name).To(Equal(nameForLocalStorageClass))
+	Expect(sc.Finalizers).To(HaveLen(1))
+	Expect(sc.Finalizers).To(ContainElement(controller.LocalStorageClassFinalizerName))
+
+	Expect(sc.Parameters).To(HaveLen(5))
+	Expect(sc.Parameters).To(HaveKeyWithValue(controller.TypeParamKey, lscType))
+	Expect(sc.Parameters).To(HaveKeyWithValue(controller.LVMTypeParamKey, lvmType))
+	Expect(sc.Parameters).To(HaveKeyWithValue(controller.LVMVolumeBindingModeParamKey, volumeBindingMode))
+	Expect(sc.Parameters).To(HaveKeyWithValue(controller.FSTypeParamKey, expectedFSType))
+	Expect(sc.Parameters).To(HaveKey(controller.LVMVolumeGroupsParamKey))
+	Expect(sc.Parameters[controller.LVMVolumeGroupsParamKey]).To(Equal(expectString))
+
+	Expect(sc.Provisioner).To(Equal(controller.LocalStorageClassProvisioner))
+	Expect(string(*sc.ReclaimPolicy)).To(Equal(reclaimPolicy))
+	Expect(string(*sc.VolumeBindingMode)).To(Equal(volumeBindingMode))
+	Expect(*sc.AllowVolumeExpansion).To(BeTrue())
+}
+
+func performAllowedTopologiesChecksForSC(sc *v1.StorageClass, nodes ...string) {
+	Expect(sc.AllowedTopologies).To(HaveLen(1))
+	Expect(sc.AllowedTopologies[0].MatchLabelExpressions).To(HaveLen(1))
+	Expect(sc.AllowedTopologies[0].MatchLabelExpressions[0].Key).To(Equal("topology.sds-local-volume-csi/node"))
+	Expect(sc.AllowedTopologies[0].MatchLabelExpressions[0].Values).To(Equal(nodes))
+}
+
+func performConditionChecksForLSC(lsc *slv.LocalStorageClass, conditionType string, status metav1.ConditionStatus, reason string) {
+	Expect(lsc.Status).NotTo(BeNil())
+	condition := meta.FindStatusCondition(lsc.Status.Conditions, conditionType)
+	Expect(condition).NotTo(BeNil())
+	Expect(condition.Status).To(Equal(status))
+	Expect(condition.Reason).To(Equal(reason))
+	Expect(condition.ObservedGeneration).To(Equal(lsc.Generation))
+	Expect(condition.LastTransitionTime.IsZero()).To(BeFalse())
 }
 
 func delFromSlice(slice []slv.LocalStorageClassLVG, name string) []slv.LocalStorageClassLVG {
@@ -0,0 +1,145 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	slv "github.com/deckhouse/sds-local-volume/api/v1alpha1"
+	v1 "k8s.io/api/storage/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"sds-local-volume-controller/pkg/config"
+	"sds-local-volume-controller/pkg/logger"
+)
+
+const (
+	OrphanedStorageClassCollectorName = "orphaned-storage-class-collector"
+
+	// OrphanedSinceAnnotationKey flags the storage class left without its LocalStorageClass with the time it was found
+	OrphanedSinceAnnotationKey = "storage.deckhouse.io/orphaned-since"
+)
+
+// RunOrphanedStorageClassCollector periodically collects the storage classes of the provisioner the LocalStorageClasses
+// have been deleted of bypassing the controller, e.g. with their finalizer stripped. The collector runs on the leader
+// only, like the controllers of the manager.
+func RunOrphanedStorageClassCollector(
+	mgr manager.Manager,
+	cfg config.Options,
+	log logger.Logger,
+) error {
+	cl := mgr.GetClient()
+	// the LocalStorageClasses are read bypassing the cache, so the one just created is never taken for the deleted one
+	reader := mgr.GetAPIReader()
+
+	return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		ticker := time.NewTicker(cfg.OrphanedStorageClassCleanupInterval * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			err := CollectOrphanedStorageClasses(ctx, cl, reader, log)
+			if err != nil {
+				log.Error(err, "[RunOrphanedStorageClassCollector] unable to collect the orphaned storage classes")
+			}
+		}
+	}))
+}
+
+// CollectOrphanedStorageClasses flags the storage classes of the provisioner with the controller finalizer and without
+// their LocalStorageClasses and deletes the ones flagged by the previous sweep. So the storage class is deleted at
+// least one sweep interval after it has been orphaned, and the flag is removed if its LocalStorageClass is created
+// again meanwhile.
+func CollectOrphanedStorageClasses(ctx context.Context, cl client.Client, reader client.Reader, log logger.Logger) error {
+	scList := &v1.StorageClassList{}
+	err := cl.List(ctx, scList)
+	if err != nil {
+		return fmt.Errorf("unable to list the storage classes: %w", err)
+	}
+
+	var errs error
+	for i := range scList.Items {
+		sc := &scList.Items[i]
+		if !isManagedStorageClass(sc) {
+			continue
+		}
+
+		lsc := &slv.LocalStorageClass{}
+		err = reader.Get(ctx, client.ObjectKey{Name: sc.Name}, lsc)
+		if err == nil {
+			if _, flagged := sc.Annotations[OrphanedSinceAnnotationKey]; flagged {
+				log.Info(fmt.Sprintf("[CollectOrphanedStorageClasses] the LocalStorageClass of the storage class %s has appeared, the orphaned flag will be removed", sc.Name))
+				err = patchWithRetry(ctx, cl, sc, false, func(obj client.Object) {
+					annotations := obj.GetAnnotations()
+					delete(annotations, OrphanedSinceAnnotationKey)
+					obj.SetAnnotations(annotations)
+				})
+				if err != nil {
+					errs = errors.Join(errs, fmt.Errorf("unable to remove the orphaned flag of the storage class %s: %w", sc.Name, err))
+				}
+			}
+			continue
+		}
+		if !errors2.IsNotFound(err) {
+			errs = errors.Join(errs, fmt.Errorf("unable to get the LocalStorageClass of the storage class %s: %w", sc.Name, err))
+			continue
+		}
+
+		if _, flagged := sc.Annotations[OrphanedSinceAnnotationKey]; !flagged {
+			log.Warning(fmt.Sprintf("[CollectOrphanedStorageClasses] the storage class %s has no LocalStorageClass. It is flagged as orphaned and will be deleted by the next sweep", sc.Name))
+			err = patchWithRetry(ctx, cl, sc, false, func(obj client.Object) {
+				annotations := obj.GetAnnotations()
+				if annotations == nil {
+					annotations = make(map[string]string, 1)
+				}
+				annotations[OrphanedSinceAnnotationKey] = time.Now().UTC().Format(time.RFC3339)
+				obj.SetAnnotations(annotations)
+			})
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("unable to flag the storage class %s as orphaned: %w", sc.Name, err))
+			}
+			continue
+		}
+
+		log.Warning(fmt.Sprintf("[CollectOrphanedStorageClasses] the storage class %s orphaned since %s will be deleted", sc.Name, sc.Annotations[OrphanedSinceAnnotationKey]))
+		err = deleteStorageClass(ctx, cl, sc)
+		if err != nil && !errors2.IsNotFound(err) {
+			errs = errors.Join(errs, fmt.Errorf("unable to delete the orphaned storage class %s: %w", sc.Name, err))
+			continue
+		}
+		log.Info(fmt.Sprintf("[CollectOrphanedStorageClasses] successfully deleted the orphaned storage class %s", sc.Name))
+	}
+
+	return errs
+}
+
+// isManagedStorageClass reports if the storage class has been created by the controller for a LocalStorageClass.
+func isManagedStorageClass(sc *v1.StorageClass) bool {
+	return sc.Provisioner == LocalStorageClassProvisioner &&
+		(controllerutil.ContainsFinalizer(sc, LocalStorageClassFinalizerName) || controllerutil.ContainsFinalizer(sc, LocalStorageClassFinalizerNameOld))
+}
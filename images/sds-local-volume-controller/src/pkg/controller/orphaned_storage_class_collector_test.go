@@ -0,0 +1,131 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+
+	slv "github.com/deckhouse/sds-local-volume/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-controller/pkg/controller"
+	"sds-local-volume-controller/pkg/logger"
+)
+
+var _ = Describe(controller.OrphanedStorageClassCollectorName, func() {
+	const (
+		orphanedSCName  = "orphaned-storage-class"
+		managedSCName   = "managed-storage-class"
+		unmanagedSCName = "unmanaged-storage-class"
+	)
+
+	var (
+		ctx = context.Background()
+		cl  = NewFakeClient()
+		log = logger.Logger{}
+	)
+
+	generateStorageClass := func(name, provisioner string, finalizers ...string) *v1.StorageClass {
+		return &v1.StorageClass{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       name,
+				Finalizers: finalizers,
+			},
+			Provisioner: provisioner,
+		}
+	}
+
+	It("Flags_and_deletes_orphaned_sc", func() {
+		err := cl.Create(ctx, generateStorageClass(orphanedSCName, controller.LocalStorageClassProvisioner, controller.LocalStorageClassFinalizerName))
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.Create(ctx, generateStorageClass(managedSCName, controller.LocalStorageClassProvisioner, controller.LocalStorageClassFinalizerName))
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.Create(ctx, generateStorageClass(unmanagedSCName, controller.LocalStorageClassProvisioner))
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.Create(ctx, &slv.LocalStorageClass{ObjectMeta: metav1.ObjectMeta{Name: managedSCName}})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = controller.CollectOrphanedStorageClasses(ctx, cl, cl, log)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the orphaned storage class is only flagged by the first sweep
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: orphanedSCName}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Annotations).To(HaveKey(controller.OrphanedSinceAnnotationKey))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: managedSCName}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Annotations).NotTo(HaveKey(controller.OrphanedSinceAnnotationKey))
+
+		err = cl.Get(ctx, client.ObjectKey{Name: unmanagedSCName}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Annotations).NotTo(HaveKey(controller.OrphanedSinceAnnotationKey))
+
+		err = controller.CollectOrphanedStorageClasses(ctx, cl, cl, log)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: orphanedSCName}, sc)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: managedSCName}, sc)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the storage class without the controller finalizer is not the one of the controller
+		err = cl.Get(ctx, client.ObjectKey{Name: unmanagedSCName}, sc)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Unflags_sc_of_recreated_lsc", func() {
+		lsc := &slv.LocalStorageClass{}
+		err := cl.Get(ctx, client.ObjectKey{Name: managedSCName}, lsc)
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.Delete(ctx, lsc)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = controller.CollectOrphanedStorageClasses(ctx, cl, cl, log)
+		Expect(err).NotTo(HaveOccurred())
+
+		sc := &v1.StorageClass{}
+		err = cl.Get(ctx, client.ObjectKey{Name: managedSCName}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Annotations).To(HaveKey(controller.OrphanedSinceAnnotationKey))
+
+		err = cl.Create(ctx, &slv.LocalStorageClass{ObjectMeta: metav1.ObjectMeta{Name: managedSCName}})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = controller.CollectOrphanedStorageClasses(ctx, cl, cl, log)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cl.Get(ctx, client.ObjectKey{Name: managedSCName}, sc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sc.Annotations).NotTo(HaveKey(controller.OrphanedSinceAnnotationKey))
+		Expect(sc.Finalizers).To(ContainElement(controller.LocalStorageClassFinalizerName))
+
+		err = cl.Delete(ctx, sc)
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.Delete(ctx, &slv.LocalStorageClass{ObjectMeta: metav1.ObjectMeta{Name: managedSCName}})
+		Expect(err).NotTo(HaveOccurred())
+		err = cl.Delete(ctx, generateStorageClass(unmanagedSCName, controller.LocalStorageClassProvisioner))
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
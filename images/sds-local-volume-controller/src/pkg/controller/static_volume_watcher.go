@@ -0,0 +1,221 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/staticvolume"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"sds-local-volume-controller/pkg/config"
+	"sds-local-volume-controller/pkg/logger"
+)
+
+const (
+	StaticVolumeWatcherCtrlName = "static-volume-watcher-controller"
+
+	// the same as in the CSI driver
+	csiFinalizerName          = "storage.deckhouse.io/sds-local-volume-csi"
+	csiNodeTopologyKey        = "topology.sds-local-volume-csi/node"
+	thinPoolNameAttributeKey  = "thinPoolName"
+	onDeleteAnnotationKey     = LocalStorageClassProvisioner + "/on-delete"
+	onDeletePolicyRetain      = "retain"
+	staticVolumeRequeuePeriod = 30 * time.Second
+)
+
+// RunStaticVolumeWatcherController adopts the existing LVs of the statically provisioned PVs. Such a PV has
+// a volumeHandle in the <vg name>/<lv name> format, and the controller creates an LVMLogicalVolume for the LV,
+// so the volume might be expanded and deleted by the CSI driver like a dynamically provisioned one.
+func RunStaticVolumeWatcherController(
+	mgr manager.Manager,
+	_ config.Options,
+	log logger.Logger,
+) (controller.Controller, error) {
+	cl := mgr.GetClient()
+
+	c, err := controller.New(StaticVolumeWatcherCtrlName, mgr, controller.Options{
+		Reconciler: reconcile.Func(func(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+			pv := &v1.PersistentVolume{}
+			err := cl.Get(ctx, request.NamespacedName, pv)
+			if err != nil {
+				if errors2.IsNotFound(err) {
+					return reconcile.Result{}, nil
+				}
+				log.Error(err, fmt.Sprintf("[StaticVolumeReconciler] unable to get the PersistentVolume %s", request.Name))
+				return reconcile.Result{}, err
+			}
+
+			if !isStaticPV(pv) {
+				return reconcile.Result{}, nil
+			}
+
+			log.Debug(fmt.Sprintf("[StaticVolumeReconciler] starts the adoption of the static PersistentVolume %s", pv.Name))
+			err = adoptStaticVolume(ctx, cl, log, pv)
+			if err != nil {
+				log.Error(err, fmt.Sprintf("[StaticVolumeReconciler] unable to adopt the static PersistentVolume %s", pv.Name))
+				return reconcile.Result{RequeueAfter: staticVolumeRequeuePeriod}, nil
+			}
+
+			return reconcile.Result{}, nil
+		}),
+	})
+	if err != nil {
+		log.Error(err, "[RunStaticVolumeWatcherController] unable to create controller")
+		return nil, err
+	}
+
+	err = c.Watch(source.Kind(mgr.GetCache(), &v1.PersistentVolume{}, &handler.TypedEnqueueRequestForObject[*v1.PersistentVolume]{}))
+	if err != nil {
+		log.Error(err, "[RunStaticVolumeWatcherController] unable to watch the events")
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func isStaticPV(pv *v1.PersistentVolume) bool {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != LocalStorageClassProvisioner || pv.DeletionTimestamp != nil {
+		return false
+	}
+
+	_, _, ok := staticvolume.ParseVolumeHandle(pv.Spec.CSI.VolumeHandle)
+	return ok
+}
+
+// getPVNodeName returns the node the PV is bound to by its node affinity.
+func getPVNodeName(pv *v1.PersistentVolume) (string, error) {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return "", fmt.Errorf("the PersistentVolume %s has no required node affinity", pv.Name)
+	}
+
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			if (expr.Key == csiNodeTopologyKey || expr.Key == v1.LabelHostname) && expr.Operator == v1.NodeSelectorOpIn && len(expr.Values) == 1 {
+				return expr.Values[0], nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("the node affinity of the PersistentVolume %s does not select a single node by the %s or %s key", pv.Name, csiNodeTopologyKey, v1.LabelHostname)
+}
+
+// adoptStaticVolume creates the LVMLogicalVolume for the LV of the static PV if there is none yet. The existing LV is
+// kept as is by the agent, and the LVMLogicalVolume retains it on the volume deletion, so no data is lost.
+func adoptStaticVolume(ctx context.Context, cl client.Client, log logger.Logger, pv *v1.PersistentVolume) error {
+	vgName, lvName, _ := staticvolume.ParseVolumeHandle(pv.Spec.CSI.VolumeHandle)
+	llvName := staticvolume.LLVName(vgName, lvName)
+
+	llv := &snc.LVMLogicalVolume{}
+	err := cl.Get(ctx, client.ObjectKey{Name: llvName}, llv)
+	if err == nil {
+		log.Debug(fmt.Sprintf("[adoptStaticVolume] the LV %s/%s of the PersistentVolume %s has been already adopted by the LVMLogicalVolume %s", vgName, lvName, pv.Name, llvName))
+		return ensureVolumeHandleAnnotation(ctx, cl, llv, pv.Spec.CSI.VolumeHandle)
+	}
+	if !errors2.IsNotFound(err) {
+		return err
+	}
+
+	nodeName, err := getPVNodeName(pv)
+	if err != nil {
+		return err
+	}
+
+	lvgs := &snc.LVMVolumeGroupList{}
+	err = cl.List(ctx, lvgs)
+	if err != nil {
+		return err
+	}
+
+	var lvg *snc.LVMVolumeGroup
+	for i := range lvgs.Items {
+		if lvgs.Items[i].Spec.ActualVGNameOnTheNode == vgName && lvgs.Items[i].Spec.Local.NodeName == nodeName {
+			lvg = &lvgs.Items[i]
+			break
+		}
+	}
+	if lvg == nil {
+		return fmt.Errorf("no LVMVolumeGroup found for the VG %s on the node %s", vgName, nodeName)
+	}
+
+	capacity, ok := pv.Spec.Capacity[v1.ResourceStorage]
+	if !ok {
+		return fmt.Errorf("the PersistentVolume %s has no storage capacity", pv.Name)
+	}
+
+	spec := snc.LVMLogicalVolumeSpec{
+		ActualLVNameOnTheNode: lvName,
+		Type:                  LVMThickType,
+		Size:                  capacity.String(),
+		LVMVolumeGroupName:    lvg.Name,
+	}
+	if pv.Spec.CSI.VolumeAttributes[LVMTypeParamKey] == LVMThinType {
+		spec.Type = LVMThinType
+		spec.Thin = &snc.LVMLogicalVolumeThinSpec{PoolName: pv.Spec.CSI.VolumeAttributes[thinPoolNameAttributeKey]}
+		if spec.Thin.PoolName == "" {
+			return fmt.Errorf("the PersistentVolume %s of the Thin type has no %s volume attribute", pv.Name, thinPoolNameAttributeKey)
+		}
+	}
+
+	llv = &snc.LVMLogicalVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: llvName,
+			Annotations: map[string]string{
+				onDeleteAnnotationKey:                  onDeletePolicyRetain,
+				staticvolume.AdoptedPVAnnotationKey:    pv.Name,
+				staticvolume.VolumeHandleAnnotationKey: pv.Spec.CSI.VolumeHandle,
+			},
+			Finalizers: []string{csiFinalizerName},
+		},
+		Spec: spec,
+	}
+
+	err = cl.Create(ctx, llv)
+	if err != nil && !errors2.IsAlreadyExists(err) {
+		return err
+	}
+
+	log.Info(fmt.Sprintf("[adoptStaticVolume] the LV %s/%s of the PersistentVolume %s is adopted by the LVMLogicalVolume %s", vgName, lvName, pv.Name, llvName))
+	return nil
+}
+
+// ensureVolumeHandleAnnotation sets the volumeHandle of the PV on the LVMLogicalVolume adopted before the annotation
+// had been introduced, so the CSI driver lists the volume by the handle.
+func ensureVolumeHandleAnnotation(ctx context.Context, cl client.Client, llv *snc.LVMLogicalVolume, volumeHandle string) error {
+	if llv.Annotations[staticvolume.VolumeHandleAnnotationKey] == volumeHandle {
+		return nil
+	}
+
+	patch := client.MergeFrom(llv.DeepCopy())
+	if llv.Annotations == nil {
+		llv.Annotations = make(map[string]string, 1)
+	}
+	llv.Annotations[staticvolume.VolumeHandleAnnotationKey] = volumeHandle
+
+	return cl.Patch(ctx, llv, patch)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/staticvolume"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-controller/pkg/logger"
+)
+
+func TestStaticVolumeWatcher(t *testing.T) {
+	cl := NewFakeClient()
+	ctx := context.Background()
+	log := logger.Logger{}
+
+	newStaticPV := func(name, volumeHandle, node string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{
+				Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")},
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{
+						Driver:       LocalStorageClassProvisioner,
+						VolumeHandle: volumeHandle,
+					},
+				},
+				NodeAffinity: &v1.VolumeNodeAffinity{
+					Required: &v1.NodeSelector{
+						NodeSelectorTerms: []v1.NodeSelectorTerm{{
+							MatchExpressions: []v1.NodeSelectorRequirement{{
+								Key:      v1.LabelHostname,
+								Operator: v1.NodeSelectorOpIn,
+								Values:   []string{node},
+							}},
+						}},
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("isStaticPV", func(t *testing.T) {
+		assert.True(t, isStaticPV(newStaticPV("pv", "data/lv", "node-1")))
+		assert.False(t, isStaticPV(newStaticPV("pv", "pvc-1", "node-1")))
+
+		pv := newStaticPV("pv", "data/lv", "node-1")
+		pv.Spec.CSI.Driver = "other.csi.example.com"
+		assert.False(t, isStaticPV(pv))
+	})
+
+	t.Run("adoptStaticVolume_creates_llv", func(t *testing.T) {
+		lvg := &snc.LVMVolumeGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "lvg-1"},
+			Spec: snc.LVMVolumeGroupSpec{
+				ActualVGNameOnTheNode: "data",
+				Local:                 snc.LVMVolumeGroupLocalSpec{NodeName: "node-1"},
+			},
+		}
+		err := cl.Create(ctx, lvg)
+		if err != nil {
+			t.Error(err)
+		}
+
+		pv := newStaticPV("static-pv", "data/lv_01", "node-1")
+		err = adoptStaticVolume(ctx, cl, log, pv)
+		if assert.NoError(t, err) {
+			llv := &snc.LVMLogicalVolume{}
+			err = cl.Get(ctx, client.ObjectKey{Name: staticvolume.LLVName("data", "lv_01")}, llv)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "lv_01", llv.Spec.ActualLVNameOnTheNode)
+				assert.Equal(t, "lvg-1", llv.Spec.LVMVolumeGroupName)
+				assert.Equal(t, LVMThickType, llv.Spec.Type)
+				assert.Equal(t, "10Gi", llv.Spec.Size)
+				assert.Equal(t, onDeletePolicyRetain, llv.Annotations[onDeleteAnnotationKey])
+				assert.Equal(t, "data/lv_01", llv.Annotations[staticvolume.VolumeHandleAnnotationKey])
+			}
+		}
+
+		// the adoption is idempotent
+		assert.NoError(t, adoptStaticVolume(ctx, cl, log, pv))
+	})
+
+	t.Run("adoptStaticVolume_sets_volume_handle", func(t *testing.T) {
+		llv := &snc.LVMLogicalVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        staticvolume.LLVName("data", "lv_03"),
+				Annotations: map[string]string{staticvolume.AdoptedPVAnnotationKey: "static-pv-3"},
+			},
+		}
+		err := cl.Create(ctx, llv)
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = adoptStaticVolume(ctx, cl, log, newStaticPV("static-pv-3", "data/lv_03", "node-1"))
+		if assert.NoError(t, err) {
+			err = cl.Get(ctx, client.ObjectKeyFromObject(llv), llv)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "data/lv_03", llv.Annotations[staticvolume.VolumeHandleAnnotationKey])
+			}
+		}
+	})
+
+	t.Run("adoptStaticVolume_no_lvg", func(t *testing.T) {
+		err := adoptStaticVolume(ctx, cl, log, newStaticPV("static-pv-2", "data/lv_02", "node-2"))
+		assert.Error(t, err)
+	})
+}
@@ -33,12 +33,14 @@ import (
 	apiruntime "k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"sds-local-volume-csi/config"
 	"sds-local-volume-csi/driver"
 	"sds-local-volume-csi/pkg/kubutils"
 	"sds-local-volume-csi/pkg/logger"
+	"sds-local-volume-csi/pkg/utils"
 )
 
 var (
@@ -98,6 +100,23 @@ func main() {
 		Scheme: scheme,
 	})
 
+	// the informers are created lazily, so only the resources the driver actually waits for are watched
+	informerCache, err := cache.New(kConfig, cache.Options{
+		Scheme: scheme,
+	})
+	if err != nil {
+		log.Error(err, "[main] unable to create the informer cache")
+		os.Exit(1)
+	}
+	// the cache outlives the driver, so the in-flight calls are able to finish while the driver drains on the shutdown
+	cacheCtx, cancelCache := context.WithCancel(context.Background())
+	defer cancelCache()
+	go func() {
+		if err := informerCache.Start(cacheCtx); err != nil {
+			log.Error(err, "[main] unable to start the informer cache")
+		}
+	}()
+
 	http.HandleFunc("/healthz", healthHandler)
 	http.HandleFunc("/readyz", healthHandler)
 	go func() {
@@ -107,7 +126,35 @@ func main() {
 		}
 	}()
 
-	drv, err := driver.NewDriver(cfgParams.CsiAddress, cfgParams.DriverName, cfgParams.Address, &cfgParams.NodeName, log, cl)
+	// the leases serialize the operations on the same volume between the controller plugin replicas
+	var volumeLeases *utils.VolumeLeases
+	if cfgParams.VolumeLeaseDuration > 0 {
+		volumeLeases = utils.NewVolumeLeases(cl, log, cfgParams.PodNamespace, cfgParams.PodName, cfgParams.VolumeLeaseDuration)
+	}
+
+	drv, err := driver.NewDriver(driver.DriverOptions{
+		CSIAddress:                    cfgParams.CsiAddress,
+		DriverName:                    cfgParams.DriverName,
+		Address:                       cfgParams.Address,
+		NodeName:                      cfgParams.NodeName,
+		StaleLVGPolicy:                cfgParams.StaleLVGPolicy,
+		NodeSelectionStrategy:         cfgParams.NodeSelectionStrategy,
+		TopologyKeys:                  cfgParams.TopologyKeys,
+		WaitOptions:                   cfgParams.WaitOptions,
+		MaxConcurrentOperations:       cfgParams.MaxConcurrentOperations,
+		ShutdownTimeout:               cfgParams.ShutdownTimeout,
+		EncryptionRotationInterval:    cfgParams.EncryptionRotationInterval,
+		FsckPolicy:                    cfgParams.FsckPolicy,
+		FstrimInterval:                cfgParams.FstrimInterval,
+		MaxVolumesPerNode:             cfgParams.MaxVolumesPerNode,
+		DeviceWaitTimeout:             cfgParams.DeviceWaitTimeout,
+		UnmountTimeout:                cfgParams.UnmountTimeout,
+		UnmountEscalation:             cfgParams.UnmountEscalation,
+		FSFreezeTimeout:               cfgParams.FSFreezeTimeout,
+		MaxConcurrentFormats:          cfgParams.MaxConcurrentFormats,
+		CgroupRoot:                    cfgParams.CgroupRoot,
+		OrphanedMountsCleanupInterval: cfgParams.OrphanedMountsCleanupInterval,
+	}, log, cl, informerCache, volumeLeases)
 	if err != nil {
 		log.Error(err, "[main] create NewDriver")
 	}
@@ -20,26 +20,57 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/stalelvg"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	"sds-local-volume-csi/driver"
+	"sds-local-volume-csi/internal"
 	"sds-local-volume-csi/pkg/logger"
+	"sds-local-volume-csi/pkg/utils"
 )
 
 const (
 	NodeName                             = "KUBE_NODE_NAME"
 	LogLevel                             = "LOG_LEVEL"
+	PodName                              = "POD_NAME"
+	PodNamespace                         = "POD_NAMESPACE"
 	DefaultHealthProbeBindAddressEnvName = "HEALTH_PROBE_BIND_ADDRESS"
 	DefaultHealthProbeBindAddress        = ":8081"
 )
 
 type Options struct {
-	NodeName               string
-	Version                string
-	Loglevel               logger.Verbosity
-	HealthProbeBindAddress string
-	CsiAddress             string
-	DriverName             string
-	Address                string
+	NodeName                string
+	Version                 string
+	Loglevel                logger.Verbosity
+	HealthProbeBindAddress  string
+	CsiAddress              string
+	DriverName              string
+	Address                 string
+	StaleLVGPolicy          stalelvg.Policy
+	NodeSelectionStrategy   string
+	TopologyKeys            []string
+	WaitOptions             utils.WaitOptions
+	VolumeLeaseDuration     time.Duration
+	PodName                 string
+	PodNamespace            string
+	MaxConcurrentOperations int
+	ShutdownTimeout         time.Duration
+
+	EncryptionRotationInterval time.Duration
+	FsckPolicy                 string
+	FstrimInterval             time.Duration
+	MaxVolumesPerNode          int64
+	DeviceWaitTimeout          time.Duration
+	UnmountTimeout             time.Duration
+	UnmountEscalation          string
+	FSFreezeTimeout            time.Duration
+	MaxConcurrentFormats       int
+	CgroupRoot                 string
+
+	OrphanedMountsCleanupInterval time.Duration
 }
 
 func NewConfig() (*Options, error) {
@@ -68,11 +99,134 @@ func NewConfig() (*Options, error) {
 	fl.StringVar(&opts.CsiAddress, "csi-address", "unix:///var/lib/kubelet/plugins/"+driver.DefaultDriverName+"/csi.sock", "CSI address")
 	fl.StringVar(&opts.DriverName, "driver-name", driver.DefaultDriverName, "Name for the driver")
 	fl.StringVar(&opts.Address, "address", driver.DefaultAddress, "Address to serve on")
+	fl.DurationVar(&opts.StaleLVGPolicy.Threshold, "stale-lvg-threshold", 0, "Age of the LVMVolumeGroup status after which its capacity is considered stale, 0 disables the check")
+	fl.StringVar(&opts.StaleLVGPolicy.Action, "stale-lvg-policy", stalelvg.PolicySkip, "How to treat LVMVolumeGroups with stale capacity: Skip or SafetyMargin")
+	fl.IntVar(&opts.StaleLVGPolicy.SafetyMarginPercent, "stale-lvg-safety-margin-percent", 20, "Percent of the last known free space to hold back for LVMVolumeGroups with stale capacity (SafetyMargin policy)")
+	fl.StringVar(&opts.NodeSelectionStrategy, "node-selection-strategy", internal.NodeSelectionStrategyMostFree, "Default strategy of the node selection for the Immediate binding mode: most-free, least-free, round-robin or random")
+
+	fl.Func("topology-keys", "Comma-separated node label keys (e.g. topology.kubernetes.io/zone) reported in the volume topology in addition to the node one", func(val string) error {
+		for _, key := range strings.Split(val, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				opts.TopologyKeys = append(opts.TopologyKeys, key)
+			}
+		}
+		return nil
+	})
+
+	opts.WaitOptions.ResizeDelta = resource.MustParse(internal.ResizeDelta)
+	fl.Func("resize-delta", "Tolerance of the LV size comparing to the requested one (default "+internal.ResizeDelta+")", func(val string) error {
+		delta, err := resource.ParseQuantity(val)
+		if err != nil {
+			return err
+		}
+		opts.WaitOptions.ResizeDelta = delta
+		return nil
+	})
+	fl.DurationVar(&opts.WaitOptions.Timeout, "wait-action-timeout", internal.WaitActionTimeout, "Time to wait for the LV creation, expansion and deletion on the node. The creation and expansion are also bounded by the sidecars' --timeout")
+
+	fl.DurationVar(&opts.VolumeLeaseDuration, "volume-lease-duration", 0, "Duration of the per-volume leases serializing the controller operations between the replicas, 0 disables the leases")
+
+	fl.IntVar(&opts.MaxConcurrentOperations, "max-concurrent-operations", 0, "Maximum number of the CSI calls processed at the same time, 0 means no limit")
+
+	fl.DurationVar(&opts.ShutdownTimeout, "shutdown-timeout", internal.ShutdownTimeout, "Time given to the in-flight CSI calls to finish on the shutdown before they are cancelled and rolled back")
+
+	fl.DurationVar(&opts.EncryptionRotationInterval, "encryption-rotation-interval", 0, "Period of the checks for the requested encryption key rotations of the node's volumes, 0 disables the rotation. Set for the node plugin only")
+
+	fl.StringVar(&opts.FsckPolicy, "fsck-policy", internal.FsckPolicyNone, "Default check of the formatted volumes before they are mounted to the node: none, check or repair. Might be overridden per StorageClass")
+
+	fl.DurationVar(&opts.FstrimInterval, "fstrim-interval", 0, "Period of the fstrim of the node's volumes with the fstrim discard policy, 0 disables it. Set for the node plugin only")
+
+	fl.Int64Var(&opts.MaxVolumesPerNode, "max-volumes-per-node", 0, "Maximum number of the volumes of the node, 0 derives it from the LVM metadata limits of the node's VGs. Set for the node plugin only")
+
+	fl.DurationVar(&opts.DeviceWaitTimeout, "device-wait-timeout", internal.DeviceWaitTimeout, "Time to wait for the device of the volume to appear on the node before the stage is retried. Set for the node plugin only")
+
+	fl.DurationVar(&opts.UnmountTimeout, "unmount-timeout", 0, "Time to retry the unmount of the staged volume before it is escalated, 0 disables the escalation. Set for the node plugin only")
+	fl.StringVar(&opts.UnmountEscalation, "unmount-escalation", internal.UnmountEscalationLazy, "Escalation of the unmount of the staged volume not finished in time: lazy or force")
+
+	fl.DurationVar(&opts.FSFreezeTimeout, "fsfreeze-timeout", 0, "Longest time a filesystem is kept frozen for a snapshot, after it the filesystem is thawed anyway. 0 disables the freeze. Set for the node plugin only")
+
+	fl.IntVar(&opts.MaxConcurrentFormats, "max-concurrent-formats", 0, "Maximum number of the filesystem creations and checks run on the node at the same time, 0 means no limit. Set for the node plugin only")
+
+	fl.StringVar(&opts.CgroupRoot, "cgroup-root", "/sys/fs/cgroup", "Path the cgroup v2 hierarchy of the node is mounted at, the IO limits of the volumes are set in the cgroups of their Pods. Set for the node plugin only")
+
+	fl.DurationVar(&opts.OrphanedMountsCleanupInterval, "orphaned-mounts-cleanup-interval", 0, "Period of the cleanup of the staging mounts left on the node for the deleted volumes, 0 disables it. Set for the node plugin only")
 
 	err := fl.Parse(os.Args[1:])
 	if err != nil {
 		return &opts, err
 	}
 
+	if err = opts.StaleLVGPolicy.Validate(); err != nil {
+		return &opts, fmt.Errorf("[NewConfig] invalid stale LVMVolumeGroup policy: %w", err)
+	}
+
+	if err = utils.ValidateNodeSelectionStrategy(opts.NodeSelectionStrategy); err != nil {
+		return &opts, fmt.Errorf("[NewConfig] invalid node selection strategy: %w", err)
+	}
+
+	if err = opts.WaitOptions.Validate(); err != nil {
+		return &opts, fmt.Errorf("[NewConfig] invalid wait options: %w", err)
+	}
+
+	if opts.ShutdownTimeout < 0 {
+		return &opts, fmt.Errorf("[NewConfig] shutdown timeout must not be negative, got %s", opts.ShutdownTimeout)
+	}
+
+	if err = utils.ValidateFsckPolicy(opts.FsckPolicy); err != nil {
+		return &opts, fmt.Errorf("[NewConfig] invalid fsck policy: %w", err)
+	}
+
+	if opts.MaxConcurrentFormats < 0 {
+		return &opts, fmt.Errorf("[NewConfig] max concurrent formats must not be negative, got %d", opts.MaxConcurrentFormats)
+	}
+
+	if opts.FSFreezeTimeout < 0 {
+		return &opts, fmt.Errorf("[NewConfig] fsfreeze timeout must not be negative, got %s", opts.FSFreezeTimeout)
+	}
+
+	if opts.UnmountTimeout < 0 {
+		return &opts, fmt.Errorf("[NewConfig] unmount timeout must not be negative, got %s", opts.UnmountTimeout)
+	}
+
+	if err = utils.ValidateUnmountEscalation(opts.UnmountEscalation); err != nil {
+		return &opts, fmt.Errorf("[NewConfig] invalid unmount escalation: %w", err)
+	}
+
+	if opts.DeviceWaitTimeout <= 0 {
+		return &opts, fmt.Errorf("[NewConfig] device wait timeout must be positive, got %s", opts.DeviceWaitTimeout)
+	}
+
+	if opts.MaxVolumesPerNode < 0 {
+		return &opts, fmt.Errorf("[NewConfig] max volumes per node must not be negative, got %d", opts.MaxVolumesPerNode)
+	}
+
+	if opts.FstrimInterval < 0 {
+		return &opts, fmt.Errorf("[NewConfig] fstrim interval must not be negative, got %s", opts.FstrimInterval)
+	}
+
+	if opts.OrphanedMountsCleanupInterval < 0 {
+		return &opts, fmt.Errorf("[NewConfig] orphaned mounts cleanup interval must not be negative, got %s", opts.OrphanedMountsCleanupInterval)
+	}
+
+	if opts.EncryptionRotationInterval < 0 {
+		return &opts, fmt.Errorf("[NewConfig] encryption rotation interval must not be negative, got %s", opts.EncryptionRotationInterval)
+	}
+
+	if opts.MaxConcurrentOperations < 0 {
+		return &opts, fmt.Errorf("[NewConfig] max concurrent operations must not be negative, got %d", opts.MaxConcurrentOperations)
+	}
+
+	if opts.VolumeLeaseDuration > 0 {
+		opts.PodName = os.Getenv(PodName)
+		opts.PodNamespace = os.Getenv(PodNamespace)
+		if opts.PodName == "" || opts.PodNamespace == "" {
+			return &opts, fmt.Errorf("[NewConfig] %s and %s env variables are required for the volume leases", PodName, PodNamespace)
+		}
+	}
+
+	if err = utils.ValidateTopologyKeys(opts.TopologyKeys); err != nil {
+		return &opts, fmt.Errorf("[NewConfig] invalid topology keys: %w", err)
+	}
+
 	return &opts, nil
 }
@@ -20,16 +20,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/staticvolume"
 	"github.com/deckhouse/sds-node-configurator/api/v1alpha1"
 	"github.com/golang/protobuf/ptypes/timestamp"
-	"github.com/google/uuid"
+	"github.com/golang/protobuf/ptypes/wrappers"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"sds-local-volume-csi/internal"
 	"sds-local-volume-csi/pkg/utils"
@@ -40,14 +47,24 @@ const (
 	sourceVolumeKindVolume   = "LVMLogicalVolume"
 )
 
+// supportedAccessModes are the access modes a local volume might be used with.
+var supportedAccessModes = map[csi.VolumeCapability_AccessMode_Mode]struct{}{
+	csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER:      {},
+	csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY: {},
+	// with the SINGLE_NODE_MULTI_WRITER capability the ReadWriteOncePod volumes are requested with the SINGLE_NODE_SINGLE_WRITER
+	// mode, which the node plugin enforces, and the ReadWriteOnce ones with the SINGLE_NODE_MULTI_WRITER mode
+	csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER: {},
+	csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER:  {},
+}
+
 func (d *Driver) CreateVolume(ctx context.Context, request *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
-	traceID := uuid.New().String()
+	traceID := traceIDFromContext(ctx)
 
 	d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s] ========== CreateVolume ============", traceID))
 	d.log.Trace(request.String())
 	d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s] ========== CreateVolume ============", traceID))
 
-	if request.Parameters[internal.TypeKey] != internal.Lvm {
+	if t := request.Parameters[internal.TypeKey]; t != internal.Lvm && t != internal.RawType {
 		return nil, status.Error(codes.InvalidArgument, "Unsupported Storage Class type")
 	}
 
@@ -59,6 +76,25 @@ func (d *Driver) CreateVolume(ctx context.Context, request *csi.CreateVolumeRequ
 		return nil, status.Error(codes.InvalidArgument, "Volume Capability cannot de empty")
 	}
 
+	if deadline, ok := ctx.Deadline(); ok {
+		d.log.Debug(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] the request deadline is in %s", traceID, volumeID, time.Until(deadline)))
+	}
+
+	release, err := d.lockVolume(ctx, traceID, "CreateVolume", volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	err = d.checkAllowedNamespace(ctx, traceID, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Parameters[internal.TypeKey] == internal.RawType {
+		return d.createRawDeviceVolume(ctx, traceID, request)
+	}
+
 	BindingMode := request.Parameters[internal.BindingModeKey]
 	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] storage class BindingMode: %s", traceID, volumeID, BindingMode))
 
@@ -77,6 +113,110 @@ func (d *Driver) CreateVolume(ctx context.Context, request *csi.CreateVolumeRequ
 		return nil, status.Errorf(codes.Internal, "error during GetStorageClassLVGs")
 	}
 
+	thinPoolName, err := utils.GetRequestedThinPool(ctx, d.cl, request.Parameters, request.MutableParameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetRequestedThinPool", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error getting the requested thin pool: %s", err.Error())
+	}
+	if thinPoolName != "" {
+		if LvmType != internal.LVMTypeThin {
+			return nil, status.Errorf(codes.InvalidArgument, "%s might be requested only for %s volumes", internal.ThinPoolKey, internal.LVMTypeThin)
+		}
+
+		storageClassLVGs, storageClassLVGParametersMap = utils.OverrideThinPool(storageClassLVGs, thinPoolName)
+		if len(storageClassLVGs) == 0 {
+			d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] no LVMVolumeGroup of the storage class has the requested thin pool %s", traceID, volumeID, thinPoolName))
+			return nil, status.Errorf(codes.InvalidArgument, "no LVMVolumeGroup of the storage class has the requested thin pool %s", thinPoolName)
+		}
+		d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] the requested thin pool %s overrides the storage class's ones, LVMVolumeGroups: %+v", traceID, volumeID, thinPoolName, storageClassLVGParametersMap))
+	}
+
+	overprovisioningFactor, err := utils.ParseOverprovisioningFactor(request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.ThinOverprovisioningKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.ThinOverprovisioningKey, err.Error())
+	}
+
+	maxSize, err := utils.ParseMaxSize(request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.MaxSizeKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.MaxSizeKey, err.Error())
+	}
+
+	quota, err := utils.ParseQuota(request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.QuotaMaxTotalSizeKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.QuotaMaxTotalSizeKey, err.Error())
+	}
+
+	encryption, err := utils.ParseEncryption(request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.EncryptionKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.EncryptionKey, err.Error())
+	}
+
+	// the options are applied by the node service on the staging, they are passed there in the volume context
+	if _, err := utils.GetFsckPolicy(request.Parameters, internal.FsckPolicyNone); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.FsckPolicyKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.FsckPolicyKey, err.Error())
+	}
+
+	if _, err := utils.GetExt4Options(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid ext4 tuning storage class parameters", traceID, volumeID))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter: %s", err.Error())
+	}
+	if _, err := utils.ParseMkfsOptions(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.MkfsOptionsKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.MkfsOptionsKey, err.Error())
+	}
+
+	llvLabels, llvAnnotations := utils.GetVolumeOwnerMetadata(request.Parameters)
+	if onDelete, ok := request.Parameters[internal.OnDeleteKey]; ok {
+		if err := utils.ValidateOnDeletePolicy(onDelete); err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.OnDeleteKey))
+			return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.OnDeleteKey, err.Error())
+		}
+		llvAnnotations[internal.OnDeleteKey] = onDelete
+	}
+
+	if _, err := utils.GetWaitOptions(request.Parameters, d.waitOptions); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameters", traceID, volumeID))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameters: %s", err.Error())
+	}
+	if _, err := utils.IsForceFormat(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.ForceFormatKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.ForceFormatKey, err.Error())
+	}
+	if _, err := utils.GetDiscardPolicy(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.DiscardPolicyKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.DiscardPolicyKey, err.Error())
+	}
+	if _, err := utils.GetIOLimits(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameters", traceID, volumeID))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameters: %s", err.Error())
+	}
+	if _, err := utils.GetBlockTuning(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameters", traceID, volumeID))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameters: %s", err.Error())
+	}
+	if _, err := utils.GetXFSDuplicateUUIDPolicy(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.XFSDuplicateUUIDKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.XFSDuplicateUUIDKey, err.Error())
+	}
+	if _, err := utils.GetFSGroupChangePolicy(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.FSGroupChangePolicyKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.FSGroupChangePolicyKey, err.Error())
+	}
+	if _, err := utils.GetSecureErase(request.Parameters); err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.SecureEraseKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.SecureEraseKey, err.Error())
+	}
+	for _, key := range []string{internal.ResizeDeltaKey, internal.WaitTimeoutKey, internal.ThinOverprovisioningKey, internal.MaxSizeKey, internal.EncryptionKey, internal.DiscardPolicyKey, internal.IOSchedulerKey, internal.ReadAheadKBKey, internal.NrRequestsKey, internal.QoSReadBPSKey, internal.QoSWriteBPSKey, internal.QoSReadIOPSKey, internal.QoSWriteIOPSKey, internal.SecureEraseKey} {
+		if val, ok := request.Parameters[key]; ok {
+			llvAnnotations[key] = val
+		}
+	}
+
 	contiguous := utils.IsContiguous(request, LvmType)
 	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] contiguous: %t", traceID, volumeID, contiguous))
 
@@ -90,11 +230,78 @@ func (d *Driver) CreateVolume(ctx context.Context, request *csi.CreateVolumeRequ
 	lvName := volumeID
 	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] llv name: %s", traceID, volumeID, llvName))
 
-	llvSize := resource.NewQuantity(request.CapacityRange.GetRequiredBytes(), resource.BinarySI)
+	requiredBytes := request.CapacityRange.GetRequiredBytes()
+	limitBytes := request.CapacityRange.GetLimitBytes()
+	if limitBytes > 0 && requiredBytes > limitBytes {
+		return nil, status.Errorf(codes.InvalidArgument, "required bytes %d are greater than limit bytes %d", requiredBytes, limitBytes)
+	}
+
+	// the volume created from a source inherits its filesystem, so it is not checked against the minimal size
+	if minSize := utils.GetMinFSSize(request.VolumeCapabilities); request.VolumeContentSource == nil && requiredBytes < minSize {
+		if limitBytes > 0 && limitBytes < minSize {
+			return nil, status.Errorf(codes.OutOfRange, "limit bytes %d are less than the minimal size %d of the requested filesystem", limitBytes, minSize)
+		}
+		d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] required bytes %d are increased to the minimal size %d of the requested filesystem", traceID, volumeID, requiredBytes, minSize))
+		requiredBytes = minSize
+	}
+
+	if maxSize > 0 && requiredBytes > maxSize {
+		d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] required bytes %d exceed the maximum volume size %d of the storage class", traceID, volumeID, requiredBytes, maxSize))
+		return nil, status.Errorf(codes.OutOfRange, "requested size %d exceeds the maximum volume size %s of the storage class", requiredBytes, request.Parameters[internal.MaxSizeKey])
+	}
+
+	// LVM rounds the size of a logical volume up to the extent size, so the volume is created with the rounded size
+	llvSize, err := utils.RoundUpToExtentSize(*resource.NewQuantity(requiredBytes, resource.BinarySI), internal.LVMExtentSize)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error RoundUpToExtentSize", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error rounding the volume size: %s", err.Error())
+	}
 	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] llv size: %s", traceID, volumeID, llvSize.String()))
 
+	existingLLV, err := utils.GetLVMLogicalVolume(ctx, d.cl, llvName, "")
+	if err != nil && !kerrors.IsNotFound(err) {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error getting LVMLogicalVolume", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error getting LVMLogicalVolume %s: %s", llvName, err.Error())
+	}
+	if err == nil {
+		d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] LVMLogicalVolume %s already exists. Check if it matches the request", traceID, volumeID, llvName))
+		if msg := checkExistingLLV(existingLLV, request, storageClassLVGParametersMap, LvmType, requiredBytes, limitBytes); msg != "" {
+			d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] existing LVMLogicalVolume %s does not match the request: %s", traceID, volumeID, llvName, msg))
+			return nil, status.Errorf(codes.AlreadyExists, "LVMLogicalVolume %s already exists and does not match the request: %s", llvName, msg)
+		}
+
+		existingLVG, err := utils.SelectLVGByName(storageClassLVGs, existingLLV.Spec.LVMVolumeGroupName)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error getting LVMVolumeGroup of the existing LVMLogicalVolume", traceID, volumeID))
+			return nil, status.Errorf(codes.FailedPrecondition, "error getting LVMVolumeGroup %s: %s", existingLLV.Spec.LVMVolumeGroupName, err.Error())
+		}
+
+		existingSize, err := resource.ParseQuantity(existingLLV.Spec.Size)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s] error parsing quantity %s", traceID, existingLLV.Spec.Size))
+			return nil, status.Errorf(codes.Internal, "error parsing quantity: %v", err)
+		}
+
+		d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] existing LVMLogicalVolume %s matches the request, return it", traceID, volumeID, llvName))
+		return d.waitForCreatedVolume(ctx, traceID, request, existingLLV.Spec, existingSize, *existingLVG, "")
+	}
+
+	if quota > 0 {
+		storageClassName, err := d.checkStorageClassQuota(ctx, traceID, request, quota, *llvSize)
+		if err != nil {
+			return nil, err
+		}
+		// the created LVMLogicalVolume is in the cache once its status is awaited, so it is counted instead
+		defer d.quotaReservations.Release(storageClassName, volumeID)
+
+		if len(validation.IsValidLabelValue(storageClassName)) == 0 {
+			llvLabels[internal.LLVStorageClassKey] = storageClassName
+		}
+	}
+
 	var selectedLVG *v1alpha1.LVMVolumeGroup
-	var preferredNode string
+	var lvgSelectionReason string
+	var reservedPool string
 	var sourceVolume *v1alpha1.LVMLogicalVolumeSource
 
 	if request.VolumeContentSource != nil {
@@ -111,6 +318,10 @@ func (d *Driver) CreateVolume(ctx context.Context, request *csi.CreateVolumeRequ
 				return nil, status.Errorf(codes.NotFound, "error getting LVMLogicalVolumeSnapshot %s: %s", sourceVolume.Name, err.Error())
 			}
 
+			if err := utils.CheckSourceEncryption(encryption, sourceVol.Annotations); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "unable to restore the snapshot %s: %s", sourceVolume.Name, err.Error())
+			}
+
 			if sourceVol.Status == nil || sourceVol.Status.Phase != internal.LLVSStatusCreated {
 				d.log.Error(nil, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] source LVMLogicalVolumeSnapshot is not in Created phase", traceID, sourceVolume.Name))
 				return nil, status.Errorf(codes.FailedPrecondition, "LVMLogicalVolumeSnapshot %s is not in Created phase", sourceVolume.Name)
@@ -141,12 +352,9 @@ func (d *Driver) CreateVolume(ctx context.Context, request *csi.CreateVolumeRequ
 				d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] should use the same storage class as source", traceID, volumeID))
 				return nil, status.Errorf(codes.InvalidArgument, "should use the same storage class as source")
 			}
-
-			// prefer the same node as the source
-			preferredNode = sourceVol.Status.NodeName
 		case *csi.VolumeContentSource_Volume:
 			sourceVolume.Kind = sourceVolumeKindVolume
-			sourceVolume.Name = s.Volume.VolumeId
+			sourceVolume.Name = utils.LLVNameForVolume(s.Volume.VolumeId)
 
 			// get source volume
 			sourceVol, err := utils.GetLVMLogicalVolume(ctx, d.cl, sourceVolume.Name, "")
@@ -159,6 +367,10 @@ func (d *Driver) CreateVolume(ctx context.Context, request *csi.CreateVolumeRequ
 				return nil, status.Errorf(codes.InvalidArgument, "Source LVMLogicalVolume '%s' is not of 'Thin' type", sourceVol.Name)
 			}
 
+			if err := utils.CheckSourceEncryption(encryption, sourceVol.Annotations); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "unable to clone the volume %s: %s", sourceVolume.Name, err.Error())
+			}
+
 			// check size
 			sourceSizeQty, err := resource.ParseQuantity(sourceVol.Spec.Size)
 			if err != nil {
@@ -176,176 +388,1011 @@ func (d *Driver) CreateVolume(ctx context.Context, request *csi.CreateVolumeRequ
 			selectedLVG, err = utils.SelectLVGByName(storageClassLVGs, sourceVol.Spec.LVMVolumeGroupName)
 			if err != nil {
 				d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s] error getting LVMVolumeGroup %s", traceID, sourceVol.Spec.LVMVolumeGroupName))
-				return nil, status.Errorf(codes.Internal, "error getting LVMVolumeGroup %s: %s", sourceVol.Spec.LVMVolumeGroupName, err.Error())
+				return nil, status.Errorf(codes.FailedPrecondition, "error getting LVMVolumeGroup %s: %s", sourceVol.Spec.LVMVolumeGroupName, err.Error())
 			}
 
 			if _, ok := storageClassLVGParametersMap[selectedLVG.Name]; !ok {
 				d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] should use the same storage class as source", traceID, volumeID))
 				return nil, status.Errorf(codes.InvalidArgument, "should use the same storage class as source")
 			}
+		}
+	} else {
+		selectedLVG, _, lvgSelectionReason, reservedPool, err = d.selectLVGForVolume(ctx, traceID, request, storageClassLVGs, storageClassLVGParametersMap, LvmType, *llvSize, overprovisioningFactor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the space is reserved only for the time of provisioning, the LVMVolumeGroup status reflects it afterward
+	defer func() {
+		if reservedPool != "" {
+			d.reservations.Release(reservedPool, volumeID)
+		}
+	}()
+
+	if limitBytes > 0 && llvSize.Value() > limitBytes {
+		return nil, status.Errorf(codes.OutOfRange, "volume size %s rounded up to the extent size %s exceeds limit bytes %d", llvSize.String(), internal.LVMExtentSize, limitBytes)
+	}
 
-			// prefer the same node as the source
-			preferredNode = selectedLVG.Spec.Local.NodeName
+	if sourceVolume != nil && LvmType == internal.LVMTypeThin && overprovisioningFactor > 0 {
+		exceeds, err := utils.ExceedsOverprovisioningFactor(*selectedLVG, storageClassLVGParametersMap[selectedLVG.Name], *llvSize, overprovisioningFactor)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error ExceedsOverprovisioningFactor", traceID, volumeID))
+			return nil, status.Errorf(codes.Internal, "error checking the overprovisioning of the LVMVolumeGroup %s: %s", selectedLVG.Name, err.Error())
+		}
+		if exceeds {
+			return nil, status.Errorf(codes.ResourceExhausted, "thin pool of the LVMVolumeGroup %s would exceed the overprovisioning factor %g", selectedLVG.Name, overprovisioningFactor)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		// do not start provisioning if the sidecar is not waiting for it anymore
+		if err := ctx.Err(); err != nil {
+			d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] the request is done before the LVMLogicalVolume creation: %s", traceID, volumeID, err.Error()))
+			return nil, status.FromContextError(err).Err()
+		}
+
+		llvSpec := utils.GetLLVSpec(
+			d.log,
+			lvName,
+			*selectedLVG,
+			storageClassLVGParametersMap,
+			LvmType,
+			*llvSize,
+			contiguous,
+			sourceVolume,
+		)
+		d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] LVMLogicalVolumeSpec: %+v", traceID, volumeID, llvSpec))
+		d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] ------------ CreateLVMLogicalVolume start ------------", traceID, volumeID))
+		_, err = utils.CreateLVMLogicalVolume(ctx, d.cl, d.log, traceID, llvName, llvSpec, llvLabels, llvAnnotations)
+		if err != nil {
+			if kerrors.IsAlreadyExists(err) {
+				// a concurrent request has created it in the meantime
+				d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] LVMLogicalVolume %s already exists. Skip creating", traceID, volumeID, llvName))
+			} else {
+				d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error CreateLVMLogicalVolume", traceID, volumeID))
+				return nil, err
+			}
 		}
+		d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] ------------ CreateLVMLogicalVolume end ------------", traceID, volumeID))
+
+		response, err := d.waitForCreatedVolume(ctx, traceID, request, llvSpec, *llvSize, *selectedLVG, lvgSelectionReason)
+		// the volumes created from a source have to be placed to the LVMVolumeGroup of the source,
+		// the others might be placed to another LVMVolumeGroup if the agent failed to create the volume
+		if err == nil || sourceVolume != nil || attempt >= internal.CreateVolumeMaxAttempts || !errors.Is(err, utils.ErrLLVFailed) {
+			return response, err
+		}
+
+		failedLVGName := selectedLVG.Name
+		d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] attempt %d to create the volume in the LVG %s failed: %s. Try another LVG", traceID, volumeID, attempt, failedLVGName, err.Error()))
+
+		// the LVMLogicalVolume with the same name can not be created until the failed one is removed
+		if _, err = utils.WaitForLLVDeletion(ctx, d.cache, d.log, traceID, llvName); err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error WaitForLLVDeletion", traceID, volumeID))
+			return nil, status.Errorf(codes.Internal, "error waiting for the failed LVMLogicalVolume %s to be deleted: %s", llvName, err.Error())
+		}
+
+		d.reservations.Release(reservedPool, volumeID)
+		reservedPool = ""
+		storageClassLVGs = slices.DeleteFunc(storageClassLVGs, func(lvg v1alpha1.LVMVolumeGroup) bool {
+			return lvg.Name == failedLVGName
+		})
+
+		selectedLVG, _, lvgSelectionReason, reservedPool, err = d.selectLVGForVolume(ctx, traceID, request, storageClassLVGs, storageClassLVGParametersMap, LvmType, *llvSize, overprovisioningFactor)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForCreatedVolume waits until the LVMLogicalVolume is created on the node and builds the CreateVolume response.
+// The LVMLogicalVolume is deleted if its creation fails, so the request might be retried.
+func (d *Driver) waitForCreatedVolume(
+	ctx context.Context,
+	traceID string,
+	request *csi.CreateVolumeRequest,
+	llvSpec v1alpha1.LVMLogicalVolumeSpec,
+	llvSize resource.Quantity,
+	selectedLVG v1alpha1.LVMVolumeGroup,
+	lvgSelectionReason string,
+) (*csi.CreateVolumeResponse, error) {
+	volumeID := request.Name
+	llvName := request.Name
+
+	waitOptions, err := utils.GetWaitOptions(request.Parameters, d.waitOptions)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetWaitOptions", traceID, volumeID))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameters: %s", err.Error())
+	}
+
+	d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] start wait CreateLVMLogicalVolume, resize delta: %s, timeout: %s", traceID, volumeID, waitOptions.ResizeDelta.String(), waitOptions.Timeout))
+
+	waitCtx, cancel := context.WithTimeout(ctx, waitOptions.Timeout)
+	defer cancel()
+
+	attemptCounter, err := utils.WaitForStatusUpdate(waitCtx, d.cache, d.log, traceID, request.Name, "", llvSize, waitOptions.ResizeDelta)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error WaitForStatusUpdate. Delete LVMLogicalVolume %s", traceID, volumeID, request.Name))
+
+		// the call might be cancelled on the driver shutdown, so the rollback does not depend on its context
+		rollbackCtx, cancelRollback := context.WithTimeout(context.WithoutCancel(ctx), internal.RollbackTimeout)
+		defer cancelRollback()
+
+		// the agent might be still creating the LV, so it is told to stop before the LVMLogicalVolume is deleted
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			abortErr := utils.AbortLVMLogicalVolume(rollbackCtx, d.cl, d.log, traceID, request.Name, err.Error())
+			if abortErr != nil {
+				d.log.Error(abortErr, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error AbortLVMLogicalVolume", traceID, volumeID))
+			}
+		}
+
+		deleteErr := utils.DeleteLVMLogicalVolume(rollbackCtx, d.cl, d.log, traceID, request.Name)
+		if deleteErr != nil {
+			d.log.Error(deleteErr, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error DeleteLVMLogicalVolume", traceID, volumeID))
+		}
+
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error creating LVMLogicalVolume", traceID, volumeID))
+		// the sidecar has given up on the call, it retries CreateVolume from scratch with a new deadline
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, err
+	}
+	d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] finish wait CreateLVMLogicalVolume, attempt counter = %d", traceID, volumeID, attemptCounter))
+
+	capacityBytes := llvSize.Value()
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, llvName, "")
+	if err != nil {
+		d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] unable to get the actual size of the LVMLogicalVolume: %s", traceID, volumeID, err.Error()))
+	} else if llv.Status != nil && llv.Status.ActualSize.Value() > 0 {
+		capacityBytes = llv.Status.ActualSize.Value()
+	}
+
+	volumeCtx := make(map[string]string, len(request.Parameters))
+	for k, v := range request.Parameters {
+		volumeCtx[k] = v
+	}
+
+	volumeCtx[internal.SubPath] = request.Name
+	volumeCtx[internal.TraceIDKey] = traceID
+	volumeCtx[internal.VGNameKey] = selectedLVG.Spec.ActualVGNameOnTheNode
+	volumeCtx[internal.LVGNameKey] = selectedLVG.Name
+	if lvgSelectionReason != "" {
+		volumeCtx[internal.LVGSelectionReasonKey] = lvgSelectionReason
+	}
+	if llvSpec.Type == internal.LVMTypeThin {
+		volumeCtx[internal.ThinPoolNameKey] = llvSpec.Thin.PoolName
 	} else {
-		switch BindingMode {
-		case internal.BindingModeI:
-			d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] BindingMode is %s. Start selecting node", traceID, volumeID, internal.BindingModeI))
-			selectedNodeName, freeSpace, err := utils.GetNodeWithMaxFreeSpace(storageClassLVGs, storageClassLVGParametersMap, LvmType)
+		volumeCtx[internal.ThinPoolNameKey] = ""
+	}
+
+	mountCtx, err := utils.GetMountVolumeContext(request.VolumeCapabilities)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetMountVolumeContext", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "unable to store the mount options in the volume context: %s", err.Error())
+	}
+	for k, v := range mountCtx {
+		volumeCtx[k] = v
+	}
+
+	// the topology is always derived from the LVMVolumeGroup the LV is created in, whatever node was preferred,
+	// so the PV node affinity points to the node the data is actually on
+	lvgNode := utils.GetLVGNodeName(selectedLVG)
+	if lvgNode == "" {
+		d.log.Error(fmt.Errorf("no node"), fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] LVMVolumeGroup %s has no node", traceID, volumeID, selectedLVG.Name))
+		return nil, status.Errorf(codes.Internal, "LVMVolumeGroup %s has no node", selectedLVG.Name)
+	}
+
+	segments, err := utils.GetNodeTopologySegments(ctx, d.cl, lvgNode, d.topologyKeys)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetNodeTopologySegments", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "unable to get the topology of the node %s: %s", lvgNode, err.Error())
+	}
+
+	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] Volume created successfully. volumeCtx: %+v", traceID, volumeID, volumeCtx))
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			CapacityBytes: capacityBytes,
+			VolumeId:      request.Name,
+			VolumeContext: volumeCtx,
+			ContentSource: request.VolumeContentSource,
+			AccessibleTopology: []*csi.Topology{
+				{Segments: segments},
+			},
+		},
+	}, nil
+}
+
+// checkStorageClassQuota reserves the size of the volume within the quota of the storage class it is provisioned from
+// and returns the name of the storage class. The check and the reservation are serialized, so the concurrent requests
+// do not exceed the quota together. The reservation is dropped once the cache counts the LVMLogicalVolume or the PV of
+// the volume, or it is released by the caller if the volume is not created. Only the leader of the external-provisioner
+// creates the volumes, so a single controller plugin replica keeps the reservations. The returned error is a gRPC
+// status error.
+func (d *Driver) checkStorageClassQuota(ctx context.Context, traceID string, request *csi.CreateVolumeRequest, quota int64, size resource.Quantity) (string, error) {
+	volumeID := request.Name
+
+	storageClassName, err := utils.GetPVCStorageClassName(ctx, d.cl, request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetPVCStorageClassName", traceID, volumeID))
+		return "", status.Errorf(codes.Internal, "error getting the storage class of the volume: %s", err.Error())
+	}
+	if storageClassName == "" {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to check the quota of the storage class: the PersistentVolumeClaim of the volume is unknown")
+	}
+
+	err = d.indexPVsByStorageClass(ctx)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error AddPVStorageClassIndex", traceID, volumeID))
+		return "", status.Errorf(codes.Internal, "error indexing the PersistentVolumes by the storage classes: %s", err.Error())
+	}
+
+	d.quotaMu.Lock()
+	defer d.quotaMu.Unlock()
+
+	provisionedSize, counted, err := utils.GetStorageClassProvisionedSize(ctx, d.cache, d.name, storageClassName)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetStorageClassProvisionedSize", traceID, volumeID))
+		return "", status.Errorf(codes.Internal, "error getting the provisioned size of the storage class %s: %s", storageClassName, err.Error())
+	}
+	for id := range counted {
+		d.quotaReservations.Release(storageClassName, id)
+	}
+
+	if !d.quotaReservations.Reserve(storageClassName, volumeID, size.Value(), quota-provisionedSize) {
+		reservedSize := d.quotaReservations.Reserved(storageClassName)
+		d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] the volume size %s would exceed the quota %s of the storage class %s, provisioned: %d bytes, being provisioned: %d bytes", traceID, volumeID, size.String(), request.Parameters[internal.QuotaMaxTotalSizeKey], storageClassName, provisionedSize, reservedSize))
+		return "", status.Errorf(codes.ResourceExhausted, "the volume size %s would exceed the quota %s of the storage class %s, provisioned: %d bytes, being provisioned: %d bytes", size.String(), request.Parameters[internal.QuotaMaxTotalSizeKey], storageClassName, provisionedSize, reservedSize)
+	}
+
+	return storageClassName, nil
+}
+
+// indexPVsByStorageClass adds the index the quota checks list the PersistentVolumes by to the cache. It is added on
+// the first check, so the PersistentVolumes are watched only by the controller plugin with the quotas in use.
+func (d *Driver) indexPVsByStorageClass(ctx context.Context) error {
+	d.pvIndexMu.Lock()
+	defer d.pvIndexMu.Unlock()
+
+	if d.pvIndexed {
+		return nil
+	}
+
+	err := utils.AddPVStorageClassIndex(ctx, d.cache)
+	if err != nil {
+		return err
+	}
+	d.pvIndexed = true
+
+	return nil
+}
+
+// checkAllowedNamespace checks the volume is provisioned for the PVC of a namespace the storage class allows. The
+// namespace of the PVC is passed in the parameters by the external-provisioner. The returned error is a gRPC status
+// error.
+func (d *Driver) checkAllowedNamespace(ctx context.Context, traceID string, request *csi.CreateVolumeRequest) error {
+	volumeID := request.Name
+
+	filter, err := utils.ParseNamespaceFilter(request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.AllowedNSSelectorKey))
+		return status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.AllowedNSSelectorKey, err.Error())
+	}
+	if filter == nil {
+		return nil
+	}
+
+	namespace := request.Parameters[internal.PVCNamespaceKey]
+	if namespace == "" {
+		return status.Errorf(codes.FailedPrecondition, "unable to check the allowed namespaces of the storage class: the PersistentVolumeClaim of the volume is unknown")
+	}
+
+	allowed, err := utils.IsNamespaceAllowed(ctx, d.cl, filter, namespace)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error IsNamespaceAllowed", traceID, volumeID))
+		return status.Errorf(codes.Internal, "error checking the namespace %s: %s", namespace, err.Error())
+	}
+	if !allowed {
+		d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] the namespace %s is not allowed by the storage class", traceID, volumeID, namespace))
+		return status.Errorf(codes.PermissionDenied, "the volumes of the storage class are not allowed in the namespace %s", namespace)
+	}
+
+	return nil
+}
+
+// lockVolume makes sure the volume is not processed by another call at the same time, neither in this controller
+// plugin replica nor in the other ones. The returned error is a gRPC status error.
+func (d *Driver) lockVolume(ctx context.Context, traceID, method, volumeID string) (func(), error) {
+	if !d.inFlight.Insert(volumeID) {
+		d.log.Warning(fmt.Sprintf("[%s][traceID:%s][volumeID:%s] another operation on the volume is in progress", method, traceID, volumeID))
+		return nil, status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, volumeID)
+	}
+
+	if d.volumeLeases == nil {
+		return func() { d.inFlight.Delete(volumeID) }, nil
+	}
+
+	release, err := d.volumeLeases.Acquire(ctx, volumeID)
+	if err != nil {
+		d.inFlight.Delete(volumeID)
+		if errors.Is(err, utils.ErrVolumeLeaseHeld) {
+			d.log.Warning(fmt.Sprintf("[%s][traceID:%s][volumeID:%s] the volume is being processed by another replica", method, traceID, volumeID))
+			return nil, status.Errorf(codes.Aborted, "an operation on the volume %s is already in progress in another replica", volumeID)
+		}
+
+		d.log.Error(err, fmt.Sprintf("[%s][traceID:%s][volumeID:%s] error acquiring the volume lease", method, traceID, volumeID))
+		return nil, status.Errorf(codes.Unavailable, "unable to acquire the lease of the volume %s: %s", volumeID, err.Error())
+	}
+
+	return func() {
+		release()
+		d.inFlight.Delete(volumeID)
+	}, nil
+}
+
+// listTopologyNodes lists the nodes to resolve the topologies without the node key. No request is made
+// if every topology has the node key.
+func (d *Driver) listTopologyNodes(ctx context.Context, topologies ...*csi.Topology) ([]corev1.Node, error) {
+	if utils.TopologyHasNodeKey(topologies...) {
+		return nil, nil
+	}
+
+	nodes := &corev1.NodeList{}
+	err := d.cl.List(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes.Items, nil
+}
+
+// selectLVGForVolume selects the LVMVolumeGroup for a new volume among the StorageClass ones according to the binding
+// mode, the topology requirements and the selection policies, and reserves the space for the volume in it.
+// The returned error is a gRPC status error.
+func (d *Driver) selectLVGForVolume(
+	ctx context.Context,
+	traceID string,
+	request *csi.CreateVolumeRequest,
+	storageClassLVGs []v1alpha1.LVMVolumeGroup,
+	storageClassLVGParametersMap map[string]string,
+	lvmType string,
+	llvSize resource.Quantity,
+	overprovisioningFactor float64,
+) (selectedLVG *v1alpha1.LVMVolumeGroup, preferredNode, lvgSelectionReason, reservedPool string, err error) {
+	volumeID := request.Name
+
+	var staleLVGs, candidateNodes, overprovisionedLVGs []string
+	var notEnoughSpace bool
+	storageClassLVGs, staleLVGs = utils.ApplyStaleLVGPolicy(storageClassLVGs, d.staleLVGPolicy, time.Now())
+	if len(staleLVGs) != 0 {
+		d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] capacity data of the LVMVolumeGroups %v is stale, the policy %s is applied", traceID, volumeID, staleLVGs, d.staleLVGPolicy.Action))
+	}
+
+	// the topologies with the extra keys only (e.g. the zone one) are resolved to the nodes by their labels
+	topologyNodes, err := d.listTopologyNodes(ctx, slices.Concat(request.GetAccessibilityRequirements().GetRequisite(), request.GetAccessibilityRequirements().GetPreferred())...)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error listTopologyNodes", traceID, volumeID))
+		return nil, "", "", "", status.Errorf(codes.Internal, "unable to list the nodes: %s", err.Error())
+	}
+
+	// the space reserved by the volumes which are being provisioned is not reflected in the LVMVolumeGroups status yet
+	availableLVGs := utils.ApplyCapacityReservations(storageClassLVGs, storageClassLVGParametersMap, lvmType, d.reservations)
+
+	switch request.Parameters[internal.BindingModeKey] {
+	case internal.BindingModeI:
+		d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] BindingMode is %s. Start selecting node", traceID, volumeID, internal.BindingModeI))
+
+		accessibleLVGs := utils.FilterLVGsByRequisiteTopology(availableLVGs, request.AccessibilityRequirements, topologyNodes)
+		selectedNodeName, err := d.selectNodeByStrategy(traceID, request, accessibleLVGs, storageClassLVGParametersMap, lvmType, llvSize)
+		if err != nil {
+			return nil, "", "", "", err
+		}
+
+		candidateNodes = []string{selectedNodeName}
+	case internal.BindingModeWFFC:
+		candidateNodes = utils.GetTopologyNodes(request.AccessibilityRequirements, topologyNodes)
+		d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] BindingMode is %s. Candidate nodes in the order of preference: %v", traceID, volumeID, internal.BindingModeWFFC, candidateNodes))
+	}
+
+	// the external-provisioner without the Topology feature passes no accessibility requirements, so the node is
+	// selected among the nodes of the storage class's LVMVolumeGroups the same way as for the Immediate binding mode
+	if len(candidateNodes) == 0 && len(request.GetAccessibilityRequirements().GetRequisite()) == 0 && len(request.GetAccessibilityRequirements().GetPreferred()) == 0 {
+		d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] the request has no accessibility requirements, select a node of the storage class's LVMVolumeGroups", traceID, volumeID))
+		selectedNodeName, err := d.selectNodeByStrategy(traceID, request, availableLVGs, storageClassLVGParametersMap, lvmType, llvSize)
+		if err != nil {
+			return nil, "", "", "", err
+		}
+
+		candidateNodes = []string{selectedNodeName}
+	}
+
+	lvgSelectionPolicy := internal.LVGSelectionPolicyFreeSpace
+	if p, ok := request.Parameters[internal.LVGSelectionPolicyKey]; ok {
+		if err := utils.ValidateLVGSelectionPolicy(p); err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.LVGSelectionPolicyKey))
+			return nil, "", "", "", status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.LVGSelectionPolicyKey, err.Error())
+		}
+		lvgSelectionPolicy = p
+	}
+
+	lvgPriorities, err := utils.GetStorageClassLVGPriorities(request.Parameters[internal.LVMVolumeGroupKey])
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetStorageClassLVGPriorities", traceID, volumeID))
+		return nil, "", "", "", status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.LVMVolumeGroupKey, err.Error())
+	}
+
+	// the candidates are tried in order, the next one is used if the LVMVolumeGroup of the previous one has no space
+	for _, node := range candidateNodes {
+		d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] candidate node: %s. Select LVG with the policy %s", traceID, volumeID, node, lvgSelectionPolicy))
+		lvg, reason, err := utils.SelectLVG(availableLVGs, node, storageClassLVGParametersMap, lvgPriorities, lvmType, llvSize, lvgSelectionPolicy)
+		if err != nil {
+			d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] unable to select LVG on the node %s: %s", traceID, volumeID, node, err.Error()))
+			continue
+		}
+
+		enough, err := utils.HasEnoughSpace(*lvg, storageClassLVGParametersMap, lvmType, llvSize)
+		if err != nil {
+			d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] unable to check free space of the LVG %s: %s", traceID, volumeID, lvg.Name, err.Error()))
+			continue
+		}
+		if !enough {
+			notEnoughSpace = true
+			d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] LVG %s on the node %s has not enough space for the volume, try the next candidate", traceID, volumeID, lvg.Name, node))
+			continue
+		}
+
+		if lvmType == internal.LVMTypeThin && overprovisioningFactor > 0 {
+			exceeds, err := utils.ExceedsOverprovisioningFactor(*lvg, storageClassLVGParametersMap[lvg.Name], llvSize, overprovisioningFactor)
 			if err != nil {
-				d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetNodeMaxVGSize", traceID, volumeID))
+				d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] unable to check the overprovisioning of the LVG %s: %s", traceID, volumeID, lvg.Name, err.Error()))
+				continue
 			}
+			if exceeds {
+				d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] the thin pool of the LVG %s on the node %s would exceed the overprovisioning factor %g, try the next candidate", traceID, volumeID, lvg.Name, node, overprovisioningFactor))
+				overprovisionedLVGs = append(overprovisionedLVGs, lvg.Name)
+				continue
+			}
+		}
 
-			preferredNode = selectedNodeName
-			d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] Selected node: %s, free space %s", traceID, volumeID, selectedNodeName, freeSpace.String()))
-			if LvmType == internal.LVMTypeThick {
-				if llvSize.Value() > freeSpace.Value() {
-					return nil, status.Errorf(codes.Internal, "requested size: %s is greater than free space: %s", llvSize.String(), freeSpace.String())
-				}
+		// the status of the LVMVolumeGroup might be outdated, so the space is reserved against its actual free space
+		// to make sure the concurrent requests have not taken it
+		storageClassLVG, err := utils.SelectLVGByName(storageClassLVGs, lvg.Name)
+		if err != nil {
+			d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] unable to find the LVG %s: %s", traceID, volumeID, lvg.Name, err.Error()))
+			continue
+		}
+
+		pool, err := utils.ReserveCapacity(d.reservations, *storageClassLVG, storageClassLVGParametersMap, lvmType, volumeID, llvSize)
+		if err != nil {
+			d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] unable to reserve space in the LVG %s: %s", traceID, volumeID, lvg.Name, err.Error()))
+			continue
+		}
+		if pool == "" {
+			notEnoughSpace = true
+			d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] the space of the LVG %s on the node %s is reserved by the other volumes, try the next candidate", traceID, volumeID, lvg.Name, node))
+			continue
+		}
+		d.log.Debug(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] reserved %s in %s until the volume is provisioned", traceID, volumeID, llvSize.String(), pool))
+
+		selectedLVG, lvgSelectionReason, preferredNode, reservedPool = storageClassLVG, reason, node, pool
+		break
+	}
+	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] selectedLVG: %+v, reason: %s", traceID, volumeID, selectedLVG, lvgSelectionReason))
+
+	if selectedLVG == nil {
+		err := fmt.Errorf("no LVMVolumeGroup with enough space found on the candidate nodes %v", candidateNodes)
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error SelectLVG", traceID, volumeID))
+		if len(staleLVGs) != 0 {
+			return nil, "", "", "", status.Errorf(codes.Unavailable, "error during SelectLVG: capacity data of the LVMVolumeGroups %v is stale", staleLVGs)
+		}
+		if len(overprovisionedLVGs) != 0 {
+			return nil, "", "", "", status.Errorf(codes.ResourceExhausted, "thin pools of the LVMVolumeGroups %v would exceed the overprovisioning factor %g", overprovisionedLVGs, overprovisioningFactor)
+		}
+		if notEnoughSpace {
+			return nil, "", "", "", status.Errorf(codes.ResourceExhausted, "error during SelectLVG: %s", err.Error())
+		}
+		return nil, "", "", "", status.Errorf(codes.FailedPrecondition, "error during SelectLVG: %s", err.Error())
+	}
+
+	return selectedLVG, preferredNode, lvgSelectionReason, reservedPool, nil
+}
+
+// selectNodeByStrategy selects the node for the volume among the nodes of the LVMVolumeGroups with the node selection
+// strategy of the storage class or the default one.
+func (d *Driver) selectNodeByStrategy(
+	traceID string,
+	request *csi.CreateVolumeRequest,
+	lvgs []v1alpha1.LVMVolumeGroup,
+	storageClassLVGParametersMap map[string]string,
+	lvmType string,
+	llvSize resource.Quantity,
+) (string, error) {
+	volumeID := request.Name
+
+	strategy := d.nodeSelectionStrategy
+	if s, ok := request.Parameters[internal.NodeSelectionStrategyKey]; ok {
+		if err := utils.ValidateNodeSelectionStrategy(s); err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.NodeSelectionStrategyKey))
+			return "", status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.NodeSelectionStrategyKey, err.Error())
+		}
+		strategy = s
+	}
+	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] Start selecting node with the strategy %s", traceID, volumeID, strategy))
+
+	selectedNodeName, freeSpace, err := utils.SelectNodeByStrategy(lvgs, storageClassLVGParametersMap, lvmType, llvSize, strategy, &d.nodeSelectionCounter)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error SelectNodeByStrategy", traceID, volumeID))
+		if errors.Is(err, utils.ErrNotEnoughSpace) {
+			return "", status.Errorf(codes.ResourceExhausted, "error during node selection: %s", err.Error())
+		}
+		return "", status.Errorf(codes.FailedPrecondition, "error during node selection: %s", err.Error())
+	}
+
+	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] Selected node: %s, free space %s", traceID, volumeID, selectedNodeName, freeSpace.String()))
+	return selectedNodeName, nil
+}
+
+// checkExistingLLV returns the description of the mismatch between the existing LVMLogicalVolume and the CreateVolume
+// request or an empty string if the LVMLogicalVolume satisfies the request.
+func checkExistingLLV(
+	llv *v1alpha1.LVMLogicalVolume,
+	request *csi.CreateVolumeRequest,
+	storageClassLVGParametersMap map[string]string,
+	lvmType string,
+	requiredBytes, limitBytes int64,
+) string {
+	if llv.Spec.Type != lvmType {
+		return fmt.Sprintf("type %s differs from the requested %s", llv.Spec.Type, lvmType)
+	}
+
+	thinPoolName, ok := storageClassLVGParametersMap[llv.Spec.LVMVolumeGroupName]
+	if !ok {
+		return fmt.Sprintf("LVMVolumeGroup %s is not in the storage class", llv.Spec.LVMVolumeGroupName)
+	}
+
+	if lvmType == internal.LVMTypeThin && (llv.Spec.Thin == nil || llv.Spec.Thin.PoolName != thinPoolName) {
+		return fmt.Sprintf("thin pool differs from the requested %s", thinPoolName)
+	}
+
+	size, err := resource.ParseQuantity(llv.Spec.Size)
+	if err != nil {
+		return fmt.Sprintf("unable to parse size %s: %s", llv.Spec.Size, err.Error())
+	}
+	if size.Value() < requiredBytes {
+		return fmt.Sprintf("size %s is less than the required %d bytes", llv.Spec.Size, requiredBytes)
+	}
+	if limitBytes > 0 && size.Value() > limitBytes {
+		return fmt.Sprintf("size %s is greater than the limit of %d bytes", llv.Spec.Size, limitBytes)
+	}
+
+	var expectedSource *v1alpha1.LVMLogicalVolumeSource
+	switch s := request.GetVolumeContentSource().GetType().(type) {
+	case *csi.VolumeContentSource_Snapshot:
+		expectedSource = &v1alpha1.LVMLogicalVolumeSource{Kind: sourceVolumeKindSnapshot, Name: s.Snapshot.GetSnapshotId()}
+	case *csi.VolumeContentSource_Volume:
+		expectedSource = &v1alpha1.LVMLogicalVolumeSource{Kind: sourceVolumeKindVolume, Name: s.Volume.GetVolumeId()}
+	}
+
+	switch {
+	case expectedSource == nil && llv.Spec.Source != nil:
+		return fmt.Sprintf("it is created from the %s %s while the request has no content source", llv.Spec.Source.Kind, llv.Spec.Source.Name)
+	case expectedSource != nil && (llv.Spec.Source == nil || *llv.Spec.Source != *expectedSource):
+		return fmt.Sprintf("content source differs from the requested %s %s", expectedSource.Kind, expectedSource.Name)
+	}
+
+	return ""
+}
+
+func (d *Driver) DeleteVolume(ctx context.Context, request *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	traceID := traceIDFromContext(ctx)
+	d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s] ========== Start DeleteVolume ============", traceID))
+	if len(request.VolumeId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID cannot be empty")
+	}
+
+	release, err := d.lockVolume(ctx, traceID, "DeleteVolume", request.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// the raw device volume has no LVMLogicalVolume, its device and quota are released once its PV is deleted
+	d.rawDeviceClaims.Delete(request.VolumeId)
+	d.quotaReservations.ReleaseVolume(request.VolumeId)
+
+	// the LV of a static volume is deleted only if it has been adopted, otherwise it is not managed by the driver
+	llvName := utils.LLVNameForVolume(request.VolumeId)
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, llvName, "")
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] LVMLogicalVolume not found, consider the volume deleted", traceID, request.VolumeId))
+			return &csi.DeleteVolumeResponse{}, nil
+		}
+
+		d.log.Error(err, fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] error GetLVMLogicalVolume", traceID, request.VolumeId))
+		return nil, status.Errorf(codes.Internal, "error getting LVMLogicalVolume %s: %s", request.VolumeId, err.Error())
+	}
+
+	// the snapshots refer to the LVMLogicalVolume, so it is kept until they are deleted
+	snapshots, err := utils.GetLLVSnapshotNames(ctx, d.cl, llv.Name)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] error GetLLVSnapshotNames", traceID, request.VolumeId))
+		return nil, status.Errorf(codes.Internal, "error listing the snapshots of LVMLogicalVolume %s: %s", llv.Name, err.Error())
+	}
+	if len(snapshots) > 0 {
+		d.log.Warning(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] the volume has snapshots: %s", traceID, request.VolumeId, strings.Join(snapshots, ", ")))
+		return nil, status.Errorf(codes.FailedPrecondition, "volume %s has snapshots, delete them first: %s", request.VolumeId, strings.Join(snapshots, ", "))
+	}
+
+	if llv.Annotations[internal.OnDeleteKey] == internal.OnDeletePolicyRetain {
+		d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] the volume has the %s on-delete policy. The LV will be kept on the node", traceID, request.VolumeId, internal.OnDeletePolicyRetain))
+		err = utils.RetainLVMLogicalVolume(ctx, d.cl, d.log, traceID, llv)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] error RetainLVMLogicalVolume", traceID, request.VolumeId))
+			return nil, status.Errorf(codes.Internal, "error deleting LVMLogicalVolume %s with the LV retained: %s", request.VolumeId, err.Error())
+		}
+
+		d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] Volume deleted successfully, the LV is recorded in the LocalOrphanedVolume %s", traceID, request.VolumeId, llvName))
+		d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s] ========== END DeleteVolume ============", traceID))
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	err = utils.DeleteLVMLogicalVolume(ctx, d.cl, d.log, traceID, llvName)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] LVMLogicalVolume not found, consider the volume deleted", traceID, request.VolumeId))
+			return &csi.DeleteVolumeResponse{}, nil
+		}
+
+		d.log.Error(err, fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] error DeleteLVMLogicalVolume", traceID, request.VolumeId))
+		return nil, status.Errorf(codes.Internal, "error deleting LVMLogicalVolume %s: %s", request.VolumeId, err.Error())
+	}
+
+	// the LVMLogicalVolume is removed only after the agent deletes the LV on the node and removes its finalizer,
+	// so the LV does not leak if the agent is down
+	waitOptions, err := utils.GetWaitOptions(llv.Annotations, d.waitOptions)
+	if err != nil {
+		d.log.Warning(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] invalid wait options in the LVMLogicalVolume annotations, the default ones are used: %s", traceID, request.VolumeId, err.Error()))
+		waitOptions = d.waitOptions
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, waitOptions.Timeout)
+	defer cancel()
+
+	attemptCounter, err := utils.WaitForLLVDeletion(waitCtx, d.cache, d.log, traceID, llvName)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] error WaitForLLVDeletion", traceID, request.VolumeId))
+		if llv, getErr := utils.GetLVMLogicalVolume(ctx, d.cl, llvName, ""); getErr == nil && llv.Status != nil && llv.Status.Phase == utils.LLVStatusFailed {
+			return nil, status.Errorf(codes.Unavailable, "LVMLogicalVolume %s failed to be deleted on the node: %s", request.VolumeId, llv.Status.Reason)
+		}
+		return nil, status.Errorf(codes.Unavailable, "LVMLogicalVolume %s is still being deleted: %s", request.VolumeId, err.Error())
+	}
+	d.log.Trace(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] finish wait DeleteLVMLogicalVolume, attempt counter = %d", traceID, request.VolumeId, attemptCounter))
+
+	d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] Volume deleted successfully", traceID, request.VolumeId))
+	d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s] ========== END DeleteVolume ============", traceID))
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+func (d *Driver) ControllerPublishVolume(_ context.Context, request *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	d.log.Info("method ControllerPublishVolume")
+	return &csi.ControllerPublishVolumeResponse{
+		PublishContext: map[string]string{
+			d.publishInfoVolumeName: request.VolumeId,
+		},
+	}, nil
+}
+
+func (d *Driver) ControllerUnpublishVolume(_ context.Context, _ *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	d.log.Info("method ControllerUnpublishVolume")
+	// todo called Immediate
+	return &csi.ControllerUnpublishVolumeResponse{}, nil
+}
+
+func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, request *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	traceID := traceIDFromContext(ctx)
+	volumeID := request.GetVolumeId()
+	d.log.Info(fmt.Sprintf("[ValidateVolumeCapabilities][traceID:%s][volumeID:%s] method ValidateVolumeCapabilities", traceID, volumeID))
+
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID cannot be empty")
+	}
+
+	if len(request.VolumeCapabilities) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume Capabilities cannot be empty")
+	}
+
+	// the raw device volume has no LVMLogicalVolume
+	var llv *v1alpha1.LVMLogicalVolume
+	if utils.IsRawDeviceVolume(request.VolumeContext) {
+		err := d.checkRawDeviceVolumeExists(ctx, traceID, "ValidateVolumeCapabilities", volumeID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		llv, err = utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(volumeID), "")
+		if err != nil {
+			if kerrors.IsNotFound(err) {
+				return nil, status.Errorf(codes.NotFound, "LVMLogicalVolume %s not found", volumeID)
 			}
-		case internal.BindingModeWFFC:
-			d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] BindingMode is %s. Get preferredNode", traceID, volumeID, internal.BindingModeWFFC))
-			if len(request.AccessibilityRequirements.Preferred) != 0 {
-				t := request.AccessibilityRequirements.Preferred[0].Segments
-				preferredNode = t[internal.TopologyKey]
+			d.log.Error(err, fmt.Sprintf("[ValidateVolumeCapabilities][traceID:%s][volumeID:%s] error getting LVMLogicalVolume", traceID, volumeID))
+			return nil, status.Errorf(codes.Internal, "error getting LVMLogicalVolume %s: %s", volumeID, err.Error())
+		}
+	}
+
+	message := validateVolumeCapabilities(request.VolumeCapabilities)
+	if message == "" {
+		message = validateVolumeParameters(llv, request.Parameters, request.VolumeContext)
+	}
+
+	if message != "" {
+		d.log.Info(fmt.Sprintf("[ValidateVolumeCapabilities][traceID:%s][volumeID:%s] the volume capabilities are not confirmed: %s", traceID, volumeID, message))
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: message}, nil
+	}
+
+	d.log.Info(fmt.Sprintf("[ValidateVolumeCapabilities][traceID:%s][volumeID:%s] the volume capabilities are confirmed", traceID, volumeID))
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      request.VolumeContext,
+			VolumeCapabilities: request.VolumeCapabilities,
+			Parameters:         request.Parameters,
+		},
+	}, nil
+}
+
+// validateVolumeCapabilities returns the reason why the capabilities are not supported or an empty string if they are.
+func validateVolumeCapabilities(capabilities []*csi.VolumeCapability) string {
+	for _, capability := range capabilities {
+		if capability.GetAccessMode() == nil {
+			return "access mode is not specified"
+		}
+
+		mode := capability.GetAccessMode().GetMode()
+		if _, supported := supportedAccessModes[mode]; !supported {
+			return fmt.Sprintf("access mode %s is not supported", mode.String())
+		}
+
+		switch capability.GetAccessType().(type) {
+		case *csi.VolumeCapability_Block:
+		case *csi.VolumeCapability_Mount:
+			fsType := capability.GetMount().GetFsType()
+			if _, valid := ValidFSTypes[strings.ToLower(fsType)]; fsType != "" && !valid {
+				return fmt.Sprintf("fsType %s is not supported", fsType)
 			}
+		default:
+			return "access type is not specified"
+		}
+	}
+
+	return ""
+}
+
+// validateVolumeParameters returns the reason why the storage class parameters do not match the volume or an empty string if they do.
+// The LVMLogicalVolume is nil for the raw device volumes.
+func validateVolumeParameters(llv *v1alpha1.LVMLogicalVolume, parameters, volumeContext map[string]string) string {
+	if lvmType, set := parameters[internal.LvmTypeKey]; set && llv != nil && lvmType != llv.Spec.Type {
+		return fmt.Sprintf("the volume has LVM type %s, but %s is requested", llv.Spec.Type, lvmType)
+	}
+
+	for _, key := range []string{internal.TypeKey, internal.LvmTypeKey, internal.LVMVolumeGroupKey} {
+		param, paramSet := parameters[key]
+		stored, storedSet := volumeContext[key]
+		if paramSet && storedSet && param != stored {
+			return fmt.Sprintf("parameter %s does not match the volume: %q requested, %q stored in the volume context", key, param, stored)
 		}
+	}
+
+	return ""
+}
+
+func (d *Driver) ListVolumes(ctx context.Context, request *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	traceID := traceIDFromContext(ctx)
+	d.log.Info(fmt.Sprintf("[ListVolumes][traceID:%s] method ListVolumes, starting token: %q, max entries: %d", traceID, request.StartingToken, request.MaxEntries))
 
-		d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] preferredNode: %s. Select LVG", traceID, volumeID, preferredNode))
-		selectedLVG, err = utils.SelectLVG(storageClassLVGs, preferredNode)
-		d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] selectedLVG: %+v", traceID, volumeID, selectedLVG))
-		if err != nil {
-			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error SelectLVG", traceID, volumeID))
-			return nil, status.Errorf(codes.Internal, "error during SelectLVG")
-		}
+	if request.MaxEntries < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "max entries can not be negative: %d", request.MaxEntries)
 	}
 
-	llvSpec := utils.GetLLVSpec(
-		d.log,
-		lvName,
-		*selectedLVG,
-		storageClassLVGParametersMap,
-		LvmType,
-		*llvSize,
-		contiguous,
-		sourceVolume,
-	)
-	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] LVMLogicalVolumeSpec: %+v", traceID, volumeID, llvSpec))
-	resizeDelta, err := resource.ParseQuantity(internal.ResizeDelta)
+	llvs, err := utils.GetDriverLLVs(ctx, d.cl)
 	if err != nil {
-		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error ParseQuantity for ResizeDelta", traceID, volumeID))
-		return nil, err
+		d.log.Error(err, fmt.Sprintf("[ListVolumes][traceID:%s] unable to list LVMLogicalVolumes", traceID))
+		return nil, status.Errorf(codes.Internal, "unable to list LVMLogicalVolumes: %s", err.Error())
 	}
 
-	d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] ------------ CreateLVMLogicalVolume start ------------", traceID, volumeID))
-	_, err = utils.CreateLVMLogicalVolume(ctx, d.cl, d.log, traceID, llvName, llvSpec)
+	// the raw device volumes have no LVMLogicalVolumes, they follow the LV ones
+	rawPVs, err := utils.GetRawDevicePVs(ctx, d.cl, d.name)
 	if err != nil {
-		if kerrors.IsAlreadyExists(err) {
-			d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] LVMLogicalVolume %s already exists. Skip creating", traceID, volumeID, llvName))
-		} else {
-			d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error CreateLVMLogicalVolume", traceID, volumeID))
-			return nil, err
+		d.log.Error(err, fmt.Sprintf("[ListVolumes][traceID:%s] unable to list the raw device PersistentVolumes", traceID))
+		return nil, status.Errorf(codes.Internal, "unable to list the raw device PersistentVolumes: %s", err.Error())
+	}
+	total := len(llvs) + len(rawPVs)
+
+	start := 0
+	if request.StartingToken != "" {
+		start, err = strconv.Atoi(request.StartingToken)
+		if err != nil || start < 0 || start > total {
+			d.log.Warning(fmt.Sprintf("[ListVolumes][traceID:%s] invalid starting token %q", traceID, request.StartingToken))
+			return nil, status.Errorf(codes.Aborted, "invalid starting token %q", request.StartingToken)
 		}
 	}
-	d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] ------------ CreateLVMLogicalVolume end ------------", traceID, volumeID))
 
-	d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] start wait CreateLVMLogicalVolume", traceID, volumeID))
+	end := total
+	if request.MaxEntries > 0 && start+int(request.MaxEntries) < end {
+		end = start + int(request.MaxEntries)
+	}
 
-	attemptCounter, err := utils.WaitForStatusUpdate(ctx, d.cl, d.log, traceID, request.Name, "", *llvSize, resizeDelta)
+	lvgs, err := utils.GetLVGList(ctx, d.cl)
 	if err != nil {
-		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error WaitForStatusUpdate. Delete LVMLogicalVolume %s", traceID, volumeID, request.Name))
+		d.log.Error(err, fmt.Sprintf("[ListVolumes][traceID:%s] unable to list LVMVolumeGroups", traceID))
+		return nil, status.Errorf(codes.Internal, "unable to list LVMVolumeGroups: %s", err.Error())
+	}
+	lvgNodes := utils.GetLVGNodeNames(lvgs.Items)
 
-		deleteErr := utils.DeleteLVMLogicalVolume(ctx, d.cl, d.log, traceID, request.Name)
-		if deleteErr != nil {
-			d.log.Error(deleteErr, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error DeleteLVMLogicalVolume", traceID, volumeID))
+	deviceNodes := make(map[string]string)
+	if end > len(llvs) {
+		devices := &v1alpha1.BlockDeviceList{}
+		err = d.cl.List(ctx, devices)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[ListVolumes][traceID:%s] unable to list BlockDevices", traceID))
+			return nil, status.Errorf(codes.Internal, "unable to list BlockDevices: %s", err.Error())
+		}
+		for _, device := range devices.Items {
+			deviceNodes[device.Name] = device.Status.NodeName
 		}
-
-		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error creating LVMLogicalVolume", traceID, volumeID))
-		return nil, err
 	}
-	d.log.Trace(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] finish wait CreateLVMLogicalVolume, attempt counter = %d", traceID, volumeID, attemptCounter))
 
-	volumeCtx := make(map[string]string, len(request.Parameters))
-	for k, v := range request.Parameters {
-		volumeCtx[k] = v
-	}
+	segmentsByNode := make(map[string]map[string]string)
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, end-start)
+	for i := start; i < end; i++ {
+		var (
+			volume   *csi.Volume
+			nodeName string
+		)
+		if i < len(llvs) {
+			nodeName = lvgNodes[llvs[i].Spec.LVMVolumeGroupName]
+			volume = llvToCSIVolume(&llvs[i], d.nodeTopology(ctx, traceID, "ListVolumes", nodeName, segmentsByNode))
+		} else {
+			pv := &rawPVs[i-len(llvs)]
+			nodeName = deviceNodes[pv.Spec.CSI.VolumeAttributes[internal.RawDeviceNameKey]]
+			volume = rawDevicePVToCSIVolume(pv, d.nodeTopology(ctx, traceID, "ListVolumes", nodeName, segmentsByNode))
+		}
 
-	volumeCtx[internal.SubPath] = request.Name
-	volumeCtx[internal.VGNameKey] = selectedLVG.Spec.ActualVGNameOnTheNode
-	if llvSpec.Type == internal.LVMTypeThin {
-		volumeCtx[internal.ThinPoolNameKey] = llvSpec.Thin.PoolName
-	} else {
-		volumeCtx[internal.ThinPoolNameKey] = ""
+		entry := &csi.ListVolumesResponse_Entry{
+			Volume: volume,
+			Status: &csi.ListVolumesResponse_VolumeStatus{},
+		}
+
+		// a local volume might be used only on the node where its LV or device resides
+		if nodeName != "" {
+			entry.Status.PublishedNodeIds = []string{nodeName}
+		}
+
+		entries = append(entries, entry)
 	}
 
-	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] Volume created successfully. volumeCtx: %+v", traceID, volumeID, volumeCtx))
+	var nextToken string
+	if end < total {
+		nextToken = strconv.Itoa(end)
+	}
 
-	return &csi.CreateVolumeResponse{
-		Volume: &csi.Volume{
-			CapacityBytes: request.CapacityRange.GetRequiredBytes(),
-			VolumeId:      request.Name,
-			VolumeContext: volumeCtx,
-			ContentSource: request.VolumeContentSource,
-			AccessibleTopology: []*csi.Topology{
-				{Segments: map[string]string{
-					internal.TopologyKey: preferredNode,
-				}},
-			},
-		},
+	d.log.Info(fmt.Sprintf("[ListVolumes][traceID:%s] return %d volumes, next token: %q", traceID, len(entries), nextToken))
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: nextToken,
 	}, nil
 }
 
-func (d *Driver) DeleteVolume(ctx context.Context, request *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
-	traceID := uuid.New().String()
-	d.log.Info("[DeleteVolume][traceID:%s] ========== Start DeleteVolume ============", traceID)
-	if len(request.VolumeId) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "Volume ID cannot be empty")
+// nodeTopology returns the topology of the volumes on the node with the segments NodeGetInfo reports for it, or nil if
+// the node is unknown. Only the node key is reported if the node is not found. The segments are cached by the node
+// name in segmentsByNode unless it is nil, so a node is got once per call.
+func (d *Driver) nodeTopology(ctx context.Context, traceID, method, nodeName string, segmentsByNode map[string]map[string]string) []*csi.Topology {
+	if nodeName == "" {
+		return nil
 	}
 
-	err := utils.DeleteLVMLogicalVolume(ctx, d.cl, d.log, traceID, request.VolumeId)
-	if err != nil {
-		d.log.Error(err, "error DeleteLVMLogicalVolume")
+	segments, cached := segmentsByNode[nodeName]
+	if !cached {
+		var err error
+		segments, err = utils.GetNodeTopologySegments(ctx, d.cl, nodeName, d.topologyKeys)
+		if err != nil {
+			d.log.Warning(fmt.Sprintf("[%s][traceID:%s] unable to get the topology segments of the node %s, only the node key is reported: %v", method, traceID, nodeName, err))
+			segments = map[string]string{internal.TopologyKey: nodeName}
+		}
+		if segmentsByNode != nil {
+			segmentsByNode[nodeName] = segments
+		}
 	}
-	d.log.Info(fmt.Sprintf("[DeleteVolume][traceID:%s][volumeID:%s] Volume deleted successfully", traceID, request.VolumeId))
-	d.log.Info("[DeleteVolume][traceID:%s] ========== END DeleteVolume ============", traceID)
-	return &csi.DeleteVolumeResponse{}, nil
-}
 
-func (d *Driver) ControllerPublishVolume(_ context.Context, request *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	d.log.Info("method ControllerPublishVolume")
-	return &csi.ControllerPublishVolumeResponse{
-		PublishContext: map[string]string{
-			d.publishInfoVolumeName: request.VolumeId,
-		},
-	}, nil
+	return []*csi.Topology{{Segments: segments}}
 }
 
-func (d *Driver) ControllerUnpublishVolume(_ context.Context, _ *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
-	d.log.Info("method ControllerUnpublishVolume")
-	// todo called Immediate
-	return &csi.ControllerUnpublishVolumeResponse{}, nil
-}
+func llvToCSIVolume(llv *v1alpha1.LVMLogicalVolume, topology []*csi.Topology) *csi.Volume {
+	volume := &csi.Volume{
+		VolumeId:           utils.VolumeIDForLLV(llv),
+		AccessibleTopology: topology,
+	}
 
-func (d *Driver) ValidateVolumeCapabilities(_ context.Context, _ *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
-	d.log.Info("call method ValidateVolumeCapabilities")
-	return nil, nil
-}
+	if llv.Status != nil && !llv.Status.ActualSize.IsZero() {
+		volume.CapacityBytes = llv.Status.ActualSize.Value()
+	} else if size, err := resource.ParseQuantity(llv.Spec.Size); err == nil {
+		volume.CapacityBytes = size.Value()
+	}
 
-func (d *Driver) ListVolumes(_ context.Context, _ *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
-	d.log.Info("call method ListVolumes")
-	return nil, nil
+	if llv.Spec.Source != nil {
+		switch llv.Spec.Source.Kind {
+		case sourceVolumeKindSnapshot:
+			volume.ContentSource = &csi.VolumeContentSource{
+				Type: &csi.VolumeContentSource_Snapshot{
+					Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: llv.Spec.Source.Name},
+				},
+			}
+		case sourceVolumeKindVolume:
+			volume.ContentSource = &csi.VolumeContentSource{
+				Type: &csi.VolumeContentSource_Volume{
+					Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: llv.Spec.Source.Name},
+				},
+			}
+		}
+	}
+
+	return volume
 }
 
-func (d *Driver) GetCapacity(_ context.Context, _ *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	d.log.Info("method GetCapacity")
+func (d *Driver) GetCapacity(ctx context.Context, request *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	traceID := traceIDFromContext(ctx)
+
+	d.log.Info(fmt.Sprintf("[GetCapacity][traceID:%s] method GetCapacity", traceID))
+	d.log.Trace(fmt.Sprintf("[GetCapacity][traceID:%s] request: %s", traceID, request.String()))
+
+	if request.Parameters[internal.TypeKey] != internal.Lvm || len(request.Parameters[internal.LVMVolumeGroupKey]) == 0 {
+		d.log.Debug(fmt.Sprintf("[GetCapacity][traceID:%s] the request has no LVMVolumeGroups in the parameters. Return zero capacity", traceID))
+		return &csi.GetCapacityResponse{}, nil
+	}
+
+	lvmType := request.Parameters[internal.LvmTypeKey]
+	storageClassLVGs, storageClassLVGParametersMap, err := utils.GetStorageClassLVGsAndParameters(ctx, d.cl, d.log, request.Parameters[internal.LVMVolumeGroupKey])
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[GetCapacity][traceID:%s] error GetStorageClassLVGs", traceID))
+		return nil, status.Errorf(codes.Internal, "error during GetStorageClassLVGs: %s", err.Error())
+	}
+
+	storageClassLVGs, staleLVGs := utils.ApplyStaleLVGPolicy(storageClassLVGs, d.staleLVGPolicy, time.Now())
+	if len(staleLVGs) != 0 {
+		d.log.Warning(fmt.Sprintf("[GetCapacity][traceID:%s] capacity data of the LVMVolumeGroups %v is stale, the policy %s is applied", traceID, staleLVGs, d.staleLVGPolicy.Action))
+	}
+
+	if request.AccessibleTopology != nil {
+		topologyNodes, err := d.listTopologyNodes(ctx, request.AccessibleTopology)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[GetCapacity][traceID:%s] error listTopologyNodes", traceID))
+			return nil, status.Errorf(codes.Internal, "unable to list the nodes: %s", err.Error())
+		}
+
+		nodeNames := utils.GetTopologyNodeNames(request.AccessibleTopology, topologyNodes)
+		storageClassLVGs = utils.FilterLVGsByNodeNames(storageClassLVGs, nodeNames)
+		d.log.Debug(fmt.Sprintf("[GetCapacity][traceID:%s] %d LVMVolumeGroups belong to the nodes %v", traceID, len(storageClassLVGs), nodeNames))
+	}
+
+	// The LVMVolumeGroup status does not provide the largest contiguous free segment, so the free space of
+	// the VG (or of the thin pool) is the best estimation of the maximum volume size we have.
+	available, maximum, err := utils.GetLVGsCapacity(storageClassLVGs, storageClassLVGParametersMap, lvmType)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[GetCapacity][traceID:%s] unable to count the capacity", traceID))
+		return nil, status.Errorf(codes.Internal, "unable to count the capacity: %s", err.Error())
+	}
 
-	// todo MaxSize one PV
-	// todo call volumeBindingMode: WaitForFirstConsumer
+	// Every volume size is rounded up to the extent size, so the smallest volume is one extent and the biggest one
+	// is the whole number of extents fitting into the free space.
+	minimum := resource.MustParse(internal.LVMExtentSize)
+	maximum.Set(maximum.Value() / minimum.Value() * minimum.Value())
+	d.log.Info(fmt.Sprintf("[GetCapacity][traceID:%s] available capacity: %s, maximum volume size: %s, minimum volume size: %s", traceID, available.String(), maximum.String(), minimum.String()))
 
 	return &csi.GetCapacityResponse{
-		AvailableCapacity: 1000000,
-		MaximumVolumeSize: nil,
-		MinimumVolumeSize: nil,
+		AvailableCapacity: available.Value(),
+		MaximumVolumeSize: &wrappers.Int64Value{Value: maximum.Value()},
+		MinimumVolumeSize: &wrappers.Int64Value{Value: minimum.Value()},
 	}, nil
 }
 
@@ -358,6 +1405,12 @@ func (d *Driver) ControllerGetCapabilities(_ context.Context, _ *csi.ControllerG
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+		csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
 	}
 
 	csiCaps := make([]*csi.ControllerServiceCapability, len(capabilities))
@@ -377,12 +1430,24 @@ func (d *Driver) ControllerGetCapabilities(_ context.Context, _ *csi.ControllerG
 }
 
 func (d *Driver) CreateSnapshot(ctx context.Context, request *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
-	traceID := uuid.New().String()
+	traceID := traceIDFromContext(ctx)
 
 	d.log.Trace(fmt.Sprintf("[CreateSnapshot][traceID:%s] ========== CreateSnapshot ============", traceID))
 	d.log.Trace(request.String())
 
-	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, request.SourceVolumeId, "")
+	release, err := d.lockVolume(ctx, traceID, "CreateSnapshot", request.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	snapshotOptions, err := utils.GetSnapshotOptions(request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] error GetSnapshotOptions", traceID, request.Name))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid snapshot class parameters: %s", err.Error())
+	}
+
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(request.SourceVolumeId), "")
 	if err != nil {
 		d.log.Error(err, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] error getting LVMLogicalVolume", traceID, request.SourceVolumeId))
 		return nil, status.Errorf(codes.Internal, "error getting LVMLogicalVolume %s: %s", request.SourceVolumeId, err.Error())
@@ -396,6 +1461,10 @@ func (d *Driver) CreateSnapshot(ctx context.Context, request *csi.CreateSnapshot
 		return nil, status.Errorf(codes.FailedPrecondition, "Source LVMLogicalVolume '%s' ActualSize is unknown", request.SourceVolumeId)
 	}
 
+	if snapshotOptions.ThinPoolName != "" && snapshotOptions.ThinPoolName != llv.Spec.Thin.PoolName {
+		return nil, status.Errorf(codes.InvalidArgument, "the snapshot is requested in the thin pool %s, but it can only be created in the thin pool %s of the source volume", snapshotOptions.ThinPoolName, llv.Spec.Thin.PoolName)
+	}
+
 	lvg, err := utils.GetLVMVolumeGroup(ctx, d.cl, llv.Spec.LVMVolumeGroupName)
 	if err != nil {
 		d.log.Error(
@@ -412,17 +1481,18 @@ func (d *Driver) CreateSnapshot(ctx context.Context, request *csi.CreateSnapshot
 
 	freeSpace, err := utils.GetLVMThinPoolFreeSpace(*lvg, llv.Spec.Thin.PoolName)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "get free space for thin pool %s in lvg %s: %v", llv.Spec.Thin.PoolName, lvg.Name, err)
+		return nil, status.Errorf(codes.FailedPrecondition, "get free space for thin pool %s in lvg %s: %v", llv.Spec.Thin.PoolName, lvg.Name, err)
 	}
 
-	if freeSpace.Value() < llv.Status.ActualSize.Value() {
+	requiredSpace := snapshotOptions.RequiredSpace(llv.Status.ActualSize)
+	if freeSpace.Value() < requiredSpace.Value() {
 		return nil, status.Errorf(
-			codes.FailedPrecondition,
+			codes.ResourceExhausted,
 			"not enough space in pool %s (lvg %s): %s; need at least %s",
 			llv.Spec.Thin.PoolName,
 			lvg.Name,
 			freeSpace.String(),
-			llv.Status.ActualSize.String(),
+			requiredSpace.String(),
 		)
 	}
 
@@ -437,6 +1507,15 @@ func (d *Driver) CreateSnapshot(ctx context.Context, request *csi.CreateSnapshot
 		actualNameOnTheNode = name
 	}
 
+	// the filesystem is frozen by the node plugin, so the snapshot is consistent
+	if snapshotOptions.FSFreeze {
+		thaw, err := d.freezeSourceVolume(ctx, traceID, llv.Name, name)
+		if err != nil {
+			return nil, err
+		}
+		defer thaw()
+	}
+
 	_, err = utils.CreateLVMLogicalVolumeSnapshot(
 		ctx,
 		d.cl,
@@ -447,6 +1526,7 @@ func (d *Driver) CreateSnapshot(ctx context.Context, request *csi.CreateSnapshot
 			ActualSnapshotNameOnTheNode: actualNameOnTheNode,
 			LVMLogicalVolumeName:        llv.Name,
 		},
+		snapshotAnnotations(llv),
 	)
 	if err != nil {
 		if kerrors.IsAlreadyExists(err) {
@@ -461,7 +1541,9 @@ func (d *Driver) CreateSnapshot(ctx context.Context, request *csi.CreateSnapshot
 	if err != nil {
 		d.log.Error(err, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] error WaitForStatusUpdate. DeleteLVMLogicalVolumeSnapshot %s", traceID, name, request.Name))
 
-		deleteErr := utils.DeleteLVMLogicalVolumeSnapshot(ctx, d.cl, d.log, traceID, request.Name)
+		rollbackCtx, cancelRollback := context.WithTimeout(context.WithoutCancel(ctx), internal.RollbackTimeout)
+		defer cancelRollback()
+		deleteErr := utils.DeleteLVMLogicalVolumeSnapshot(rollbackCtx, d.cl, d.log, traceID, request.Name)
 		if deleteErr != nil {
 			d.log.Error(deleteErr, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] error DeleteLVMLogicalVolumeSnapshot", traceID, name))
 		}
@@ -471,6 +1553,19 @@ func (d *Driver) CreateSnapshot(ctx context.Context, request *csi.CreateSnapshot
 	}
 	d.log.Trace(fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] finish wait CreateLVMLogicalVolume, attempt counter = %d", traceID, name, attemptCounter))
 
+	if snapshotOptions.FSFreeze {
+		err = d.checkSourceVolumeFrozen(ctx, llv.Name, name)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] the snapshot is inconsistent. DeleteLVMLogicalVolumeSnapshot %s", traceID, name, name))
+			rollbackCtx, cancelRollback := context.WithTimeout(context.WithoutCancel(ctx), internal.RollbackTimeout)
+			defer cancelRollback()
+			if deleteErr := utils.DeleteLVMLogicalVolumeSnapshot(rollbackCtx, d.cl, d.log, traceID, name); deleteErr != nil {
+				d.log.Error(deleteErr, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] error DeleteLVMLogicalVolumeSnapshot", traceID, name))
+			}
+			return nil, err
+		}
+	}
+
 	sourceSizeQty, err := resource.ParseQuantity(llv.Spec.Size)
 	if err != nil {
 		d.log.Error(err, fmt.Sprintf("[CreateSnapshot][traceID:%s] error parsing quantity %s", traceID, llv.Spec.Size))
@@ -496,16 +1591,22 @@ func (d *Driver) DeleteSnapshot(ctx context.Context, request *csi.DeleteSnapshot
 		return nil, status.Error(codes.InvalidArgument, "SnapshotId ID cannot be empty")
 	}
 
-	traceID := uuid.New().String()
+	traceID := traceIDFromContext(ctx)
 	d.log.Trace(fmt.Sprintf("[DeleteSnapshot][traceID:%s] ========== DeleteSnapshot ============", traceID))
 	d.log.Trace(request.String())
 
+	release, err := d.lockVolume(ctx, traceID, "DeleteSnapshot", request.SnapshotId)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	if err := utils.DeleteLVMLogicalVolumeSnapshot(ctx, d.cl, d.log, traceID, request.SnapshotId); err != nil {
 		d.log.Error(err, "error DeleteLVMLogicalVolume")
 	}
 
 	d.log.Info(fmt.Sprintf("[Snapshot][traceID:%s][SnapshotId:%s] Snapshot deleted successfully", traceID, request.SnapshotId))
-	d.log.Info("[Snapshot][traceID:%s] ========== END Snapshot ============", traceID)
+	d.log.Info(fmt.Sprintf("[Snapshot][traceID:%s] ========== END Snapshot ============", traceID))
 	return &csi.DeleteSnapshotResponse{}, nil
 }
 
@@ -515,7 +1616,7 @@ func (d *Driver) ListSnapshots(_ context.Context, _ *csi.ListSnapshotsRequest) (
 }
 
 func (d *Driver) ControllerExpandVolume(ctx context.Context, request *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	traceID := uuid.New().String()
+	traceID := traceIDFromContext(ctx)
 
 	d.log.Info(fmt.Sprintf("[ControllerExpandVolume][traceID:%s] method ControllerExpandVolume", traceID))
 	d.log.Trace(fmt.Sprintf("[ControllerExpandVolume][traceID:%s] ========== ControllerExpandVolume ============", traceID))
@@ -527,21 +1628,41 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, request *csi.Contro
 		return nil, status.Error(codes.InvalidArgument, "Volume id cannot be empty")
 	}
 
-	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, volumeID, "")
+	release, err := d.lockVolume(ctx, traceID, "ControllerExpandVolume", volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(volumeID), "")
 	if err != nil {
+		if _, _, static := staticvolume.ParseVolumeHandle(volumeID); static && kerrors.IsNotFound(err) {
+			d.log.Warning(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] the static volume has not been adopted yet", traceID, volumeID))
+			return nil, status.Errorf(codes.FailedPrecondition, "the static volume %s has not been adopted by an LVMLogicalVolume yet", volumeID)
+		}
 		d.log.Error(err, fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] error getting LVMLogicalVolume", traceID, volumeID))
 		return nil, status.Errorf(codes.Internal, "error getting LVMLogicalVolume: %s", err.Error())
 	}
 
-	resizeDelta, err := resource.ParseQuantity(internal.ResizeDelta)
+	waitOptions, err := utils.GetWaitOptions(llv.Annotations, d.waitOptions)
 	if err != nil {
-		d.log.Error(err, fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] error ParseQuantity for ResizeDelta", traceID, volumeID))
-		return nil, err
+		d.log.Warning(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] invalid wait options in the LVMLogicalVolume annotations, the default ones are used: %s", traceID, volumeID, err.Error()))
+		waitOptions = d.waitOptions
 	}
+	resizeDelta := waitOptions.ResizeDelta
 	d.log.Trace(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] resizeDelta: %s", traceID, volumeID, resizeDelta.String()))
 	requestCapacity := resource.NewQuantity(request.CapacityRange.GetRequiredBytes(), resource.BinarySI)
 	d.log.Trace(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] requestCapacity: %s", traceID, volumeID, requestCapacity.String()))
 
+	// the expansion request has no storage class parameters, so the limit is stored in the annotations at the creation
+	maxSize, err := utils.ParseMaxSize(llv.Annotations)
+	if err != nil {
+		d.log.Warning(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] invalid maximum volume size in the LVMLogicalVolume annotations, it is ignored: %s", traceID, volumeID, err.Error()))
+	} else if maxSize > 0 && requestCapacity.Value() > maxSize {
+		d.log.Warning(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] requested size %s exceeds the maximum volume size %d of the storage class", traceID, volumeID, requestCapacity.String(), maxSize))
+		return nil, status.Errorf(codes.OutOfRange, "requested size %s exceeds the maximum volume size %s of the storage class", requestCapacity.String(), llv.Annotations[internal.MaxSizeKey])
+	}
+
 	nodeExpansionRequired := true
 	if request.GetVolumeCapability().GetBlock() != nil {
 		nodeExpansionRequired = false
@@ -567,19 +1688,54 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, request *csi.Contro
 
 		if lvgFreeSpace.Value() < (requestCapacity.Value() - llv.Status.ActualSize.Value()) {
 			d.log.Error(err, fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] requested size: %s is greater than the capacity of the LVMVolumeGroup: %s", traceID, volumeID, requestCapacity.String(), lvgFreeSpace.String()))
-			return nil, status.Errorf(codes.Internal, "requested size: %s is greater than the capacity of the LVMVolumeGroup: %s", requestCapacity.String(), lvgFreeSpace.String())
+			return nil, status.Errorf(codes.ResourceExhausted, "requested size: %s is greater than the capacity of the LVMVolumeGroup: %s", requestCapacity.String(), lvgFreeSpace.String())
+		}
+	}
+
+	if llv.Spec.Type == internal.LVMTypeThin && llv.Spec.Thin != nil {
+		growth := resource.NewQuantity(requestCapacity.Value()-llv.Status.ActualSize.Value(), resource.BinarySI)
+		thinPoolFreeSpace, err := utils.GetLVMThinPoolFreeSpace(*lvg, llv.Spec.Thin.PoolName)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] error GetLVMThinPoolFreeSpace", traceID, volumeID))
+			return nil, status.Errorf(codes.Internal, "error getting the thin pool %s free space: %v", llv.Spec.Thin.PoolName, err)
+		}
+
+		if thinPoolFreeSpace.Value() < growth.Value() {
+			d.log.Warning(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] the volume growth %s is greater than the free space of the thin pool %s: %s", traceID, volumeID, growth.String(), llv.Spec.Thin.PoolName, thinPoolFreeSpace.String()))
+			return nil, status.Errorf(codes.ResourceExhausted, "the volume growth %s is greater than the free space of the thin pool %s: %s", growth.String(), llv.Spec.Thin.PoolName, thinPoolFreeSpace.String())
+		}
+
+		// the factor is stored in the LVMLogicalVolume annotations as the expansion request has no StorageClass parameters
+		overprovisioningFactor, err := utils.ParseOverprovisioningFactor(llv.Annotations)
+		if err != nil {
+			d.log.Warning(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] invalid overprovisioning factor in the LVMLogicalVolume annotations, it is ignored: %s", traceID, volumeID, err.Error()))
+		}
+
+		if overprovisioningFactor > 0 {
+			exceeds, err := utils.ExceedsOverprovisioningFactor(*lvg, llv.Spec.Thin.PoolName, *growth, overprovisioningFactor)
+			if err != nil {
+				d.log.Error(err, fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] error ExceedsOverprovisioningFactor", traceID, volumeID))
+				return nil, status.Errorf(codes.Internal, "error checking the overprovisioning factor: %v", err)
+			}
+			if exceeds {
+				d.log.Warning(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] the thin pool %s would exceed the overprovisioning factor %g", traceID, volumeID, llv.Spec.Thin.PoolName, overprovisioningFactor))
+				return nil, status.Errorf(codes.ResourceExhausted, "the thin pool %s of the LVMVolumeGroup %s would exceed the overprovisioning factor %g", llv.Spec.Thin.PoolName, lvg.Name, overprovisioningFactor)
+			}
 		}
 	}
 
 	d.log.Info(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] start resize LVMLogicalVolume", traceID, volumeID))
 	d.log.Info(fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] requested size: %s, actual size: %s", traceID, volumeID, requestCapacity.String(), llv.Status.ActualSize.String()))
-	err = utils.ExpandLVMLogicalVolume(ctx, d.cl, llv, requestCapacity.String())
+	err = utils.ExpandLVMLogicalVolume(ctx, d.cl, traceID, llv, requestCapacity.String())
 	if err != nil {
 		d.log.Error(err, fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] error updating LVMLogicalVolume", traceID, volumeID))
 		return nil, status.Errorf(codes.Internal, "error updating LVMLogicalVolume: %v", err)
 	}
 
-	attemptCounter, err := utils.WaitForStatusUpdate(ctx, d.cl, d.log, traceID, llv.Name, llv.Namespace, *requestCapacity, resizeDelta)
+	waitCtx, cancel := context.WithTimeout(ctx, waitOptions.Timeout)
+	defer cancel()
+
+	attemptCounter, err := utils.WaitForStatusUpdate(waitCtx, d.cache, d.log, traceID, llv.Name, llv.Namespace, *requestCapacity, resizeDelta)
 	if err != nil {
 		d.log.Error(err, fmt.Sprintf("[ControllerExpandVolume][traceID:%s][volumeID:%s] error WaitForStatusUpdate", traceID, volumeID))
 		return nil, err
@@ -594,12 +1750,270 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, request *csi.Contro
 	}, nil
 }
 
-func (d *Driver) ControllerGetVolume(_ context.Context, _ *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
-	d.log.Info(" call method ControllerGetVolume")
-	return &csi.ControllerGetVolumeResponse{}, nil
+func (d *Driver) ControllerGetVolume(ctx context.Context, request *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	traceID := traceIDFromContext(ctx)
+	volumeID := request.GetVolumeId()
+	d.log.Info(fmt.Sprintf("[ControllerGetVolume][traceID:%s][volumeID:%s] method ControllerGetVolume", traceID, volumeID))
+
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume id cannot be empty")
+	}
+
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(volumeID), "")
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			// the raw device volume has no LVMLogicalVolume, only its PV
+			pv, err := utils.GetRawDevicePV(ctx, d.cl, d.name, volumeID)
+			if err != nil {
+				d.log.Error(err, fmt.Sprintf("[ControllerGetVolume][traceID:%s][volumeID:%s] error GetRawDevicePV", traceID, volumeID))
+				return nil, status.Errorf(codes.Internal, "error getting the PersistentVolume of the volume: %s", err.Error())
+			}
+			if pv != nil {
+				return d.getRawDeviceVolume(ctx, traceID, pv)
+			}
+
+			return nil, status.Errorf(codes.NotFound, "LVMLogicalVolume %s not found", volumeID)
+		}
+		d.log.Error(err, fmt.Sprintf("[ControllerGetVolume][traceID:%s][volumeID:%s] error getting LVMLogicalVolume", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error getting LVMLogicalVolume: %s", err.Error())
+	}
+
+	lvg, err := utils.GetLVMVolumeGroup(ctx, d.cl, llv.Spec.LVMVolumeGroupName)
+	if err != nil && !kerrors.IsNotFound(err) {
+		d.log.Error(err, fmt.Sprintf("[ControllerGetVolume][traceID:%s][volumeID:%s] error getting LVMVolumeGroup", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error getting LVMVolumeGroup: %s", err.Error())
+	}
+	if kerrors.IsNotFound(err) {
+		lvg = nil
+	}
+
+	var nodeName string
+	if lvg != nil {
+		nodeName = lvg.Spec.Local.NodeName
+	}
+
+	volumeStatus := &csi.ControllerGetVolumeResponse_VolumeStatus{
+		VolumeCondition: getVolumeCondition(llv, lvg),
+	}
+	if nodeName != "" {
+		volumeStatus.PublishedNodeIds = []string{nodeName}
+	}
+	d.log.Info(fmt.Sprintf("[ControllerGetVolume][traceID:%s][volumeID:%s] volume condition: abnormal=%t, message: %s", traceID, volumeID, volumeStatus.VolumeCondition.Abnormal, volumeStatus.VolumeCondition.Message))
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: llvToCSIVolume(llv, d.nodeTopology(ctx, traceID, "ControllerGetVolume", nodeName, nil)),
+		Status: volumeStatus,
+	}, nil
+}
+
+// getVolumeCondition reports the volume as abnormal if the LVMLogicalVolume failed, its LVMVolumeGroup is not ready
+// (e.g. a PV is missing) or its thin pool is out of space.
+func getVolumeCondition(llv *v1alpha1.LVMLogicalVolume, lvg *v1alpha1.LVMVolumeGroup) *csi.VolumeCondition {
+	if llv.Status != nil && llv.Status.Phase == utils.LLVStatusFailed {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("LVMLogicalVolume %s is in the %s phase: %s", llv.Name, llv.Status.Phase, llv.Status.Reason),
+		}
+	}
+
+	if lvg == nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("LVMVolumeGroup %s not found", llv.Spec.LVMVolumeGroupName),
+		}
+	}
+
+	if lvg.Status.Phase != utils.LVGStatusReady {
+		reasons := make([]string, 0, len(lvg.Status.Conditions))
+		for _, c := range lvg.Status.Conditions {
+			if c.Status != metav1.ConditionTrue {
+				reasons = append(reasons, fmt.Sprintf("%s: %s", c.Type, c.Message))
+			}
+		}
+
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("LVMVolumeGroup %s is in the %s phase: %s", lvg.Name, lvg.Status.Phase, strings.Join(reasons, "; ")),
+		}
+	}
+
+	if llv.Spec.Type == internal.LVMTypeThin && llv.Spec.Thin != nil {
+		for _, tp := range lvg.Status.ThinPools {
+			if tp.Name != llv.Spec.Thin.PoolName {
+				continue
+			}
+
+			if !tp.Ready {
+				return &csi.VolumeCondition{
+					Abnormal: true,
+					Message:  fmt.Sprintf("thin pool %s of the LVMVolumeGroup %s is not ready: %s", tp.Name, lvg.Name, tp.Message),
+				}
+			}
+
+			if tp.UsedSize.Cmp(tp.ActualSize) >= 0 {
+				return &csi.VolumeCondition{
+					Abnormal: true,
+					Message:  fmt.Sprintf("thin pool %s of the LVMVolumeGroup %s is out of space", tp.Name, lvg.Name),
+				}
+			}
+		}
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is healthy",
+	}
 }
 
-func (d *Driver) ControllerModifyVolume(_ context.Context, _ *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
-	d.log.Info(" call method ControllerModifyVolume")
+func (d *Driver) ControllerModifyVolume(ctx context.Context, request *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	traceID := traceIDFromContext(ctx)
+	volumeID := request.GetVolumeId()
+	d.log.Info(fmt.Sprintf("[ControllerModifyVolume][traceID:%s][volumeID:%s] method ControllerModifyVolume, mutable parameters: %+v", traceID, volumeID, request.MutableParameters))
+
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume id cannot be empty")
+	}
+
+	contiguous, annotations, err := parseMutableParameters(request.MutableParameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[ControllerModifyVolume][traceID:%s][volumeID:%s] invalid mutable parameters", traceID, volumeID))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mutable parameters: %s", err.Error())
+	}
+
+	release, err := d.lockVolume(ctx, traceID, "ControllerModifyVolume", volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(volumeID), "")
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "LVMLogicalVolume %s not found", volumeID)
+		}
+		d.log.Error(err, fmt.Sprintf("[ControllerModifyVolume][traceID:%s][volumeID:%s] error getting LVMLogicalVolume", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error getting LVMLogicalVolume: %s", err.Error())
+	}
+
+	if contiguous != nil && llv.Spec.Type != internal.LVMTypeThick {
+		return nil, status.Errorf(codes.InvalidArgument, "parameter %s might be set only for %s volumes", internal.LVMVThickContiguousParamKey, internal.LVMTypeThick)
+	}
+
+	if pool, ok := request.MutableParameters[internal.ThinPoolKey]; ok && (llv.Spec.Thin == nil || llv.Spec.Thin.PoolName != pool) {
+		return nil, status.Errorf(codes.InvalidArgument, "the thin pool of the existing volume can not be changed to %s", pool)
+	}
+
+	if _, ok := annotations[internal.EncryptionReencryptKey]; ok && annotations[internal.EncryptionKeySecretKey] == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "parameter %s requires %s", internal.EncryptionReencryptKey, internal.EncryptionKeySecretKey)
+	}
+
+	if _, ok := annotations[internal.EncryptionKeySecretKey]; ok {
+		if !utils.IsEncrypted(llv.Annotations) {
+			return nil, status.Errorf(codes.InvalidArgument, "the key of the volume might be rotated only if the volume is encrypted")
+		}
+		if _, ok := annotations[internal.EncryptionReencryptKey]; !ok {
+			annotations[internal.EncryptionReencryptKey] = strconv.FormatBool(false)
+		}
+		if isKeyRotationRequested(llv, annotations) {
+			d.log.Info(fmt.Sprintf("[ControllerModifyVolume][traceID:%s][volumeID:%s] the encryption key rotation is requested with the secret %s", traceID, volumeID, annotations[internal.EncryptionKeySecretKey]))
+			annotations[internal.EncryptionRotationStatusKey] = internal.EncryptionRotationPending
+			annotations[internal.EncryptionRotationMessageKey] = ""
+		}
+	}
+
+	err = utils.ModifyLVMLogicalVolume(ctx, d.cl, llv, contiguous, annotations)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[ControllerModifyVolume][traceID:%s][volumeID:%s] error updating LVMLogicalVolume", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error updating LVMLogicalVolume: %s", err.Error())
+	}
+
+	if contiguous != nil {
+		attemptCounter, err := utils.WaitForContiguousUpdate(ctx, d.cache, d.log, traceID, llv.Name, *contiguous)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[ControllerModifyVolume][traceID:%s][volumeID:%s] error WaitForContiguousUpdate", traceID, volumeID))
+			return nil, status.Errorf(codes.Internal, "error waiting for the contiguous allocation to be applied: %s", err.Error())
+		}
+		d.log.Trace(fmt.Sprintf("[ControllerModifyVolume][traceID:%s][volumeID:%s] finish wait for the contiguous allocation, attempt counter = %d", traceID, volumeID, attemptCounter))
+	}
+
+	d.log.Info(fmt.Sprintf("[ControllerModifyVolume][traceID:%s][volumeID:%s] Volume modified successfully", traceID, volumeID))
 	return &csi.ControllerModifyVolumeResponse{}, nil
 }
+
+// snapshotAnnotations returns the annotations of the source volume the snapshot keeps, so the volumes restored from
+// the snapshot are checked against them even if the source volume is deleted.
+func snapshotAnnotations(llv *v1alpha1.LVMLogicalVolume) map[string]string {
+	if encryption, ok := llv.Annotations[internal.EncryptionKey]; ok {
+		return map[string]string{internal.EncryptionKey: encryption}
+	}
+
+	return nil
+}
+
+// isKeyRotationRequested reports whether the requested key rotation differs from the one already done or in progress,
+// so the repeated calls with the same VolumeAttributesClass do not restart the rotation.
+func isKeyRotationRequested(llv *v1alpha1.LVMLogicalVolume, annotations map[string]string) bool {
+	if _, ok := llv.Annotations[internal.EncryptionRotationStatusKey]; !ok {
+		return true
+	}
+
+	return llv.Annotations[internal.EncryptionKeySecretKey] != annotations[internal.EncryptionKeySecretKey] ||
+		llv.Annotations[internal.EncryptionReencryptKey] != annotations[internal.EncryptionReencryptKey]
+}
+
+// parseMutableParameters validates the mutable parameters and splits them into the contiguous allocation policy
+// (the part of the LVMLogicalVolume spec) and the attributes to be stored in the LVMLogicalVolume annotations.
+func parseMutableParameters(params map[string]string) (*bool, map[string]string, error) {
+	var contiguous *bool
+	annotations := make(map[string]string, len(params))
+	for key, value := range params {
+		switch key {
+		case internal.LVMVThickContiguousParamKey:
+			val, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parameter %s must be a boolean: %w", key, err)
+			}
+			contiguous = &val
+		case internal.ThinPoolKey:
+			// the thin pool is chosen on the volume creation, the caller checks it is not changed
+			continue
+		case internal.DiscardKey:
+			if _, err := strconv.ParseBool(value); err != nil {
+				return nil, nil, fmt.Errorf("parameter %s must be a boolean: %w", key, err)
+			}
+			annotations[key] = value
+		case internal.EncryptionKeySecretKey:
+			if _, _, err := utils.ParseSecretRef(value); err != nil {
+				return nil, nil, fmt.Errorf("parameter %s: %w", key, err)
+			}
+			annotations[key] = value
+		case internal.EncryptionReencryptKey:
+			val, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parameter %s must be a boolean: %w", key, err)
+			}
+			annotations[key] = strconv.FormatBool(val)
+		case internal.QoSReadBPSKey, internal.QoSWriteBPSKey:
+			q, err := resource.ParseQuantity(value)
+			if err != nil || q.Sign() < 0 {
+				return nil, nil, fmt.Errorf("parameter %s must be a non-negative quantity, got %q", key, value)
+			}
+			annotations[key] = strconv.FormatInt(q.Value(), 10)
+		case internal.QoSReadIOPSKey, internal.QoSWriteIOPSKey:
+			iops, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parameter %s must be a non-negative integer: %w", key, err)
+			}
+			annotations[key] = strconv.FormatUint(iops, 10)
+		case internal.IOSchedulerKey, internal.ReadAheadKBKey, internal.NrRequestsKey:
+			if _, err := utils.GetBlockTuning(map[string]string{key: value}); err != nil {
+				return nil, nil, err
+			}
+			annotations[key] = value
+		default:
+			return nil, nil, fmt.Errorf("parameter %s is not mutable", key)
+		}
+	}
+
+	return contiguous, annotations, nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/staticvolume"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+func TestStaticVolumeLookup(t *testing.T) {
+	const volumeID = "vg-data/lv-data"
+
+	lvg := &snc.LVMVolumeGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "vg-1"},
+		Spec:       snc.LVMVolumeGroupSpec{Local: snc.LVMVolumeGroupLocalSpec{NodeName: testNodeName}},
+		Status:     snc.LVMVolumeGroupStatus{Phase: utils.LVGStatusReady},
+	}
+	llv := &snc.LVMLogicalVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        utils.LLVNameForVolume(volumeID),
+			Annotations: map[string]string{staticvolume.VolumeHandleAnnotationKey: volumeID},
+			Finalizers:  []string{utils.SDSLocalVolumeCSIFinalizer},
+		},
+		Spec: snc.LVMLogicalVolumeSpec{
+			ActualLVNameOnTheNode: "lv-data",
+			Type:                  internal.LVMTypeThick,
+			Size:                  "1Gi",
+			LVMVolumeGroupName:    lvg.Name,
+		},
+		Status: &snc.LVMLogicalVolumeStatus{Phase: utils.LLVStatusCreated},
+	}
+	d := newTestDriver(t, lvg, llv)
+
+	t.Run("ControllerGetVolume", func(t *testing.T) {
+		resp, err := d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: volumeID})
+		if assert.NoError(t, err) {
+			assert.Equal(t, volumeID, resp.Volume.VolumeId)
+			assert.Equal(t, []string{testNodeName}, resp.Status.PublishedNodeIds)
+			assert.False(t, resp.Status.VolumeCondition.Abnormal)
+		}
+	})
+
+	t.Run("ListVolumes", func(t *testing.T) {
+		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+		if assert.NoError(t, err) && assert.Len(t, resp.Entries, 1) {
+			assert.Equal(t, volumeID, resp.Entries[0].Volume.VolumeId)
+		}
+	})
+
+	t.Run("ValidateVolumeCapabilities", func(t *testing.T) {
+		resp, err := d.ValidateVolumeCapabilities(context.Background(), &csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId: volumeID,
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+			}},
+		})
+		if assert.NoError(t, err) {
+			assert.NotNil(t, resp.Confirmed, resp.Message)
+		}
+	})
+
+	t.Run("unknown static volume", func(t *testing.T) {
+		_, err := d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: "vg-data/lv-missing"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestGetCapacity(t *testing.T) {
+	extentSize := resource.MustParse(internal.LVMExtentSize)
+
+	lvgs := []*snc.LVMVolumeGroup{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "vg-1"},
+			Status: snc.LVMVolumeGroupStatus{
+				Phase:  utils.LVGStatusReady,
+				Nodes:  []snc.LVMVolumeGroupNode{{Name: testNodeName}},
+				VGFree: *resource.NewQuantity(10<<30+extentSize.Value()/2, resource.BinarySI),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "vg-2"},
+			Status: snc.LVMVolumeGroupStatus{
+				Phase:  utils.LVGStatusReady,
+				Nodes:  []snc.LVMVolumeGroupNode{{Name: "node-2"}},
+				VGFree: resource.MustParse("1Gi"),
+			},
+		},
+	}
+	d := newTestDriver(t, lvgs[0], lvgs[1])
+
+	resp, err := d.GetCapacity(context.Background(), &csi.GetCapacityRequest{
+		Parameters: map[string]string{
+			internal.TypeKey:           internal.Lvm,
+			internal.LvmTypeKey:        internal.LVMTypeThick,
+			internal.LVMVolumeGroupKey: "- name: vg-1\n- name: vg-2\n",
+		},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(11<<30)+extentSize.Value()/2, resp.AvailableCapacity)
+		assert.Equal(t, int64(10<<30), resp.MaximumVolumeSize.GetValue())
+		assert.Equal(t, extentSize.Value(), resp.MinimumVolumeSize.GetValue())
+	}
+}
+
+func TestStaticVolumeModify(t *testing.T) {
+	const volumeID = "vg-data/lv-data"
+
+	llv := &snc.LVMLogicalVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: utils.LLVNameForVolume(volumeID)},
+		Spec: snc.LVMLogicalVolumeSpec{
+			ActualLVNameOnTheNode: "lv-data",
+			Type:                  internal.LVMTypeThick,
+			Size:                  "1Gi",
+			LVMVolumeGroupName:    "vg-1",
+		},
+		Status: &snc.LVMLogicalVolumeStatus{Phase: utils.LLVStatusCreated, Contiguous: ptr.To(true)},
+	}
+	d := newTestDriver(t, llv)
+	d.cache = newClientCache(d.cl)
+
+	_, err := d.ControllerModifyVolume(context.Background(), &csi.ControllerModifyVolumeRequest{
+		VolumeId:          volumeID,
+		MutableParameters: map[string]string{internal.LVMVThickContiguousParamKey: "true"},
+	})
+	if assert.NoError(t, err) {
+		updated := &snc.LVMLogicalVolume{}
+		if assert.NoError(t, d.cl.Get(context.Background(), client.ObjectKeyFromObject(llv), updated)) {
+			assert.Equal(t, ptr.To(true), updated.Spec.Thick.Contiguous)
+		}
+	}
+}
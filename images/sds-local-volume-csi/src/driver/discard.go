@@ -0,0 +1,92 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// runFstrim trims the node's staged volumes with the fstrim discard policy until the context is done.
+func (d *Driver) runFstrim(ctx context.Context) {
+	ticker := time.NewTicker(d.fstrimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.trimVolumes(ctx)
+	}
+}
+
+// trimVolumes runs fstrim over the staged volumes of the node with the fstrim discard policy. A volume is trimmed
+// by any of its mount points, as fstrim discards the unused blocks of the whole filesystem.
+func (d *Driver) trimVolumes(ctx context.Context) {
+	llvs := &v1alpha1.LVMLogicalVolumeList{}
+	err := d.cache.List(ctx, llvs)
+	if err != nil {
+		d.log.Error(err, "[trimVolumes] unable to list the LVMLogicalVolumes")
+		return
+	}
+
+	lvgs, err := utils.GetLVGList(ctx, d.cl)
+	if err != nil {
+		d.log.Error(err, "[trimVolumes] unable to list the LVMVolumeGroups")
+		return
+	}
+	nodeVGs := make(map[string]string, len(lvgs.Items))
+	for _, lvg := range lvgs.Items {
+		if utils.GetLVGNodeName(lvg) == d.hostID {
+			nodeVGs[lvg.Name] = lvg.Spec.ActualVGNameOnTheNode
+		}
+	}
+
+	for _, llv := range llvs.Items {
+		vgName, ok := nodeVGs[llv.Spec.LVMVolumeGroupName]
+		if !ok || llv.Annotations[internal.DiscardPolicyKey] != internal.DiscardPolicyFstrim {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		devPath := fmt.Sprintf("/dev/%s/%s", vgName, llv.Spec.ActualLVNameOnTheNode)
+		targets, err := d.storeManager.GetDeviceMountTargets(devPath)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[trimVolumes] unable to get the mount points of the volume %s", llv.Name))
+			continue
+		}
+		if len(targets) == 0 {
+			continue
+		}
+
+		err = d.storeManager.TrimFS(targets[0])
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[trimVolumes] unable to trim the volume %s", llv.Name))
+		}
+	}
+}
@@ -27,11 +27,15 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/stalelvg"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"sds-local-volume-csi/internal"
@@ -45,8 +49,7 @@ const (
 	DefaultDriverName = "local.csi.storage.deckhouse.io"
 	// DefaultAddress is the default address that the csi plugin will serve its
 	// http handler on.
-	DefaultAddress           = "127.0.0.1:12302"
-	defaultWaitActionTimeout = 5 * time.Minute
+	DefaultAddress = "127.0.0.1:12302"
 )
 
 var (
@@ -57,10 +60,10 @@ type Driver struct {
 	name                  string
 	publishInfoVolumeName string
 
-	csiAddress        string
-	address           string
-	hostID            string
-	waitActionTimeout time.Duration
+	csiAddress  string
+	address     string
+	hostID      string
+	waitOptions utils.WaitOptions // default tolerance and timeout of the waits for the agent, might be overridden per StorageClass
 
 	srv     *grpc.Server
 	httpSrv http.Server
@@ -69,35 +72,142 @@ type Driver struct {
 	readyMu      sync.Mutex // protects ready
 	ready        bool
 	cl           client.Client
+	cache        cache.Cache // shared informers to wait for the status updates of the resources
 	storeManager utils.NodeStoreManager
 	inFlight     *internal.InFlight
+	reservations *internal.CapacityReservations
+
+	quotaMu           sync.Mutex                     // serializes the quota checks, so the concurrent volumes do not exceed a quota together
+	quotaReservations *internal.CapacityReservations // the sizes of the volumes not counted by the cache yet by the StorageClass
+	pvIndexMu         sync.Mutex                     // protects pvIndexed
+	pvIndexed         bool                           // the PersistentVolumes of the cache are indexed by their StorageClasses
+
+	staleLVGPolicy stalelvg.Policy
+
+	nodeSelectionStrategy string
+	nodeSelectionCounter  atomic.Uint64 // used by the round-robin node selection strategy
+
+	topologyKeys []string // node label keys reported in the topology in addition to the node one
+
+	volumeLeases *utils.VolumeLeases // nil if the controller plugin runs without the per-volume leases
+
+	metrics         *grpcMetrics
+	nodeMetrics     *nodeMetrics
+	operationsLimit chan struct{} // semaphore of the concurrent CSI calls, nil if they are not limited
+
+	shutdownTimeout time.Duration  // time given to the in-flight calls to finish on the shutdown before they are cancelled
+	calls           sync.WaitGroup // in-flight CSI calls
+
+	encryptionRotationInterval time.Duration // period of the encryption key rotation checks on the node, 0 disables them
+	fsckPolicy                 string        // default policy of the filesystem check before the volume is staged
+	fstrimInterval             time.Duration // period of the fstrim of the node's volumes with the fstrim discard policy, 0 disables it
+	maxVolumesPerNode          int64         // maximum number of the volumes of the node, 0 derives it from the LVM metadata limits
+	deviceWaitTimeout          time.Duration // time to wait for the device of the volume to appear on the node
+	unmountTimeout             time.Duration // time to retry the unstage unmount before the escalation, 0 disables the escalation
+	unmountEscalation          string        // escalation of the unstage unmount: lazy or force
+	unmountStartedAt           sync.Map      // the time of the first unstage unmount attempt by the volume ID
+	fsFreezeTimeout            time.Duration // longest time the node plugin keeps a filesystem frozen for a snapshot, 0 disables the freeze
+	formatsLimit               chan struct{} // semaphore of the concurrent mkfs and fsck runs on the node, nil if they are not limited
+	cgroupRoot                 string        // path of the node's cgroup v2 hierarchy the IO limits of the Pods are set in
+	erasedVolumes              sync.Map      // the volume IDs erased since their release, so the retried release does not erase them again
+	rawDeviceClaims            sync.Map      // the BlockDevice names taken by the raw device volumes by the volume ID, as their PVs might not exist yet
+	rawDeviceMu                sync.Mutex    // serializes the raw device selection, so a device is not taken by two volumes at once
+
+	orphanedMountsCleanupInterval time.Duration // period of the cleanup of the staging mounts of the deleted volumes, 0 disables it
 
 	csi.UnimplementedControllerServer
 	csi.UnimplementedIdentityServer
 	csi.UnimplementedNodeServer
 }
 
+// DriverOptions are the settings of the driver. The zero values of the optional limits, intervals and timeouts
+// disable the corresponding features, see the fields of the Driver.
+type DriverOptions struct {
+	CSIAddress            string
+	DriverName            string // DefaultDriverName if empty
+	Address               string
+	NodeName              string
+	StaleLVGPolicy        stalelvg.Policy
+	NodeSelectionStrategy string
+	TopologyKeys          []string
+	WaitOptions           utils.WaitOptions
+
+	MaxConcurrentOperations int
+	ShutdownTimeout         time.Duration
+
+	EncryptionRotationInterval    time.Duration
+	FsckPolicy                    string
+	FstrimInterval                time.Duration
+	MaxVolumesPerNode             int64
+	DeviceWaitTimeout             time.Duration
+	UnmountTimeout                time.Duration
+	UnmountEscalation             string
+	FSFreezeTimeout               time.Duration
+	MaxConcurrentFormats          int
+	CgroupRoot                    string
+	OrphanedMountsCleanupInterval time.Duration
+}
+
 // NewDriver returns a CSI plugin that contains the necessary gRPC
 // interfaces to interact with Kubernetes over unix domain sockets for
 // managing  disks
-func NewDriver(csiAddress, driverName, address string, nodeName *string, log *logger.Logger, cl client.Client) (*Driver, error) {
+func NewDriver(opts DriverOptions, log *logger.Logger, cl client.Client, informerCache cache.Cache, volumeLeases *utils.VolumeLeases) (*Driver, error) {
+	driverName := opts.DriverName
 	if driverName == "" {
 		driverName = DefaultDriverName
 	}
 
 	st := utils.NewStore(log)
 
-	return &Driver{
-		name:              driverName,
-		hostID:            *nodeName,
-		csiAddress:        csiAddress,
-		address:           address,
-		log:               log,
-		waitActionTimeout: defaultWaitActionTimeout,
-		cl:                cl,
-		storeManager:      st,
-		inFlight:          internal.NewInFlight(),
-	}, nil
+	var operationsLimit chan struct{}
+	if opts.MaxConcurrentOperations > 0 {
+		operationsLimit = make(chan struct{}, opts.MaxConcurrentOperations)
+	}
+
+	var formatsLimit chan struct{}
+	if opts.MaxConcurrentFormats > 0 {
+		formatsLimit = make(chan struct{}, opts.MaxConcurrentFormats)
+	}
+
+	d := &Driver{
+		name:           driverName,
+		hostID:         opts.NodeName,
+		csiAddress:     opts.CSIAddress,
+		address:        opts.Address,
+		log:            log,
+		waitOptions:    opts.WaitOptions,
+		cl:             cl,
+		cache:          informerCache,
+		storeManager:   st,
+		inFlight:       internal.NewInFlight(),
+		reservations:   internal.NewCapacityReservations(),
+		staleLVGPolicy: opts.StaleLVGPolicy,
+
+		quotaReservations: internal.NewCapacityReservations(),
+
+		nodeSelectionStrategy: opts.NodeSelectionStrategy,
+		topologyKeys:          opts.TopologyKeys,
+		volumeLeases:          volumeLeases,
+		metrics:               newGRPCMetrics(),
+		operationsLimit:       operationsLimit,
+		shutdownTimeout:       opts.ShutdownTimeout,
+
+		encryptionRotationInterval: opts.EncryptionRotationInterval,
+		fsckPolicy:                 opts.FsckPolicy,
+		fstrimInterval:             opts.FstrimInterval,
+		maxVolumesPerNode:          opts.MaxVolumesPerNode,
+		deviceWaitTimeout:          opts.DeviceWaitTimeout,
+		unmountTimeout:             opts.UnmountTimeout,
+		unmountEscalation:          opts.UnmountEscalation,
+		fsFreezeTimeout:            opts.FSFreezeTimeout,
+		formatsLimit:               formatsLimit,
+		cgroupRoot:                 opts.CgroupRoot,
+
+		orphanedMountsCleanupInterval: opts.OrphanedMountsCleanupInterval,
+	}
+	d.nodeMetrics = newNodeMetrics(d.metrics.registry, d.countStagedVolumes)
+
+	return d, nil
 }
 
 func (d *Driver) Run(ctx context.Context) error {
@@ -120,6 +230,9 @@ func (d *Driver) Run(ctx context.Context) error {
 	if u.Scheme != "unix" {
 		return fmt.Errorf("currently only unix domain sockets are supported, have: %s", u.Scheme)
 	}
+	// kubelet registers the plugin once the socket appears, so the staged volumes are recovered before it is created
+	d.recoverStagedVolumes(ctx)
+
 	// remove the socket if it's already there. This can happen if we
 	// deploy a new version and the socket was created from the old running
 	// plugin.
@@ -133,16 +246,7 @@ func (d *Driver) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	// log response errors for better observability
-	errHandler := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		resp, err := handler(ctx, req)
-		if err != nil {
-			d.log.Error(err, fmt.Sprintf("method %s method failed ", info.FullMethod))
-		}
-		return resp, err
-	}
-
-	d.srv = grpc.NewServer(grpc.UnaryInterceptor(errHandler))
+	d.srv = grpc.NewServer(grpc.ChainUnaryInterceptor(d.traceInterceptor, d.metricsInterceptor, d.concurrencyInterceptor))
 	csi.RegisterIdentityServer(d.srv, d)
 	csi.RegisterControllerServer(d.srv, d)
 	csi.RegisterNodeServer(d.srv, d)
@@ -156,6 +260,7 @@ func (d *Driver) Run(ctx context.Context) error {
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	mux.Handle("/metrics", promhttp.HandlerFor(d.metrics.registry, promhttp.HandlerOpts{}))
 
 	d.httpSrv = http.Server{
 		Handler: mux,
@@ -164,20 +269,36 @@ func (d *Driver) Run(ctx context.Context) error {
 	d.ready = true
 	d.log.Info(fmt.Sprintf("grpc_addr %s http_addr %s starting server", grpcAddr, d.address))
 
+	// the re-encryption is resumable, so the rotation is not waited for on the shutdown
+	if d.encryptionRotationInterval > 0 {
+		go d.runEncryptionKeyRotation(ctx)
+	}
+	if d.fstrimInterval > 0 {
+		go d.runFstrim(ctx)
+	}
+	if d.orphanedMountsCleanupInterval > 0 {
+		go d.runOrphanedMountsCleanup(ctx)
+	}
+	if d.fsFreezeTimeout > 0 {
+		go d.runFSFreeze(ctx)
+	}
+
 	var eg errgroup.Group
 	eg.Go(func() error {
 		<-ctx.Done()
 		return d.httpSrv.Shutdown(context.Background())
 	})
 	eg.Go(func() error {
-		go func() {
-			<-ctx.Done()
-			d.log.Info("server stopped")
-			d.readyMu.Lock()
-			d.ready = false
-			d.readyMu.Unlock()
-			d.srv.GracefulStop()
-		}()
+		<-ctx.Done()
+		d.log.Info("server is stopping")
+		d.readyMu.Lock()
+		d.ready = false
+		d.readyMu.Unlock()
+		d.drain()
+		d.log.Info("server stopped")
+		return nil
+	})
+	eg.Go(func() error {
 		return d.srv.Serve(grpcListener)
 	})
 	eg.Go(func() error {
@@ -190,3 +311,35 @@ func (d *Driver) Run(ctx context.Context) error {
 
 	return eg.Wait()
 }
+
+// drain stops accepting new CSI calls and waits for the in-flight ones to finish. The calls still running after the
+// shutdown timeout are cancelled, so they roll back their changes (e.g. delete the half-created LVMLogicalVolumes),
+// and the driver waits for the rollback up to the rollback timeout.
+func (d *Driver) drain() {
+	stopped := make(chan struct{})
+	go func() {
+		d.srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return
+	case <-time.After(d.shutdownTimeout):
+	}
+
+	d.log.Warning(fmt.Sprintf("the in-flight calls have not finished in %s, cancel them", d.shutdownTimeout))
+	d.srv.Stop()
+
+	finished := make(chan struct{})
+	go func() {
+		d.calls.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(internal.RollbackTimeout):
+		d.log.Warning(fmt.Sprintf("the cancelled calls have not rolled back in %s", internal.RollbackTimeout))
+	}
+}
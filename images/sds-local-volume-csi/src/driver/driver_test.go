@@ -0,0 +1,83 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	slv "github.com/deckhouse/sds-local-volume/api/v1alpha1"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/logger"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+const testNodeName = "node-1"
+
+// clientCache is the informer cache reading the objects from the client, so the waits see the objects at once.
+type clientCache struct {
+	*informertest.FakeInformers
+	cl client.Client
+}
+
+func newClientCache(cl client.Client) *clientCache {
+	return &clientCache{FakeInformers: &informertest.FakeInformers{Scheme: cl.Scheme()}, cl: cl}
+}
+
+func (c *clientCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.cl.Get(ctx, key, obj, opts...)
+}
+
+func (c *clientCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.cl.List(ctx, list, opts...)
+}
+
+// newTestDriver returns the driver of the node testNodeName backed by a fake client with the objects.
+func newTestDriver(t *testing.T, objects ...client.Object) *Driver {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	for _, f := range []func(*runtime.Scheme) error{corev1.AddToScheme, snc.AddToScheme, slv.AddToScheme} {
+		if err := f(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log, err := logger.NewLogger(logger.InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Driver{
+		name:         DefaultDriverName,
+		hostID:       testNodeName,
+		log:          log,
+		cl:           fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		storeManager: utils.NewStore(log),
+		inFlight:     internal.NewInFlight(),
+		reservations: internal.NewCapacityReservations(),
+
+		quotaReservations: internal.NewCapacityReservations(),
+	}
+}
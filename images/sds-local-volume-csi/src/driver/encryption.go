@@ -0,0 +1,165 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// runEncryptionKeyRotation rotates the keys of the node's encrypted volumes requested with a VolumeAttributesClass
+// until the context is done. The volumes are processed one by one, so the node disks are never loaded with several
+// re-encryptions at a time.
+func (d *Driver) runEncryptionKeyRotation(ctx context.Context) {
+	ticker := time.NewTicker(d.encryptionRotationInterval)
+	defer ticker.Stop()
+
+	for {
+		d.rotateEncryptionKeys(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rotateEncryptionKeys processes the node's volumes with the pending or the interrupted key rotation.
+func (d *Driver) rotateEncryptionKeys(ctx context.Context) {
+	llvs := &v1alpha1.LVMLogicalVolumeList{}
+	err := d.cache.List(ctx, llvs)
+	if err != nil {
+		d.log.Error(err, "[rotateEncryptionKeys] unable to list the LVMLogicalVolumes")
+		return
+	}
+
+	for i := range llvs.Items {
+		llv := &llvs.Items[i]
+		rotationStatus := llv.Annotations[internal.EncryptionRotationStatusKey]
+		if rotationStatus != internal.EncryptionRotationPending && rotationStatus != internal.EncryptionRotationReencrypting {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		lvg, err := utils.GetLVMVolumeGroup(ctx, d.cl, llv.Spec.LVMVolumeGroupName)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[rotateEncryptionKeys] unable to get the LVMVolumeGroup %s of the LVMLogicalVolume %s", llv.Spec.LVMVolumeGroupName, llv.Name))
+			continue
+		}
+		if utils.GetLVGNodeName(*lvg) != d.hostID {
+			continue
+		}
+
+		devPath := fmt.Sprintf("/dev/%s/%s", lvg.Spec.ActualVGNameOnTheNode, llv.Spec.ActualLVNameOnTheNode)
+		err = d.rotateEncryptionKey(ctx, llv, devPath)
+		if err == nil {
+			continue
+		}
+
+		d.log.Error(err, fmt.Sprintf("[rotateEncryptionKeys] unable to rotate the encryption key of the LVMLogicalVolume %s", llv.Name))
+		err = utils.SetEncryptionRotationStatus(ctx, d.cl, llv.Name, internal.EncryptionRotationFailed, err.Error())
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[rotateEncryptionKeys] unable to report the failed key rotation of the LVMLogicalVolume %s", llv.Name))
+		}
+	}
+}
+
+// rotateEncryptionKey changes the passphrase of the volume's device and, if requested, re-encrypts the data with
+// a new volume key. The re-encryption is resumed if the plugin is restarted while it is in progress.
+func (d *Driver) rotateEncryptionKey(ctx context.Context, llv *v1alpha1.LVMLogicalVolume, devPath string) error {
+	secrets, err := d.getSecretData(ctx, llv.Annotations[internal.EncryptionKeySecretKey])
+	if err != nil {
+		return err
+	}
+
+	newPassphrase, err := utils.GetLUKSNewPassphrase(secrets)
+	if err != nil {
+		return err
+	}
+
+	if llv.Annotations[internal.EncryptionRotationStatusKey] == internal.EncryptionRotationPending {
+		passphrase, err := utils.GetLUKSPassphrase(secrets)
+		if err != nil {
+			return err
+		}
+
+		// the volume is being staged or expanded, the rotation is retried on the next pass
+		if !d.inFlight.Insert(llv.Name) {
+			return nil
+		}
+		err = d.storeManager.ChangeLUKSKey(devPath, passphrase, newPassphrase)
+		d.inFlight.Delete(llv.Name)
+		if err != nil {
+			return err
+		}
+
+		if llv.Annotations[internal.EncryptionReencryptKey] != "true" {
+			d.log.Info(fmt.Sprintf("[rotateEncryptionKey] the passphrase of the LVMLogicalVolume %s is changed", llv.Name))
+			return utils.SetEncryptionRotationStatus(ctx, d.cl, llv.Name, internal.EncryptionRotationCompleted, "the passphrase is changed")
+		}
+
+		err = utils.SetEncryptionRotationStatus(ctx, d.cl, llv.Name, internal.EncryptionRotationReencrypting, "0%")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.storeManager.ReencryptLUKS(devPath, newPassphrase, func(done, total int64) {
+		err := utils.SetEncryptionRotationStatus(ctx, d.cl, llv.Name, internal.EncryptionRotationReencrypting, fmt.Sprintf("%d%%", done*100/total))
+		if err != nil {
+			d.log.Warning(fmt.Sprintf("[rotateEncryptionKey] unable to report the re-encryption progress of the LVMLogicalVolume %s: %v", llv.Name, err))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	d.log.Info(fmt.Sprintf("[rotateEncryptionKey] the passphrase of the LVMLogicalVolume %s is changed and the data is re-encrypted", llv.Name))
+	return utils.SetEncryptionRotationStatus(ctx, d.cl, llv.Name, internal.EncryptionRotationCompleted, "the passphrase is changed and the data is re-encrypted")
+}
+
+// getSecretData returns the data of the Secret referenced as <namespace>/<name>.
+func (d *Driver) getSecretData(ctx context.Context, ref string) (map[string]string, error) {
+	namespace, name, err := utils.ParseSecretRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{}
+	err = d.cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the secret %s: %w", ref, err)
+	}
+
+	data := make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+
+	return data, nil
+}
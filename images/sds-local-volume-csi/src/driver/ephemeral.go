@@ -0,0 +1,206 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// ephemeralVolumeIDPrefix is the prefix of the IDs kubelet generates for the inline ephemeral volumes.
+const ephemeralVolumeIDPrefix = "csi-"
+
+func isEphemeralVolume(volumeContext map[string]string) bool {
+	return volumeContext[internal.EphemeralContextKey] == "true"
+}
+
+// nodePublishEphemeralVolume creates the LV of the inline ephemeral volume on the node and mounts it to the target.
+// The volume is not staged, and its LVMLogicalVolume is created by the node plugin as there is no CreateVolume call.
+func (d *Driver) nodePublishEphemeralVolume(ctx context.Context, request *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	traceID := traceIDFromContext(ctx)
+	volumeID := request.GetVolumeId()
+	target := request.GetTargetPath()
+	volumeContext := request.GetVolumeContext()
+
+	mountVolume := request.GetVolumeCapability().GetMount()
+	if mountVolume == nil {
+		return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Ephemeral volume must have the mount access type")
+	}
+	if request.GetReadonly() {
+		return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Ephemeral volume can not be read-only, it is empty")
+	}
+
+	fsType := volumeFsType(mountVolume, volumeContext)
+	if _, ok := ValidFSTypes[strings.ToLower(fsType)]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] Invalid fsType %s", fsType)
+	}
+
+	size, err := resource.ParseQuantity(volumeContext[internal.EphemeralSizeKey])
+	if err != nil || size.Sign() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] Ephemeral volume attribute %s must be a positive quantity, got %q", internal.EphemeralSizeKey, volumeContext[internal.EphemeralSizeKey])
+	}
+	if minSize := utils.GetMinFSSize([]*csi.VolumeCapability{request.GetVolumeCapability()}); size.Value() < minSize {
+		size = *resource.NewQuantity(minSize, resource.BinarySI)
+	}
+	llvSize, err := utils.RoundUpToExtentSize(size, internal.LVMExtentSize)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] %s", err.Error())
+	}
+
+	secureErase, err := utils.GetSecureErase(volumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] %s", err.Error())
+	}
+
+	thinPoolName := volumeContext[internal.ThinPoolNameKey]
+	lvmType := internal.LVMTypeThick
+	if thinPoolName != "" {
+		lvmType = internal.LVMTypeThin
+	}
+
+	ok := d.inFlight.Insert(volumeID)
+	if !ok {
+		return nil, status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, volumeID)
+	}
+	defer d.inFlight.Delete(volumeID)
+	d.erasedVolumes.Delete(volumeID)
+
+	lvg, err := d.selectEphemeralLVG(ctx, volumeContext[internal.LVGNameKey], thinPoolName, *llvSize)
+	if err != nil {
+		return nil, err
+	}
+
+	d.log.Info(fmt.Sprintf("[NodePublishVolume][traceID:%s][volumeID:%s] creating ephemeral volume of size %s in LVMVolumeGroup %s", traceID, volumeID, llvSize.String(), lvg.Name))
+	spec := utils.GetLLVSpec(d.log, volumeID, *lvg, map[string]string{lvg.Name: thinPoolName}, lvmType, *llvSize, false, nil)
+	annotations := map[string]string{internal.EphemeralKey: "true"}
+	if secureErase != "" {
+		annotations[internal.SecureEraseKey] = secureErase
+	}
+	_, err = utils.CreateLVMLogicalVolume(ctx, d.cl, d.log, traceID, volumeID, spec, nil, annotations)
+	if err != nil && !kerrors.IsAlreadyExists(err) {
+		d.log.Error(err, fmt.Sprintf("[NodePublishVolume][traceID:%s][volumeID:%s] error creating LVMLogicalVolume", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] Error creating LVMLogicalVolume %s: %v", volumeID, err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, d.waitOptions.Timeout)
+	defer cancel()
+	_, err = utils.WaitForStatusUpdate(waitCtx, d.cache, d.log, traceID, volumeID, "", *llvSize, d.waitOptions.ResizeDelta)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[NodePublishVolume][traceID:%s][volumeID:%s] error waiting for ephemeral volume, delete it", traceID, volumeID))
+		if err := utils.DeleteLVMLogicalVolume(context.WithoutCancel(ctx), d.cl, d.log, traceID, volumeID); err != nil {
+			d.log.Error(err, fmt.Sprintf("[NodePublishVolume][traceID:%s][volumeID:%s] error deleting LVMLogicalVolume", traceID, volumeID))
+		}
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] Error creating ephemeral volume %s: %v", volumeID, err)
+	}
+
+	mountFlags, err := volumeMountFlags(mountVolume, volumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] %s", err.Error())
+	}
+
+	devPath, err := d.waitForDevice(ctx, fmt.Sprintf("/dev/%s/%s", lvg.Spec.ActualVGNameOnTheNode, volumeID))
+	if err != nil {
+		return nil, err
+	}
+	err = d.storeManager.NodeStageVolumeFS(devPath, target, fsType, collectMountOptions(mountFlags, nil), nil, lvmType, thinPoolName)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[NodePublishVolume][traceID:%s][volumeID:%s] error mounting ephemeral volume", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] Error mounting ephemeral volume %q at %q: %v", devPath, target, err)
+	}
+
+	d.log.Info(fmt.Sprintf("[NodePublishVolume][traceID:%s][volumeID:%s] ephemeral volume is mounted at %s", traceID, volumeID, target))
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// selectEphemeralLVG returns the LVMVolumeGroup of the node to create the ephemeral volume in: the requested one or,
+// if none is requested, the one with the most free space.
+func (d *Driver) selectEphemeralLVG(ctx context.Context, lvgName, thinPoolName string, size resource.Quantity) (*v1alpha1.LVMVolumeGroup, error) {
+	lvgs, err := utils.GetLVGList(ctx, d.cl)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] Error listing LVMVolumeGroups: %v", err)
+	}
+
+	var selected *v1alpha1.LVMVolumeGroup
+	var selectedFree resource.Quantity
+	for i := range lvgs.Items {
+		lvg := &lvgs.Items[i]
+		if utils.GetLVGNodeName(*lvg) != d.hostID || (lvgName != "" && lvg.Name != lvgName) {
+			continue
+		}
+
+		free := utils.GetLVMVolumeGroupFreeSpace(*lvg)
+		if thinPoolName != "" {
+			free, err = utils.GetLVMThinPoolFreeSpace(*lvg, thinPoolName)
+			if err != nil {
+				continue
+			}
+		}
+
+		if selected == nil || free.Cmp(selectedFree) > 0 {
+			selected, selectedFree = lvg, free
+		}
+	}
+
+	if selected == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] No LVMVolumeGroup %q with thin pool %q found on node %s", lvgName, thinPoolName, d.hostID)
+	}
+	if selectedFree.Cmp(size) < 0 {
+		return nil, status.Errorf(codes.ResourceExhausted, "[NodePublishVolume] LVMVolumeGroup %s has %s free, %s is requested", selected.Name, selectedFree.String(), size.String())
+	}
+
+	return selected, nil
+}
+
+// deleteEphemeralVolume deletes the LVMLogicalVolume of the unpublished volume if it is an ephemeral one.
+// The persistent volumes are left as is.
+func (d *Driver) deleteEphemeralVolume(ctx context.Context, volumeID string) error {
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(volumeID), "")
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if llv.Annotations[internal.EphemeralKey] != "true" {
+		return nil
+	}
+
+	err = d.eraseVolume(ctx, volumeID, llv)
+	if err != nil {
+		return err
+	}
+
+	d.log.Info(fmt.Sprintf("[NodeUnpublishVolume] deleting ephemeral volume %s", volumeID))
+	err = utils.DeleteLVMLogicalVolume(ctx, d.cl, d.log, traceIDFromContext(ctx), volumeID)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	d.erasedVolumes.Delete(volumeID)
+	return nil
+}
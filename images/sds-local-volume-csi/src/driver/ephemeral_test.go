@@ -0,0 +1,93 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sds-local-volume-csi/internal"
+)
+
+func TestNodePublishEphemeralVolume(t *testing.T) {
+	lvg := &snc.LVMVolumeGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "vg-1"},
+		Status: snc.LVMVolumeGroupStatus{
+			Nodes:  []snc.LVMVolumeGroupNode{{Name: testNodeName}},
+			VGSize: resource.MustParse("1Gi"),
+		},
+	}
+	mountCapability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+
+	// kubelet sends no staging target path for the inline ephemeral volumes, so none of the cases has it
+	for _, tc := range []struct {
+		name          string
+		volumeContext map[string]string
+		lvgName       string
+		code          codes.Code
+		message       string
+	}{
+		{
+			name:          "persistent volume requires the staging target path",
+			volumeContext: map[string]string{},
+			code:          codes.InvalidArgument,
+			message:       "Staging target path cannot be empty",
+		},
+		{
+			name:          "ephemeral volume with an invalid size",
+			volumeContext: map[string]string{internal.EphemeralContextKey: "true", internal.EphemeralSizeKey: "big"},
+			code:          codes.InvalidArgument,
+			message:       "must be a positive quantity",
+		},
+		{
+			name:          "ephemeral volume in a missing LVMVolumeGroup",
+			volumeContext: map[string]string{internal.EphemeralContextKey: "true", internal.EphemeralSizeKey: "100Mi", internal.LVGNameKey: "vg-2"},
+			code:          codes.InvalidArgument,
+			message:       "No LVMVolumeGroup",
+		},
+		{
+			name:          "ephemeral volume larger than the free space",
+			volumeContext: map[string]string{internal.EphemeralContextKey: "true", internal.EphemeralSizeKey: "2Gi"},
+			code:          codes.ResourceExhausted,
+			message:       "vg-1 has 1Gi free",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newTestDriver(t, lvg.DeepCopy())
+
+			_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				VolumeId:         "csi-1",
+				TargetPath:       t.TempDir(),
+				VolumeCapability: mountCapability,
+				VolumeContext:    tc.volumeContext,
+			})
+			assert.Equal(t, tc.code, status.Code(err), err)
+			assert.ErrorContains(t, err, tc.message)
+		})
+	}
+}
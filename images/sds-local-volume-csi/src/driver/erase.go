@@ -0,0 +1,69 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// eraseReleasedVolume erases the data of the unstaged volume if its secure erase is requested. The request has
+// no volume context, so the erase is taken from the annotations of the LVMLogicalVolume.
+func (d *Driver) eraseReleasedVolume(ctx context.Context, volumeID string) error {
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(volumeID), "")
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get the LVMLogicalVolume: %w", err)
+	}
+
+	return d.eraseVolume(ctx, volumeID, llv)
+}
+
+// eraseVolume erases the LV of the released volume with the secure erase of its LVMLogicalVolume. The erase of a large
+// LV might outlast the request, so the erased volume is remembered, and the retried request does not erase it again.
+func (d *Driver) eraseVolume(ctx context.Context, volumeID string, llv *v1alpha1.LVMLogicalVolume) error {
+	mode := llv.Annotations[internal.SecureEraseKey]
+	if mode == "" {
+		return nil
+	}
+	if _, erased := d.erasedVolumes.Load(volumeID); erased {
+		return nil
+	}
+
+	lvg, err := utils.GetLVMVolumeGroup(ctx, d.cl, llv.Spec.LVMVolumeGroupName)
+	if err != nil {
+		return fmt.Errorf("unable to get the LVMVolumeGroup %s: %w", llv.Spec.LVMVolumeGroupName, err)
+	}
+
+	devPath := fmt.Sprintf("/dev/%s/%s", lvg.Spec.ActualVGNameOnTheNode, llv.Spec.ActualLVNameOnTheNode)
+	err = d.storeManager.EraseDevice(devPath, mode)
+	if err != nil {
+		return err
+	}
+
+	d.erasedVolumes.Store(volumeID, struct{}{})
+	d.log.Info(fmt.Sprintf("[eraseVolume] the volume %s is erased with the %s mode", volumeID, mode))
+	return nil
+}
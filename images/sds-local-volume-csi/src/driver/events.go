@@ -0,0 +1,79 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sds-local-volume-csi/internal"
+)
+
+const (
+	// the events of the node are in the default namespace, as the node itself is not namespaced
+	nodeEventNamespace = "default"
+	nodeEventComponent = "sds-local-volume-csi-node"
+
+	unmountEscalatedReason = "VolumeUnmountEscalated"
+	unmountFailedReason    = "VolumeUnmountFailed"
+
+	blockTuningFailedReason = "VolumeTuningFailed"
+	ioLimitsFailedReason    = "VolumeIOLimitsFailed"
+
+	orphanedMountCleanedReason       = "OrphanedVolumeMountCleaned"
+	orphanedMountCleanupFailedReason = "OrphanedVolumeMountCleanupFailed"
+)
+
+// recordNodeEvent records the event of the node the plugin runs on, so it is shown by kubectl describe node.
+// The event of a CSI call carries its traceID, so the event might be correlated with the logs of the call.
+// The event is informational, so the failure to record it is only logged.
+func (d *Driver) recordNodeEvent(ctx context.Context, eventType, reason, message string) {
+	var annotations map[string]string
+	if traceID, ok := ctx.Value(traceIDKey{}).(string); ok {
+		message = fmt.Sprintf("%s (traceID: %s)", message, traceID)
+		annotations = map[string]string{internal.TraceIDKey: traceID}
+	}
+
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: d.hostID + ".",
+			Namespace:    nodeEventNamespace,
+			Annotations:  annotations,
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       d.hostID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: nodeEventComponent, Host: d.hostID},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	err := d.cl.Create(ctx, event)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[recordNodeEvent] unable to record the %s event of the node %s", reason, d.hostID))
+	}
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// fsFreezeQueueSize is the number of the LVMLogicalVolume events the freeze worker might lag behind the informer.
+const fsFreezeQueueSize = 64
+
+// frozenVolume is the volume the node plugin has frozen the filesystem of.
+type frozenVolume struct {
+	mountPoint string
+	timer      *time.Timer
+}
+
+// freezeSourceVolume requests the node plugin to freeze the filesystem of the snapshot's source volume and waits until
+// it is frozen. The returned function thaws the filesystem, the node plugin thaws it by itself after its timeout
+// anyway. The returned error is a gRPC status error.
+func (d *Driver) freezeSourceVolume(ctx context.Context, traceID, llvName, snapshotName string) (func(), error) {
+	release, err := d.lockVolume(ctx, traceID, "CreateSnapshot", llvName)
+	if err != nil {
+		return nil, err
+	}
+
+	thaw := func() {
+		thawCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), internal.RollbackTimeout)
+		defer cancel()
+		if err := utils.ReleaseFSFreeze(thawCtx, d.cl, llvName); err != nil {
+			d.log.Error(err, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] error releasing the filesystem freeze", traceID, llvName))
+		}
+		release()
+	}
+
+	err = utils.RequestFSFreeze(ctx, d.cl, llvName, snapshotName)
+	if err != nil {
+		release()
+		d.log.Error(err, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] error requesting the filesystem freeze", traceID, llvName))
+		return nil, status.Errorf(codes.Internal, "error requesting the filesystem freeze of the volume %s: %s", llvName, err.Error())
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, internal.FSFreezeWaitTimeout)
+	defer cancel()
+	attemptCounter, err := utils.WaitForFSFreeze(waitCtx, d.cache, d.log, traceID, llvName, snapshotName)
+	if err != nil {
+		thaw()
+		d.log.Error(err, fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] error waiting for the filesystem freeze", traceID, llvName))
+		return nil, status.Errorf(codes.Aborted, "the filesystem of the volume %s has not been frozen: %s", llvName, err.Error())
+	}
+	d.log.Info(fmt.Sprintf("[CreateSnapshot][traceID:%s][volumeID:%s] the filesystem is frozen for the snapshot %s, attempt counter = %d", traceID, llvName, snapshotName, attemptCounter))
+
+	return thaw, nil
+}
+
+// checkSourceVolumeFrozen checks the filesystem of the source volume has stayed frozen while the snapshot was taken,
+// i.e. the node plugin has not thawed it by the timeout. The returned error is a gRPC status error.
+func (d *Driver) checkSourceVolumeFrozen(ctx context.Context, llvName, snapshotName string) error {
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, llvName, "")
+	if err != nil {
+		return status.Errorf(codes.Internal, "error getting LVMLogicalVolume %s: %s", llvName, err.Error())
+	}
+
+	if !utils.IsFSFrozenForSnapshot(llv, snapshotName) {
+		return status.Errorf(codes.Aborted, "the filesystem of the volume %s has been thawed before the snapshot %s was taken: %s", llvName, snapshotName, llv.Annotations[internal.FSFreezeMessageKey])
+	}
+
+	return nil
+}
+
+// runFSFreeze freezes and thaws the filesystems of the node's volumes on the requests of the controller until
+// the context is done. A filesystem is never kept frozen longer than the freeze timeout, even if the controller
+// has failed to withdraw the request. The events are processed one by one, so the frozen volumes need no locking.
+func (d *Driver) runFSFreeze(ctx context.Context) {
+	informer, err := d.cache.GetInformer(ctx, &v1alpha1.LVMLogicalVolume{})
+	if err != nil {
+		d.log.Error(err, "[runFSFreeze] unable to get the LVMLogicalVolume informer")
+		return
+	}
+
+	events := make(chan string, fsFreezeQueueSize)
+	notify := func(obj interface{}) {
+		llv, ok := obj.(*v1alpha1.LVMLogicalVolume)
+		if !ok || (llv.Annotations[internal.FSFreezeRequestKey] == "" && llv.Annotations[internal.FSFreezeStatusKey] != internal.FSFreezeFrozen) {
+			return
+		}
+
+		select {
+		case events <- llv.Name:
+		case <-ctx.Done():
+		}
+	}
+
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(_, newObj interface{}) { notify(newObj) },
+		DeleteFunc: notify,
+	})
+	if err != nil {
+		d.log.Error(err, "[runFSFreeze] unable to add the LVMLogicalVolume event handler")
+		return
+	}
+	defer func() {
+		_ = informer.RemoveEventHandler(registration)
+	}()
+
+	frozen := make(map[string]*frozenVolume)
+	timeouts := make(chan string)
+	for {
+		select {
+		case <-ctx.Done():
+			// the status is reported as the leftover freeze on the next start
+			for name, volume := range frozen {
+				d.thawFS(ctx, name, volume, "")
+			}
+			return
+		case name := <-timeouts:
+			if volume, ok := frozen[name]; ok {
+				d.log.Warning(fmt.Sprintf("[runFSFreeze] the filesystem of the LVMLogicalVolume %s is frozen longer than %s, thawing it", name, d.fsFreezeTimeout))
+				d.thawFS(ctx, name, volume, fmt.Sprintf("thawed by the timeout of %s", d.fsFreezeTimeout))
+				delete(frozen, name)
+			}
+		case name := <-events:
+			d.reconcileFSFreeze(ctx, name, frozen, timeouts)
+		}
+	}
+}
+
+// reconcileFSFreeze freezes or thaws the filesystem of the volume according to the freeze request.
+func (d *Driver) reconcileFSFreeze(ctx context.Context, name string, frozen map[string]*frozenVolume, timeouts chan<- string) {
+	llv := &v1alpha1.LVMLogicalVolume{}
+	err := d.cache.Get(ctx, client.ObjectKey{Name: name}, llv)
+	if err != nil {
+		if !kerrors.IsNotFound(err) {
+			d.log.Error(err, fmt.Sprintf("[reconcileFSFreeze] unable to get the LVMLogicalVolume %s", name))
+			return
+		}
+		if volume, ok := frozen[name]; ok {
+			d.thawFS(ctx, name, volume, "")
+			delete(frozen, name)
+		}
+		return
+	}
+
+	requested := llv.Annotations[internal.FSFreezeRequestKey] != ""
+	freezeStatus := llv.Annotations[internal.FSFreezeStatusKey]
+	volume, isFrozen := frozen[name]
+	switch {
+	case requested && !isFrozen && freezeStatus == "":
+		d.freezeFS(ctx, llv, frozen, timeouts)
+	case !requested && isFrozen:
+		d.thawFS(ctx, name, volume, "thawed after the snapshot")
+		delete(frozen, name)
+	case !isFrozen && freezeStatus == internal.FSFreezeFrozen:
+		// frozen before the node plugin restart, the filesystem is looked up again
+		mountPoint, onNode, err := d.getFSMountPoint(ctx, llv)
+		if err != nil || !onNode || mountPoint == "" {
+			return
+		}
+		d.log.Warning(fmt.Sprintf("[reconcileFSFreeze] thawing the filesystem of the LVMLogicalVolume %s frozen before the restart", name))
+		d.thawFS(ctx, name, &frozenVolume{mountPoint: mountPoint}, "thawed after the node plugin restart")
+	}
+}
+
+// freezeFS freezes the filesystem of the volume if it is on the node and reports the result.
+func (d *Driver) freezeFS(ctx context.Context, llv *v1alpha1.LVMLogicalVolume, frozen map[string]*frozenVolume, timeouts chan<- string) {
+	mountPoint, onNode, err := d.getFSMountPoint(ctx, llv)
+	if !onNode {
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[freezeFS] unable to check if the LVMLogicalVolume %s is on the node", llv.Name))
+		}
+		return
+	}
+
+	freezeStatus, message := internal.FSFreezeFrozen, fmt.Sprintf("frozen at %s", mountPoint)
+	switch {
+	case err != nil:
+		freezeStatus, message = internal.FSFreezeFailed, err.Error()
+	case mountPoint == "":
+		freezeStatus, message = internal.FSFreezeSkipped, "the filesystem is not mounted"
+	default:
+		d.log.Info(fmt.Sprintf("[freezeFS] freezing the filesystem of the LVMLogicalVolume %s at %s", llv.Name, mountPoint))
+		err = d.storeManager.FreezeFS(mountPoint)
+		if err != nil {
+			freezeStatus, message = internal.FSFreezeFailed, err.Error()
+			break
+		}
+
+		name := llv.Name
+		frozen[name] = &frozenVolume{
+			mountPoint: mountPoint,
+			timer: time.AfterFunc(d.fsFreezeTimeout, func() {
+				select {
+				case timeouts <- name:
+				case <-ctx.Done():
+				}
+			}),
+		}
+	}
+
+	err = utils.SetFSFreezeStatus(ctx, d.cl, llv.Name, freezeStatus, message)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[freezeFS] unable to report the filesystem freeze of the LVMLogicalVolume %s", llv.Name))
+		if volume, ok := frozen[llv.Name]; ok {
+			d.thawFS(ctx, llv.Name, volume, "")
+			delete(frozen, llv.Name)
+		}
+	}
+}
+
+// thawFS thaws the frozen filesystem of the volume and reports the result unless the message is empty.
+func (d *Driver) thawFS(ctx context.Context, name string, volume *frozenVolume, message string) {
+	if volume.timer != nil {
+		volume.timer.Stop()
+	}
+
+	freezeStatus := internal.FSFreezeThawed
+	d.log.Info(fmt.Sprintf("[thawFS] thawing the filesystem of the LVMLogicalVolume %s at %s", name, volume.mountPoint))
+	err := d.storeManager.ThawFS(volume.mountPoint)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[thawFS] unable to thaw the filesystem of the LVMLogicalVolume %s", name))
+		freezeStatus, message = internal.FSFreezeFailed, err.Error()
+	}
+
+	if message == "" {
+		return
+	}
+	err = utils.SetFSFreezeStatus(ctx, d.cl, name, freezeStatus, message)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[thawFS] unable to report the filesystem thaw of the LVMLogicalVolume %s", name))
+	}
+}
+
+// getFSMountPoint returns a mount point of the volume's filesystem, or an empty string if it is not mounted on the node.
+// The block volumes are bind mounted as files, so only the directories are considered. Freezing the filesystem
+// at any of its mount points freezes it at all of them.
+func (d *Driver) getFSMountPoint(ctx context.Context, llv *v1alpha1.LVMLogicalVolume) (mountPoint string, onNode bool, err error) {
+	lvg, err := utils.GetLVMVolumeGroup(ctx, d.cl, llv.Spec.LVMVolumeGroupName)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to get the LVMVolumeGroup %s: %w", llv.Spec.LVMVolumeGroupName, err)
+	}
+	if utils.GetLVGNodeName(*lvg) != d.hostID {
+		return "", false, nil
+	}
+
+	devPath := fmt.Sprintf("/dev/%s/%s", lvg.Spec.ActualVGNameOnTheNode, llv.Spec.ActualLVNameOnTheNode)
+	if llv.Annotations[internal.EncryptionKey] == internal.EncryptionLUKS {
+		devPath = utils.LUKSDevicePath(llv.Name)
+	}
+
+	targets, err := d.storeManager.GetDeviceMountTargets(devPath)
+	if err != nil {
+		return "", true, err
+	}
+	for _, target := range targets {
+		if info, err := os.Stat(target); err == nil && info.IsDir() {
+			return target, true, nil
+		}
+	}
+
+	return "", true, nil
+}
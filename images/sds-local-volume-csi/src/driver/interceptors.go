@@ -0,0 +1,135 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sds-local-volume-csi/internal"
+)
+
+type traceIDKey struct{}
+
+// grpcMetrics are the metrics of the CSI calls served by the driver.
+type grpcMetrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newGRPCMetrics() *grpcMetrics {
+	m := &grpcMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "sds_local_volume_csi",
+			Name:      "grpc_requests_total",
+			Help:      "Total number of the CSI calls by the method and the gRPC status code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "sds_local_volume_csi",
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Duration of the CSI calls by the method.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120, 300},
+		}, []string{"method"}),
+	}
+	m.registry.MustRegister(m.requests, m.duration)
+
+	return m
+}
+
+// traceIDFromContext returns the traceID of the CSI call, so every log line of the call might be correlated.
+func traceIDFromContext(ctx context.Context) string {
+	if traceID, ok := ctx.Value(traceIDKey{}).(string); ok {
+		return traceID
+	}
+
+	return uuid.New().String()
+}
+
+// requestTraceID returns the traceID recorded in the volume context of the request or a new one.
+func requestTraceID(req interface{}) string {
+	if r, ok := req.(interface{ GetVolumeContext() map[string]string }); ok {
+		if traceID := r.GetVolumeContext()[internal.TraceIDKey]; traceID != "" {
+			return traceID
+		}
+	}
+
+	return uuid.New().String()
+}
+
+// traceInterceptor assigns a traceID to the CSI call and logs its result. The call of a volume created by the driver,
+// e.g. the node staging or publication, continues the trace of the volume creation recorded in its volume context,
+// so the logs of the controller plugin, the agent and the node plugin are correlated by the same traceID.
+func (d *Driver) traceInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	d.calls.Add(1)
+	defer d.calls.Done()
+
+	traceID := requestTraceID(req)
+	start := time.Now()
+
+	resp, err := handler(context.WithValue(ctx, traceIDKey{}, traceID), req)
+
+	msg := fmt.Sprintf("[grpc][traceID:%s] method=%s code=%s duration=%s", traceID, info.FullMethod, status.Code(err).String(), time.Since(start))
+	if err != nil {
+		// log response errors for better observability
+		d.log.Error(err, msg)
+	} else {
+		d.log.Debug(msg)
+	}
+
+	return resp, err
+}
+
+// metricsInterceptor counts the CSI calls by the result code and observes their duration, the node mount operations
+// are observed by the node metrics as well.
+func (d *Driver) metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	duration := time.Since(start)
+	d.metrics.requests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	d.metrics.duration.WithLabelValues(info.FullMethod).Observe(duration.Seconds())
+	d.nodeMetrics.observeOperation(info.FullMethod, duration, err)
+
+	return resp, err
+}
+
+// concurrencyInterceptor limits the number of the CSI calls processed at the same time. The calls over the limit wait
+// for a free slot until their deadline. The identity calls are never limited, so the probes are not blocked.
+func (d *Driver) concurrencyInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if d.operationsLimit == nil || strings.HasPrefix(info.FullMethod, "/csi.v1.Identity/") {
+		return handler(ctx, req)
+	}
+
+	select {
+	case d.operationsLimit <- struct{}{}:
+		defer func() { <-d.operationsLimit }()
+	case <-ctx.Done():
+		return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent operations: %s", ctx.Err().Error())
+	}
+
+	return handler(ctx, req)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// runOrphanedMountsCleanup cleans up the orphaned staging mounts of the node until the context is done.
+func (d *Driver) runOrphanedMountsCleanup(ctx context.Context) {
+	ticker := time.NewTicker(d.orphanedMountsCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.cleanupOrphanedMounts(ctx)
+	}
+}
+
+// cleanupOrphanedMounts unmounts the staging mounts of the deleted volumes left on the node after the plugin or node
+// crash interrupted their unstage. kubelet forgets such a volume once its PersistentVolume is deleted, so the mount
+// is never unstaged by kubelet and keeps the LV open. A mount is orphaned only if both the PersistentVolume and
+// the LVMLogicalVolume of its volume are gone, so a volume being staged or provisioned is never touched.
+func (d *Driver) cleanupOrphanedMounts(ctx context.Context) {
+	mountPoints, err := d.storeManager.GetStagingMountPoints(d.name)
+	if err != nil {
+		d.log.Error(err, "[cleanupOrphanedMounts] unable to get the staging mounts of the node")
+		return
+	}
+	if len(mountPoints) == 0 {
+		return
+	}
+
+	pvs := &v1.PersistentVolumeList{}
+	err = d.cl.List(ctx, pvs)
+	if err != nil {
+		d.log.Error(err, "[cleanupOrphanedMounts] unable to list the PersistentVolumes")
+		return
+	}
+	pvVolumeIDs := make(map[string]struct{}, len(pvs.Items))
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == d.name {
+			pvVolumeIDs[pv.Spec.CSI.VolumeHandle] = struct{}{}
+		}
+	}
+
+	for _, stagingPath := range mountPoints {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// the volume data is written by kubelet before the stage, so the mount without it is not the one of kubelet
+		volumeID, err := d.storeManager.GetStagedVolumeID(stagingPath)
+		if err != nil {
+			d.log.Debug(fmt.Sprintf("[cleanupOrphanedMounts] unable to get the volume staged at %s, skipping: %s", stagingPath, err.Error()))
+			continue
+		}
+		if _, ok := pvVolumeIDs[volumeID]; ok {
+			continue
+		}
+
+		_, err = utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(volumeID), "")
+		if err == nil {
+			continue
+		}
+		if !kerrors.IsNotFound(err) {
+			d.log.Error(err, fmt.Sprintf("[cleanupOrphanedMounts] unable to get the LVMLogicalVolume of the volume %s", volumeID))
+			continue
+		}
+
+		d.cleanupOrphanedMount(ctx, volumeID, stagingPath)
+	}
+}
+
+// cleanupOrphanedMount unstages the orphaned volume and reports the result by the metrics and the node event.
+func (d *Driver) cleanupOrphanedMount(ctx context.Context, volumeID, stagingPath string) {
+	// the volume being unstaged by kubelet right now is left to kubelet
+	if !d.inFlight.Insert(volumeID) {
+		return
+	}
+	defer d.inFlight.Delete(volumeID)
+
+	err := d.unstageOrphanedMount(volumeID, stagingPath)
+	if err != nil {
+		message := fmt.Sprintf("Unable to clean up the orphaned staging mount %s of the deleted volume %s: %s", stagingPath, volumeID, err.Error())
+		d.log.Warning(fmt.Sprintf("[cleanupOrphanedMount] %s", message))
+		d.nodeMetrics.orphanedMountCleanups.WithLabelValues("failed").Inc()
+		d.recordNodeEvent(ctx, v1.EventTypeWarning, orphanedMountCleanupFailedReason, message)
+		return
+	}
+
+	message := fmt.Sprintf("The orphaned staging mount %s of the deleted volume %s has been cleaned up", stagingPath, volumeID)
+	d.log.Info(fmt.Sprintf("[cleanupOrphanedMount] %s", message))
+	d.nodeMetrics.orphanedMountCleanups.WithLabelValues("cleaned").Inc()
+	d.recordNodeEvent(ctx, v1.EventTypeNormal, orphanedMountCleanedReason, message)
+}
+
+// unstageOrphanedMount unstages the volume the same way NodeUnstageVolume does and removes the data kubelet has left
+// for it. The volume still published to a Pod is kept, as unmounting it would break the Pod.
+func (d *Driver) unstageOrphanedMount(volumeID, stagingPath string) error {
+	device, err := d.storeManager.GetMountDevice(stagingPath)
+	if err != nil {
+		return fmt.Errorf("unable to get the device: %w", err)
+	}
+	published, err := d.getPublishedTargets(device, stagingPath, "", false)
+	if err != nil {
+		return fmt.Errorf("unable to check the publications: %w", err)
+	}
+	if len(published) != 0 {
+		return fmt.Errorf("the volume is still published at %v", published)
+	}
+
+	err = d.storeManager.Unstage(stagingPath)
+	if err != nil {
+		return fmt.Errorf("unable to unmount: %w", err)
+	}
+
+	err = d.storeManager.CloseLUKS(utils.LUKSMapperName(volumeID))
+	if err != nil {
+		return fmt.Errorf("unable to close the encrypted volume: %w", err)
+	}
+
+	return d.storeManager.RemoveVolumeData(stagingPath)
+}
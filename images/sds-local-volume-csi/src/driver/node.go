@@ -18,17 +18,27 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/deckhouse/sds-node-configurator/api/v1alpha1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
 )
 
 const (
@@ -45,15 +55,41 @@ var (
 		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
 		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
 		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+		csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP,
+		csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
 	}
 
 	ValidFSTypes = map[string]struct{}{
-		internal.FSTypeExt4: {},
-		internal.FSTypeXfs:  {},
+		internal.FSTypeExt4:  {},
+		internal.FSTypeXfs:   {},
+		internal.FSTypeBtrfs: {},
+	}
+
+	// bindMountOptions are the per-mount options a bind mount might apply. The rest of the mount flags are
+	// the filesystem options, e.g. data=writeback or compress=zstd, they are applied on the staging only,
+	// as the bind mount can not change the options of the filesystem.
+	bindMountOptions = map[string]struct{}{
+		"ro":            {},
+		"rw":            {},
+		"atime":         {},
+		"noatime":       {},
+		"diratime":      {},
+		"nodiratime":    {},
+		"relatime":      {},
+		"norelatime":    {},
+		"strictatime":   {},
+		"nostrictatime": {},
+		"dev":           {},
+		"nodev":         {},
+		"exec":          {},
+		"noexec":        {},
+		"suid":          {},
+		"nosuid":        {},
 	}
 )
 
-func (d *Driver) NodeStageVolume(_ context.Context, request *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+func (d *Driver) NodeStageVolume(ctx context.Context, request *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
 	volumeID := request.GetVolumeId()
 	if len(volumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "[NodeStageVolume] Volume id cannot be empty")
@@ -70,13 +106,38 @@ func (d *Driver) NodeStageVolume(_ context.Context, request *csi.NodeStageVolume
 	}
 
 	context := request.GetVolumeContext()
-	vgName, ok := context[internal.VGNameKey]
-	if !ok {
-		return nil, status.Error(codes.InvalidArgument, "[NodeStageVolume] Volume group name cannot be empty")
+	devPath, err := utils.GetVolumeDevicePath(volumeID, context)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
 	}
+	// the volume staged again is erased again when it is released
+	d.erasedVolumes.Delete(volumeID)
 
 	if volCap.GetBlock() != nil {
-		d.log.Info("[NodeStageVolume] Block volume detected. Skipping staging.")
+		if !utils.IsEncrypted(context) {
+			d.log.Info("[NodeStageVolume] Block volume detected. Skipping staging.")
+			return &csi.NodeStageVolumeResponse{}, nil
+		}
+
+		d.log.Info("[NodeStageVolume] Encrypted block volume detected. Opening the device.")
+		if !d.inFlight.Insert(volumeID) {
+			return nil, status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, volumeID)
+		}
+		defer d.inFlight.Delete(volumeID)
+
+		lvmDevPath := devPath
+		devPath, err = d.waitForDevice(ctx, devPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := d.checkDeviceIdentity(lvmDevPath, devPath, context); err != nil {
+			return nil, err
+		}
+
+		if _, err := d.openEncryptedVolume(volumeID, devPath, request.GetSecrets()); err != nil {
+			return nil, err
+		}
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
@@ -85,12 +146,9 @@ func (d *Driver) NodeStageVolume(_ context.Context, request *csi.NodeStageVolume
 		return nil, status.Error(codes.InvalidArgument, "[NodeStageVolume] Volume capability mount cannot be empty")
 	}
 
-	fsType := mountVolume.GetFsType()
-	if fsType == "" {
-		fsType = defaultFsType
-	}
+	fsType := volumeFsType(mountVolume, context)
 
-	_, ok = ValidFSTypes[strings.ToLower(fsType)]
+	_, ok := ValidFSTypes[strings.ToLower(fsType)]
 	if !ok {
 		d.log.Error(fmt.Errorf("[NodeStageVolume] Invalid fsType: %s. Supported values: %v", fsType, ValidFSTypes), "Invalid fsType")
 		return nil, status.Errorf(codes.InvalidArgument, "invalid fsType")
@@ -108,7 +166,42 @@ func (d *Driver) NodeStageVolume(_ context.Context, request *csi.NodeStageVolume
 		formatOptions = append(formatOptions, "-m", "bigtime=0,inobtcount=0,reflink=0", "-i", "nrext64=0")
 	}
 
-	mountOptions := collectMountOptions(fsType, mountVolume.GetMountFlags(), []string{})
+	if fsType == internal.FSTypeExt4 {
+		ext4Options, err := utils.GetExt4Options(context)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
+		}
+		formatOptions = append(formatOptions, ext4Options...)
+	}
+
+	mkfsOptions, err := utils.ParseMkfsOptions(context)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
+	}
+	// the filesystem is labeled after the PVC, so the owner of the LV is seen with lsblk -f on the node
+	if label := utils.GetFSLabel(context, fsType); label != "" && !slices.Contains(mkfsOptions, "-L") {
+		formatOptions = append(formatOptions, "-L", label)
+	}
+	formatOptions = append(formatOptions, mkfsOptions...)
+
+	mountFlags, err := volumeMountFlags(mountVolume, context)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
+	}
+	mountOptions := collectMountOptions(mountFlags, []string{})
+
+	fsckPolicy, err := utils.GetFsckPolicy(context, d.fsckPolicy)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
+	}
+
+	discardPolicy, err := utils.GetDiscardPolicy(context)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
+	}
+	if discardPolicy == internal.DiscardPolicyMount && !slices.Contains(mountOptions, "discard") {
+		mountOptions = append(mountOptions, "discard")
+	}
 
 	d.log.Debug(fmt.Sprintf("[NodeStageVolume] Volume %s operation started", volumeID))
 	ok = d.inFlight.Insert(volumeID)
@@ -120,14 +213,53 @@ func (d *Driver) NodeStageVolume(_ context.Context, request *csi.NodeStageVolume
 		d.inFlight.Delete(volumeID)
 	}()
 
-	devPath := fmt.Sprintf("/dev/%s/%s", vgName, request.VolumeId)
-	d.log.Debug(fmt.Sprintf("[NodeStageVolume] Checking if device exists: %s", devPath))
-	exists, err := d.storeManager.PathExists(devPath)
+	// the repeated stage, e.g. after the kubelet or plugin restart, finds the volume mounted and leaves it as is,
+	// so the device in use is neither checked nor formatted again
+	stagedDevPath := devPath
+	if utils.IsEncrypted(context) {
+		stagedDevPath = utils.LUKSDevicePath(volumeID)
+	}
+	staged, err := d.storeManager.IsMountedAt(stagedDevPath, target)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error checking if device exists: %v", err)
+		return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error checking if volume %q is staged at %q: %v", volumeID, target, err)
 	}
-	if !exists {
-		return nil, status.Errorf(codes.NotFound, "[NodeStageVolume] Device %s not found", devPath)
+	if staged {
+		d.log.Info(fmt.Sprintf("[NodeStageVolume] Volume %q (%q) is already staged at %s", volumeID, stagedDevPath, target))
+		err = d.resizeStagedVolume(volumeID, stagedDevPath, target)
+		if err != nil {
+			return nil, err
+		}
+		d.tuneBlockDevice(ctx, volumeID, stagedDevPath, d.getVolumeAttributes(ctx, volumeID, context))
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	d.log.Debug(fmt.Sprintf("[NodeStageVolume] Waiting for the device %s", devPath))
+	lvmDevPath := devPath
+	devPath, err = d.waitForDevice(ctx, devPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.checkDeviceIdentity(lvmDevPath, devPath, context)
+	if err != nil {
+		return nil, err
+	}
+
+	if utils.IsEncrypted(context) {
+		devPath, err = d.openEncryptedVolume(volumeID, devPath, request.GetSecrets())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	forceFormat, err := utils.IsForceFormat(context)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
+	}
+	err = d.storeManager.CheckDeviceFormat(devPath, fsType, forceFormat)
+	if err != nil {
+		d.log.Error(err, "[NodeStageVolume] Refusing to format the device")
+		return nil, status.Errorf(codes.FailedPrecondition, "[NodeStageVolume] Device %q can not be formatted: %v", devPath, err)
 	}
 
 	lvmType := context[internal.LvmTypeKey]
@@ -139,32 +271,57 @@ func (d *Driver) NodeStageVolume(_ context.Context, request *csi.NodeStageVolume
 	d.log.Trace(fmt.Sprintf("lvmThinPoolName = %s", lvmThinPoolName))
 	d.log.Trace(fmt.Sprintf("fsType = %s", fsType))
 
-	err = d.storeManager.NodeStageVolumeFS(devPath, target, fsType, mountOptions, formatOptions, lvmType, lvmThinPoolName)
+	// the empty device is formatted by the staging, which is observed as the mkfs duration
+	existingFormat, err := d.storeManager.GetDiskFormat(devPath)
 	if err != nil {
-		d.log.Error(err, "[NodeStageVolume] Error mounting volume")
-		return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error format device %q and mounting volume at %q: %v", devPath, target, err)
+		return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error getting the format of device %q: %v", devPath, err)
 	}
 
-	needResize, err := d.storeManager.NeedResize(devPath, target)
-	if err != nil {
-		d.log.Error(err, "[NodeStageVolume] Error checking if volume needs resize")
-		return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error checking if the volume %q (%q) mounted at %q needs resizing: %v", volumeID, devPath, target, err)
+	// the XFS of a clone or a restored snapshot has the UUID of its source, and it is not mounted next to the source
+	if fsType == internal.FSTypeXfs && existingFormat == internal.FSTypeXfs {
+		mountOptions, err = d.handleDuplicateXFSUUID(devPath, mountOptions, context)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if needResize {
-		d.log.Info(fmt.Sprintf("[NodeStageVolume] Resizing volume %q (%q) mounted at %q", volumeID, devPath, target))
-		err = d.storeManager.ResizeFS(target)
+	// mkfs and fsck saturate the node's IO, so the number of them run at the same time is limited
+	if existingFormat == "" || fsckPolicy != internal.FsckPolicyNone {
+		release, err := d.acquireFormatSlot(ctx, volumeID)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error resizing volume %q (%q) mounted at %q: %v", volumeID, devPath, target, err)
+			return nil, err
 		}
+		defer release()
 	}
 
-	d.log.Info(fmt.Sprintf("[NodeStageVolume] Volume %q (%q) successfully staged at %s. FsType: %s", volumeID, devPath, target, fsType))
+	err = d.storeManager.CheckFS(devPath, fsckPolicy)
+	if err != nil {
+		d.log.Error(err, "[NodeStageVolume] Error checking filesystem")
+		return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error checking filesystem of device %q: %v", devPath, err)
+	}
+
+	stageStart := time.Now()
+	err = d.storeManager.NodeStageVolumeFS(devPath, target, fsType, mountOptions, formatOptions, lvmType, lvmThinPoolName)
+	if err != nil {
+		d.log.Error(err, "[NodeStageVolume] Error mounting volume")
+		return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error format device %q and mounting volume at %q: %v", devPath, target, err)
+	}
+	if existingFormat == "" {
+		d.nodeMetrics.mkfsDuration.WithLabelValues(fsType).Observe(time.Since(stageStart).Seconds())
+	}
+
+	err = d.resizeStagedVolume(volumeID, devPath, target)
+	if err != nil {
+		return nil, err
+	}
+	d.tuneBlockDevice(ctx, volumeID, devPath, d.getVolumeAttributes(ctx, volumeID, context))
+
+	d.log.Info(fmt.Sprintf("[NodeStageVolume][traceID:%s] Volume %q (%q) successfully staged at %s. FsType: %s", traceIDFromContext(ctx), volumeID, devPath, target, fsType))
 
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
-func (d *Driver) NodeUnstageVolume(_ context.Context, request *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+func (d *Driver) NodeUnstageVolume(ctx context.Context, request *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
 	d.log.Debug(fmt.Sprintf("[NodeUnstageVolume] method called with request: %v", request))
 	volumeID := request.GetVolumeId()
 	if len(volumeID) == 0 {
@@ -185,15 +342,42 @@ func (d *Driver) NodeUnstageVolume(_ context.Context, request *csi.NodeUnstageVo
 		d.log.Debug(fmt.Sprintf("[NodeUnstageVolume] Volume %s operation completed", volumeID))
 		d.inFlight.Delete(volumeID)
 	}()
-	err := d.storeManager.Unstage(target)
+
+	// the staging is shared by all the publications of the volume on the node, so it is kept until the last one is gone.
+	// The publications are counted by the kernel mounts, so the count is right after the kubelet or plugin restart too
+	device, err := d.storeManager.GetMountDevice(target)
+	if err != nil {
+		// the encrypted block volume is staged as the opened device, which is closed only if no Pod uses it
+		device = utils.LUKSDevicePath(volumeID)
+	}
+	published, err := d.getPublishedTargets(device, target, "", false)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeUnstageVolume] Error checking publications of volume %q: %v", volumeID, err)
+	}
+	if len(published) != 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "[NodeUnstageVolume] Volume %q is still published at %v", volumeID, published)
+	}
+
+	err = d.unstage(ctx, volumeID, target)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "[NodeUnstageVolume] Error unmounting volume %q mounted at %q: %v", volumeID, target, err)
 	}
 
+	// the request has no volume context, so the encrypted volume is recognized by its opened device
+	err = d.storeManager.CloseLUKS(utils.LUKSMapperName(volumeID))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeUnstageVolume] Error closing encrypted volume %q: %v", volumeID, err)
+	}
+
+	err = d.eraseReleasedVolume(ctx, volumeID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeUnstageVolume] Error erasing volume %q: %v", volumeID, err)
+	}
+
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
-func (d *Driver) NodePublishVolume(_ context.Context, request *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+func (d *Driver) NodePublishVolume(ctx context.Context, request *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
 	d.log.Info("Start method NodePublishVolume")
 	d.log.Trace("------------- NodePublishVolume --------------")
 	d.log.Trace(request.String())
@@ -204,11 +388,6 @@ func (d *Driver) NodePublishVolume(_ context.Context, request *csi.NodePublishVo
 		return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Volume id cannot be empty")
 	}
 
-	source := request.GetStagingTargetPath()
-	if len(source) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Staging target path cannot be empty")
-	}
-
 	target := request.GetTargetPath()
 	if len(target) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Target path cannot be empty")
@@ -219,17 +398,29 @@ func (d *Driver) NodePublishVolume(_ context.Context, request *csi.NodePublishVo
 		return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Volume capability cannot be empty")
 	}
 
+	// kubelet does not stage the inline ephemeral volumes, so they have no staging target path
+	if isEphemeralVolume(request.GetVolumeContext()) {
+		return d.nodePublishEphemeralVolume(ctx, request)
+	}
+
+	source := request.GetStagingTargetPath()
+	if len(source) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Staging target path cannot be empty")
+	}
+
 	mountOptions := []string{"bind"}
 	if request.GetReadonly() {
 		mountOptions = append(mountOptions, "ro")
 	}
 
-	vgName, ok := request.GetVolumeContext()[internal.VGNameKey]
-	if !ok {
-		return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Volume group name cannot be empty")
+	devPath, err := utils.GetVolumeDevicePath(volumeID, request.GetVolumeContext())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] %s", err.Error())
+	}
+	if utils.IsEncrypted(request.GetVolumeContext()) {
+		devPath = utils.LUKSDevicePath(volumeID)
 	}
 
-	devPath := fmt.Sprintf("/dev/%s/%s", vgName, request.VolumeId)
 	d.log.Debug(fmt.Sprintf("[NodePublishVolume] Checking if device exists: %s", devPath))
 	exists, err := d.storeManager.PathExists(devPath)
 	if err != nil {
@@ -241,7 +432,7 @@ func (d *Driver) NodePublishVolume(_ context.Context, request *csi.NodePublishVo
 
 	d.log.Debug(fmt.Sprintf("[NodePublishVolume] Volume %s operation started", volumeID))
 
-	ok = d.inFlight.Insert(volumeID)
+	ok := d.inFlight.Insert(volumeID)
 	if !ok {
 		return nil, status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, volumeID)
 	}
@@ -250,6 +441,17 @@ func (d *Driver) NodePublishVolume(_ context.Context, request *csi.NodePublishVo
 		d.inFlight.Delete(volumeID)
 	}()
 
+	// a ReadWriteOncePod volume might be used by a single Pod only, while the ReadWriteOnce one is shared by the Pods of the node
+	if volCap.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER {
+		published, err := d.getPublishedTargets(devPath, source, target, volCap.GetBlock() != nil)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[NodePublishVolume] Error checking publications of volume %q: %v", volumeID, err)
+		}
+		if len(published) != 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "[NodePublishVolume] Volume %q is already published at %v and allows a single writer only", volumeID, published)
+		}
+	}
+
 	switch volCap.GetAccessType().(type) {
 	case *csi.VolumeCapability_Block:
 		d.log.Trace("[NodePublishVolume] Block volume detected.")
@@ -265,10 +467,7 @@ func (d *Driver) NodePublishVolume(_ context.Context, request *csi.NodePublishVo
 		if mountVolume == nil {
 			return nil, status.Error(codes.InvalidArgument, "[NodePublishVolume] Volume capability mount cannot be empty")
 		}
-		fsType := mountVolume.GetFsType()
-		if fsType == "" {
-			fsType = defaultFsType
-		}
+		fsType := volumeFsType(mountVolume, request.GetVolumeContext())
 
 		_, ok = ValidFSTypes[strings.ToLower(fsType)]
 		if !ok {
@@ -276,18 +475,44 @@ func (d *Driver) NodePublishVolume(_ context.Context, request *csi.NodePublishVo
 			return nil, status.Errorf(codes.InvalidArgument, "Invalid fsType")
 		}
 
-		mountOptions = collectMountOptions(fsType, mountVolume.GetMountFlags(), mountOptions)
+		mountFlags, err := volumeMountFlags(mountVolume, request.GetVolumeContext())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] %s", err.Error())
+		}
+		mountOptions = collectMountOptions(mountFlags, mountOptions)
+
+		// kubelet delegates the fsGroup of the Pod to the driver instead of changing the ownership itself
+		if mountGroup := mountVolume.GetVolumeMountGroup(); mountGroup != "" {
+			gid, err := strconv.ParseInt(mountGroup, 10, 32)
+			if err != nil || gid < 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] Invalid volume mount group %q", mountGroup)
+			}
+
+			policy, err := utils.GetFSGroupChangePolicy(request.GetVolumeContext())
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] %s", err.Error())
+			}
+
+			err = d.storeManager.SetVolumeOwnership(source, gid, request.GetReadonly(), policy == internal.FSGroupChangePolicyOnRootMismatch)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "[NodePublishVolume] Error applying volume mount group %d to volume %q: %v", gid, volumeID, err)
+			}
+		}
 
-		err := d.storeManager.NodePublishVolumeFS(source, devPath, target, fsType, mountOptions)
+		err = d.storeManager.NodePublishVolumeFS(source, devPath, target, fsType, mountOptions)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "[NodePublishVolume] Error bind mounting volume %q. Source: %q. Target: %q. Mount options:%v. Err: %v", volumeID, source, target, mountOptions, err)
 		}
 	}
 
+	attributes := d.getVolumeAttributes(ctx, volumeID, request.GetVolumeContext())
+	d.tuneBlockDevice(ctx, volumeID, devPath, attributes)
+	d.limitVolumeIO(ctx, volumeID, devPath, request.GetVolumeContext()[internal.PodUIDContextKey], attributes)
+
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
-func (d *Driver) NodeUnpublishVolume(_ context.Context, request *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+func (d *Driver) NodeUnpublishVolume(ctx context.Context, request *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
 	d.log.Debug(fmt.Sprintf("[NodeUnpublishVolume] method called with request: %v", request))
 	d.log.Trace("------------- NodeUnpublishVolume --------------")
 	d.log.Trace(request.String())
@@ -318,12 +543,92 @@ func (d *Driver) NodeUnpublishVolume(_ context.Context, request *csi.NodeUnpubli
 		return nil, status.Errorf(codes.Internal, "[NodeUnpublishVolume] Error unmounting volume %q mounted at %q: %v", volumeID, target, err)
 	}
 
+	// kubelet names the inline ephemeral volumes csi-<hash>, the persistent ones are never looked up
+	if strings.HasPrefix(volumeID, ephemeralVolumeIDPrefix) {
+		err = d.deleteEphemeralVolume(ctx, volumeID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[NodeUnpublishVolume] Error deleting ephemeral volume %q: %v", volumeID, err)
+		}
+	}
+
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
-func (d *Driver) NodeGetVolumeStats(_ context.Context, _ *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
-	d.log.Info("method NodeGetVolumeStats")
-	return &csi.NodeGetVolumeStatsResponse{}, nil
+func (d *Driver) NodeGetVolumeStats(ctx context.Context, request *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	d.log.Debug(fmt.Sprintf("[NodeGetVolumeStats] method called with request: %v", request))
+
+	volumeID := request.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "[NodeGetVolumeStats] Volume id cannot be empty")
+	}
+
+	volumePath := request.GetVolumePath()
+	if len(volumePath) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "[NodeGetVolumeStats] Volume path cannot be empty")
+	}
+
+	exists, err := d.storeManager.PathExists(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeGetVolumeStats] Error checking if volume path %q exists: %v", volumePath, err)
+	}
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "[NodeGetVolumeStats] Volume path %q not found", volumePath)
+	}
+
+	condition := d.getNodeVolumeCondition(ctx, volumeID, volumePath)
+
+	isBlock, err := d.storeManager.IsBlockDevice(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeGetVolumeStats] Error checking if volume path %q is a block device: %v", volumePath, err)
+	}
+
+	if isBlock {
+		size, err := d.storeManager.GetBlockSizeBytes(volumePath)
+		if err != nil {
+			if condition.Abnormal {
+				return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+			}
+			return nil, status.Errorf(codes.Internal, "[NodeGetVolumeStats] Error getting the size of the block volume %q: %v", volumeID, err)
+		}
+
+		return &csi.NodeGetVolumeStatsResponse{
+			Usage: []*csi.VolumeUsage{
+				{
+					Unit:  csi.VolumeUsage_BYTES,
+					Total: size,
+				},
+			},
+			VolumeCondition: condition,
+		}, nil
+	}
+
+	stats, err := d.storeManager.GetFSStats(volumePath)
+	if err != nil {
+		// the stats of the broken volume are not available, while its condition is what the health monitor needs
+		if condition.Abnormal {
+			return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+		}
+		return nil, status.Errorf(codes.Internal, "[NodeGetVolumeStats] Error getting the filesystem stats of the volume %q: %v", volumeID, err)
+	}
+	d.log.Trace(fmt.Sprintf("[NodeGetVolumeStats] Volume %q stats: %+v", volumeID, stats))
+
+	return &csi.NodeGetVolumeStatsResponse{
+		VolumeCondition: condition,
+		Usage: []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Total:     stats.TotalBytes,
+				Available: stats.AvailableBytes,
+				Used:      stats.UsedBytes,
+			},
+			{
+				Unit:      csi.VolumeUsage_INODES,
+				Total:     stats.TotalInodes,
+				Available: stats.AvailableInodes,
+				Used:      stats.UsedInodes,
+			},
+		},
+	}, nil
 }
 
 func (d *Driver) NodeExpandVolume(_ context.Context, request *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
@@ -342,13 +647,76 @@ func (d *Driver) NodeExpandVolume(_ context.Context, request *csi.NodeExpandVolu
 		return nil, status.Error(codes.InvalidArgument, "Volume Path cannot be empty")
 	}
 
-	err := d.storeManager.ResizeFS(volumePath)
+	exists, err := d.storeManager.PathExists(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeExpandVolume] Error checking if volume path %q exists: %v", volumePath, err)
+	}
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "[NodeExpandVolume] Volume path %q not found", volumePath)
+	}
+
+	// the opened encrypted device is grown to the expanded LV first
+	if encrypted, err := d.storeManager.PathExists(utils.LUKSDevicePath(volumeID)); err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeExpandVolume] Error checking if volume %q is encrypted: %v", volumeID, err)
+	} else if encrypted {
+		err = d.storeManager.ResizeLUKS(utils.LUKSMapperName(volumeID), request.GetSecrets()[internal.LUKSPassphraseKey])
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[NodeExpandVolume] Error resizing encrypted volume %q: %v", volumeID, err)
+		}
+	}
+
+	// kubelet might call the method for a block volume even though the controller does not require the node expansion,
+	// there is no filesystem to resize, so just the new size of the device is returned
+	isBlock := request.GetVolumeCapability().GetBlock() != nil
+	if !isBlock {
+		isBlock, err = d.storeManager.IsBlockDevice(volumePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[NodeExpandVolume] Error checking if volume path %q is a block device: %v", volumePath, err)
+		}
+	}
+
+	devicePath := volumePath
+	if !isBlock {
+		devicePath, err = d.storeManager.GetMountDevice(volumePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[NodeExpandVolume] %v", err)
+		}
+	}
+
+	// the LV is expanded by the agent, the node might see the new size of the device a bit later.
+	// The agent considers the LV resized within the delta, so the same tolerance is applied here
+	deviceSize, err := d.storeManager.GetBlockSizeBytes(devicePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeExpandVolume] %v", err)
+	}
+	requiredBytes := request.GetCapacityRange().GetRequiredBytes()
+	resizeDelta := resource.MustParse(internal.ResizeDelta)
+	if deviceSize < requiredBytes && !utils.AreSizesEqualWithinDelta(*resource.NewQuantity(deviceSize, resource.BinarySI), *resource.NewQuantity(requiredBytes, resource.BinarySI), resizeDelta) {
+		d.log.Warning(fmt.Sprintf("[NodeExpandVolume] the device %s of the volume %s has the size %d less than the required %d yet", devicePath, volumeID, deviceSize, requiredBytes))
+		return nil, status.Errorf(codes.Unavailable, "[NodeExpandVolume] the device %s is not expanded to %d bytes yet", devicePath, requiredBytes)
+	}
+
+	if isBlock {
+		d.log.Info(fmt.Sprintf("[NodeExpandVolume] Volume %q at %q is a block volume of %d bytes, no filesystem to resize", volumeID, volumePath, deviceSize))
+		return &csi.NodeExpandVolumeResponse{CapacityBytes: deviceSize}, nil
+	}
+
+	err = d.storeManager.ResizeFS(volumePath)
 	if err != nil {
 		d.log.Error(err, "d.mounter.ResizeFS:")
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	return &csi.NodeExpandVolumeResponse{}, nil
+	needResize, err := d.storeManager.NeedResize(devicePath, volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeExpandVolume] Error checking the filesystem size of the volume %q: %v", volumeID, err)
+	}
+	if needResize {
+		return nil, status.Errorf(codes.Internal, "[NodeExpandVolume] the filesystem of the volume %q is not expanded to the device size %d", volumeID, deviceSize)
+	}
+
+	d.log.Info(fmt.Sprintf("[NodeExpandVolume] Volume %q (%q) mounted at %q is expanded to %d bytes", volumeID, devicePath, volumePath, deviceSize))
+	return &csi.NodeExpandVolumeResponse{CapacityBytes: deviceSize}, nil
 }
 
 func (d *Driver) NodeGetCapabilities(_ context.Context, request *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
@@ -370,36 +738,241 @@ func (d *Driver) NodeGetCapabilities(_ context.Context, request *csi.NodeGetCapa
 	}, nil
 }
 
-func (d *Driver) NodeGetInfo(_ context.Context, _ *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+func (d *Driver) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 	d.log.Info("method NodeGetInfo")
 	d.log.Info(fmt.Sprintf("hostID = %s", d.hostID))
 
+	segments, err := utils.GetNodeTopologySegments(ctx, d.cl, d.hostID, d.topologyKeys)
+	if err != nil {
+		d.log.Error(err, "[NodeGetInfo] unable to get the node topology")
+		return nil, status.Errorf(codes.Internal, "unable to get the node topology: %s", err.Error())
+	}
+	d.log.Info(fmt.Sprintf("topology segments = %v", segments))
+
+	maxVolumes := d.getMaxVolumesPerNode(ctx)
+	d.log.Info(fmt.Sprintf("max volumes per node = %d", maxVolumes))
+
 	return &csi.NodeGetInfoResponse{
-		NodeId: d.hostID,
-		//MaxVolumesPerNode: 10,
+		NodeId:            d.hostID,
+		MaxVolumesPerNode: maxVolumes,
 		AccessibleTopology: &csi.Topology{
-			Segments: map[string]string{
-				internal.TopologyKey: d.hostID,
-			},
+			Segments: segments,
 		},
 	}, nil
 }
 
+// waitForDevice waits for the device of the volume to appear on the node and returns its path. The device not ready
+// in time is reported as Unavailable, so kubelet retries the request. The returned error is a gRPC status error.
+func (d *Driver) waitForDevice(ctx context.Context, devPath string) (string, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, d.deviceWaitTimeout)
+	defer cancel()
+
+	readyPath, err := d.storeManager.WaitForDevice(waitCtx, devPath)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[waitForDevice] the device %s is not ready", devPath))
+		if errors.Is(err, utils.ErrDeviceNotReady) {
+			return "", status.Errorf(codes.Unavailable, "device %s is not ready: %s", devPath, err.Error())
+		}
+		return "", status.Errorf(codes.Internal, "error waiting for the device %s: %s", devPath, err.Error())
+	}
+
+	return readyPath, nil
+}
+
+// unstage unmounts the staging path of the volume. The unmount failing or hanging because a process keeps the files
+// open is retried until the unmount timeout, and then escalated to the lazy or forced unmount, so the Pod does not
+// get stuck terminating. The timeout is counted from the first attempt, as kubelet retries the request with its own
+// deadline. The escalation is reported in the events of the node.
+func (d *Driver) unstage(ctx context.Context, volumeID, target string) error {
+	if d.unmountTimeout == 0 {
+		return d.storeManager.Unstage(target)
+	}
+
+	startedAt, _ := d.unmountStartedAt.LoadOrStore(volumeID, time.Now())
+	deadline := time.After(time.Until(startedAt.(time.Time).Add(d.unmountTimeout)))
+
+	var err error
+retry:
+	for {
+		// the hung unmount can not be interrupted, so it is left running in the background
+		result := make(chan error, 1)
+		go func() {
+			result <- d.storeManager.Unstage(target)
+		}()
+
+		select {
+		case err = <-result:
+			if err == nil {
+				d.unmountStartedAt.Delete(volumeID)
+				return nil
+			}
+			d.log.Warning(fmt.Sprintf("[NodeUnstageVolume] unable to unmount the volume %s at %s, retrying: %s", volumeID, target, err.Error()))
+		case <-deadline:
+			err = fmt.Errorf("the unmount has not finished")
+			break retry
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		select {
+		case <-deadline:
+			break retry
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(internal.UnmountRetryInterval):
+		}
+	}
+
+	message := fmt.Sprintf("The unmount of the volume %s at %s has failed in %s: %s. The volume is unmounted with the %s escalation, the processes keeping its files open might lose the unsaved data", volumeID, target, d.unmountTimeout, err.Error(), d.unmountEscalation)
+	d.log.Warning(fmt.Sprintf("[NodeUnstageVolume] %s", message))
+	d.recordNodeEvent(ctx, v1.EventTypeWarning, unmountEscalatedReason, message)
+
+	err = d.storeManager.ForceUnmount(target, d.unmountEscalation)
+	if err != nil {
+		d.recordNodeEvent(ctx, v1.EventTypeWarning, unmountFailedReason, fmt.Sprintf("The %s unmount of the volume %s at %s has failed: %s", d.unmountEscalation, volumeID, target, err.Error()))
+		return err
+	}
+	d.unmountStartedAt.Delete(volumeID)
+
+	// the target is not a mount point anymore, so only the directory is removed
+	return d.storeManager.Unstage(target)
+}
+
+// checkDeviceIdentity checks the device of the volume is the expected LV, so a stale volume context does not lead
+// to formatting another volume. The mismatch is only logged if the force format is set. The returned error is
+// a gRPC status error.
+func (d *Driver) checkDeviceIdentity(lvmDevPath, devPath string, volumeCtx map[string]string) error {
+	// the raw device is not an LV, it is identified by its BlockDevice, and the format check still guards its data
+	if utils.IsRawDeviceVolume(volumeCtx) {
+		return nil
+	}
+
+	vgName, lvName, ok := utils.ParseLVMDevicePath(lvmDevPath)
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "[NodeStageVolume] Device path %q is not in the /dev/<vg>/<lv> format", lvmDevPath)
+	}
+
+	err := d.storeManager.CheckDeviceIdentity(devPath, vgName, lvName)
+	if err == nil {
+		return nil
+	}
+
+	if force, _ := utils.IsForceFormat(volumeCtx); force {
+		d.log.Warning(fmt.Sprintf("[NodeStageVolume] the identity check of the device %s failed, ignored as the force format is set: %s", devPath, err.Error()))
+		return nil
+	}
+
+	d.log.Error(err, "[NodeStageVolume] Device identity check failed")
+	return status.Errorf(codes.FailedPrecondition, "[NodeStageVolume] Device %q identity check failed: %v", devPath, err)
+}
+
+// getMaxVolumesPerNode returns the configured maximum number of the volumes of the node. If it is not configured,
+// the maximum is derived from the LVM metadata limits of the node's VGs. The node's volumes are not limited
+// if the limits are unknown, so the failure to get them is only logged.
+func (d *Driver) getMaxVolumesPerNode(ctx context.Context) int64 {
+	if d.maxVolumesPerNode > 0 {
+		return d.maxVolumesPerNode
+	}
+
+	lvgs, err := utils.GetLVGList(ctx, d.cl)
+	if err != nil {
+		d.log.Error(err, "[NodeGetInfo] unable to list the LVMVolumeGroups, the volumes of the node are not limited")
+		return 0
+	}
+
+	var maxVolumes int64
+	for _, lvg := range lvgs.Items {
+		if utils.GetLVGNodeName(lvg) != d.hostID {
+			continue
+		}
+
+		limit, err := d.storeManager.GetVGVolumeLimit(lvg.Spec.ActualVGNameOnTheNode)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[NodeGetInfo] unable to get the volume limit of the VG %s, the volumes of the node are not limited", lvg.Spec.ActualVGNameOnTheNode))
+			return 0
+		}
+		maxVolumes += limit
+	}
+
+	return maxVolumes
+}
+
+// getPublishedTargets returns the paths the volume's device is published at, except for the staging path and the target
+// of the current request. kubelet bind mounts the published block device once more to a path named after the Pod UID
+// as the target is, so such a mount belongs to the same Pod.
+func (d *Driver) getPublishedTargets(devPath, stagingPath, target string, isBlock bool) ([]string, error) {
+	targets, err := d.storeManager.GetDeviceMountTargets(devPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(targets, func(t string) bool {
+		return t == stagingPath || t == target || (isBlock && filepath.Base(t) == filepath.Base(target))
+	}), nil
+}
+
+// openEncryptedVolume opens the LUKS device of the encrypted volume with the passphrase from the node stage secret and
+// returns the path of the opened device. The returned error is a gRPC status error.
+func (d *Driver) openEncryptedVolume(volumeID, devPath string, secrets map[string]string) (string, error) {
+	passphrase, err := utils.GetLUKSPassphrase(secrets)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
+	}
+
+	luksPath, err := d.storeManager.OpenLUKS(devPath, utils.LUKSMapperName(volumeID), passphrase)
+	if err != nil {
+		d.log.Error(err, "[NodeStageVolume] Error opening encrypted volume")
+		return "", status.Errorf(codes.Internal, "[NodeStageVolume] Error opening encrypted volume %q (%q): %v", volumeID, devPath, err)
+	}
+
+	return luksPath, nil
+}
+
+// volumeFsType returns the filesystem type of the volume: the requested one, the one stored in the volume context
+// at the volume creation or the default one.
+func volumeFsType(mountVolume *csi.VolumeCapability_MountVolume, volumeCtx map[string]string) string {
+	if fsType := mountVolume.GetFsType(); fsType != "" {
+		return fsType
+	}
+
+	if fsType := volumeCtx[internal.FSTypeContextKey]; fsType != "" {
+		return fsType
+	}
+
+	return defaultFsType
+}
+
+// volumeMountFlags returns the requested mount flags together with the ones stored in the volume context
+// at the volume creation.
+func volumeMountFlags(mountVolume *csi.VolumeCapability_MountVolume, volumeCtx map[string]string) ([]string, error) {
+	storedFlags, err := utils.GetMountFlagsFromContext(volumeCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	mountFlags := slices.Clone(mountVolume.GetMountFlags())
+	for _, flag := range storedFlags {
+		if !slices.Contains(mountFlags, flag) {
+			mountFlags = append(mountFlags, flag)
+		}
+	}
+
+	return mountFlags, nil
+}
+
 // collectMountOptions returns array of mount options from
-// VolumeCapability_MountVolume and special mount options for
-// given filesystem.
-func collectMountOptions(fsType string, mountFlags, mountOptions []string) []string {
+// VolumeCapability_MountVolume. Only the per-mount options
+// are added to the bind mount options. The nouuid option of
+// the XFS with a duplicate UUID is added by handleDuplicateXFSUUID.
+func collectMountOptions(mountFlags, mountOptions []string) []string {
+	bindMount := slices.Contains(mountOptions, "bind")
 	for _, opt := range mountFlags {
-		if !slices.Contains(mountOptions, opt) {
-			mountOptions = append(mountOptions, opt)
+		if _, ok := bindMountOptions[opt]; bindMount && !ok {
+			continue
 		}
-	}
 
-	// By default, xfs does not allow mounting of two volumes with the same filesystem uuid.
-	// Force ignore this uuid to be able to mount volume + its clone / restored snapshot on the same node.
-	if fsType == internal.FSTypeXfs {
-		if !slices.Contains(mountOptions, "nouuid") {
-			mountOptions = append(mountOptions, "nouuid")
+		if !slices.Contains(mountOptions, opt) {
+			mountOptions = append(mountOptions, opt)
 		}
 	}
 
@@ -443,3 +1016,176 @@ func needLegacyXFSSupport() (bool, error) {
 
 	return major < 5 || major == 5 && minor <= 15, nil
 }
+
+// handleDuplicateXFSUUID checks the XFS filesystem of the device has a UUID of its own and, if not, either mounts it
+// with the nouuid option or generates a new UUID according to the volume's policy. The returned error is a gRPC status
+// error.
+func (d *Driver) handleDuplicateXFSUUID(devPath string, mountOptions []string, volumeContext map[string]string) ([]string, error) {
+	policy, err := utils.GetXFSDuplicateUUIDPolicy(volumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[NodeStageVolume] %s", err.Error())
+	}
+
+	duplicate, err := d.storeManager.HasDuplicateXFSUUID(devPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error checking the filesystem UUID of device %q: %v", devPath, err)
+	}
+	if !duplicate {
+		return mountOptions, nil
+	}
+
+	if policy == internal.XFSDuplicateUUIDRegenerate {
+		d.log.Info(fmt.Sprintf("[NodeStageVolume] The filesystem of device %s has the UUID of a mounted one, generating a new UUID", devPath))
+		err = d.storeManager.RegenerateXFSUUID(devPath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[NodeStageVolume] Error generating a new filesystem UUID of device %q: %v", devPath, err)
+		}
+		return mountOptions, nil
+	}
+
+	d.log.Info(fmt.Sprintf("[NodeStageVolume] The filesystem of device %s has the UUID of a mounted one, mounting it with nouuid", devPath))
+	if !slices.Contains(mountOptions, "nouuid") {
+		mountOptions = append(mountOptions, "nouuid")
+	}
+	return mountOptions, nil
+}
+
+// getVolumeAttributes returns the attributes of the volume applied on its staging and publication. The volume context
+// is overridden by the LVMLogicalVolume annotations, so the changes made with a VolumeAttributesClass are applied
+// on the next staging or publication, and the volume context is used alone if the LVMLogicalVolume can not be got.
+func (d *Driver) getVolumeAttributes(ctx context.Context, volumeID string, volumeContext map[string]string) map[string]string {
+	llv, err := utils.GetLVMLogicalVolume(ctx, d.cl, utils.LLVNameForVolume(volumeID), "")
+	if err != nil {
+		d.log.Warning(fmt.Sprintf("[getVolumeAttributes] unable to get the LVMLogicalVolume of the volume %s, the volume context is used: %s", volumeID, err.Error()))
+		return volumeContext
+	}
+
+	attributes := make(map[string]string, len(volumeContext)+len(llv.Annotations))
+	maps.Copy(attributes, volumeContext)
+	maps.Copy(attributes, llv.Annotations)
+
+	return attributes
+}
+
+// tuneBlockDevice applies the tuning of the request queue to the device of the volume. The device-mapper device gets
+// the kernel defaults whenever the LV is activated again, e.g. after the node reboot, so the tuning is applied on every
+// staging and publication. The volume stays staged and published even if the kernel rejects the tuning,
+// which is reported by a node event.
+func (d *Driver) tuneBlockDevice(ctx context.Context, volumeID, devPath string, attributes map[string]string) {
+	tuning, err := utils.GetBlockTuning(attributes)
+	if err == nil && tuning.IsEmpty() {
+		return
+	}
+	if err == nil {
+		err = d.storeManager.TuneBlockDevice(devPath, tuning)
+	}
+	if err != nil {
+		message := fmt.Sprintf("The tuning of the device %s of the volume %s has failed: %s", devPath, volumeID, err.Error())
+		d.log.Warning(fmt.Sprintf("[tuneBlockDevice] %s", message))
+		d.recordNodeEvent(ctx, v1.EventTypeWarning, blockTuningFailedReason, message)
+	}
+}
+
+// limitVolumeIO limits the IO of the Pod the volume is published for to the volume's device. The volume stays published
+// even if the limits can not be set, e.g. the node has no cgroup v2, which is reported by a node event.
+func (d *Driver) limitVolumeIO(ctx context.Context, volumeID, devPath, podUID string, attributes map[string]string) {
+	limits, err := utils.GetIOLimits(attributes)
+	if err == nil && limits.IsEmpty() {
+		return
+	}
+	if err == nil && podUID == "" {
+		err = fmt.Errorf("kubelet has passed no Pod UID")
+	}
+	if err == nil {
+		err = d.storeManager.SetPodIOLimits(d.cgroupRoot, podUID, devPath, limits)
+	}
+	if err != nil {
+		message := fmt.Sprintf("The IO limits of the volume %s (%s) have not been set: %s", volumeID, devPath, err.Error())
+		d.log.Warning(fmt.Sprintf("[NodePublishVolume] %s", message))
+		d.recordNodeEvent(ctx, v1.EventTypeWarning, ioLimitsFailedReason, message)
+	}
+}
+
+// getNodeVolumeCondition reports the volume as abnormal if its mount is broken on the node, otherwise by the state of its
+// LVMLogicalVolume, LVMVolumeGroup and thin pool like the controller does. The LVMLogicalVolume is taken from the
+// informer cache, as the stats of every volume are requested by kubelet periodically.
+func (d *Driver) getNodeVolumeCondition(ctx context.Context, volumeID, volumePath string) *csi.VolumeCondition {
+	problem, err := d.storeManager.CheckMountHealth(volumePath)
+	if err != nil {
+		d.log.Warning(fmt.Sprintf("[NodeGetVolumeStats] unable to check the mount of the volume %s at %s: %s", volumeID, volumePath, err.Error()))
+	}
+	if problem != "" {
+		d.log.Warning(fmt.Sprintf("[NodeGetVolumeStats] the volume %s at %s is abnormal: %s", volumeID, volumePath, problem))
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  problem,
+		}
+	}
+
+	llv := &v1alpha1.LVMLogicalVolume{}
+	err = d.cache.Get(ctx, client.ObjectKey{Name: utils.LLVNameForVolume(volumeID)}, llv)
+	if err != nil {
+		d.log.Debug(fmt.Sprintf("[NodeGetVolumeStats] unable to get the LVMLogicalVolume of the volume %s, its condition is not checked: %s", volumeID, err.Error()))
+		return &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  "volume is healthy",
+		}
+	}
+
+	lvg, err := utils.GetLVMVolumeGroup(ctx, d.cl, llv.Spec.LVMVolumeGroupName)
+	if err != nil {
+		if !kerrors.IsNotFound(err) {
+			d.log.Debug(fmt.Sprintf("[NodeGetVolumeStats] unable to get the LVMVolumeGroup of the volume %s, its condition is not checked: %s", volumeID, err.Error()))
+			return &csi.VolumeCondition{
+				Abnormal: false,
+				Message:  "volume is healthy",
+			}
+		}
+		lvg = nil
+	}
+
+	return getVolumeCondition(llv, lvg)
+}
+
+// resizeStagedVolume grows the filesystem of the staged volume to the size of its device, e.g. if the volume has been
+// expanded while it was not staged. The returned error is a gRPC status error.
+func (d *Driver) resizeStagedVolume(volumeID, devPath, target string) error {
+	needResize, err := d.storeManager.NeedResize(devPath, target)
+	if err != nil {
+		d.log.Error(err, "[NodeStageVolume] Error checking if volume needs resize")
+		return status.Errorf(codes.Internal, "[NodeStageVolume] Error checking if the volume %q (%q) mounted at %q needs resizing: %v", volumeID, devPath, target, err)
+	}
+
+	if needResize {
+		d.log.Info(fmt.Sprintf("[NodeStageVolume] Resizing volume %q (%q) mounted at %q", volumeID, devPath, target))
+		err = d.storeManager.ResizeFS(target)
+		if err != nil {
+			return status.Errorf(codes.Internal, "[NodeStageVolume] Error resizing volume %q (%q) mounted at %q: %v", volumeID, devPath, target, err)
+		}
+	}
+
+	return nil
+}
+
+// acquireFormatSlot waits for a free slot of the concurrent mkfs and fsck runs on the node until the call deadline.
+// The staging over the limit fails with ResourceExhausted, so kubelet retries it later. The returned function frees
+// the slot.
+func (d *Driver) acquireFormatSlot(ctx context.Context, volumeID string) (func(), error) {
+	if d.formatsLimit == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case d.formatsLimit <- struct{}{}:
+		return func() { <-d.formatsLimit }, nil
+	default:
+	}
+
+	d.log.Info(fmt.Sprintf("[NodeStageVolume] Volume %s waits for %d running filesystem creations or checks to finish", volumeID, cap(d.formatsLimit)))
+	select {
+	case d.formatsLimit <- struct{}{}:
+		return func() { <-d.formatsLimit }, nil
+	case <-ctx.Done():
+		return nil, status.Errorf(codes.ResourceExhausted, "[NodeStageVolume] Volume %s: too many concurrent filesystem creations or checks on the node: %s", volumeID, ctx.Err().Error())
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+)
+
+// nodeOperations are the node calls observed as the mount operations by their CSI methods.
+var nodeOperations = map[string]string{
+	"/csi.v1.Node/NodeStageVolume":     "stage",
+	"/csi.v1.Node/NodeUnstageVolume":   "unstage",
+	"/csi.v1.Node/NodePublishVolume":   "publish",
+	"/csi.v1.Node/NodeUnpublishVolume": "unpublish",
+}
+
+// nodeMetrics are the metrics of the mount and format operations of the node plugin.
+type nodeMetrics struct {
+	operationDuration *prometheus.HistogramVec
+	operationFailures *prometheus.CounterVec
+	mkfsDuration      *prometheus.HistogramVec
+
+	orphanedMountCleanups *prometheus.CounterVec
+}
+
+// newNodeMetrics registers the node metrics in the registry of the CSI call metrics, so they are served by the same
+// endpoint. The number of the staged volumes is read from the node's mounts on every scrape.
+func newNodeMetrics(registry *prometheus.Registry, stagedVolumes func() float64) *nodeMetrics {
+	m := &nodeMetrics{
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "sds_local_volume_csi",
+			Subsystem: "node",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the stage, unstage, publish and unpublish operations of the volumes.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120, 300},
+		}, []string{"operation"}),
+		operationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "sds_local_volume_csi",
+			Subsystem: "node",
+			Name:      "operation_failures_total",
+			Help:      "Total number of the failed stage, unstage, publish and unpublish operations by the gRPC status code.",
+		}, []string{"operation", "code"}),
+		mkfsDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "sds_local_volume_csi",
+			Subsystem: "node",
+			Name:      "mkfs_duration_seconds",
+			Help:      "Duration of the filesystem creation on the staged volumes, including their first mount.",
+			Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600},
+		}, []string{"fs_type"}),
+		orphanedMountCleanups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "sds_local_volume_csi",
+			Subsystem: "node",
+			Name:      "orphaned_mount_cleanups_total",
+			Help:      "Total number of the cleanups of the staging mounts left on the node for the deleted volumes by their result: cleaned or failed.",
+		}, []string{"result"}),
+	}
+	registry.MustRegister(m.operationDuration, m.operationFailures, m.mkfsDuration, m.orphanedMountCleanups, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "sds_local_volume_csi",
+		Subsystem: "node",
+		Name:      "staged_volumes",
+		Help:      "Number of the volumes currently staged on the node.",
+	}, stagedVolumes))
+
+	return m
+}
+
+// observeOperation observes the duration of the node call and counts its failure, other calls are skipped.
+func (m *nodeMetrics) observeOperation(method string, duration time.Duration, err error) {
+	operation, ok := nodeOperations[method]
+	if !ok {
+		return
+	}
+
+	m.operationDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		m.operationFailures.WithLabelValues(operation, status.Code(err).String()).Inc()
+	}
+}
+
+// countStagedVolumes returns the number of the volumes of the driver staged on the node for the staged volumes gauge.
+func (d *Driver) countStagedVolumes() float64 {
+	count, err := d.storeManager.GetStagedVolumeCount(d.name)
+	if err != nil {
+		d.log.Warning(fmt.Sprintf("[countStagedVolumes] unable to count the staged volumes: %s", err.Error()))
+		return math.NaN()
+	}
+
+	return float64(count)
+}
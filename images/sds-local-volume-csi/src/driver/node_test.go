@@ -0,0 +1,111 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// xfsUUIDStore is the store manager reporting whether the filesystem UUID is duplicate and recording its regeneration.
+type xfsUUIDStore struct {
+	utils.NodeStoreManager
+	duplicate   bool
+	regenerated []string
+}
+
+func (s *xfsUUIDStore) HasDuplicateXFSUUID(string) (bool, error) {
+	return s.duplicate, nil
+}
+
+func (s *xfsUUIDStore) RegenerateXFSUUID(devicePath string) error {
+	s.regenerated = append(s.regenerated, devicePath)
+	return nil
+}
+
+func TestCollectMountOptions(t *testing.T) {
+	assert.Equal(t, []string{"noatime"}, collectMountOptions([]string{"noatime", "noatime"}, []string{}))
+	assert.Equal(t, []string{"bind", "ro", "noatime"}, collectMountOptions([]string{"noatime", "nouuid"}, []string{"bind", "ro"}))
+}
+
+func TestHandleDuplicateXFSUUID(t *testing.T) {
+	const devPath = "/dev/vg-1/pvc-1"
+
+	for _, tc := range []struct {
+		name          string
+		volumeContext map[string]string
+		duplicate     bool
+		mountOptions  []string
+		regenerated   []string
+		code          codes.Code
+	}{
+		{
+			name:         "unique UUID is mounted as is",
+			mountOptions: []string{"noatime"},
+		},
+		{
+			name:          "unique UUID is not regenerated",
+			volumeContext: map[string]string{internal.XFSDuplicateUUIDKey: internal.XFSDuplicateUUIDRegenerate},
+			mountOptions:  []string{"noatime"},
+		},
+		{
+			name:         "duplicate UUID is mounted with nouuid by default",
+			duplicate:    true,
+			mountOptions: []string{"noatime", "nouuid"},
+		},
+		{
+			name:          "duplicate UUID is mounted with nouuid",
+			volumeContext: map[string]string{internal.XFSDuplicateUUIDKey: internal.XFSDuplicateUUIDNouuid},
+			duplicate:     true,
+			mountOptions:  []string{"noatime", "nouuid"},
+		},
+		{
+			name:          "duplicate UUID is regenerated",
+			volumeContext: map[string]string{internal.XFSDuplicateUUIDKey: internal.XFSDuplicateUUIDRegenerate},
+			duplicate:     true,
+			mountOptions:  []string{"noatime"},
+			regenerated:   []string{devPath},
+		},
+		{
+			name:          "unknown policy",
+			volumeContext: map[string]string{internal.XFSDuplicateUUIDKey: "ignore"},
+			code:          codes.InvalidArgument,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &xfsUUIDStore{duplicate: tc.duplicate}
+			d := newTestDriver(t)
+			d.storeManager = store
+
+			mountOptions, err := d.handleDuplicateXFSUUID(devPath, []string{"noatime"}, tc.volumeContext)
+			if tc.code != codes.OK {
+				assert.Equal(t, tc.code, status.Code(err))
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.mountOptions, mountOptions)
+				assert.Equal(t, tc.regenerated, store.regenerated)
+			}
+		})
+	}
+}
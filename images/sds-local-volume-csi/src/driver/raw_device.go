@@ -0,0 +1,213 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// createRawDeviceVolume provisions the volume on a whole BlockDevice selected by the storage class's parameters on
+// a node allowed by the topology requirements. Nothing is created for the volume: the device is taken by its PV, and
+// the volumes being provisioned keep their devices in memory until their PVs are created. The volume gets the size
+// of the device. The returned error is a gRPC status error.
+func (d *Driver) createRawDeviceVolume(ctx context.Context, traceID string, request *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	volumeID := request.Name
+
+	if request.VolumeContentSource != nil {
+		return nil, status.Error(codes.InvalidArgument, "raw device volumes can not be created from a volume content source")
+	}
+
+	filter, err := utils.ParseRawDeviceFilter(request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid raw device storage class parameters", traceID, volumeID))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameters: %s", err.Error())
+	}
+
+	quota, err := utils.ParseQuota(request.Parameters)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] invalid storage class parameter %s", traceID, volumeID, internal.QuotaMaxTotalSizeKey))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid storage class parameter %s: %s", internal.QuotaMaxTotalSizeKey, err.Error())
+	}
+
+	requiredBytes := request.CapacityRange.GetRequiredBytes()
+	limitBytes := request.CapacityRange.GetLimitBytes()
+	if limitBytes > 0 && requiredBytes > limitBytes {
+		return nil, status.Errorf(codes.InvalidArgument, "required bytes %d are greater than limit bytes %d", requiredBytes, limitBytes)
+	}
+	if minSize := utils.GetMinFSSize(request.VolumeCapabilities); requiredBytes < minSize {
+		requiredBytes = minSize
+	}
+
+	// the topologies with the extra keys only (e.g. the zone one) are resolved to the nodes by their labels
+	topologyNodes, err := d.listTopologyNodes(ctx, slices.Concat(request.GetAccessibilityRequirements().GetRequisite(), request.GetAccessibilityRequirements().GetPreferred())...)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error listTopologyNodes", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "unable to list the nodes: %s", err.Error())
+	}
+	nodes := utils.GetTopologyNodes(request.AccessibilityRequirements, topologyNodes)
+	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] selecting a raw device of at least %d bytes, candidate nodes in the order of preference: %v", traceID, volumeID, requiredBytes, nodes))
+
+	d.rawDeviceMu.Lock()
+	defer d.rawDeviceMu.Unlock()
+
+	devices := &v1alpha1.BlockDeviceList{}
+	err = d.cl.List(ctx, devices)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error listing BlockDevices", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error listing BlockDevices: %s", err.Error())
+	}
+
+	claimed, err := utils.GetClaimedRawDevices(ctx, d.cl, d.name)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetClaimedRawDevices", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "error getting the taken raw devices: %s", err.Error())
+	}
+	// the retried request selects its device again, the devices of the other volumes being provisioned are skipped
+	d.rawDeviceClaims.Range(func(key, value any) bool {
+		if key.(string) != volumeID {
+			claimed[value.(string)] = struct{}{}
+		}
+		return true
+	})
+
+	device := utils.SelectRawDevice(devices.Items, filter, requiredBytes, limitBytes, nodes, claimed)
+	if device == nil {
+		d.log.Warning(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] no consumable BlockDevice of the storage class fits the volume of %d bytes", traceID, volumeID, requiredBytes))
+		return nil, status.Errorf(codes.ResourceExhausted, "no consumable BlockDevice of the storage class fits the volume of %d bytes on the nodes %v", requiredBytes, nodes)
+	}
+	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] selected the BlockDevice %s (%s, %s) on the node %s", traceID, volumeID, device.Name, device.Status.Path, device.Status.Size.String(), device.Status.NodeName))
+
+	segments, err := utils.GetNodeTopologySegments(ctx, d.cl, device.Status.NodeName, d.topologyKeys)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetNodeTopologySegments", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "unable to get the topology of the node %s: %s", device.Status.NodeName, err.Error())
+	}
+
+	volumeCtx := make(map[string]string, len(request.Parameters))
+	for k, v := range request.Parameters {
+		volumeCtx[k] = v
+	}
+	volumeCtx[internal.TraceIDKey] = traceID
+	volumeCtx[internal.RawDeviceNameKey] = device.Name
+	volumeCtx[internal.RawDevicePathKey] = device.Status.Path
+
+	mountCtx, err := utils.GetMountVolumeContext(request.VolumeCapabilities)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] error GetMountVolumeContext", traceID, volumeID))
+		return nil, status.Errorf(codes.Internal, "unable to store the mount options in the volume context: %s", err.Error())
+	}
+	for k, v := range mountCtx {
+		volumeCtx[k] = v
+	}
+
+	// the reservation is the last step, so it is kept for the volume until its PV is counted or it is deleted
+	if quota > 0 {
+		_, err = d.checkStorageClassQuota(ctx, traceID, request, quota, device.Status.Size)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.rawDeviceClaims.Store(volumeID, device.Name)
+	d.log.Info(fmt.Sprintf("[CreateVolume][traceID:%s][volumeID:%s] Volume created successfully. volumeCtx: %+v", traceID, volumeID, volumeCtx))
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			CapacityBytes: device.Status.Size.Value(),
+			VolumeId:      volumeID,
+			VolumeContext: volumeCtx,
+			AccessibleTopology: []*csi.Topology{
+				{Segments: segments},
+			},
+		},
+	}, nil
+}
+
+// checkRawDeviceVolumeExists returns the NotFound status error if the raw device volume has neither the PV nor
+// the device taken by its provisioning.
+func (d *Driver) checkRawDeviceVolumeExists(ctx context.Context, traceID, method, volumeID string) error {
+	if _, provisioning := d.rawDeviceClaims.Load(volumeID); provisioning {
+		return nil
+	}
+
+	pv, err := utils.GetRawDevicePV(ctx, d.cl, d.name, volumeID)
+	if err != nil {
+		d.log.Error(err, fmt.Sprintf("[%s][traceID:%s][volumeID:%s] error GetRawDevicePV", method, traceID, volumeID))
+		return status.Errorf(codes.Internal, "error getting the PersistentVolume of the raw device volume %s: %s", volumeID, err.Error())
+	}
+	if pv == nil {
+		return status.Errorf(codes.NotFound, "raw device volume %s not found", volumeID)
+	}
+
+	return nil
+}
+
+// getRawDeviceVolume returns the volume and the status of the raw device PV, which is abnormal if the BlockDevice of
+// the volume is gone. The returned error is a gRPC status error.
+func (d *Driver) getRawDeviceVolume(ctx context.Context, traceID string, pv *corev1.PersistentVolume) (*csi.ControllerGetVolumeResponse, error) {
+	volumeID := pv.Spec.CSI.VolumeHandle
+	deviceName := pv.Spec.CSI.VolumeAttributes[internal.RawDeviceNameKey]
+
+	device := &v1alpha1.BlockDevice{}
+	err := d.cl.Get(ctx, client.ObjectKey{Name: deviceName}, device)
+	if err != nil && !kerrors.IsNotFound(err) {
+		d.log.Error(err, fmt.Sprintf("[ControllerGetVolume][traceID:%s][volumeID:%s] error getting BlockDevice %s", traceID, volumeID, deviceName))
+		return nil, status.Errorf(codes.Internal, "error getting BlockDevice %s: %s", deviceName, err.Error())
+	}
+
+	volumeStatus := &csi.ControllerGetVolumeResponse_VolumeStatus{
+		VolumeCondition: &csi.VolumeCondition{Abnormal: false, Message: "volume is healthy"},
+	}
+	var nodeName string
+	if kerrors.IsNotFound(err) {
+		volumeStatus.VolumeCondition = &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("BlockDevice %s not found", deviceName),
+		}
+	} else {
+		nodeName = device.Status.NodeName
+		volumeStatus.PublishedNodeIds = []string{nodeName}
+	}
+	d.log.Info(fmt.Sprintf("[ControllerGetVolume][traceID:%s][volumeID:%s] raw device volume condition: abnormal=%t, message: %s", traceID, volumeID, volumeStatus.VolumeCondition.Abnormal, volumeStatus.VolumeCondition.Message))
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: rawDevicePVToCSIVolume(pv, d.nodeTopology(ctx, traceID, "ControllerGetVolume", nodeName, nil)),
+		Status: volumeStatus,
+	}, nil
+}
+
+// rawDevicePVToCSIVolume returns the CSI volume of the raw device PV with the topology of the node of its BlockDevice.
+func rawDevicePVToCSIVolume(pv *corev1.PersistentVolume, topology []*csi.Topology) *csi.Volume {
+	return &csi.Volume{
+		VolumeId:           pv.Spec.CSI.VolumeHandle,
+		CapacityBytes:      pv.Spec.Capacity.Storage().Value(),
+		AccessibleTopology: topology,
+	}
+}
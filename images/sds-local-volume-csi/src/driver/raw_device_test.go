@@ -0,0 +1,202 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+func newRawDevicePV(volumeID, deviceName string) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: volumeID},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       DefaultDriverName,
+					VolumeHandle: volumeID,
+					VolumeAttributes: map[string]string{
+						internal.TypeKey:          internal.RawType,
+						internal.RawDeviceNameKey: deviceName,
+						internal.RawDevicePathKey: "/dev/" + deviceName,
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRawDeviceVolumes(t *testing.T) {
+	device := &snc.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev-1"},
+		Status:     snc.BlockDeviceStatus{NodeName: testNodeName, Path: "/dev/dev-1"},
+	}
+	lvg := &snc.LVMVolumeGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "vg-1"},
+		Spec:       snc.LVMVolumeGroupSpec{Local: snc.LVMVolumeGroupLocalSpec{NodeName: testNodeName}},
+		Status:     snc.LVMVolumeGroupStatus{Phase: utils.LVGStatusReady},
+	}
+	llv := &snc.LVMLogicalVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-lv", Finalizers: []string{utils.SDSLocalVolumeCSIFinalizer}},
+		Spec:       snc.LVMLogicalVolumeSpec{Type: internal.LVMTypeThick, Size: "1Gi", LVMVolumeGroupName: lvg.Name},
+	}
+	d := newTestDriver(t, device, lvg, llv, newRawDevicePV("pvc-raw-1", "dev-1"), newRawDevicePV("pvc-raw-2", "dev-gone"))
+	d.rawDeviceClaims.Store("pvc-raw-provisioning", "dev-2")
+
+	blockCapability := []*csi.VolumeCapability{{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}}
+	rawContext := map[string]string{internal.TypeKey: internal.RawType}
+
+	for _, tc := range []struct {
+		name       string
+		volumeID   string
+		parameters map[string]string
+		code       codes.Code
+		confirmed  bool
+	}{
+		{name: "existing volume", volumeID: "pvc-raw-1", confirmed: true},
+		{name: "volume being provisioned", volumeID: "pvc-raw-provisioning", confirmed: true},
+		{name: "type mismatch", volumeID: "pvc-raw-1", parameters: map[string]string{internal.TypeKey: internal.Lvm}},
+		{name: "missing volume", volumeID: "pvc-raw-missing", code: codes.NotFound},
+	} {
+		t.Run("ValidateVolumeCapabilities "+tc.name, func(t *testing.T) {
+			resp, err := d.ValidateVolumeCapabilities(context.Background(), &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           tc.volumeID,
+				VolumeContext:      rawContext,
+				VolumeCapabilities: blockCapability,
+				Parameters:         tc.parameters,
+			})
+			assert.Equal(t, tc.code, status.Code(err))
+			if err == nil {
+				assert.Equal(t, tc.confirmed, resp.Confirmed != nil, resp.Message)
+			}
+		})
+	}
+
+	t.Run("ControllerGetVolume", func(t *testing.T) {
+		resp, err := d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: "pvc-raw-1"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "pvc-raw-1", resp.Volume.VolumeId)
+			assert.Equal(t, int64(10<<30), resp.Volume.CapacityBytes)
+			assert.Equal(t, []string{testNodeName}, resp.Status.PublishedNodeIds)
+			assert.False(t, resp.Status.VolumeCondition.Abnormal)
+		}
+
+		resp, err = d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: "pvc-raw-2"})
+		if assert.NoError(t, err) {
+			assert.True(t, resp.Status.VolumeCondition.Abnormal)
+			assert.Contains(t, resp.Status.VolumeCondition.Message, "BlockDevice dev-gone not found")
+		}
+
+		_, err = d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: "pvc-raw-missing"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("ListVolumes", func(t *testing.T) {
+		var ids []string
+		token := ""
+		for {
+			resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{MaxEntries: 2, StartingToken: token})
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, entry := range resp.Entries {
+				ids = append(ids, entry.Volume.VolumeId)
+				if entry.Volume.VolumeId == "pvc-raw-1" {
+					assert.Equal(t, []string{testNodeName}, entry.Status.PublishedNodeIds)
+				}
+			}
+			if token = resp.NextToken; token == "" {
+				break
+			}
+		}
+		assert.Equal(t, []string{"pvc-lv", "pvc-raw-1", "pvc-raw-2"}, ids)
+	})
+}
+
+func TestVolumeTopology(t *testing.T) {
+	const zoneKey = "topology.kubernetes.io/zone"
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Labels: map[string]string{zoneKey: "zone-a"}}}
+	device := &snc.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev-1"},
+		Status:     snc.BlockDeviceStatus{NodeName: testNodeName, Path: "/dev/dev-1"},
+	}
+	lvgs := []*snc.LVMVolumeGroup{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "vg-1"},
+			Spec:       snc.LVMVolumeGroupSpec{Local: snc.LVMVolumeGroupLocalSpec{NodeName: testNodeName}},
+			Status:     snc.LVMVolumeGroupStatus{Phase: utils.LVGStatusReady},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "vg-2"},
+			Spec:       snc.LVMVolumeGroupSpec{Local: snc.LVMVolumeGroupLocalSpec{NodeName: "node-gone"}},
+			Status:     snc.LVMVolumeGroupStatus{Phase: utils.LVGStatusReady},
+		},
+	}
+	llvs := []*snc.LVMLogicalVolume{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-lv-1", Finalizers: []string{utils.SDSLocalVolumeCSIFinalizer}},
+			Spec:       snc.LVMLogicalVolumeSpec{Type: internal.LVMTypeThick, Size: "1Gi", LVMVolumeGroupName: "vg-1"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-lv-2", Finalizers: []string{utils.SDSLocalVolumeCSIFinalizer}},
+			Spec:       snc.LVMLogicalVolumeSpec{Type: internal.LVMTypeThick, Size: "1Gi", LVMVolumeGroupName: "vg-2"},
+		},
+	}
+	d := newTestDriver(t, node, device, lvgs[0], lvgs[1], llvs[0], llvs[1], newRawDevicePV("pvc-raw", "dev-1"))
+	d.topologyKeys = []string{zoneKey}
+
+	expected := map[string][]*csi.Topology{
+		"pvc-lv-1": {{Segments: map[string]string{internal.TopologyKey: testNodeName, zoneKey: "zone-a"}}},
+		"pvc-lv-2": {{Segments: map[string]string{internal.TopologyKey: "node-gone"}}},
+		"pvc-raw":  {{Segments: map[string]string{internal.TopologyKey: testNodeName, zoneKey: "zone-a"}}},
+	}
+
+	t.Run("ListVolumes", func(t *testing.T) {
+		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+		if assert.NoError(t, err) && assert.Len(t, resp.Entries, len(expected)) {
+			for _, entry := range resp.Entries {
+				assert.Equal(t, expected[entry.Volume.VolumeId], entry.Volume.AccessibleTopology, entry.Volume.VolumeId)
+			}
+		}
+	})
+
+	t.Run("ControllerGetVolume", func(t *testing.T) {
+		for volumeID, topology := range expected {
+			resp, err := d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: volumeID})
+			if assert.NoError(t, err, volumeID) {
+				assert.Equal(t, topology, resp.Volume.AccessibleTopology, volumeID)
+			}
+		}
+	})
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	corev1 "k8s.io/api/core/v1"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/utils"
+)
+
+// recoverStagedVolumes brings the volumes kubelet considers staged on the node back after the node reboot or
+// the plugin restart: the LVs left inactive are activated, the missing staging mounts are mounted again, and the tuning
+// of the devices is restored.
+// Otherwise kubelet, which does not stage the volume it has staged once, publishes the volume with a missing device
+// or an empty staging directory. The recovery is done before the plugin socket appears, so kubelet does not call
+// the plugin until it is over, and it is bounded by the recovery timeout, so the plugin starts anyway.
+func (d *Driver) recoverStagedVolumes(ctx context.Context) {
+	volumes, err := d.storeManager.GetStagedVolumes(d.name)
+	if err != nil {
+		d.log.Error(err, "[recoverStagedVolumes] unable to get the staged volumes of the node")
+		return
+	}
+	if len(volumes) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, internal.StagedVolumesRecoveryTimeout)
+	defer cancel()
+
+	pvs := &corev1.PersistentVolumeList{}
+	err = d.cl.List(ctx, pvs)
+	if err != nil {
+		d.log.Error(err, "[recoverStagedVolumes] unable to list the PersistentVolumes")
+		return
+	}
+	pvByVolumeID := make(map[string]*corev1.PersistentVolume, len(pvs.Items))
+	for i := range pvs.Items {
+		if pvs.Items[i].Spec.CSI != nil && pvs.Items[i].Spec.CSI.Driver == d.name {
+			pvByVolumeID[pvs.Items[i].Spec.CSI.VolumeHandle] = &pvs.Items[i]
+		}
+	}
+
+	d.log.Info(fmt.Sprintf("[recoverStagedVolumes] recovering %d staged volumes of the node", len(volumes)))
+	for _, volume := range volumes {
+		if ctx.Err() != nil {
+			d.log.Warning("[recoverStagedVolumes] the recovery of the staged volumes has timed out")
+			return
+		}
+
+		// the volume of the deleted PersistentVolume is left to kubelet to unstage
+		pv, ok := pvByVolumeID[volume.VolumeID]
+		if !ok {
+			d.log.Debug(fmt.Sprintf("[recoverStagedVolumes] no PersistentVolume found for the volume %s, skipping", volume.VolumeID))
+			continue
+		}
+
+		err = d.recoverStagedVolume(ctx, volume, pv)
+		if err != nil {
+			d.log.Error(err, fmt.Sprintf("[recoverStagedVolumes] unable to recover the volume %s", volume.VolumeID))
+		}
+	}
+}
+
+// recoverStagedVolume activates the LV of the staged volume if its device is missing and stages the filesystem volume
+// again if it is not mounted at its staging path. The staging is the same as the one kubelet requests, so the volume
+// is checked by the same policies, and the encrypted volume is opened with the staging secret of the PersistentVolume.
+func (d *Driver) recoverStagedVolume(ctx context.Context, volume utils.StagedVolume, pv *corev1.PersistentVolume) error {
+	volumeContext := pv.Spec.CSI.VolumeAttributes
+	devPath, err := utils.GetVolumeDevicePath(volume.VolumeID, volumeContext)
+	if err != nil {
+		return err
+	}
+
+	exists, err := d.storeManager.PathExists(devPath)
+	if err != nil {
+		return fmt.Errorf("unable to check if the device %s exists: %w", devPath, err)
+	}
+	if !exists {
+		if utils.IsRawDeviceVolume(volumeContext) {
+			return fmt.Errorf("the raw device %s of the volume is missing", devPath)
+		}
+
+		vgName, lvName, ok := utils.ParseLVMDevicePath(devPath)
+		if !ok {
+			return fmt.Errorf("unable to parse the device path %s", devPath)
+		}
+
+		err = d.storeManager.ActivateLV(vgName, lvName)
+		if err != nil {
+			return err
+		}
+	}
+
+	stagedDevPath := devPath
+	if utils.IsEncrypted(volumeContext) {
+		stagedDevPath = utils.LUKSDevicePath(volume.VolumeID)
+	}
+
+	if volume.Block {
+		// the reactivated device has the kernel defaults, while the volume might still be published
+		d.retuneBlockDevice(ctx, volume.VolumeID, stagedDevPath, volumeContext)
+		return nil
+	}
+	staged, err := d.storeManager.IsMountedAt(stagedDevPath, volume.StagingTargetPath)
+	if err != nil {
+		return fmt.Errorf("unable to check if the volume is staged at %s: %w", volume.StagingTargetPath, err)
+	}
+	if staged {
+		d.retuneBlockDevice(ctx, volume.VolumeID, stagedDevPath, volumeContext)
+		return nil
+	}
+
+	var secrets map[string]string
+	if ref := pv.Spec.CSI.NodeStageSecretRef; ref != nil {
+		secrets, err = d.getSecretData(ctx, ref.Namespace+"/"+ref.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	d.log.Info(fmt.Sprintf("[recoverStagedVolume] staging the volume %s at %s again", volume.VolumeID, volume.StagingTargetPath))
+	_, err = d.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          volume.VolumeID,
+		StagingTargetPath: volume.StagingTargetPath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{
+					FsType:     pv.Spec.CSI.FSType,
+					MountFlags: pv.Spec.MountOptions,
+				},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		},
+		Secrets:       secrets,
+		VolumeContext: volumeContext,
+	})
+	return err
+}
+
+// retuneBlockDevice applies the tuning of the volume to its device if the device exists. The published volumes are not
+// published again after the plugin restart, so the tuning of the reactivated devices is restored by the recovery.
+func (d *Driver) retuneBlockDevice(ctx context.Context, volumeID, devPath string, volumeContext map[string]string) {
+	exists, err := d.storeManager.PathExists(devPath)
+	if err != nil || !exists {
+		return
+	}
+
+	d.tuneBlockDevice(ctx, volumeID, devPath, d.getVolumeAttributes(ctx, volumeID, volumeContext))
+}
@@ -16,17 +16,24 @@ limitations under the License.
 
 package internal
 
+import "time"
+
 const (
 	TypeKey                     = "local.csi.storage.deckhouse.io/type"
 	Lvm                         = "lvm"
+	RawType                     = "raw"
 	LvmTypeKey                  = "local.csi.storage.deckhouse.io/lvm-type"
 	BindingModeKey              = "local.csi.storage.deckhouse.io/volume-binding-mode"
 	LVMVolumeGroupKey           = "local.csi.storage.deckhouse.io/lvm-volume-groups"
 	LVMVThickContiguousParamKey = "local.csi.storage.deckhouse.io/lvm-thick-contiguous"
 	ActualNameOnTheNodeKey      = "local.csi.storage.deckhouse.io/actualNameOnTheNode"
+	SnapshotSizePercentKey      = "local.csi.storage.deckhouse.io/snapshot-size-percent"
+	SnapshotThinPoolKey         = "local.csi.storage.deckhouse.io/snapshot-thin-pool"
+	SnapshotFSFreezeKey         = "local.csi.storage.deckhouse.io/snapshot-fsfreeze"
 	TopologyKey                 = "topology.sds-local-volume-csi/node"
 	SubPath                     = "subPath"
 	VGNameKey                   = "vgname"
+	LVNameKey                   = "lvname"
 	ThinPoolNameKey             = "thinPoolName"
 	LVMTypeThin                 = "Thin"
 	LVMTypeThick                = "Thick"
@@ -35,10 +42,198 @@ const (
 	BindingModeWFFC             = "WaitForFirstConsumer"
 	BindingModeI                = "Immediate"
 	ResizeDelta                 = "32Mi"
+	WaitActionTimeout           = 5 * time.Minute
+	DeviceWaitTimeout           = 30 * time.Second
+	DeviceWaitInitialBackoff    = 100 * time.Millisecond
+	DeviceWaitMaxBackoff        = 5 * time.Second
+	UnmountRetryInterval        = time.Second
+	FSFreezeWaitTimeout         = 30 * time.Second
+	ShutdownTimeout             = 20 * time.Second
+	RollbackTimeout             = 5 * time.Second
+	CreateVolumeMaxAttempts     = 3
+	NodeSelectionStrategyKey    = "local.csi.storage.deckhouse.io/node-selection-strategy"
+	LVGSelectionPolicyKey       = "local.csi.storage.deckhouse.io/lvg-selection-policy"
+	ThinOverprovisioningKey     = "local.csi.storage.deckhouse.io/lvm-thin-overprovisioning-factor"
+	MaxSizeKey                  = "local.csi.storage.deckhouse.io/max-size"
+	QuotaMaxTotalSizeKey        = "local.csi.storage.deckhouse.io/quota-max-total-size"
+	AllowedNamespacesKey        = "local.csi.storage.deckhouse.io/allowed-namespaces"
+	AllowedNSSelectorKey        = "local.csi.storage.deckhouse.io/allowed-namespaces-selector"
+	ThinPoolKey                 = "local.csi.storage.deckhouse.io/lvm-thin-pool"
+	MkfsOptionsKey              = "local.csi.storage.deckhouse.io/mkfs-options"
+	Ext4ReservedBlocksKey       = "local.csi.storage.deckhouse.io/ext4-reserved-blocks-percent"
+	Ext4LazyInitKey             = "local.csi.storage.deckhouse.io/ext4-lazy-init"
+	Ext4BigallocClusterSizeKey  = "local.csi.storage.deckhouse.io/ext4-bigalloc-cluster-size"
+	Ext4MinBigallocClusterSize  = "8Ki"
+	EncryptionKey               = "local.csi.storage.deckhouse.io/encryption"
+	EncryptionLUKS              = "luks"
+	LUKSPassphraseKey           = "passphrase"
+	LUKSNewPassphraseKey        = "newPassphrase"
+	LUKSMapperPrefix            = "luks-"
+	OnDeleteKey                 = "local.csi.storage.deckhouse.io/on-delete"
+	ResizeDeltaKey              = "local.csi.storage.deckhouse.io/resize-delta"
+	WaitTimeoutKey              = "local.csi.storage.deckhouse.io/wait-timeout"
+	AbortKey                    = "local.csi.storage.deckhouse.io/abort"
+	LVGNameKey                  = "lvmVolumeGroupName"
+	LVGSelectionReasonKey       = "lvmVolumeGroupSelectionReason"
+	// LVMExtentSize is the default LVM physical extent size. Every LV size is rounded up to it,
+	// so it is the smallest volume we are able to provision.
+	LVMExtentSize = "4Mi"
 
 	FSTypeKey = "csi.storage.k8s.io/fstype"
 
+	// the filesystem type and mount flags of the requested volume capability stored in the volume context
+	FSTypeContextKey     = "local.csi.storage.deckhouse.io/fstype"
+	MountFlagsContextKey = "local.csi.storage.deckhouse.io/mount-flags"
+
+	// parameters passed by the external-provisioner with the --extra-create-metadata flag
+	PVCNameKey      = "csi.storage.k8s.io/pvc/name"
+	PVCNamespaceKey = "csi.storage.k8s.io/pvc/namespace"
+	PVNameKey       = "csi.storage.k8s.io/pv/name"
+
+	// the LVMLogicalVolume labels and annotations describing the volume owner.
+	// They are meant to be set as the LV tags on the node by the agent.
+	LLVPVCNameKey      = "local.csi.storage.deckhouse.io/pvc-name"
+	LLVPVCNamespaceKey = "local.csi.storage.deckhouse.io/pvc-namespace"
+	LLVPVNameKey       = "local.csi.storage.deckhouse.io/pv-name"
+	// the LVMLogicalVolume label of the storage class the volume with the quota is provisioned from, so the volumes
+	// being provisioned count towards the quota before their PVs are created
+	LLVStorageClassKey = "local.csi.storage.deckhouse.io/storage-class"
+
+	// mutable volume attributes which might be changed with a VolumeAttributesClass.
+	// Except for the contiguous allocation, they are stored in the LVMLogicalVolume annotations and applied on the node.
+	// The QoS limits are set in the io.max of the cgroup of the Pod the volume is published for.
+	QoSReadBPSKey   = "local.csi.storage.deckhouse.io/qos-read-bps"
+	QoSWriteBPSKey  = "local.csi.storage.deckhouse.io/qos-write-bps"
+	QoSReadIOPSKey  = "local.csi.storage.deckhouse.io/qos-read-iops"
+	QoSWriteIOPSKey = "local.csi.storage.deckhouse.io/qos-write-iops"
+	DiscardKey      = "local.csi.storage.deckhouse.io/discard"
+
+	// tuning of the request queue of the volume's device applied by the node plugin when the volume is published.
+	// It might be set in a StorageClass and changed with a VolumeAttributesClass, so it is kept in the LVMLogicalVolume
+	// annotations as well.
+	IOSchedulerKey        = "local.csi.storage.deckhouse.io/io-scheduler"
+	IOSchedulerNone       = "none"
+	IOSchedulerMQDeadline = "mq-deadline"
+	ReadAheadKBKey        = "local.csi.storage.deckhouse.io/read-ahead-kb"
+	NrRequestsKey         = "local.csi.storage.deckhouse.io/nr-requests"
+
+	// the key rotation of the encrypted volume requested with a VolumeAttributesClass: the <namespace>/<name> of the Secret
+	// with the current and the new passphrases, and whether to re-encrypt the data with a new volume key afterward.
+	// The node plugin reports the rotation progress in the status and message annotations of the LVMLogicalVolume.
+	EncryptionKeySecretKey       = "local.csi.storage.deckhouse.io/encryption-key-secret"
+	EncryptionReencryptKey       = "local.csi.storage.deckhouse.io/encryption-reencrypt"
+	EncryptionRotationStatusKey  = "local.csi.storage.deckhouse.io/encryption-rotation-status"
+	EncryptionRotationMessageKey = "local.csi.storage.deckhouse.io/encryption-rotation-message"
+
+	// statuses of the encryption key rotation
+	EncryptionRotationPending      = "Pending"
+	EncryptionRotationReencrypting = "Reencrypting"
+	EncryptionRotationCompleted    = "Completed"
+	EncryptionRotationFailed       = "Failed"
+
+	// the CSI inline ephemeral volumes: kubelet marks them in the volume context, and the Pod sets the size
+	// and, optionally, the LVMVolumeGroup (LVGNameKey) and the thin pool (ThinPoolNameKey) in the volume attributes
+	EphemeralContextKey = "csi.storage.k8s.io/ephemeral"
+	EphemeralSizeKey    = "size"
+	EphemeralKey        = "local.csi.storage.deckhouse.io/ephemeral"
+
+	// the traceID of the CSI call which has created or last changed the volume, recorded in the annotations
+	// of the LVMLogicalVolume for the agent and in the volume context for the node plugin, so the logs of the same
+	// volume operation might be correlated across the components
+	TraceIDKey = "local.csi.storage.deckhouse.io/trace-id"
+
+	// the UID of the Pod the volume is published for, passed by kubelet as the CSIDriver has podInfoOnMount set
+	PodUIDContextKey = "csi.storage.k8s.io/pod.uid"
+
+	// node selection strategies for the Immediate volume binding mode
+	NodeSelectionStrategyMostFree   = "most-free"
+	NodeSelectionStrategyLeastFree  = "least-free"
+	NodeSelectionStrategyRoundRobin = "round-robin"
+	NodeSelectionStrategyRandom     = "random"
+
+	// policies of the LVMVolumeGroup selection among several ones on the same node
+	LVGSelectionPolicyFreeSpace = "free-space"
+	LVGSelectionPolicyPriority  = "priority"
+	LVGSelectionPolicyType      = "type"
+
+	// policies of the LV handling on the volume deletion.
+	// The policy is stored in the LVMLogicalVolume annotations as DeleteVolume does not get the storage class's parameters.
+	OnDeletePolicyDelete = "delete"
+	OnDeletePolicyRetain = "retain"
+
+	// the filesystem freeze of the source volume while its snapshot is taken: the controller requests the freeze by
+	// the snapshot name, and the node plugin reports whether the filesystem is frozen, thawed or not mounted at all
+	FSFreezeRequestKey = "local.csi.storage.deckhouse.io/fsfreeze-request"
+	FSFreezeStatusKey  = "local.csi.storage.deckhouse.io/fsfreeze-status"
+	FSFreezeMessageKey = "local.csi.storage.deckhouse.io/fsfreeze-message"
+	FSFreezeFrozen     = "Frozen"
+	FSFreezeThawed     = "Thawed"
+	FSFreezeSkipped    = "Skipped"
+	FSFreezeFailed     = "Failed"
+
+	// escalations of the unstage unmount not finished in time: the lazy unmount detaches the filesystem right away
+	// and releases it when the last file is closed, the forced one aborts the pending requests of the filesystem
+	UnmountEscalationLazy  = "lazy"
+	UnmountEscalationForce = "force"
+
+	// formatting of the device bearing a foreign signature or not matching the VG and LV of the volume, disabled
+	// by default to prevent the data loss caused by the stale volume contexts
+	ForceFormatKey = "local.csi.storage.deckhouse.io/force-format"
+
+	// policies of returning the space freed by the workloads to the thin pool or the underlying device: with the discard
+	// mount option on every deletion, or by the fstrim run periodically by the node plugin over the staged volumes.
+	// The policy is stored in the LVMLogicalVolume annotations, so the node plugin finds the volumes to trim.
+	DiscardPolicyKey    = "local.csi.storage.deckhouse.io/discard-policy"
+	DiscardPolicyNone   = "none"
+	DiscardPolicyMount  = "mount"
+	DiscardPolicyFstrim = "fstrim"
+
+	// handling of the XFS filesystem with the same UUID as a mounted one, e.g. of the volume cloned or restored from
+	// a snapshot of a volume mounted to the same node, which XFS refuses to mount: the filesystem is either mounted
+	// with the nouuid option or gets a new UUID before it is mounted
+	XFSDuplicateUUIDKey        = "local.csi.storage.deckhouse.io/xfs-duplicate-uuid"
+	XFSDuplicateUUIDNouuid     = "nouuid"
+	XFSDuplicateUUIDRegenerate = "regenerate"
+
+	// policies of the change of the volume ownership to the fsGroup of a Pod, named after fsGroupChangePolicy of the Pod:
+	// the files are walked either on every publish or only if the root directory of the volume does not match yet
+	FSGroupChangePolicyKey            = "local.csi.storage.deckhouse.io/fs-group-change-policy"
+	FSGroupChangePolicyAlways         = "Always"
+	FSGroupChangePolicyOnRootMismatch = "OnRootMismatch"
+
+	// secure erase of the LV of a scratch volume released by the node, so its data does not survive for the next
+	// tenant of the blocks: the blocks are either discarded, so the thin pool zeroes them before they are provisioned
+	// again, or overwritten with zeros
+	SecureEraseKey     = "local.csi.storage.deckhouse.io/secure-erase"
+	SecureEraseDiscard = "discard"
+	SecureEraseZero    = "zero"
+
+	// policies of the filesystem check before the volume is mounted to the node
+	FsckPolicyKey    = "local.csi.storage.deckhouse.io/fsck-policy"
+	FsckPolicyNone   = "none"
+	FsckPolicyCheck  = "check"
+	FsckPolicyRepair = "repair"
+
+	// the raw device volumes taking the whole BlockDevices: the storage class selects the devices by their labels
+	// and size, and the volume context holds the BlockDevice of the volume and the path of its device on the node
+	RawDeviceSelectorKey = "local.csi.storage.deckhouse.io/raw-device-selector"
+	RawDeviceMinSizeKey  = "local.csi.storage.deckhouse.io/raw-device-min-size"
+	RawDeviceMaxSizeKey  = "local.csi.storage.deckhouse.io/raw-device-max-size"
+	RawDeviceNameKey     = "blockDeviceName"
+	RawDevicePathKey     = "devicePath"
+
 	// supported filesystem types
-	FSTypeExt4 = "ext4"
-	FSTypeXfs  = "xfs"
+	FSTypeExt4  = "ext4"
+	FSTypeXfs   = "xfs"
+	FSTypeBtrfs = "btrfs"
+
+	// XFSMinSize is the smallest filesystem mkfs.xfs creates since xfsprogs 5.19
+	XFSMinSize = "300Mi"
+	// BtrfsMinSize is the smallest filesystem mkfs.btrfs creates with the default profiles
+	BtrfsMinSize = "109Mi"
+
+	// the directory kubelet keeps the staging paths and the data of the CSI volumes in, the volumes staged before
+	// the node reboot or the plugin restart are recovered by the data at the plugin start for the recovery timeout
+	KubeletCSIPluginDir          = "/var/lib/kubelet/plugins/kubernetes.io/csi"
+	StagedVolumesRecoveryTimeout = 2 * time.Minute
 )
@@ -0,0 +1,102 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"sync"
+)
+
+// CapacityReservations is a ledger of the space reserved by the volumes which are being provisioned. The space is
+// reserved per storage pool (an LVMVolumeGroup or its thin pool) until the provisioning of the volume is finished,
+// so the concurrent requests do not pass the free space check against the same storage pool.
+type CapacityReservations struct {
+	mux          *sync.Mutex
+	reservations map[string]map[string]int64
+}
+
+// NewCapacityReservations instantiates a CapacityReservations structure.
+func NewCapacityReservations() *CapacityReservations {
+	return &CapacityReservations{
+		mux:          &sync.Mutex{},
+		reservations: make(map[string]map[string]int64),
+	}
+}
+
+// Reserve reserves the size for the volume in the storage pool if the free space of the pool minus the space
+// reserved by the other volumes is enough. Returns false if it is not.
+// Reserving the space for the same volume twice is a no-op.
+func (r *CapacityReservations) Reserve(pool, volumeID string, size, freeSpace int64) bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, ok := r.reservations[pool][volumeID]; ok {
+		return true
+	}
+
+	if freeSpace-r.reserved(pool) < size {
+		return false
+	}
+
+	if r.reservations[pool] == nil {
+		r.reservations[pool] = make(map[string]int64)
+	}
+	r.reservations[pool][volumeID] = size
+
+	return true
+}
+
+// Release removes the reservation of the volume from the storage pool.
+// It will do nothing if there is no such reservation.
+func (r *CapacityReservations) Release(pool, volumeID string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	delete(r.reservations[pool], volumeID)
+	if len(r.reservations[pool]) == 0 {
+		delete(r.reservations, pool)
+	}
+}
+
+// ReleaseVolume removes the reservations of the volume from all the storage pools.
+func (r *CapacityReservations) ReleaseVolume(volumeID string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	for pool, volumes := range r.reservations {
+		delete(volumes, volumeID)
+		if len(volumes) == 0 {
+			delete(r.reservations, pool)
+		}
+	}
+}
+
+// Reserved returns the total space reserved in the storage pool.
+func (r *CapacityReservations) Reserved(pool string) int64 {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.reserved(pool)
+}
+
+func (r *CapacityReservations) reserved(pool string) int64 {
+	var total int64
+	for _, size := range r.reservations[pool] {
+		total += size
+	}
+
+	return total
+}
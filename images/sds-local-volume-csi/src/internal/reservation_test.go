@@ -0,0 +1,59 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"testing"
+)
+
+func TestCapacityReservations(t *testing.T) {
+	r := NewCapacityReservations()
+
+	if !r.Reserve("lvg", "vol-1", 6, 10) {
+		t.Fatalf("expected the first reservation to succeed")
+	}
+
+	if !r.Reserve("lvg", "vol-1", 6, 10) {
+		t.Fatalf("expected the repeated reservation of the same volume to succeed")
+	}
+
+	if r.Reserve("lvg", "vol-2", 6, 10) {
+		t.Fatalf("expected the reservation exceeding the free space to fail")
+	}
+
+	if !r.Reserve("other-lvg", "vol-2", 6, 10) {
+		t.Fatalf("expected the reservation in another pool to succeed")
+	}
+
+	if reserved := r.Reserved("lvg"); reserved != 6 {
+		t.Fatalf("expected 6 reserved, got %d", reserved)
+	}
+
+	r.Release("lvg", "vol-1")
+	if reserved := r.Reserved("lvg"); reserved != 0 {
+		t.Fatalf("expected nothing reserved after the release, got %d", reserved)
+	}
+
+	if !r.Reserve("lvg", "vol-2", 6, 10) {
+		t.Fatalf("expected the reservation after the release to succeed")
+	}
+
+	r.ReleaseVolume("vol-2")
+	if reserved := r.Reserved("lvg") + r.Reserved("other-lvg"); reserved != 0 {
+		t.Fatalf("expected nothing reserved after the release of the volume in all the pools, got %d", reserved)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"sds-local-volume-csi/internal"
+)
+
+// BlockTuning is the tuning of the request queue of the volume's device. The zero values leave the settings as is.
+type BlockTuning struct {
+	Scheduler   string
+	ReadAheadKB string
+	NrRequests  string
+}
+
+// IsEmpty reports whether no setting of the device is tuned.
+func (t BlockTuning) IsEmpty() bool {
+	return t == BlockTuning{}
+}
+
+// GetBlockTuning returns the tuning of the volume's device from the StorageClass parameters, the mutable parameters
+// or the LVMLogicalVolume annotations.
+func GetBlockTuning(parameters map[string]string) (BlockTuning, error) {
+	t := BlockTuning{
+		Scheduler:   parameters[internal.IOSchedulerKey],
+		ReadAheadKB: parameters[internal.ReadAheadKBKey],
+		NrRequests:  parameters[internal.NrRequestsKey],
+	}
+
+	switch t.Scheduler {
+	case "", internal.IOSchedulerNone, internal.IOSchedulerMQDeadline:
+	default:
+		return BlockTuning{}, fmt.Errorf("%s must be %s or %s, got %q", internal.IOSchedulerKey, internal.IOSchedulerNone, internal.IOSchedulerMQDeadline, t.Scheduler)
+	}
+
+	if t.ReadAheadKB != "" {
+		if _, err := strconv.ParseUint(t.ReadAheadKB, 10, 32); err != nil {
+			return BlockTuning{}, fmt.Errorf("%s must be a non-negative integer, got %q", internal.ReadAheadKBKey, t.ReadAheadKB)
+		}
+	}
+
+	if t.NrRequests != "" {
+		if n, err := strconv.ParseUint(t.NrRequests, 10, 32); err != nil || n == 0 {
+			return BlockTuning{}, fmt.Errorf("%s must be a positive integer, got %q", internal.NrRequestsKey, t.NrRequests)
+		}
+	}
+
+	return t, nil
+}
+
+// TuneBlockDevice applies the tuning to the request queue of the device, e.g. /dev/vg/lv resolved to /dev/dm-3.
+// The settings are not persisted by the kernel, so they are applied again every time the volume is published.
+func (s *Store) TuneBlockDevice(devicePath string, tuning BlockTuning) error {
+	device, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the device %s: %w", devicePath, err)
+	}
+
+	queueDir := filepath.Join("/sys/block", filepath.Base(device), "queue")
+	s.Log.Debug(fmt.Sprintf("[TuneBlockDevice] tuning the queue %s of the device %s: %+v", queueDir, devicePath, tuning))
+
+	return writeQueueTuning(queueDir, tuning)
+}
+
+// writeQueueTuning writes the tuning to the sysfs attributes of the request queue. The scheduler is set first, as its
+// change resets the number of the requests.
+func writeQueueTuning(queueDir string, tuning BlockTuning) error {
+	for _, setting := range []struct{ name, value string }{
+		{"scheduler", tuning.Scheduler},
+		{"read_ahead_kb", tuning.ReadAheadKB},
+		{"nr_requests", tuning.NrRequests},
+	} {
+		if setting.value == "" {
+			continue
+		}
+
+		err := os.WriteFile(filepath.Join(queueDir, setting.name), []byte(setting.value), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to set %s of the device queue to %s: %w", setting.name, setting.value, err)
+		}
+	}
+
+	return nil
+}
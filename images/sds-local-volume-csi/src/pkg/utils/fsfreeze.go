@@ -0,0 +1,121 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/logger"
+)
+
+// RequestFSFreeze requests the node plugin to freeze the filesystem of the volume for the snapshot. The status
+// of the previous freeze is reset, so the one reported afterwards belongs to this request.
+func RequestFSFreeze(ctx context.Context, kc client.Client, lvmLogicalVolumeName, snapshotName string) error {
+	llv, err := GetLVMLogicalVolume(ctx, kc, lvmLogicalVolumeName, "")
+	if err != nil {
+		return fmt.Errorf("get LVMLogicalVolume %s: %w", lvmLogicalVolumeName, err)
+	}
+
+	patch := client.MergeFrom(llv.DeepCopy())
+	if llv.Annotations == nil {
+		llv.Annotations = make(map[string]string, 1)
+	}
+	llv.Annotations[internal.FSFreezeRequestKey] = snapshotName
+	delete(llv.Annotations, internal.FSFreezeStatusKey)
+	delete(llv.Annotations, internal.FSFreezeMessageKey)
+
+	return kc.Patch(ctx, llv, patch)
+}
+
+// ReleaseFSFreeze withdraws the freeze request, so the node plugin thaws the filesystem of the volume.
+func ReleaseFSFreeze(ctx context.Context, kc client.Client, lvmLogicalVolumeName string) error {
+	llv, err := GetLVMLogicalVolume(ctx, kc, lvmLogicalVolumeName, "")
+	if err != nil {
+		return fmt.Errorf("get LVMLogicalVolume %s: %w", lvmLogicalVolumeName, err)
+	}
+
+	if _, ok := llv.Annotations[internal.FSFreezeRequestKey]; !ok {
+		return nil
+	}
+
+	patch := client.MergeFrom(llv.DeepCopy())
+	delete(llv.Annotations, internal.FSFreezeRequestKey)
+
+	return kc.Patch(ctx, llv, patch)
+}
+
+// SetFSFreezeStatus reports the state of the filesystem freeze of the volume in the LVMLogicalVolume annotations.
+func SetFSFreezeStatus(ctx context.Context, kc client.Client, lvmLogicalVolumeName, freezeStatus, message string) error {
+	llv, err := GetLVMLogicalVolume(ctx, kc, lvmLogicalVolumeName, "")
+	if err != nil {
+		return fmt.Errorf("get LVMLogicalVolume %s: %w", lvmLogicalVolumeName, err)
+	}
+
+	patch := client.MergeFrom(llv.DeepCopy())
+	if llv.Annotations == nil {
+		llv.Annotations = make(map[string]string, 2)
+	}
+	llv.Annotations[internal.FSFreezeStatusKey] = freezeStatus
+	llv.Annotations[internal.FSFreezeMessageKey] = message
+
+	return kc.Patch(ctx, llv, patch)
+}
+
+// IsFSFrozenForSnapshot reports whether the filesystem of the volume is frozen, or does not need to be as the volume
+// is not mounted, for the snapshot.
+func IsFSFrozenForSnapshot(llv *snc.LVMLogicalVolume, snapshotName string) bool {
+	if llv.Annotations[internal.FSFreezeRequestKey] != snapshotName {
+		return false
+	}
+
+	freezeStatus := llv.Annotations[internal.FSFreezeStatusKey]
+	return freezeStatus == internal.FSFreezeFrozen || freezeStatus == internal.FSFreezeSkipped
+}
+
+// WaitForFSFreeze waits until the node plugin freezes the filesystem of the volume for the snapshot or reports it is
+// not mounted.
+func WaitForFSFreeze(ctx context.Context, informerCache cache.Cache, log *logger.Logger, traceID, lvmLogicalVolumeName, snapshotName string) (int, error) {
+	log.Info(fmt.Sprintf("[WaitForFSFreeze][traceID:%s][volumeID:%s] Waiting for the filesystem freeze", traceID, lvmLogicalVolumeName))
+	attemptCounter, err := waitForLLV(ctx, informerCache, lvmLogicalVolumeName, "", func(llv *snc.LVMLogicalVolume, attempt int) (bool, error) {
+		if llv == nil {
+			return false, fmt.Errorf("LVMLogicalVolume %s not found", lvmLogicalVolumeName)
+		}
+
+		if llv.Annotations[internal.FSFreezeRequestKey] != snapshotName {
+			log.Trace(fmt.Sprintf("[WaitForFSFreeze][traceID:%s][volumeID:%s] Attempt %d, the freeze request is not in the cache yet. Waiting...", traceID, lvmLogicalVolumeName, attempt))
+			return false, nil
+		}
+
+		if llv.Annotations[internal.FSFreezeStatusKey] == internal.FSFreezeFailed {
+			return false, fmt.Errorf("the filesystem freeze has failed: %s", llv.Annotations[internal.FSFreezeMessageKey])
+		}
+
+		return IsFSFrozenForSnapshot(llv, snapshotName), nil
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		log.Warning(fmt.Sprintf("[WaitForFSFreeze][traceID:%s][volumeID:%s] context done. The filesystem has not been frozen in time", traceID, lvmLogicalVolumeName))
+	}
+
+	return attemptCounter, err
+}
@@ -18,17 +18,30 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand/v2"
 	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	slv "github.com/deckhouse/sds-local-volume/api/v1alpha1"
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/stalelvg"
 	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
 	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"sds-local-volume-csi/internal"
@@ -41,21 +54,119 @@ const (
 	LLVStatusFailed             = "Failed"
 	LLVSStatusFailed            = "Failed"
 	LLVTypeThin                 = "Thin"
+	LVGStatusReady              = "Ready"
 	KubernetesAPIRequestLimit   = 3
 	KubernetesAPIRequestTimeout = 1
 	SDSLocalVolumeCSIFinalizer  = "storage.deckhouse.io/sds-local-volume-csi"
 )
 
+var (
+	// ErrNotEnoughSpace is returned when none of the LVMVolumeGroups has enough free space for the volume.
+	ErrNotEnoughSpace = errors.New("not enough space")
+	// ErrLLVFailed is returned when the agent failed to create the LVMLogicalVolume on the node.
+	ErrLLVFailed = errors.New("failed to create LVM logical volume")
+)
+
+// WaitOptions describe how the driver waits for the agent to apply the LVMLogicalVolume changes on the node.
+type WaitOptions struct {
+	// ResizeDelta is the tolerance of the LV size comparing to the requested one.
+	ResizeDelta resource.Quantity
+	// Timeout bounds the wait for the LV creation, expansion and deletion.
+	Timeout time.Duration
+}
+
+func (o WaitOptions) Validate() error {
+	if o.ResizeDelta.Sign() < 0 {
+		return fmt.Errorf("resize delta must not be negative, got %s", o.ResizeDelta.String())
+	}
+
+	if o.Timeout <= 0 {
+		return fmt.Errorf("wait timeout must be positive, got %s", o.Timeout)
+	}
+
+	return nil
+}
+
+// GetWaitOptions returns the wait options overridden by the storage class's parameters. As the expansion and
+// deletion requests have no parameters, the overrides are also stored in the LVMLogicalVolume annotations.
+func GetWaitOptions(params map[string]string, defaults WaitOptions) (WaitOptions, error) {
+	opts := defaults
+	if val, ok := params[internal.ResizeDeltaKey]; ok {
+		delta, err := resource.ParseQuantity(val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q: %w", internal.ResizeDeltaKey, val, err)
+		}
+		opts.ResizeDelta = delta
+	}
+
+	if val, ok := params[internal.WaitTimeoutKey]; ok {
+		timeout, err := time.ParseDuration(val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q: %w", internal.WaitTimeoutKey, val, err)
+		}
+		opts.Timeout = timeout
+	}
+
+	return opts, opts.Validate()
+}
+
+// SnapshotOptions are the VolumeSnapshotClass parameters of the snapshot creation.
+type SnapshotOptions struct {
+	// SizePercent is the share of the source volume size the snapshot is expected to take in the thin pool.
+	// The pool must have that much free space for the snapshot to be created.
+	SizePercent int
+	// ThinPoolName is the thin pool the snapshot is requested in. LVM thin snapshots share the pool of the origin,
+	// so it must be the source volume's pool if set.
+	ThinPoolName string
+	// FSFreeze requests the source volume's filesystem to be frozen while the snapshot is being taken.
+	FSFreeze bool
+}
+
+// GetSnapshotOptions parses and validates the VolumeSnapshotClass parameters.
+func GetSnapshotOptions(params map[string]string) (SnapshotOptions, error) {
+	opts := SnapshotOptions{SizePercent: 100}
+
+	if val, ok := params[internal.SnapshotSizePercentKey]; ok {
+		percent, err := strconv.Atoi(val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q: %w", internal.SnapshotSizePercentKey, val, err)
+		}
+		if percent < 1 || percent > 100 {
+			return opts, fmt.Errorf("%s must be in range [1, 100], got %d", internal.SnapshotSizePercentKey, percent)
+		}
+		opts.SizePercent = percent
+	}
+
+	opts.ThinPoolName = params[internal.SnapshotThinPoolKey]
+
+	if val, ok := params[internal.SnapshotFSFreezeKey]; ok {
+		freeze, err := strconv.ParseBool(val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q: %w", internal.SnapshotFSFreezeKey, val, err)
+		}
+		opts.FSFreeze = freeze
+	}
+
+	return opts, nil
+}
+
+// RequiredSpace returns the thin pool free space required to take a snapshot of the volume of the size.
+func (o SnapshotOptions) RequiredSpace(size resource.Quantity) resource.Quantity {
+	return *resource.NewQuantity(int64(math.Ceil(float64(size.Value())*float64(o.SizePercent)/100)), resource.BinarySI)
+}
+
 func CreateLVMLogicalVolumeSnapshot(
 	ctx context.Context,
 	kc client.Client,
 	log *logger.Logger,
 	traceID, name string,
 	lvmLogicalVolumeSnapshotSpec snc.LVMLogicalVolumeSnapshotSpec,
+	annotations map[string]string,
 ) (*snc.LVMLogicalVolumeSnapshot, error) {
 	llvs := &snc.LVMLogicalVolumeSnapshot{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            name,
+			Annotations:     withTraceID(annotations, traceID),
 			OwnerReferences: []metav1.OwnerReference{},
 			Finalizers:      []string{SDSLocalVolumeCSIFinalizer},
 		},
@@ -198,11 +309,13 @@ func GetLVMLogicalVolumeSnapshot(ctx context.Context, kc client.Client, lvmLogic
 	return &llvs, err
 }
 
-func CreateLVMLogicalVolume(ctx context.Context, kc client.Client, log *logger.Logger, traceID, name string, lvmLogicalVolumeSpec snc.LVMLogicalVolumeSpec) (*snc.LVMLogicalVolume, error) {
+func CreateLVMLogicalVolume(ctx context.Context, kc client.Client, log *logger.Logger, traceID, name string, lvmLogicalVolumeSpec snc.LVMLogicalVolumeSpec, labels, annotations map[string]string) (*snc.LVMLogicalVolume, error) {
 	var err error
 	llv := &snc.LVMLogicalVolume{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            name,
+			Labels:          labels,
+			Annotations:     withTraceID(annotations, traceID),
 			OwnerReferences: []metav1.OwnerReference{},
 			Finalizers:      []string{SDSLocalVolumeCSIFinalizer},
 		},
@@ -242,49 +355,295 @@ func DeleteLVMLogicalVolume(ctx context.Context, kc client.Client, log *logger.L
 	return err
 }
 
-func WaitForStatusUpdate(ctx context.Context, kc client.Client, log *logger.Logger, traceID, lvmLogicalVolumeName, namespace string, llvSize, delta resource.Quantity) (int, error) {
-	var attemptCounter int
-	sizeEquals := false
-	log.Info(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Waiting for LVM Logical Volume status update", traceID, lvmLogicalVolumeName))
-	for {
-		attemptCounter++
-		select {
-		case <-ctx.Done():
-			log.Warning(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] context done. Failed to wait for LVM Logical Volume status update", traceID, lvmLogicalVolumeName))
-			return attemptCounter, ctx.Err()
+// AbortLVMLogicalVolume marks the LVMLogicalVolume with the abort annotation, so the agent stops processing it
+// before the LVMLogicalVolume is deleted. The reason is stored as the annotation value.
+func AbortLVMLogicalVolume(ctx context.Context, kc client.Client, log *logger.Logger, traceID, lvmLogicalVolumeName, reason string) error {
+	llv, err := GetLVMLogicalVolume(ctx, kc, lvmLogicalVolumeName, "")
+	if err != nil {
+		return fmt.Errorf("get LVMLogicalVolume %s: %w", lvmLogicalVolumeName, err)
+	}
+
+	patch := client.MergeFrom(llv.DeepCopy())
+	if llv.Annotations == nil {
+		llv.Annotations = make(map[string]string, 1)
+	}
+	llv.Annotations[internal.AbortKey] = reason
+
+	log.Trace(fmt.Sprintf("[AbortLVMLogicalVolume][traceID:%s][volumeID:%s] Marking LVMLogicalVolume as aborted, reason: %s", traceID, lvmLogicalVolumeName, reason))
+	return kc.Patch(ctx, llv, patch)
+}
+
+// SetEncryptionRotationStatus reports the status and the progress or the error of the encryption key rotation
+// in the LVMLogicalVolume annotations.
+func SetEncryptionRotationStatus(ctx context.Context, kc client.Client, lvmLogicalVolumeName, rotationStatus, message string) error {
+	llv, err := GetLVMLogicalVolume(ctx, kc, lvmLogicalVolumeName, "")
+	if err != nil {
+		return fmt.Errorf("get LVMLogicalVolume %s: %w", lvmLogicalVolumeName, err)
+	}
+
+	patch := client.MergeFrom(llv.DeepCopy())
+	if llv.Annotations == nil {
+		llv.Annotations = make(map[string]string, 2)
+	}
+	llv.Annotations[internal.EncryptionRotationStatusKey] = rotationStatus
+	llv.Annotations[internal.EncryptionRotationMessageKey] = message
+
+	return kc.Patch(ctx, llv, patch)
+}
+
+// GetMinFSSize returns the smallest size of the volume the filesystem of the requested volume capabilities might be
+// created on, or zero if there is no limit.
+func GetMinFSSize(capabilities []*csi.VolumeCapability) int64 {
+	for _, capability := range capabilities {
+		var minSize resource.Quantity
+		switch strings.ToLower(capability.GetMount().GetFsType()) {
+		case internal.FSTypeXfs:
+			minSize = resource.MustParse(internal.XFSMinSize)
+		case internal.FSTypeBtrfs:
+			minSize = resource.MustParse(internal.BtrfsMinSize)
 		default:
-			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+		return minSize.Value()
+	}
+
+	return 0
+}
+
+// GetMountVolumeContext returns the volume context entries with the fsType and the mount flags of the requested
+// filesystem volume capability, so the node service stages the volume the way it was provisioned.
+func GetMountVolumeContext(capabilities []*csi.VolumeCapability) (map[string]string, error) {
+	volumeCtx := make(map[string]string, 2)
+	for _, capability := range capabilities {
+		mount := capability.GetMount()
+		if mount == nil {
+			continue
 		}
 
-		llv, err := GetLVMLogicalVolume(ctx, kc, lvmLogicalVolumeName, namespace)
-		if err != nil {
-			return attemptCounter, err
+		if fsType := mount.GetFsType(); fsType != "" {
+			volumeCtx[internal.FSTypeContextKey] = strings.ToLower(fsType)
 		}
 
-		if attemptCounter%10 == 0 {
-			log.Info(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Attempt: %d,LVM Logical Volume: %+v; delta=%s; sizeEquals=%t", traceID, lvmLogicalVolumeName, attemptCounter, llv, delta.String(), sizeEquals))
+		if len(mount.GetMountFlags()) > 0 {
+			// the mount flags might contain commas themselves, e.g. the SELinux context, so they are stored as JSON
+			flags, err := json.Marshal(mount.GetMountFlags())
+			if err != nil {
+				return nil, err
+			}
+			volumeCtx[internal.MountFlagsContextKey] = string(flags)
 		}
 
-		if llv.Status != nil {
-			log.Trace(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Attempt %d, LVM Logical Volume status: %+v, full LVMLogicalVolume resource: %+v", traceID, lvmLogicalVolumeName, attemptCounter, llv.Status, llv))
-			sizeEquals = AreSizesEqualWithinDelta(llvSize, llv.Status.ActualSize, delta)
+		break
+	}
 
-			if llv.DeletionTimestamp != nil {
-				return attemptCounter, fmt.Errorf("failed to create LVM logical volume on node for LVMLogicalVolume %s, reason: LVMLogicalVolume is being deleted", lvmLogicalVolumeName)
-			}
+	return volumeCtx, nil
+}
 
-			if llv.Status.Phase == LLVStatusFailed {
-				return attemptCounter, fmt.Errorf("failed to create LVM logical volume on node for LVMLogicalVolume %s, reason: %s", lvmLogicalVolumeName, llv.Status.Reason)
-			}
+// GetMountFlagsFromContext returns the mount flags stored in the volume context at the volume creation.
+func GetMountFlagsFromContext(volumeCtx map[string]string) ([]string, error) {
+	val, ok := volumeCtx[internal.MountFlagsContextKey]
+	if !ok || val == "" {
+		return nil, nil
+	}
 
-			if llv.Status.Phase == LLVStatusCreated {
-				if sizeEquals {
-					return attemptCounter, nil
-				}
-				log.Trace(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Attempt %d, LVM Logical Volume created but size does not match the requested size yet. Waiting...", traceID, lvmLogicalVolumeName, attemptCounter))
-			} else {
-				log.Trace(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Attempt %d, LVM Logical Volume status is not 'Created' yet. Waiting...", traceID, lvmLogicalVolumeName, attemptCounter))
+	var flags []string
+	if err := json.Unmarshal([]byte(val), &flags); err != nil {
+		return nil, fmt.Errorf("invalid %s volume context value %q: %w", internal.MountFlagsContextKey, val, err)
+	}
+
+	return flags, nil
+}
+
+// GetVolumeOwnerMetadata returns the LVMLogicalVolume labels and annotations with the PVC and PV names
+// the external-provisioner passes in the storage class's parameters. The names are always stored in the annotations,
+// but only the ones which are valid label values are set as the labels.
+func GetVolumeOwnerMetadata(params map[string]string) (labels, annotations map[string]string) {
+	labels = make(map[string]string, 3)
+	annotations = make(map[string]string, 3)
+	for paramKey, llvKey := range map[string]string{
+		internal.PVCNameKey:      internal.LLVPVCNameKey,
+		internal.PVCNamespaceKey: internal.LLVPVCNamespaceKey,
+		internal.PVNameKey:       internal.LLVPVNameKey,
+	} {
+		val, ok := params[paramKey]
+		if !ok || val == "" {
+			continue
+		}
+
+		annotations[llvKey] = val
+		if len(validation.IsValidLabelValue(val)) == 0 {
+			labels[llvKey] = val
+		}
+	}
+
+	return labels, annotations
+}
+
+// RetainLVMLogicalVolume deletes the LVMLogicalVolume but keeps its LV on the node. The LV is recorded in a LocalOrphanedVolume resource.
+// The agent removes the LV only for the LVMLogicalVolumes with its finalizer, so every finalizer is removed before the deletion.
+func RetainLVMLogicalVolume(ctx context.Context, kc client.Client, log *logger.Logger, traceID string, llv *snc.LVMLogicalVolume) error {
+	lvg, err := GetLVMVolumeGroup(ctx, kc, llv.Spec.LVMVolumeGroupName)
+	if err != nil {
+		return fmt.Errorf("get LVMVolumeGroup %s: %w", llv.Spec.LVMVolumeGroupName, err)
+	}
+
+	lov := &slv.LocalOrphanedVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: llv.Name,
+		},
+		Spec: slv.LocalOrphanedVolumeSpec{
+			VolumeID:              llv.Name,
+			NodeName:              lvg.Spec.Local.NodeName,
+			LVMVolumeGroupName:    lvg.Name,
+			ActualVGNameOnTheNode: lvg.Spec.ActualVGNameOnTheNode,
+			ActualLVNameOnTheNode: llv.Spec.ActualLVNameOnTheNode,
+			Type:                  llv.Spec.Type,
+			Size:                  llv.Spec.Size,
+		},
+	}
+	if llv.Spec.Thin != nil {
+		lov.Spec.ThinPoolName = llv.Spec.Thin.PoolName
+	}
+	if llv.Status != nil && !llv.Status.ActualSize.IsZero() {
+		lov.Spec.Size = llv.Status.ActualSize.String()
+	}
+
+	log.Trace(fmt.Sprintf("[RetainLVMLogicalVolume][traceID:%s][volumeID:%s] LocalOrphanedVolume: %+v", traceID, llv.Name, lov))
+	err = kc.Create(ctx, lov)
+	if err != nil && !kerrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create LocalOrphanedVolume %s: %w", lov.Name, err)
+	}
+
+	for _, finalizer := range slices.Clone(llv.Finalizers) {
+		log.Trace(fmt.Sprintf("[RetainLVMLogicalVolume][traceID:%s][volumeID:%s] Removing finalizer %s", traceID, llv.Name, finalizer))
+		if _, err = removeLLVFinalizerIfExist(ctx, kc, log, llv, finalizer); err != nil {
+			return fmt.Errorf("remove finalizers from LVMLogicalVolume %s: %w", llv.Name, err)
+		}
+	}
+
+	log.Trace(fmt.Sprintf("[RetainLVMLogicalVolume][traceID:%s][volumeID:%s] Trying to delete LVMLogicalVolume", traceID, llv.Name))
+	err = kc.Delete(ctx, llv)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// WaitForStatusUpdate waits until the LVMLogicalVolume is created with the requested size.
+func WaitForStatusUpdate(ctx context.Context, informerCache cache.Cache, log *logger.Logger, traceID, lvmLogicalVolumeName, namespace string, llvSize, delta resource.Quantity) (int, error) {
+	log.Info(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Waiting for LVM Logical Volume status update", traceID, lvmLogicalVolumeName))
+	attemptCounter, err := waitForLLV(ctx, informerCache, lvmLogicalVolumeName, namespace, func(llv *snc.LVMLogicalVolume, attempt int) (bool, error) {
+		if llv == nil {
+			log.Trace(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Attempt %d, LVM Logical Volume is not in the cache yet. Waiting...", traceID, lvmLogicalVolumeName, attempt))
+			return false, nil
+		}
+
+		if llv.Status == nil {
+			return false, nil
+		}
+
+		sizeEquals := AreSizesEqualWithinDelta(llvSize, llv.Status.ActualSize, delta)
+		log.Trace(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Attempt %d, LVM Logical Volume status: %+v, delta=%s; sizeEquals=%t", traceID, lvmLogicalVolumeName, attempt, llv.Status, delta.String(), sizeEquals))
+
+		if llv.DeletionTimestamp != nil {
+			return false, fmt.Errorf("failed to create LVM logical volume on node for LVMLogicalVolume %s, reason: LVMLogicalVolume is being deleted", lvmLogicalVolumeName)
+		}
+
+		if llv.Status.Phase == LLVStatusFailed {
+			return false, fmt.Errorf("%w on node for LVMLogicalVolume %s, reason: %s", ErrLLVFailed, lvmLogicalVolumeName, llv.Status.Reason)
+		}
+
+		if llv.Status.Phase == LLVStatusCreated {
+			if sizeEquals {
+				return true, nil
 			}
+			log.Trace(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Attempt %d, LVM Logical Volume created but size does not match the requested size yet. Waiting...", traceID, lvmLogicalVolumeName, attempt))
+		} else {
+			log.Trace(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] Attempt %d, LVM Logical Volume status is not 'Created' yet. Waiting...", traceID, lvmLogicalVolumeName, attempt))
+		}
+
+		return false, nil
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		log.Warning(fmt.Sprintf("[WaitForStatusUpdate][traceID:%s][volumeID:%s] context done. Failed to wait for LVM Logical Volume status update", traceID, lvmLogicalVolumeName))
+	}
+
+	return attemptCounter, err
+}
+
+// WaitForLLVDeletion waits until the LVMLogicalVolume is removed.
+func WaitForLLVDeletion(ctx context.Context, informerCache cache.Cache, log *logger.Logger, traceID, lvmLogicalVolumeName string) (int, error) {
+	log.Info(fmt.Sprintf("[WaitForLLVDeletion][traceID:%s][volumeID:%s] Waiting for LVM Logical Volume deletion", traceID, lvmLogicalVolumeName))
+	return waitForLLV(ctx, informerCache, lvmLogicalVolumeName, "", func(llv *snc.LVMLogicalVolume, attempt int) (bool, error) {
+		if llv != nil {
+			log.Trace(fmt.Sprintf("[WaitForLLVDeletion][traceID:%s][volumeID:%s] Attempt %d, LVM Logical Volume still exists. Waiting...", traceID, lvmLogicalVolumeName, attempt))
+		}
+
+		return llv == nil, nil
+	})
+}
+
+// waitForLLV waits until the condition is met for the LVMLogicalVolume. Instead of polling the API server, the condition
+// is checked against the shared informer cache every time the LVMLogicalVolume changes. The condition gets nil if
+// the LVMLogicalVolume is not in the cache (yet).
+func waitForLLV(
+	ctx context.Context,
+	informerCache cache.Cache,
+	name, namespace string,
+	condition func(llv *snc.LVMLogicalVolume, attempt int) (bool, error),
+) (int, error) {
+	informer, err := informerCache.GetInformer(ctx, &snc.LVMLogicalVolume{})
+	if err != nil {
+		return 0, fmt.Errorf("unable to get the LVMLogicalVolume informer: %w", err)
+	}
+
+	events := make(chan struct{}, 1)
+	notify := func(obj interface{}) {
+		if o, ok := obj.(client.Object); ok && o.GetName() != name {
+			return
+		}
+
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(_, newObj interface{}) { notify(newObj) },
+		DeleteFunc: notify,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to add the LVMLogicalVolume event handler: %w", err)
+	}
+	defer func() {
+		_ = informer.RemoveEventHandler(registration)
+	}()
+
+	var attemptCounter int
+	for {
+		attemptCounter++
+
+		llv := &snc.LVMLogicalVolume{}
+		err = informerCache.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, llv)
+		switch {
+		case kerrors.IsNotFound(err):
+			llv = nil
+		case err != nil:
+			return attemptCounter, err
+		}
+
+		done, err := condition(llv, attemptCounter)
+		if err != nil || done {
+			return attemptCounter, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attemptCounter, ctx.Err()
+		case <-events:
 		}
 	}
 }
@@ -307,30 +666,177 @@ func AreSizesEqualWithinDelta(leftSize, rightSize, allowedDelta resource.Quantit
 	return math.Abs(leftSizeFloat-rightSizeFloat) < float64(allowedDelta.Value())
 }
 
-func GetNodeWithMaxFreeSpace(lvgs []snc.LVMVolumeGroup, storageClassLVGParametersMap map[string]string, lvmType string) (nodeName string, freeSpace resource.Quantity, err error) {
-	var maxFreeSpace int64
+// ValidateNodeSelectionStrategy checks that the strategy is one of the supported ones.
+func ValidateNodeSelectionStrategy(strategy string) error {
+	switch strategy {
+	case internal.NodeSelectionStrategyMostFree,
+		internal.NodeSelectionStrategyLeastFree,
+		internal.NodeSelectionStrategyRoundRobin,
+		internal.NodeSelectionStrategyRandom:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported node selection strategy %q, must be one of: %s, %s, %s, %s",
+		strategy,
+		internal.NodeSelectionStrategyMostFree,
+		internal.NodeSelectionStrategyLeastFree,
+		internal.NodeSelectionStrategyRoundRobin,
+		internal.NodeSelectionStrategyRandom,
+	)
+}
+
+// SelectNodeByStrategy selects a node for the volume among the nodes of the LVMVolumeGroups. Thick volumes are placed
+// only to the LVMVolumeGroups with enough free space. The counter is used by the round-robin strategy.
+func SelectNodeByStrategy(
+	lvgs []snc.LVMVolumeGroup,
+	storageClassLVGParametersMap map[string]string,
+	lvmType string,
+	requiredSize resource.Quantity,
+	strategy string,
+	counter *atomic.Uint64,
+) (nodeName string, freeSpace resource.Quantity, err error) {
+	type candidate struct {
+		nodeName  string
+		freeSpace resource.Quantity
+	}
+
+	candidates := make([]candidate, 0, len(lvgs))
+	for _, lvg := range lvgs {
+		if len(lvg.Status.Nodes) == 0 {
+			continue
+		}
+
+		lvgFreeSpace, err := getLVGFreeSpace(lvg, storageClassLVGParametersMap, lvmType)
+		if err != nil {
+			return "", freeSpace, err
+		}
+
+		if lvgFreeSpace.Value() <= 0 || (lvmType == internal.LVMTypeThick && lvgFreeSpace.Cmp(requiredSize) < 0) {
+			continue
+		}
+
+		candidates = append(candidates, candidate{nodeName: lvg.Status.Nodes[0].Name, freeSpace: lvgFreeSpace})
+	}
+
+	if len(candidates) == 0 {
+		return "", freeSpace, fmt.Errorf("%w: no LVMVolumeGroup has enough free space for the volume of size %s", ErrNotEnoughSpace, requiredSize.String())
+	}
+
+	// keeps the order stable for the round-robin strategy
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return strings.Compare(a.nodeName, b.nodeName)
+	})
+
+	selected := candidates[0]
+	switch strategy {
+	case internal.NodeSelectionStrategyMostFree, "":
+		for _, c := range candidates[1:] {
+			if c.freeSpace.Cmp(selected.freeSpace) > 0 {
+				selected = c
+			}
+		}
+	case internal.NodeSelectionStrategyLeastFree:
+		for _, c := range candidates[1:] {
+			if c.freeSpace.Cmp(selected.freeSpace) < 0 {
+				selected = c
+			}
+		}
+	case internal.NodeSelectionStrategyRoundRobin:
+		selected = candidates[(counter.Add(1)-1)%uint64(len(candidates))]
+	case internal.NodeSelectionStrategyRandom:
+		selected = candidates[rand.IntN(len(candidates))]
+	default:
+		return "", freeSpace, ValidateNodeSelectionStrategy(strategy)
+	}
+
+	return selected.nodeName, selected.freeSpace, nil
+}
+
+// getLVGFreeSpace returns the free space of the LVMVolumeGroup for Thick volumes or the free space of its thin pool
+// from the StorageClass for Thin ones.
+func getLVGFreeSpace(lvg snc.LVMVolumeGroup, storageClassLVGParametersMap map[string]string, lvmType string) (resource.Quantity, error) {
+	if lvmType != internal.LVMTypeThin {
+		return lvg.Status.VGFree, nil
+	}
+
+	thinPoolName, ok := storageClassLVGParametersMap[lvg.Name]
+	if !ok {
+		return resource.Quantity{}, fmt.Errorf("thin pool name for lvg %s not found in storage class parameters: %+v", lvg.Name, storageClassLVGParametersMap)
+	}
+
+	freeSpace, err := GetLVMThinPoolFreeSpace(lvg, thinPoolName)
+	if err != nil {
+		return resource.Quantity{}, fmt.Errorf("get free space for thin pool %s in lvg %s: %w", thinPoolName, lvg.Name, err)
+	}
+
+	return freeSpace, nil
+}
+
+// GetLVGsCapacity returns the total free space of the LVMVolumeGroups and the biggest free space of a single one of them.
+// The latter is the maximum size of a volume as a volume can not be spread across several LVMVolumeGroups.
+func GetLVGsCapacity(lvgs []snc.LVMVolumeGroup, storageClassLVGParametersMap map[string]string, lvmType string) (available, maximum resource.Quantity, err error) {
+	var total, maxFreeSpace int64
 	for _, lvg := range lvgs {
+		var freeSpace resource.Quantity
 		switch lvmType {
 		case internal.LVMTypeThick:
 			freeSpace = lvg.Status.VGFree
 		case internal.LVMTypeThin:
 			thinPoolName, ok := storageClassLVGParametersMap[lvg.Name]
 			if !ok {
-				return "", freeSpace, fmt.Errorf("thin pool name for lvg %s not found in storage class parameters: %+v", lvg.Name, storageClassLVGParametersMap)
+				return available, maximum, fmt.Errorf("thin pool name for lvg %s not found in storage class parameters: %+v", lvg.Name, storageClassLVGParametersMap)
 			}
 			freeSpace, err = GetLVMThinPoolFreeSpace(lvg, thinPoolName)
 			if err != nil {
-				return "", freeSpace, fmt.Errorf("get free space for thin pool %s in lvg %s: %w", thinPoolName, lvg.Name, err)
+				return available, maximum, fmt.Errorf("get free space for thin pool %s in lvg %s: %w", thinPoolName, lvg.Name, err)
 			}
+		default:
+			return available, maximum, fmt.Errorf("unsupported lvm type %q", lvmType)
 		}
 
+		total += freeSpace.Value()
 		if freeSpace.Value() > maxFreeSpace {
-			nodeName = lvg.Status.Nodes[0].Name
 			maxFreeSpace = freeSpace.Value()
 		}
 	}
 
-	return nodeName, *resource.NewQuantity(maxFreeSpace, resource.BinarySI), nil
+	return *resource.NewQuantity(total, resource.BinarySI), *resource.NewQuantity(maxFreeSpace, resource.BinarySI), nil
+}
+
+// FilterLVGsByNodeNames returns only the LVMVolumeGroups which belong to any of the nodes.
+func FilterLVGsByNodeNames(lvgs []snc.LVMVolumeGroup, nodeNames []string) []snc.LVMVolumeGroup {
+	result := make([]snc.LVMVolumeGroup, 0, len(lvgs))
+	for _, lvg := range lvgs {
+		for _, node := range lvg.Status.Nodes {
+			if slices.Contains(nodeNames, node.Name) {
+				result = append(result, lvg)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// ApplyStaleLVGPolicy returns the LVMVolumeGroups with the policy applied to the stale ones and the names of the stale LVMVolumeGroups.
+func ApplyStaleLVGPolicy(lvgs []snc.LVMVolumeGroup, policy stalelvg.Policy, now time.Time) ([]snc.LVMVolumeGroup, []string) {
+	if policy.Threshold == 0 {
+		return lvgs, nil
+	}
+
+	result := make([]snc.LVMVolumeGroup, 0, len(lvgs))
+	var stale []string
+	for i := range lvgs {
+		applied, isStale := policy.Apply(&lvgs[i], now)
+		if isStale {
+			stale = append(stale, lvgs[i].Name)
+		}
+		if applied != nil {
+			result = append(result, *applied)
+		}
+	}
+
+	return result, stale
 }
 
 func GetLVMVolumeGroup(ctx context.Context, kc client.Client, lvgName string) (*snc.LVMVolumeGroup, error) {
@@ -369,11 +875,67 @@ func GetLVMThinPoolFreeSpace(lvg snc.LVMVolumeGroup, thinPoolName string) (thinP
 	return storagePoolThinPool.AvailableSpace, nil
 }
 
-func ExpandLVMLogicalVolume(ctx context.Context, kc client.Client, llv *snc.LVMLogicalVolume, newSize string) error {
+func ExpandLVMLogicalVolume(ctx context.Context, kc client.Client, traceID string, llv *snc.LVMLogicalVolume, newSize string) error {
 	llv.Spec.Size = newSize
+	llv.Annotations = withTraceID(llv.Annotations, traceID)
+	return kc.Update(ctx, llv)
+}
+
+// withTraceID records the traceID of the CSI call in the annotations of the resource it creates or changes,
+// so the agent logs of the resource might be correlated with the ones of the call.
+func withTraceID(annotations map[string]string, traceID string) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[internal.TraceIDKey] = traceID
+
+	return annotations
+}
+
+// ModifyLVMLogicalVolume sets the contiguous allocation (if not nil) and the annotations of the LVMLogicalVolume.
+func ModifyLVMLogicalVolume(ctx context.Context, kc client.Client, llv *snc.LVMLogicalVolume, contiguous *bool, annotations map[string]string) error {
+	if contiguous != nil {
+		if llv.Spec.Thick == nil {
+			llv.Spec.Thick = &snc.LVMLogicalVolumeThickSpec{}
+		}
+		llv.Spec.Thick.Contiguous = contiguous
+	}
+
+	if len(annotations) != 0 && llv.Annotations == nil {
+		llv.Annotations = make(map[string]string, len(annotations))
+	}
+	for k, v := range annotations {
+		llv.Annotations[k] = v
+	}
+
 	return kc.Update(ctx, llv)
 }
 
+// WaitForContiguousUpdate waits until the agent applies the contiguous allocation policy to the LVMLogicalVolume.
+func WaitForContiguousUpdate(ctx context.Context, informerCache cache.Cache, log *logger.Logger, traceID, lvmLogicalVolumeName string, contiguous bool) (int, error) {
+	log.Info(fmt.Sprintf("[WaitForContiguousUpdate][traceID:%s][volumeID:%s] Waiting for LVM Logical Volume contiguous status update", traceID, lvmLogicalVolumeName))
+	attemptCounter, err := waitForLLV(ctx, informerCache, lvmLogicalVolumeName, "", func(llv *snc.LVMLogicalVolume, _ int) (bool, error) {
+		if llv == nil {
+			return false, fmt.Errorf("LVMLogicalVolume %s not found", lvmLogicalVolumeName)
+		}
+
+		if llv.Status == nil {
+			return false, nil
+		}
+
+		if llv.Status.Phase == LLVStatusFailed {
+			return false, fmt.Errorf("failed to modify LVM logical volume on node for LVMLogicalVolume %s, reason: %s", lvmLogicalVolumeName, llv.Status.Reason)
+		}
+
+		return llv.Status.Phase == LLVStatusCreated && llv.Status.Contiguous != nil && *llv.Status.Contiguous == contiguous, nil
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		log.Warning(fmt.Sprintf("[WaitForContiguousUpdate][traceID:%s][volumeID:%s] context done. Failed to wait for LVM Logical Volume contiguous status update", traceID, lvmLogicalVolumeName))
+	}
+
+	return attemptCounter, err
+}
+
 func GetStorageClassLVGsAndParameters(
 	ctx context.Context,
 	kc client.Client,
@@ -414,18 +976,125 @@ func GetStorageClassLVGsAndParameters(
 	return storageClassLVGs, storageClassLVGParametersMap, nil
 }
 
-func GetLVGList(ctx context.Context, kc client.Client) (*snc.LVMVolumeGroupList, error) {
-	listLvgs := &snc.LVMVolumeGroupList{}
-	return listLvgs, kc.List(ctx, listLvgs)
+// GetRequestedThinPool returns the thin pool requested for the volume instead of the one bound in the storage class.
+// The pool might be set in the mutable parameters of the VolumeAttributesClass or in the PVC annotation, the former
+// takes precedence. The PVC is known only if the external-provisioner passes its name in the parameters.
+func GetRequestedThinPool(ctx context.Context, kc client.Client, params, mutableParams map[string]string) (string, error) {
+	if pool, ok := mutableParams[internal.ThinPoolKey]; ok {
+		return pool, nil
+	}
+
+	pvcName, pvcNamespace := params[internal.PVCNameKey], params[internal.PVCNamespaceKey]
+	if pvcName == "" || pvcNamespace == "" {
+		return "", nil
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := kc.Get(ctx, client.ObjectKey{Name: pvcName, Namespace: pvcNamespace}, pvc)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the PersistentVolumeClaim %s/%s: %w", pvcNamespace, pvcName, err)
+	}
+
+	return pvc.Annotations[internal.ThinPoolKey], nil
 }
 
-func GetLLVSpec(
-	log *logger.Logger,
-	lvName string,
-	selectedLVG snc.LVMVolumeGroup,
-	storageClassLVGParametersMap map[string]string,
-	lvmType string,
-	llvSize resource.Quantity,
+// OverrideThinPool keeps only the LVMVolumeGroups having the thin pool in their status and binds the pool to them
+// in the returned parameters map.
+func OverrideThinPool(lvgs []snc.LVMVolumeGroup, thinPoolName string) ([]snc.LVMVolumeGroup, map[string]string) {
+	filtered := make([]snc.LVMVolumeGroup, 0, len(lvgs))
+	parametersMap := make(map[string]string, len(lvgs))
+	for _, lvg := range lvgs {
+		if slices.ContainsFunc(lvg.Status.ThinPools, func(tp snc.LVMVolumeGroupThinPoolStatus) bool {
+			return tp.Name == thinPoolName
+		}) {
+			filtered = append(filtered, lvg)
+			parametersMap[lvg.Name] = thinPoolName
+		}
+	}
+
+	return filtered, parametersMap
+}
+
+func GetLLVList(ctx context.Context, kc client.Client) (*snc.LVMLogicalVolumeList, error) {
+	listLlvs := &snc.LVMLogicalVolumeList{}
+	return listLlvs, kc.List(ctx, listLlvs)
+}
+
+// GetLLVSnapshotNames returns the sorted names of the LVMLogicalVolumeSnapshots of the LVMLogicalVolume.
+func GetLLVSnapshotNames(ctx context.Context, kc client.Client, llvName string) ([]string, error) {
+	llvsList := &snc.LVMLogicalVolumeSnapshotList{}
+	if err := kc.List(ctx, llvsList); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, llvs := range llvsList.Items {
+		if llvs.Spec.LVMLogicalVolumeName == llvName {
+			names = append(names, llvs.Name)
+		}
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// GetDriverLLVs returns the LVMLogicalVolumes created by the driver sorted by name.
+func GetDriverLLVs(ctx context.Context, kc client.Client) ([]snc.LVMLogicalVolume, error) {
+	llvs, err := GetLLVList(ctx, kc)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]snc.LVMLogicalVolume, 0, len(llvs.Items))
+	for _, llv := range llvs.Items {
+		if slices.Contains(llv.Finalizers, SDSLocalVolumeCSIFinalizer) {
+			result = append(result, llv)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b snc.LVMLogicalVolume) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result, nil
+}
+
+// GetLVGNodeName returns the node of the LVMVolumeGroup: the one from the spec or, for the older resources
+// without it, the one reported by the agent.
+func GetLVGNodeName(lvg snc.LVMVolumeGroup) string {
+	if lvg.Spec.Local.NodeName != "" {
+		return lvg.Spec.Local.NodeName
+	}
+
+	if len(lvg.Status.Nodes) > 0 {
+		return lvg.Status.Nodes[0].Name
+	}
+
+	return ""
+}
+
+// GetLVGNodeNames returns the node name of every LVMVolumeGroup from the list.
+func GetLVGNodeNames(lvgs []snc.LVMVolumeGroup) map[string]string {
+	result := make(map[string]string, len(lvgs))
+	for _, lvg := range lvgs {
+		result[lvg.Name] = lvg.Spec.Local.NodeName
+	}
+
+	return result
+}
+
+func GetLVGList(ctx context.Context, kc client.Client) (*snc.LVMVolumeGroupList, error) {
+	listLvgs := &snc.LVMVolumeGroupList{}
+	return listLvgs, kc.List(ctx, listLvgs)
+}
+
+func GetLLVSpec(
+	log *logger.Logger,
+	lvName string,
+	selectedLVG snc.LVMVolumeGroup,
+	storageClassLVGParametersMap map[string]string,
+	lvmType string,
+	llvSize resource.Quantity,
 	contiguous bool,
 	source *snc.LVMLogicalVolumeSource,
 ) snc.LVMLogicalVolumeSpec {
@@ -456,13 +1125,737 @@ func GetLLVSpec(
 	return lvmLogicalVolumeSpec
 }
 
-func SelectLVG(storageClassLVGs []snc.LVMVolumeGroup, nodeName string) (*snc.LVMVolumeGroup, error) {
+// GetNodeTopologySegments returns the topology segments of the node: the node key and the extra topology keys
+// the node has labels for.
+func GetNodeTopologySegments(ctx context.Context, kc client.Client, nodeName string, topologyKeys []string) (map[string]string, error) {
+	if len(topologyKeys) == 0 {
+		return map[string]string{internal.TopologyKey: nodeName}, nil
+	}
+
+	node := &corev1.Node{}
+	err := kc.Get(ctx, client.ObjectKey{Name: nodeName}, node)
+	if err != nil {
+		return nil, fmt.Errorf("get node %s: %w", nodeName, err)
+	}
+
+	return NodeTopologySegments(node, topologyKeys), nil
+}
+
+// NodeTopologySegments returns the topology segments of the node: the node key and the extra topology keys
+// the node has labels for.
+func NodeTopologySegments(node *corev1.Node, topologyKeys []string) map[string]string {
+	segments := make(map[string]string, len(topologyKeys)+1)
+	segments[internal.TopologyKey] = node.Name
+	for _, key := range topologyKeys {
+		if val, ok := node.Labels[key]; ok {
+			segments[key] = val
+		}
+	}
+
+	return segments
+}
+
+// TopologyHasNodeKey reports whether every topology has the node key, so it might be resolved without the nodes.
+func TopologyHasNodeKey(topologies ...*csi.Topology) bool {
+	for _, t := range topologies {
+		if _, ok := t.GetSegments()[internal.TopologyKey]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetTopologyNodeNames returns the nodes the topology refers to. A topology with the node key refers to the node only,
+// a topology with the extra keys only (e.g. the zone one) refers to every node with the matching labels.
+func GetTopologyNodeNames(topology *csi.Topology, nodes []corev1.Node) []string {
+	segments := topology.GetSegments()
+	if node, ok := segments[internal.TopologyKey]; ok {
+		return []string{node}
+	}
+
+	if len(segments) == 0 {
+		return nil
+	}
+
+	var result []string
+	for _, node := range nodes {
+		matches := true
+		for key, val := range segments {
+			if node.Labels[key] != val {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			result = append(result, node.Name)
+		}
+	}
+
+	return result
+}
+
+// GetTopologyNodes returns the nodes of the topology requirement: the preferred ones in their order followed
+// by the rest of the requisite ones. The nodes are used to resolve the topologies without the node key.
+func GetTopologyNodes(requirement *csi.TopologyRequirement, nodes []corev1.Node) []string {
+	if requirement == nil {
+		return nil
+	}
+
+	result := make([]string, 0, len(requirement.Preferred)+len(requirement.Requisite))
+	for _, t := range slices.Concat(requirement.Preferred, requirement.Requisite) {
+		for _, node := range GetTopologyNodeNames(t, nodes) {
+			if !slices.Contains(result, node) {
+				result = append(result, node)
+			}
+		}
+	}
+
+	return result
+}
+
+// FilterLVGsByRequisiteTopology returns the LVMVolumeGroups on the requisite nodes. If there are no requisite
+// topologies, all the LVMVolumeGroups are returned. The nodes are used to resolve the topologies without the node key.
+func FilterLVGsByRequisiteTopology(lvgs []snc.LVMVolumeGroup, requirement *csi.TopologyRequirement, nodes []corev1.Node) []snc.LVMVolumeGroup {
+	if len(requirement.GetRequisite()) == 0 {
+		return lvgs
+	}
+
+	var nodeNames []string
+	for _, t := range requirement.GetRequisite() {
+		nodeNames = append(nodeNames, GetTopologyNodeNames(t, nodes)...)
+	}
+
+	return FilterLVGsByNodeNames(lvgs, nodeNames)
+}
+
+// ValidateTopologyKeys checks that the extra topology keys are valid label keys.
+func ValidateTopologyKeys(topologyKeys []string) error {
+	for _, key := range topologyKeys {
+		if key == internal.TopologyKey {
+			return fmt.Errorf("topology key %s is always used and must not be specified", key)
+		}
+
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			return fmt.Errorf("invalid topology key %q: %s", key, strings.Join(errs, "; "))
+		}
+	}
+
+	return nil
+}
+
+// HasEnoughSpace reports whether the LVMVolumeGroup (or its thin pool for Thin volumes) has enough free space for the volume.
+func HasEnoughSpace(lvg snc.LVMVolumeGroup, storageClassLVGParametersMap map[string]string, lvmType string, requiredSize resource.Quantity) (bool, error) {
+	freeSpace, err := getLVGFreeSpace(lvg, storageClassLVGParametersMap, lvmType)
+	if err != nil {
+		return false, err
+	}
+
+	return freeSpace.Cmp(requiredSize) >= 0, nil
+}
+
+// GetReservationPool returns the key of the storage pool the volume space is reserved in: the LVMVolumeGroup
+// for Thick volumes or its thin pool for Thin ones.
+func GetReservationPool(lvgName string, storageClassLVGParametersMap map[string]string, lvmType string) string {
+	if lvmType == internal.LVMTypeThin {
+		return lvgName + "/" + storageClassLVGParametersMap[lvgName]
+	}
+
+	return lvgName
+}
+
+// ApplyCapacityReservations returns the LVMVolumeGroups with the free space reduced by the space reserved
+// for the volumes which are being provisioned.
+func ApplyCapacityReservations(
+	lvgs []snc.LVMVolumeGroup,
+	storageClassLVGParametersMap map[string]string,
+	lvmType string,
+	reservations *internal.CapacityReservations,
+) []snc.LVMVolumeGroup {
+	result := make([]snc.LVMVolumeGroup, 0, len(lvgs))
+	for _, lvg := range lvgs {
+		reserved := reservations.Reserved(GetReservationPool(lvg.Name, storageClassLVGParametersMap, lvmType))
+		if reserved == 0 {
+			result = append(result, lvg)
+			continue
+		}
+
+		adjusted := lvg.DeepCopy()
+		if lvmType == internal.LVMTypeThin {
+			for i := range adjusted.Status.ThinPools {
+				if adjusted.Status.ThinPools[i].Name == storageClassLVGParametersMap[lvg.Name] {
+					adjusted.Status.ThinPools[i].AvailableSpace.Sub(*resource.NewQuantity(reserved, resource.BinarySI))
+					adjusted.Status.ThinPools[i].AllocatedSize.Add(*resource.NewQuantity(reserved, resource.BinarySI))
+				}
+			}
+		} else {
+			adjusted.Status.VGFree.Sub(*resource.NewQuantity(reserved, resource.BinarySI))
+		}
+		result = append(result, *adjusted)
+	}
+
+	return result
+}
+
+// ReserveCapacity reserves the space for the volume in the LVMVolumeGroup (or its thin pool) if the free space left
+// after the other reservations is enough. Returns the storage pool the space is reserved in or an empty string if
+// there is not enough space.
+func ReserveCapacity(
+	reservations *internal.CapacityReservations,
+	lvg snc.LVMVolumeGroup,
+	storageClassLVGParametersMap map[string]string,
+	lvmType, volumeID string,
+	size resource.Quantity,
+) (string, error) {
+	freeSpace, err := getLVGFreeSpace(lvg, storageClassLVGParametersMap, lvmType)
+	if err != nil {
+		return "", err
+	}
+
+	pool := GetReservationPool(lvg.Name, storageClassLVGParametersMap, lvmType)
+	if !reservations.Reserve(pool, volumeID, size.Value(), freeSpace.Value()) {
+		return "", nil
+	}
+
+	return pool, nil
+}
+
+// ParseOverprovisioningFactor parses the thin pool overprovisioning factor from the StorageClass parameters.
+// Returns 0 if the factor is not set, which means the oversubscription is not limited by the StorageClass.
+func ParseOverprovisioningFactor(parameters map[string]string) (float64, error) {
+	value, ok := parameters[internal.ThinOverprovisioningKey]
+	if !ok || value == "" {
+		return 0, nil
+	}
+
+	factor, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s: %w", internal.ThinOverprovisioningKey, err)
+	}
+
+	if factor < 1 {
+		return 0, fmt.Errorf("%s must not be less than 1, got %s", internal.ThinOverprovisioningKey, value)
+	}
+
+	return factor, nil
+}
+
+// ParseMaxSize parses the maximum volume size from the StorageClass parameters.
+// Returns 0 if the size is not set, which means the volume size is limited only by the free space.
+func ParseMaxSize(parameters map[string]string) (int64, error) {
+	value, ok := parameters[internal.MaxSizeKey]
+	if !ok || value == "" {
+		return 0, nil
+	}
+
+	size, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s: %w", internal.MaxSizeKey, err)
+	}
+
+	if size.Sign() <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %s", internal.MaxSizeKey, value)
+	}
+
+	return size.Value(), nil
+}
+
+// ParseQuota parses the maximum total size of the volumes of the StorageClass from its parameters.
+// Returns 0 if the quota is not set.
+func ParseQuota(parameters map[string]string) (int64, error) {
+	value, ok := parameters[internal.QuotaMaxTotalSizeKey]
+	if !ok || value == "" {
+		return 0, nil
+	}
+
+	size, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s: %w", internal.QuotaMaxTotalSizeKey, err)
+	}
+
+	if size.Sign() <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %s", internal.QuotaMaxTotalSizeKey, value)
+	}
+
+	return size.Value(), nil
+}
+
+// NamespaceFilter limits the namespaces the volumes of a StorageClass might be provisioned for: a namespace is allowed
+// if it is listed by its name or matches the selector.
+type NamespaceFilter struct {
+	Names []string
+	// Selector is nil if the namespaces are listed by their names only
+	Selector labels.Selector
+}
+
+// ParseNamespaceFilter parses the allowed namespaces from the StorageClass parameters. The blank names of the list
+// are skipped. Returns nil if the namespaces are not limited.
+func ParseNamespaceFilter(parameters map[string]string) (*NamespaceFilter, error) {
+	var names []string
+	for _, name := range strings.Split(parameters[internal.AllowedNamespacesKey], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	selector := strings.TrimSpace(parameters[internal.AllowedNSSelectorKey])
+	if len(names) == 0 && selector == "" {
+		return nil, nil
+	}
+
+	filter := &NamespaceFilter{Names: names}
+	if selector != "" {
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", internal.AllowedNSSelectorKey, err)
+		}
+		filter.Selector = s
+	}
+
+	return filter, nil
+}
+
+// IsNamespaceAllowed reports if the volumes of the StorageClass might be provisioned for the namespace. The namespace
+// is got for its labels only if it is not listed by its name.
+func IsNamespaceAllowed(ctx context.Context, kc client.Client, filter *NamespaceFilter, namespace string) (bool, error) {
+	if slices.Contains(filter.Names, namespace) {
+		return true, nil
+	}
+	if filter.Selector == nil {
+		return false, nil
+	}
+
+	ns := &corev1.Namespace{}
+	err := kc.Get(ctx, client.ObjectKey{Name: namespace}, ns)
+	if err != nil {
+		return false, fmt.Errorf("unable to get the namespace %s: %w", namespace, err)
+	}
+
+	return filter.Selector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// GetPVCStorageClassName returns the StorageClass of the PVC the volume is provisioned for. The PVC is known only if
+// the external-provisioner passes its name in the parameters.
+func GetPVCStorageClassName(ctx context.Context, kc client.Client, params map[string]string) (string, error) {
+	pvcName, pvcNamespace := params[internal.PVCNameKey], params[internal.PVCNamespaceKey]
+	if pvcName == "" || pvcNamespace == "" {
+		return "", nil
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := kc.Get(ctx, client.ObjectKey{Name: pvcName, Namespace: pvcNamespace}, pvc)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the PersistentVolumeClaim %s/%s: %w", pvcNamespace, pvcName, err)
+	}
+	if pvc.Spec.StorageClassName == nil {
+		return "", nil
+	}
+
+	return *pvc.Spec.StorageClassName, nil
+}
+
+// PVStorageClassIndex is the name of the field index of the PersistentVolumes by their StorageClasses.
+const PVStorageClassIndex = "spec.storageClassName"
+
+// IndexPVStorageClass returns the StorageClass of the PersistentVolume for the PVStorageClassIndex.
+func IndexPVStorageClass(obj client.Object) []string {
+	pv, ok := obj.(*corev1.PersistentVolume)
+	if !ok || pv.Spec.StorageClassName == "" {
+		return nil
+	}
+
+	return []string{pv.Spec.StorageClassName}
+}
+
+// AddPVStorageClassIndex adds the PVStorageClassIndex to the PersistentVolumes of the cache.
+func AddPVStorageClassIndex(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &corev1.PersistentVolume{}, PVStorageClassIndex, IndexPVStorageClass)
+}
+
+// GetStorageClassProvisionedSize returns the total size of the volumes of the driver provisioned from the StorageClass:
+// the capacity of its PersistentVolumes and the size of the LVMLogicalVolumes being provisioned for it, whose
+// PersistentVolumes do not exist yet. It also returns the IDs of the counted volumes. The PersistentVolumes are listed
+// by the PVStorageClassIndex, so the reader must have it.
+func GetStorageClassProvisionedSize(ctx context.Context, reader client.Reader, driverName, storageClassName string) (int64, map[string]struct{}, error) {
+	pvs := &corev1.PersistentVolumeList{}
+	err := reader.List(ctx, pvs, client.MatchingFields{PVStorageClassIndex: storageClassName})
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to list the PersistentVolumes: %w", err)
+	}
+
+	var total int64
+	counted := make(map[string]struct{}, len(pvs.Items))
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+			continue
+		}
+		counted[pv.Spec.CSI.VolumeHandle] = struct{}{}
+		total += pv.Spec.Capacity.Storage().Value()
+	}
+
+	llvs := &snc.LVMLogicalVolumeList{}
+	err = reader.List(ctx, llvs, client.MatchingLabels{internal.LLVStorageClassKey: storageClassName})
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to list the LVMLogicalVolumes: %w", err)
+	}
+	for _, llv := range llvs.Items {
+		if _, ok := counted[llv.Name]; ok {
+			continue
+		}
+
+		size, err := resource.ParseQuantity(llv.Spec.Size)
+		if err != nil {
+			return 0, nil, fmt.Errorf("unable to parse the size %s of the LVMLogicalVolume %s: %w", llv.Spec.Size, llv.Name, err)
+		}
+		counted[llv.Name] = struct{}{}
+		total += size.Value()
+	}
+
+	return total, counted, nil
+}
+
+// GetDiscardPolicy returns the discard policy of the volume from the StorageClass parameters or the volume context.
+func GetDiscardPolicy(parameters map[string]string) (string, error) {
+	switch policy := parameters[internal.DiscardPolicyKey]; policy {
+	case "":
+		return internal.DiscardPolicyNone, nil
+	case internal.DiscardPolicyNone, internal.DiscardPolicyMount, internal.DiscardPolicyFstrim:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("discard policy must be one of %s, %s or %s, got %q", internal.DiscardPolicyNone, internal.DiscardPolicyMount, internal.DiscardPolicyFstrim, policy)
+	}
+}
+
+// GetXFSDuplicateUUIDPolicy returns the handling of the XFS filesystem of the volume with the same UUID as a mounted one
+// from the StorageClass parameters or the volume context. Such a filesystem is mounted with the nouuid option by default.
+func GetXFSDuplicateUUIDPolicy(parameters map[string]string) (string, error) {
+	switch policy := parameters[internal.XFSDuplicateUUIDKey]; policy {
+	case "":
+		return internal.XFSDuplicateUUIDNouuid, nil
+	case internal.XFSDuplicateUUIDNouuid, internal.XFSDuplicateUUIDRegenerate:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%s must be %s or %s, got %q", internal.XFSDuplicateUUIDKey, internal.XFSDuplicateUUIDNouuid, internal.XFSDuplicateUUIDRegenerate, policy)
+	}
+}
+
+// GetFSGroupChangePolicy returns the policy of the change of the volume ownership to the fsGroup of a Pod
+// from the StorageClass parameters or the volume context. The ownership is changed on the root mismatch by default.
+func GetFSGroupChangePolicy(parameters map[string]string) (string, error) {
+	switch policy := parameters[internal.FSGroupChangePolicyKey]; policy {
+	case "":
+		return internal.FSGroupChangePolicyOnRootMismatch, nil
+	case internal.FSGroupChangePolicyAlways, internal.FSGroupChangePolicyOnRootMismatch:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%s must be %s or %s, got %q", internal.FSGroupChangePolicyKey, internal.FSGroupChangePolicyAlways, internal.FSGroupChangePolicyOnRootMismatch, policy)
+	}
+}
+
+// GetSecureErase returns the secure erase of the released volume from the StorageClass parameters or the volume
+// context. An empty string means the volume is not erased.
+func GetSecureErase(parameters map[string]string) (string, error) {
+	switch erase := parameters[internal.SecureEraseKey]; erase {
+	case "", internal.SecureEraseDiscard, internal.SecureEraseZero:
+		return erase, nil
+	default:
+		return "", fmt.Errorf("%s must be %s or %s, got %q", internal.SecureEraseKey, internal.SecureEraseDiscard, internal.SecureEraseZero, erase)
+	}
+}
+
+// ValidateUnmountEscalation checks that the escalation of the unstage unmount is one of the supported ones.
+func ValidateUnmountEscalation(escalation string) error {
+	switch escalation {
+	case internal.UnmountEscalationLazy, internal.UnmountEscalationForce:
+		return nil
+	default:
+		return fmt.Errorf("unmount escalation must be %s or %s, got %q", internal.UnmountEscalationLazy, internal.UnmountEscalationForce, escalation)
+	}
+}
+
+// IsForceFormat reports whether the device of the volume is formatted even if it bears a foreign signature or does not
+// match the VG and LV of the volume.
+func IsForceFormat(parameters map[string]string) (bool, error) {
+	value, ok := parameters[internal.ForceFormatKey]
+	if !ok {
+		return false, nil
+	}
+
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", internal.ForceFormatKey, value, err)
+	}
+
+	return force, nil
+}
+
+// ValidateFsckPolicy checks that the policy is one of the supported ones.
+func ValidateFsckPolicy(policy string) error {
+	switch policy {
+	case internal.FsckPolicyNone, internal.FsckPolicyCheck, internal.FsckPolicyRepair:
+		return nil
+	default:
+		return fmt.Errorf("fsck policy must be one of %s, %s or %s, got %q", internal.FsckPolicyNone, internal.FsckPolicyCheck, internal.FsckPolicyRepair, policy)
+	}
+}
+
+// GetFsckPolicy returns the fsck policy of the volume from the StorageClass parameters or the volume context,
+// or the default one of the node plugin if it is not set.
+func GetFsckPolicy(parameters map[string]string, defaultPolicy string) (string, error) {
+	policy, ok := parameters[internal.FsckPolicyKey]
+	if !ok {
+		return defaultPolicy, nil
+	}
+
+	return policy, ValidateFsckPolicy(policy)
+}
+
+// ParseMkfsOptions parses the extra options of mkfs from the StorageClass parameters. The options are separated by
+// whitespaces, e.g. "-i 8192 -E lazy_itable_init=0". The device is always passed to mkfs by the node service,
+// so no paths are allowed among the options.
+func ParseMkfsOptions(parameters map[string]string) ([]string, error) {
+	options := strings.Fields(parameters[internal.MkfsOptionsKey])
+	for _, option := range options {
+		if strings.HasPrefix(option, "/") {
+			return nil, fmt.Errorf("%s must not contain paths, got %s", internal.MkfsOptionsKey, option)
+		}
+	}
+
+	return options, nil
+}
+
+// fsLabelMaxLength is the longest label of the filesystems supported by their mkfs.
+var fsLabelMaxLength = map[string]int{
+	internal.FSTypeExt4:  16,
+	internal.FSTypeXfs:   12,
+	internal.FSTypeBtrfs: 255,
+}
+
+// GetFSLabel returns the label of the volume's filesystem: the <namespace>/<name> of the PVC passed by
+// the external-provisioner, truncated to the longest label of the filesystem. It is empty if the PVC is unknown.
+func GetFSLabel(parameters map[string]string, fsType string) string {
+	pvcName, pvcNamespace := parameters[internal.PVCNameKey], parameters[internal.PVCNamespaceKey]
+	maxLength, ok := fsLabelMaxLength[fsType]
+	if pvcName == "" || pvcNamespace == "" || !ok {
+		return ""
+	}
+
+	label := pvcNamespace + "/" + pvcName
+	if len(label) > maxLength {
+		label = label[:maxLength]
+	}
+
+	return label
+}
+
+// GetExt4Options returns the mkfs.ext4 options of the ext4 tuning StorageClass parameters: the percentage of the blocks
+// reserved for root, the initialization of the inode tables and the journal at the mkfs time instead of in the
+// background after the mount, and the bigalloc cluster size. The options set explicitly with the mkfs options
+// parameter follow these ones, so they take precedence.
+func GetExt4Options(parameters map[string]string) ([]string, error) {
+	var options []string
+
+	if value, ok := parameters[internal.Ext4ReservedBlocksKey]; ok {
+		percent, err := strconv.ParseFloat(value, 64)
+		if err != nil || percent < 0 || percent > 50 {
+			return nil, fmt.Errorf("%s must be a number from 0 to 50, got %q", internal.Ext4ReservedBlocksKey, value)
+		}
+		options = append(options, "-m", value)
+	}
+
+	if value, ok := parameters[internal.Ext4LazyInitKey]; ok {
+		lazyInit, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a boolean, got %q", internal.Ext4LazyInitKey, value)
+		}
+		if !lazyInit {
+			options = append(options, "-E", "lazy_itable_init=0,lazy_journal_init=0")
+		}
+	}
+
+	if value, ok := parameters[internal.Ext4BigallocClusterSizeKey]; ok {
+		clusterSize, err := resource.ParseQuantity(value)
+		minClusterSize := resource.MustParse(internal.Ext4MinBigallocClusterSize)
+		if err != nil || clusterSize.Cmp(minClusterSize) < 0 || clusterSize.Value()&(clusterSize.Value()-1) != 0 {
+			return nil, fmt.Errorf("%s must be a power of two not less than %s, got %q", internal.Ext4BigallocClusterSizeKey, internal.Ext4MinBigallocClusterSize, value)
+		}
+		options = append(options, "-O", "bigalloc", "-C", strconv.FormatInt(clusterSize.Value(), 10))
+	}
+
+	return options, nil
+}
+
+// ExceedsOverprovisioningFactor reports whether the allocated size of the thin pool would exceed its size multiplied
+// by the factor after the volume of the requested size is created.
+func ExceedsOverprovisioningFactor(lvg snc.LVMVolumeGroup, thinPoolName string, requiredSize resource.Quantity, factor float64) (bool, error) {
+	for _, tp := range lvg.Status.ThinPools {
+		if tp.Name != thinPoolName {
+			continue
+		}
+
+		allocated := tp.AllocatedSize.Value() + requiredSize.Value()
+		return float64(allocated) > factor*float64(tp.ActualSize.Value()), nil
+	}
+
+	return false, fmt.Errorf("[ExceedsOverprovisioningFactor] thin pool %s not found in lvg %s", thinPoolName, lvg.Name)
+}
+
+// RoundUpToExtentSize rounds the size up to the multiple of the extent size.
+func RoundUpToExtentSize(size resource.Quantity, extentSize string) (*resource.Quantity, error) {
+	extent, err := resource.ParseQuantity(extentSize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the extent size %s: %w", extentSize, err)
+	}
+
+	extents := (size.Value() + extent.Value() - 1) / extent.Value()
+	return resource.NewQuantity(extents*extent.Value(), resource.BinarySI), nil
+}
+
+// ValidateOnDeletePolicy checks that the policy is one of the supported ones.
+func ValidateOnDeletePolicy(policy string) error {
+	switch policy {
+	case internal.OnDeletePolicyDelete,
+		internal.OnDeletePolicyRetain:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported on-delete policy %q, must be one of: %s, %s",
+		policy,
+		internal.OnDeletePolicyDelete,
+		internal.OnDeletePolicyRetain,
+	)
+}
+
+// ValidateLVGSelectionPolicy checks that the policy is one of the supported ones.
+func ValidateLVGSelectionPolicy(policy string) error {
+	switch policy {
+	case internal.LVGSelectionPolicyFreeSpace,
+		internal.LVGSelectionPolicyPriority,
+		internal.LVGSelectionPolicyType:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported LVMVolumeGroup selection policy %q, must be one of: %s, %s, %s",
+		policy,
+		internal.LVGSelectionPolicyFreeSpace,
+		internal.LVGSelectionPolicyPriority,
+		internal.LVGSelectionPolicyType,
+	)
+}
+
+// GetStorageClassLVGPriorities returns the priorities of the LVMVolumeGroups from the StorageClass parameters.
+func GetStorageClassLVGPriorities(storageClassLVGParametersString string) (map[string]int, error) {
+	var storageClassLVGParametersList LVMVolumeGroups
+	err := yaml.Unmarshal([]byte(storageClassLVGParametersString), &storageClassLVGParametersList)
+	if err != nil {
+		return nil, err
+	}
+
+	priorities := make(map[string]int, len(storageClassLVGParametersList))
+	for _, v := range storageClassLVGParametersList {
+		priorities[v.Name] = v.Priority
+	}
+
+	return priorities, nil
+}
+
+// SelectLVG selects the LVMVolumeGroup on the node. If there are several ones, the LVMVolumeGroups with enough free
+// space are preferred and ordered by the policy. The returned reason describes the decision.
+func SelectLVG(
+	storageClassLVGs []snc.LVMVolumeGroup,
+	nodeName string,
+	storageClassLVGParametersMap map[string]string,
+	priorities map[string]int,
+	lvmType string,
+	requiredSize resource.Quantity,
+	policy string,
+) (*snc.LVMVolumeGroup, string, error) {
+	type candidate struct {
+		lvg       *snc.LVMVolumeGroup
+		freeSpace resource.Quantity
+		fits      bool
+		priority  int
+		typeMatch bool
+	}
+
+	candidates := make([]candidate, 0, len(storageClassLVGs))
 	for i := 0; i < len(storageClassLVGs); i++ {
-		if storageClassLVGs[i].Status.Nodes[0].Name == nodeName {
-			return &storageClassLVGs[i], nil
+		lvg := &storageClassLVGs[i]
+		if len(lvg.Status.Nodes) == 0 || lvg.Status.Nodes[0].Name != nodeName {
+			continue
+		}
+
+		freeSpace, err := getLVGFreeSpace(*lvg, storageClassLVGParametersMap, lvmType)
+		if err != nil {
+			return nil, "", fmt.Errorf("[SelectLVG] %w", err)
+		}
+
+		candidates = append(candidates, candidate{
+			lvg:       lvg,
+			freeSpace: freeSpace,
+			fits:      freeSpace.Cmp(requiredSize) >= 0,
+			priority:  priorities[lvg.Name],
+			typeMatch: isLVGLayoutMatchesType(*lvg, storageClassLVGParametersMap[lvg.Name], lvmType),
+		})
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, "", fmt.Errorf("[SelectLVG] no LVMVolumeGroup found for node %s", nodeName)
+	case 1:
+		return candidates[0].lvg, "the only LVMVolumeGroup on the node", nil
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		if a.fits != b.fits {
+			if a.fits {
+				return -1
+			}
+			return 1
+		}
+
+		switch policy {
+		case internal.LVGSelectionPolicyPriority:
+			if a.priority != b.priority {
+				return b.priority - a.priority
+			}
+		case internal.LVGSelectionPolicyType:
+			if a.typeMatch != b.typeMatch {
+				if a.typeMatch {
+					return -1
+				}
+				return 1
+			}
+		}
+
+		if c := b.freeSpace.Cmp(a.freeSpace); c != 0 {
+			return c
 		}
+
+		return strings.Compare(a.lvg.Name, b.lvg.Name)
+	})
+
+	selected := candidates[0]
+	reason := fmt.Sprintf("selected by the %s policy among %d LVMVolumeGroups on the node: priority %d, free space %s, enough space %t, type match %t",
+		policy, len(candidates), selected.priority, selected.freeSpace.String(), selected.fits, selected.typeMatch)
+
+	return selected.lvg, reason, nil
+}
+
+// isLVGLayoutMatchesType reports whether the LVMVolumeGroup is dedicated to the volume type: Thin volumes prefer
+// a ready thin pool, Thick ones prefer LVMVolumeGroups without thin pools.
+func isLVGLayoutMatchesType(lvg snc.LVMVolumeGroup, thinPoolName, lvmType string) bool {
+	if lvmType != internal.LVMTypeThin {
+		return len(lvg.Status.ThinPools) == 0
 	}
-	return nil, fmt.Errorf("[SelectLVG] no LVMVolumeGroup found for node %s", nodeName)
+
+	for _, tp := range lvg.Status.ThinPools {
+		if tp.Name == thinPoolName {
+			return tp.Ready
+		}
+	}
+
+	return false
 }
 
 func SelectLVGByName(storageClassLVGs []snc.LVMVolumeGroup, name string) (*snc.LVMVolumeGroup, error) {
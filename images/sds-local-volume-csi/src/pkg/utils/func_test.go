@@ -0,0 +1,905 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/staticvolume"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sds-local-volume-csi/internal"
+	"sds-local-volume-csi/pkg/logger"
+)
+
+func newTestLVG(name, node, free string) snc.LVMVolumeGroup {
+	return snc.LVMVolumeGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: snc.LVMVolumeGroupStatus{
+			Nodes:  []snc.LVMVolumeGroupNode{{Name: node}},
+			VGFree: resource.MustParse(free),
+		},
+	}
+}
+
+func TestGetTopologyNodes(t *testing.T) {
+	t.Run("nil_requirement_returns_nil", func(t *testing.T) {
+		assert.Nil(t, GetTopologyNodes(nil, nil))
+	})
+
+	t.Run("preferred_first_then_requisite_without_duplicates", func(t *testing.T) {
+		topology := func(node string) *csi.Topology {
+			return &csi.Topology{Segments: map[string]string{internal.TopologyKey: node}}
+		}
+		requirement := &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{topology("node-1"), topology("node-2"), topology("node-3")},
+			Preferred: []*csi.Topology{topology("node-2"), topology("node-1")},
+		}
+
+		assert.Equal(t, []string{"node-2", "node-1", "node-3"}, GetTopologyNodes(requirement, nil))
+	})
+
+	t.Run("zone_topology_resolved_by_node_labels", func(t *testing.T) {
+		const zoneKey = "topology.kubernetes.io/zone"
+		node := func(name, zone string) corev1.Node {
+			return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zoneKey: zone}}}
+		}
+		nodes := []corev1.Node{node("node-1", "a"), node("node-2", "b"), node("node-3", "a")}
+		requirement := &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{{Segments: map[string]string{zoneKey: "a"}}},
+			Preferred: []*csi.Topology{{Segments: map[string]string{internal.TopologyKey: "node-3", zoneKey: "a"}}},
+		}
+
+		assert.Equal(t, []string{"node-3", "node-1"}, GetTopologyNodes(requirement, nodes))
+
+		lvgs := []snc.LVMVolumeGroup{newTestLVG("lvg-1", "node-1", "1Gi"), newTestLVG("lvg-2", "node-2", "1Gi")}
+		filtered := FilterLVGsByRequisiteTopology(lvgs, requirement, nodes)
+		if assert.Len(t, filtered, 1) {
+			assert.Equal(t, "lvg-1", filtered[0].Name)
+		}
+	})
+}
+
+func TestSelectLVG(t *testing.T) {
+	lvgs := []snc.LVMVolumeGroup{
+		newTestLVG("lvg-small", "node-1", "1Gi"),
+		newTestLVG("lvg-big", "node-1", "10Gi"),
+		newTestLVG("lvg-other", "node-2", "100Gi"),
+	}
+	params := map[string]string{"lvg-small": "", "lvg-big": "", "lvg-other": ""}
+
+	t.Run("free_space_policy_selects_the_biggest", func(t *testing.T) {
+		lvg, _, err := SelectLVG(lvgs, "node-1", params, nil, internal.LVMTypeThick, resource.MustParse("512Mi"), internal.LVGSelectionPolicyFreeSpace)
+		assert.NoError(t, err)
+		assert.Equal(t, "lvg-big", lvg.Name)
+	})
+
+	t.Run("priority_policy_selects_the_highest_priority_with_enough_space", func(t *testing.T) {
+		priorities := map[string]int{"lvg-small": 10, "lvg-big": 1}
+
+		lvg, _, err := SelectLVG(lvgs, "node-1", params, priorities, internal.LVMTypeThick, resource.MustParse("512Mi"), internal.LVGSelectionPolicyPriority)
+		assert.NoError(t, err)
+		assert.Equal(t, "lvg-small", lvg.Name)
+
+		lvg, _, err = SelectLVG(lvgs, "node-1", params, priorities, internal.LVMTypeThick, resource.MustParse("2Gi"), internal.LVGSelectionPolicyPriority)
+		assert.NoError(t, err)
+		assert.Equal(t, "lvg-big", lvg.Name)
+	})
+
+	t.Run("no_lvg_on_the_node_returns_error", func(t *testing.T) {
+		_, _, err := SelectLVG(lvgs, "node-3", params, nil, internal.LVMTypeThick, resource.MustParse("1Gi"), internal.LVGSelectionPolicyFreeSpace)
+		assert.Error(t, err)
+	})
+}
+
+func TestExceedsOverprovisioningFactor(t *testing.T) {
+	lvg := newTestLVG("lvg", "node-1", "0")
+	lvg.Status.ThinPools = []snc.LVMVolumeGroupThinPoolStatus{
+		{
+			Name:          "tp",
+			ActualSize:    resource.MustParse("10Gi"),
+			AllocatedSize: resource.MustParse("12Gi"),
+		},
+	}
+
+	exceeds, err := ExceedsOverprovisioningFactor(lvg, "tp", resource.MustParse("3Gi"), 1.5)
+	assert.NoError(t, err)
+	assert.False(t, exceeds)
+
+	exceeds, err = ExceedsOverprovisioningFactor(lvg, "tp", resource.MustParse("4Gi"), 1.5)
+	assert.NoError(t, err)
+	assert.True(t, exceeds)
+
+	_, err = ExceedsOverprovisioningFactor(lvg, "unknown", resource.MustParse("1Gi"), 1.5)
+	assert.Error(t, err)
+}
+
+func TestRoundUpToExtentSize(t *testing.T) {
+	testCases := map[string]string{
+		"0":     "0",
+		"1":     "4Mi",
+		"4Mi":   "4Mi",
+		"5Mi":   "8Mi",
+		"1G":    "956Mi",
+		"100Mi": "100Mi",
+	}
+
+	for size, expected := range testCases {
+		rounded, err := RoundUpToExtentSize(resource.MustParse(size), internal.LVMExtentSize)
+		expectedSize := resource.MustParse(expected)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedSize.Value(), rounded.Value(), size)
+	}
+}
+
+func TestGetVolumeOwnerMetadata(t *testing.T) {
+	longName := strings.Repeat("a", 100)
+	labels, annotations := GetVolumeOwnerMetadata(map[string]string{
+		internal.PVCNameKey:      longName,
+		internal.PVCNamespaceKey: "default",
+		internal.PVNameKey:       "pvc-1",
+		internal.TypeKey:         internal.Lvm,
+	})
+
+	assert.Equal(t, map[string]string{
+		internal.LLVPVCNameKey:      longName,
+		internal.LLVPVCNamespaceKey: "default",
+		internal.LLVPVNameKey:       "pvc-1",
+	}, annotations)
+	assert.Equal(t, map[string]string{
+		internal.LLVPVCNamespaceKey: "default",
+		internal.LLVPVNameKey:       "pvc-1",
+	}, labels)
+
+	labels, annotations = GetVolumeOwnerMetadata(map[string]string{})
+	assert.Empty(t, labels)
+	assert.Empty(t, annotations)
+}
+
+func TestGetWaitOptions(t *testing.T) {
+	defaults := WaitOptions{ResizeDelta: resource.MustParse("32Mi"), Timeout: 5 * time.Minute}
+
+	opts, err := GetWaitOptions(map[string]string{}, defaults)
+	assert.NoError(t, err)
+	assert.Equal(t, defaults, opts)
+
+	opts, err = GetWaitOptions(map[string]string{
+		internal.ResizeDeltaKey: "128Mi",
+		internal.WaitTimeoutKey: "20m",
+	}, defaults)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(128*1024*1024), opts.ResizeDelta.Value())
+		assert.Equal(t, 20*time.Minute, opts.Timeout)
+	}
+
+	_, err = GetWaitOptions(map[string]string{internal.WaitTimeoutKey: "0s"}, defaults)
+	assert.Error(t, err)
+
+	_, err = GetWaitOptions(map[string]string{internal.ResizeDeltaKey: "-1Mi"}, defaults)
+	assert.Error(t, err)
+}
+
+func TestStaticVolumeHandle(t *testing.T) {
+	llvName := LLVNameForVolume("data/lv_01")
+	assert.Equal(t, staticvolume.LLVName("data", "lv_01"), llvName)
+	assert.Equal(t, "pvc-1", LLVNameForVolume("pvc-1"))
+
+	devPath, err := GetVolumeDevicePath("data/lv_01", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/data/lv_01", devPath)
+
+	devPath, err = GetVolumeDevicePath("pvc-1", map[string]string{internal.VGNameKey: "vg"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/vg/pvc-1", devPath)
+
+	devPath, err = GetVolumeDevicePath("pvc-1", map[string]string{internal.VGNameKey: "vg", internal.LVNameKey: "old"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/vg/old", devPath)
+
+	_, err = GetVolumeDevicePath("pvc-1", map[string]string{})
+	assert.Error(t, err)
+
+	devPath, err = GetVolumeDevicePath("pvc-1", map[string]string{internal.TypeKey: internal.RawType, internal.RawDevicePathKey: "/dev/sdb"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/sdb", devPath)
+
+	_, err = GetVolumeDevicePath("pvc-1", map[string]string{internal.TypeKey: internal.RawType, internal.VGNameKey: "vg"})
+	assert.Error(t, err)
+}
+
+func TestGetMountVolumeContext(t *testing.T) {
+	capabilities := []*csi.VolumeCapability{
+		{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{
+			FsType:     "XFS",
+			MountFlags: []string{"noatime", `context="system_u:object_r:container_file_t:s0:c1,c2"`},
+		}}},
+	}
+
+	volumeCtx, err := GetMountVolumeContext(capabilities)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "xfs", volumeCtx[internal.FSTypeContextKey])
+
+		flags, err := GetMountFlagsFromContext(volumeCtx)
+		assert.NoError(t, err)
+		assert.Equal(t, capabilities[0].GetMount().GetMountFlags(), flags)
+	}
+
+	volumeCtx, err = GetMountVolumeContext([]*csi.VolumeCapability{
+		{AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, volumeCtx)
+
+	_, err = GetMountFlagsFromContext(map[string]string{internal.MountFlagsContextKey: "noatime"})
+	assert.Error(t, err)
+}
+
+func TestGetSnapshotOptions(t *testing.T) {
+	opts, err := GetSnapshotOptions(map[string]string{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, SnapshotOptions{SizePercent: 100}, opts)
+	}
+
+	opts, err = GetSnapshotOptions(map[string]string{
+		internal.SnapshotSizePercentKey: "25",
+		internal.SnapshotThinPoolKey:    "pool",
+		internal.SnapshotFSFreezeKey:    "true",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, SnapshotOptions{SizePercent: 25, ThinPoolName: "pool", FSFreeze: true}, opts)
+		required := opts.RequiredSpace(resource.MustParse("10Gi"))
+		assert.Equal(t, int64(2560*1024*1024), required.Value())
+	}
+
+	for _, params := range []map[string]string{
+		{internal.SnapshotSizePercentKey: "0"},
+		{internal.SnapshotSizePercentKey: "101"},
+		{internal.SnapshotSizePercentKey: "half"},
+		{internal.SnapshotFSFreezeKey: "sometimes"},
+	} {
+		_, err = GetSnapshotOptions(params)
+		assert.Error(t, err, params)
+	}
+}
+
+func TestGetLLVSnapshotNames(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := snc.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	newSnapshot := func(name, llvName string) *snc.LVMLogicalVolumeSnapshot {
+		return &snc.LVMLogicalVolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       snc.LVMLogicalVolumeSnapshotSpec{LVMLogicalVolumeName: llvName},
+		}
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newSnapshot("snap-b", "pvc-1"),
+		newSnapshot("snap-a", "pvc-1"),
+		newSnapshot("snap-c", "pvc-2"),
+	).Build()
+
+	names, err := GetLLVSnapshotNames(context.Background(), cl, "pvc-1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"snap-a", "snap-b"}, names)
+	}
+
+	names, err = GetLLVSnapshotNames(context.Background(), cl, "pvc-3")
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestGetLVGNodeName(t *testing.T) {
+	lvg := newTestLVG("lvg-1", "node-status", "1Gi")
+	assert.Equal(t, "node-status", GetLVGNodeName(lvg))
+
+	lvg.Spec.Local.NodeName = "node-spec"
+	assert.Equal(t, "node-spec", GetLVGNodeName(lvg))
+
+	assert.Empty(t, GetLVGNodeName(snc.LVMVolumeGroup{}))
+}
+
+func TestParseMaxSize(t *testing.T) {
+	size, err := ParseMaxSize(map[string]string{})
+	assert.NoError(t, err)
+	assert.Zero(t, size)
+
+	size, err = ParseMaxSize(map[string]string{internal.MaxSizeKey: "100Gi"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100*1024*1024*1024), size)
+
+	for _, value := range []string{"0", "-1Gi", "big"} {
+		_, err = ParseMaxSize(map[string]string{internal.MaxSizeKey: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseQuota(t *testing.T) {
+	size, err := ParseQuota(map[string]string{})
+	assert.NoError(t, err)
+	assert.Zero(t, size)
+
+	size, err = ParseQuota(map[string]string{internal.QuotaMaxTotalSizeKey: "1Ti"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024*1024*1024*1024), size)
+
+	for _, value := range []string{"0", "-1Gi", "big"} {
+		_, err = ParseQuota(map[string]string{internal.QuotaMaxTotalSizeKey: value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestGetStorageClassProvisionedSize(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := snc.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	const driverName = "local.csi.storage.deckhouse.io"
+	newPV := func(name, storageClassName, driver, size string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName: storageClassName,
+				Capacity:         corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: name},
+				},
+			},
+		}
+	}
+	newLLV := func(name, size string) *snc.LVMLogicalVolume {
+		return &snc.LVMLogicalVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{internal.LLVStorageClassKey: "sc-1"}},
+			Spec:       snc.LVMLogicalVolumeSpec{Size: size},
+		}
+	}
+	storageClassName := "sc-1"
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithIndex(&corev1.PersistentVolume{}, PVStorageClassIndex, IndexPVStorageClass).WithObjects(
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", Namespace: "default"},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &storageClassName},
+		},
+		newPV("pv-1", "sc-1", driverName, "10Gi"),
+		newPV("pv-2", "sc-1", "other.csi.storage.io", "10Gi"),
+		newPV("pv-3", "sc-2", driverName, "10Gi"),
+		newLLV("pv-1", "10Gi"),
+		newLLV("pv-4", "5Gi"),
+	).Build()
+
+	name, err := GetPVCStorageClassName(context.Background(), cl, map[string]string{internal.PVCNameKey: "pvc-1", internal.PVCNamespaceKey: "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, "sc-1", name)
+
+	name, err = GetPVCStorageClassName(context.Background(), cl, map[string]string{})
+	assert.NoError(t, err)
+	assert.Empty(t, name)
+
+	size, counted, err := GetStorageClassProvisionedSize(context.Background(), cl, driverName, "sc-3")
+	assert.NoError(t, err)
+	assert.Zero(t, size)
+	assert.Empty(t, counted)
+
+	// the volume being provisioned counts until its PV is created, the one having the PV is not counted twice
+	size, counted, err = GetStorageClassProvisionedSize(context.Background(), cl, driverName, "sc-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(15*1024*1024*1024), size)
+	assert.Equal(t, map[string]struct{}{"pv-1": {}, "pv-4": {}}, counted)
+}
+
+func TestNamespaceFilter(t *testing.T) {
+	filter, err := ParseNamespaceFilter(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, filter)
+
+	_, err = ParseNamespaceFilter(map[string]string{internal.AllowedNSSelectorKey: "tier in (premium"})
+	assert.Error(t, err)
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "premium", Labels: map[string]string{"tier": "premium"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "basic", Labels: map[string]string{"tier": "basic"}}},
+	).Build()
+
+	filter, err = ParseNamespaceFilter(map[string]string{internal.AllowedNamespacesKey: "tenant-a,tenant-b"})
+	assert.NoError(t, err)
+	for namespace, expected := range map[string]bool{"tenant-a": true, "tenant-b": true, "premium": false} {
+		allowed, err := IsNamespaceAllowed(context.Background(), cl, filter, namespace)
+		assert.NoError(t, err, namespace)
+		assert.Equal(t, expected, allowed, namespace)
+	}
+
+	filter, err = ParseNamespaceFilter(map[string]string{internal.AllowedNamespacesKey: " , "})
+	assert.NoError(t, err)
+	assert.Nil(t, filter)
+
+	filter, err = ParseNamespaceFilter(map[string]string{internal.AllowedNamespacesKey: " tenant-a,, tenant-b ,"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenant-a", "tenant-b"}, filter.Names)
+
+	filter, err = ParseNamespaceFilter(map[string]string{internal.AllowedNamespacesKey: "tenant-a", internal.AllowedNSSelectorKey: "tier=premium"})
+	assert.NoError(t, err)
+	for namespace, expected := range map[string]bool{"tenant-a": true, "premium": true, "basic": false} {
+		allowed, err := IsNamespaceAllowed(context.Background(), cl, filter, namespace)
+		assert.NoError(t, err, namespace)
+		assert.Equal(t, expected, allowed, namespace)
+	}
+
+	// the unlisted namespace is got for its labels
+	_, err = IsNamespaceAllowed(context.Background(), cl, filter, "missing")
+	assert.Error(t, err)
+}
+
+func TestGetRequestedThinPool(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pvc-1",
+			Namespace:   "default",
+			Annotations: map[string]string{internal.ThinPoolKey: "pool-pvc"},
+		},
+	}).Build()
+	params := map[string]string{internal.PVCNameKey: "pvc-1", internal.PVCNamespaceKey: "default"}
+
+	pool, err := GetRequestedThinPool(context.Background(), cl, params, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "pool-pvc", pool)
+
+	pool, err = GetRequestedThinPool(context.Background(), cl, params, map[string]string{internal.ThinPoolKey: "pool-vac"})
+	assert.NoError(t, err)
+	assert.Equal(t, "pool-vac", pool)
+
+	pool, err = GetRequestedThinPool(context.Background(), cl, map[string]string{}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, pool)
+
+	_, err = GetRequestedThinPool(context.Background(), cl, map[string]string{internal.PVCNameKey: "pvc-2", internal.PVCNamespaceKey: "default"}, nil)
+	assert.Error(t, err)
+}
+
+func TestOverrideThinPool(t *testing.T) {
+	lvg1 := newTestLVG("lvg-1", "node-1", "1Gi")
+	lvg1.Status.ThinPools = []snc.LVMVolumeGroupThinPoolStatus{{Name: "pool-a"}, {Name: "pool-b"}}
+	lvg2 := newTestLVG("lvg-2", "node-2", "1Gi")
+	lvg2.Status.ThinPools = []snc.LVMVolumeGroupThinPoolStatus{{Name: "pool-a"}}
+
+	lvgs, params := OverrideThinPool([]snc.LVMVolumeGroup{lvg1, lvg2}, "pool-b")
+	if assert.Len(t, lvgs, 1) {
+		assert.Equal(t, "lvg-1", lvgs[0].Name)
+	}
+	assert.Equal(t, map[string]string{"lvg-1": "pool-b"}, params)
+
+	lvgs, _ = OverrideThinPool([]snc.LVMVolumeGroup{lvg1, lvg2}, "pool-c")
+	assert.Empty(t, lvgs)
+}
+
+func TestAbortLVMLogicalVolume(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := snc.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&snc.LVMLogicalVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+	}).Build()
+	log, err := logger.NewLogger(logger.InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = AbortLVMLogicalVolume(context.Background(), cl, log, "trace", "pvc-1", context.DeadlineExceeded.Error())
+	if assert.NoError(t, err) {
+		llv, err := GetLVMLogicalVolume(context.Background(), cl, "pvc-1", "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, context.DeadlineExceeded.Error(), llv.Annotations[internal.AbortKey])
+		}
+	}
+
+	assert.Error(t, AbortLVMLogicalVolume(context.Background(), cl, log, "trace", "pvc-2", "canceled"))
+}
+
+func TestGetMinFSSize(t *testing.T) {
+	newMountCapability := func(fsType string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: fsType}},
+		}
+	}
+
+	assert.Equal(t, int64(300*1024*1024), GetMinFSSize([]*csi.VolumeCapability{newMountCapability("XFS")}))
+	assert.Equal(t, int64(109*1024*1024), GetMinFSSize([]*csi.VolumeCapability{newMountCapability("btrfs")}))
+	assert.Zero(t, GetMinFSSize([]*csi.VolumeCapability{newMountCapability("ext4")}))
+	assert.Zero(t, GetMinFSSize([]*csi.VolumeCapability{{AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}}}))
+}
+
+func TestParseMkfsOptions(t *testing.T) {
+	options, err := ParseMkfsOptions(map[string]string{})
+	assert.NoError(t, err)
+	assert.Empty(t, options)
+
+	options, err = ParseMkfsOptions(map[string]string{internal.MkfsOptionsKey: " -i 8192  -E lazy_itable_init=0 "})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-i", "8192", "-E", "lazy_itable_init=0"}, options)
+
+	_, err = ParseMkfsOptions(map[string]string{internal.MkfsOptionsKey: "-f /dev/sdb"})
+	assert.Error(t, err)
+}
+
+func TestEncryption(t *testing.T) {
+	encryption, err := ParseEncryption(map[string]string{})
+	assert.NoError(t, err)
+	assert.Empty(t, encryption)
+
+	encryption, err = ParseEncryption(map[string]string{internal.EncryptionKey: internal.EncryptionLUKS})
+	assert.NoError(t, err)
+	assert.Equal(t, internal.EncryptionLUKS, encryption)
+
+	_, err = ParseEncryption(map[string]string{internal.EncryptionKey: "aes"})
+	assert.Error(t, err)
+
+	assert.True(t, IsEncrypted(map[string]string{internal.EncryptionKey: internal.EncryptionLUKS}))
+	assert.False(t, IsEncrypted(map[string]string{}))
+
+	assert.NoError(t, CheckSourceEncryption(internal.EncryptionLUKS, map[string]string{internal.EncryptionKey: internal.EncryptionLUKS}))
+	assert.NoError(t, CheckSourceEncryption("", nil))
+	assert.Error(t, CheckSourceEncryption(internal.EncryptionLUKS, nil))
+	assert.Error(t, CheckSourceEncryption("", map[string]string{internal.EncryptionKey: internal.EncryptionLUKS}))
+
+	_, err = GetLUKSPassphrase(map[string]string{})
+	assert.Error(t, err)
+
+	newPassphrase, err := GetLUKSNewPassphrase(map[string]string{internal.LUKSNewPassphraseKey: "new"})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", newPassphrase)
+
+	namespace, name, err := ParseSecretRef("default/luks-keys")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "default", namespace)
+		assert.Equal(t, "luks-keys", name)
+	}
+	for _, ref := range []string{"luks-keys", "/luks-keys", "default/", "default/luks/keys"} {
+		_, _, err = ParseSecretRef(ref)
+		assert.Error(t, err, ref)
+	}
+
+	assert.Equal(t, "/dev/mapper/luks-pvc-1", LUKSDevicePath("pvc-1"))
+	assert.Equal(t, "luks-"+staticvolume.LLVName("data", "lv"), LUKSMapperName("data/lv"))
+}
+
+func TestGetFSLabel(t *testing.T) {
+	params := map[string]string{
+		internal.PVCNameKey:      "data-postgres-0",
+		internal.PVCNamespaceKey: "db",
+	}
+
+	assert.Equal(t, "db/data-postgres", GetFSLabel(params, internal.FSTypeExt4))
+	assert.Equal(t, "db/data-post", GetFSLabel(params, internal.FSTypeXfs))
+	assert.Equal(t, "db/data-postgres-0", GetFSLabel(params, internal.FSTypeBtrfs))
+	assert.Empty(t, GetFSLabel(map[string]string{internal.PVCNameKey: "data"}, internal.FSTypeExt4))
+}
+
+func TestGetExt4Options(t *testing.T) {
+	options, err := GetExt4Options(map[string]string{})
+	assert.NoError(t, err)
+	assert.Empty(t, options)
+
+	options, err = GetExt4Options(map[string]string{
+		internal.Ext4ReservedBlocksKey:      "0",
+		internal.Ext4LazyInitKey:            "false",
+		internal.Ext4BigallocClusterSizeKey: "64Ki",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-m", "0", "-E", "lazy_itable_init=0,lazy_journal_init=0", "-O", "bigalloc", "-C", "65536"}, options)
+
+	options, err = GetExt4Options(map[string]string{internal.Ext4LazyInitKey: "true"})
+	assert.NoError(t, err)
+	assert.Empty(t, options)
+
+	for _, params := range []map[string]string{
+		{internal.Ext4ReservedBlocksKey: "60"},
+		{internal.Ext4ReservedBlocksKey: "-1"},
+		{internal.Ext4LazyInitKey: "no"},
+		{internal.Ext4BigallocClusterSizeKey: "4Ki"},
+		{internal.Ext4BigallocClusterSizeKey: "48Ki"},
+	} {
+		_, err = GetExt4Options(params)
+		assert.Error(t, err, params)
+	}
+}
+
+func TestIsFSFrozenForSnapshot(t *testing.T) {
+	newLLV := func(request, freezeStatus string) *snc.LVMLogicalVolume {
+		return &snc.LVMLogicalVolume{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			internal.FSFreezeRequestKey: request,
+			internal.FSFreezeStatusKey:  freezeStatus,
+		}}}
+	}
+
+	assert.True(t, IsFSFrozenForSnapshot(newLLV("snap-1", internal.FSFreezeFrozen), "snap-1"))
+	assert.True(t, IsFSFrozenForSnapshot(newLLV("snap-1", internal.FSFreezeSkipped), "snap-1"))
+	assert.False(t, IsFSFrozenForSnapshot(newLLV("snap-1", internal.FSFreezeThawed), "snap-1"))
+	assert.False(t, IsFSFrozenForSnapshot(newLLV("snap-1", internal.FSFreezeFrozen), "snap-2"))
+	assert.False(t, IsFSFrozenForSnapshot(&snc.LVMLogicalVolume{}, "snap-1"))
+}
+
+func TestIsForceFormat(t *testing.T) {
+	force, err := IsForceFormat(map[string]string{})
+	assert.NoError(t, err)
+	assert.False(t, force)
+
+	force, err = IsForceFormat(map[string]string{internal.ForceFormatKey: "true"})
+	assert.NoError(t, err)
+	assert.True(t, force)
+
+	_, err = IsForceFormat(map[string]string{internal.ForceFormatKey: "yes"})
+	assert.Error(t, err)
+}
+
+func TestParseLVMDevicePath(t *testing.T) {
+	vgName, lvName, ok := ParseLVMDevicePath("/dev/data/pvc-1")
+	assert.True(t, ok)
+	assert.Equal(t, "data", vgName)
+	assert.Equal(t, "pvc-1", lvName)
+
+	for _, path := range []string{"/dev/mapper/data-pvc--1", "/dev/sda", "data/pvc-1", "/dev/data/pvc/1"} {
+		_, _, ok = ParseLVMDevicePath(path)
+		assert.False(t, ok, path)
+	}
+}
+
+func TestGetDiscardPolicy(t *testing.T) {
+	policy, err := GetDiscardPolicy(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, internal.DiscardPolicyNone, policy)
+
+	policy, err = GetDiscardPolicy(map[string]string{internal.DiscardPolicyKey: internal.DiscardPolicyFstrim})
+	assert.NoError(t, err)
+	assert.Equal(t, internal.DiscardPolicyFstrim, policy)
+
+	_, err = GetDiscardPolicy(map[string]string{internal.DiscardPolicyKey: "online"})
+	assert.Error(t, err)
+}
+
+func TestGetFsckPolicy(t *testing.T) {
+	policy, err := GetFsckPolicy(map[string]string{}, internal.FsckPolicyCheck)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.FsckPolicyCheck, policy)
+
+	policy, err = GetFsckPolicy(map[string]string{internal.FsckPolicyKey: internal.FsckPolicyRepair}, internal.FsckPolicyNone)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.FsckPolicyRepair, policy)
+
+	_, err = GetFsckPolicy(map[string]string{internal.FsckPolicyKey: "always"}, internal.FsckPolicyNone)
+	assert.Error(t, err)
+}
+
+func TestGetXFSDuplicateUUIDPolicy(t *testing.T) {
+	policy, err := GetXFSDuplicateUUIDPolicy(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, internal.XFSDuplicateUUIDNouuid, policy)
+
+	policy, err = GetXFSDuplicateUUIDPolicy(map[string]string{internal.XFSDuplicateUUIDKey: internal.XFSDuplicateUUIDRegenerate})
+	assert.NoError(t, err)
+	assert.Equal(t, internal.XFSDuplicateUUIDRegenerate, policy)
+
+	_, err = GetXFSDuplicateUUIDPolicy(map[string]string{internal.XFSDuplicateUUIDKey: "ignore"})
+	assert.Error(t, err)
+}
+
+func TestGetFSGroupChangePolicy(t *testing.T) {
+	policy, err := GetFSGroupChangePolicy(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, internal.FSGroupChangePolicyOnRootMismatch, policy)
+
+	policy, err = GetFSGroupChangePolicy(map[string]string{internal.FSGroupChangePolicyKey: internal.FSGroupChangePolicyAlways})
+	assert.NoError(t, err)
+	assert.Equal(t, internal.FSGroupChangePolicyAlways, policy)
+
+	_, err = GetFSGroupChangePolicy(map[string]string{internal.FSGroupChangePolicyKey: "Never"})
+	assert.Error(t, err)
+}
+
+func TestGetSecureErase(t *testing.T) {
+	erase, err := GetSecureErase(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", erase)
+
+	erase, err = GetSecureErase(map[string]string{internal.SecureEraseKey: internal.SecureEraseZero})
+	assert.NoError(t, err)
+	assert.Equal(t, internal.SecureEraseZero, erase)
+
+	_, err = GetSecureErase(map[string]string{internal.SecureEraseKey: "shred"})
+	assert.Error(t, err)
+}
+
+func TestGetBlockTuning(t *testing.T) {
+	tuning, err := GetBlockTuning(map[string]string{})
+	assert.NoError(t, err)
+	assert.True(t, tuning.IsEmpty())
+
+	tuning, err = GetBlockTuning(map[string]string{
+		internal.IOSchedulerKey: internal.IOSchedulerMQDeadline,
+		internal.ReadAheadKBKey: "4096",
+		internal.NrRequestsKey:  "256",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, BlockTuning{Scheduler: internal.IOSchedulerMQDeadline, ReadAheadKB: "4096", NrRequests: "256"}, tuning)
+
+	_, err = GetBlockTuning(map[string]string{internal.IOSchedulerKey: "bfq"})
+	assert.Error(t, err)
+
+	_, err = GetBlockTuning(map[string]string{internal.ReadAheadKBKey: "-1"})
+	assert.Error(t, err)
+
+	_, err = GetBlockTuning(map[string]string{internal.NrRequestsKey: "0"})
+	assert.Error(t, err)
+}
+
+func TestGetIOLimits(t *testing.T) {
+	limits, err := GetIOLimits(map[string]string{})
+	assert.NoError(t, err)
+	assert.True(t, limits.IsEmpty())
+
+	limits, err = GetIOLimits(map[string]string{
+		internal.QoSReadBPSKey:   "100Mi",
+		internal.QoSWriteBPSKey:  "1048576",
+		internal.QoSWriteIOPSKey: "500",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, IOLimits{ReadBPS: 100 << 20, WriteBPS: 1 << 20, WriteIOPS: 500}, limits)
+
+	_, err = GetIOLimits(map[string]string{internal.QoSReadIOPSKey: "1k"})
+	assert.Error(t, err)
+
+	_, err = GetIOLimits(map[string]string{internal.QoSReadBPSKey: "-1Mi"})
+	assert.Error(t, err)
+}
+
+func TestParseRawDeviceFilter(t *testing.T) {
+	filter, err := ParseRawDeviceFilter(map[string]string{})
+	assert.NoError(t, err)
+	assert.True(t, filter.Selector.Empty())
+	assert.Zero(t, filter.MinSize)
+	assert.Zero(t, filter.MaxSize)
+
+	filter, err = ParseRawDeviceFilter(map[string]string{
+		internal.RawDeviceSelectorKey: "disk-type=nvme,tier in (fast)",
+		internal.RawDeviceMinSizeKey:  "10Gi",
+		internal.RawDeviceMaxSizeKey:  "1Ti",
+	})
+	assert.NoError(t, err)
+	assert.True(t, filter.Selector.Matches(labels.Set{"disk-type": "nvme", "tier": "fast"}))
+	assert.False(t, filter.Selector.Matches(labels.Set{"disk-type": "nvme"}))
+	assert.Equal(t, int64(10*1024*1024*1024), filter.MinSize)
+	assert.Equal(t, int64(1024*1024*1024*1024), filter.MaxSize)
+
+	for _, params := range []map[string]string{
+		{internal.RawDeviceSelectorKey: "tier in (fast"},
+		{internal.RawDeviceMinSizeKey: "ten"},
+		{internal.RawDeviceMaxSizeKey: "0"},
+		{internal.RawDeviceMinSizeKey: "2Ti", internal.RawDeviceMaxSizeKey: "1Ti"},
+	} {
+		_, err = ParseRawDeviceFilter(params)
+		assert.Error(t, err, params)
+	}
+}
+
+func TestSelectRawDevice(t *testing.T) {
+	newDevice := func(name, node, size string, consumable bool, lbls map[string]string) snc.BlockDevice {
+		return snc.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: lbls},
+			Status: snc.BlockDeviceStatus{
+				NodeName:   node,
+				Consumable: consumable,
+				Path:       "/dev/" + name,
+				Size:       resource.MustParse(size),
+			},
+		}
+	}
+	const gi = int64(1024 * 1024 * 1024)
+	devices := []snc.BlockDevice{
+		newDevice("dev-a-1", "node-a", "100Gi", true, map[string]string{"tier": "fast"}),
+		newDevice("dev-a-2", "node-a", "20Gi", true, nil),
+		newDevice("dev-b-1", "node-b", "50Gi", true, map[string]string{"tier": "fast"}),
+		newDevice("dev-b-2", "node-b", "10Gi", false, map[string]string{"tier": "fast"}),
+	}
+	all := RawDeviceFilter{Selector: labels.Everything()}
+
+	// the smallest fitting device of any node is selected
+	device := SelectRawDevice(devices, all, 15*gi, 0, nil, nil)
+	if assert.NotNil(t, device) {
+		assert.Equal(t, "dev-a-2", device.Name)
+	}
+
+	// the nodes are tried in the order of preference
+	device = SelectRawDevice(devices, all, 15*gi, 0, []string{"node-b", "node-a"}, nil)
+	if assert.NotNil(t, device) {
+		assert.Equal(t, "dev-b-1", device.Name)
+	}
+
+	// the claimed and not consumable devices are skipped
+	device = SelectRawDevice(devices, all, 5*gi, 0, []string{"node-b"}, map[string]struct{}{"dev-b-1": {}})
+	assert.Nil(t, device)
+
+	// the selector, the size limits of the storage class and the limit of the request apply
+	fast := RawDeviceFilter{Selector: labels.SelectorFromSet(labels.Set{"tier": "fast"})}
+	device = SelectRawDevice(devices, fast, gi, 0, nil, nil)
+	if assert.NotNil(t, device) {
+		assert.Equal(t, "dev-b-1", device.Name)
+	}
+	device = SelectRawDevice(devices, RawDeviceFilter{Selector: labels.Everything(), MinSize: 60 * gi}, gi, 0, nil, nil)
+	if assert.NotNil(t, device) {
+		assert.Equal(t, "dev-a-1", device.Name)
+	}
+	device = SelectRawDevice(devices, RawDeviceFilter{Selector: labels.Everything(), MaxSize: 30 * gi}, 25*gi, 0, nil, nil)
+	assert.Nil(t, device)
+	device = SelectRawDevice(devices, all, 30*gi, 60*gi, nil, nil)
+	if assert.NotNil(t, device) {
+		assert.Equal(t, "dev-b-1", device.Name)
+	}
+}
+
+func TestGetClaimedRawDevices(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	const driverName = "local.csi.storage.deckhouse.io"
+	newPV := func(name, driver string, attributes map[string]string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: name, VolumeAttributes: attributes},
+				},
+			},
+		}
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newPV("pv-1", driverName, map[string]string{internal.RawDeviceNameKey: "dev-1"}),
+		newPV("pv-2", driverName, map[string]string{internal.VGNameKey: "vg"}),
+		newPV("pv-3", "other.csi.storage.io", map[string]string{internal.RawDeviceNameKey: "dev-3"}),
+	).Build()
+
+	claimed, err := GetClaimedRawDevices(context.Background(), cl, driverName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"dev-1": {}}, claimed)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"sds-local-volume-csi/internal"
+)
+
+// IOLimits are the IO limits of the volume. A zero limit means the IO is not limited.
+type IOLimits struct {
+	ReadBPS   int64
+	WriteBPS  int64
+	ReadIOPS  int64
+	WriteIOPS int64
+}
+
+// IsEmpty reports whether the IO of the volume is not limited at all.
+func (l IOLimits) IsEmpty() bool {
+	return l == IOLimits{}
+}
+
+// GetIOLimits returns the IO limits of the volume from the StorageClass parameters, the mutable parameters or
+// the LVMLogicalVolume annotations. The throughput limits are quantities, e.g. 100Mi, the IOPS limits are integers.
+func GetIOLimits(parameters map[string]string) (IOLimits, error) {
+	var l IOLimits
+	for _, limit := range []struct {
+		key   string
+		value *int64
+		iops  bool
+	}{
+		{internal.QoSReadBPSKey, &l.ReadBPS, false},
+		{internal.QoSWriteBPSKey, &l.WriteBPS, false},
+		{internal.QoSReadIOPSKey, &l.ReadIOPS, true},
+		{internal.QoSWriteIOPSKey, &l.WriteIOPS, true},
+	} {
+		value, ok := parameters[limit.key]
+		if !ok || value == "" {
+			continue
+		}
+
+		if limit.iops {
+			iops, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || iops < 0 {
+				return IOLimits{}, fmt.Errorf("%s must be a non-negative integer, got %q", limit.key, value)
+			}
+			*limit.value = iops
+			continue
+		}
+
+		q, err := resource.ParseQuantity(value)
+		if err != nil || q.Sign() < 0 {
+			return IOLimits{}, fmt.Errorf("%s must be a non-negative quantity, got %q", limit.key, value)
+		}
+		*limit.value = q.Value()
+	}
+
+	return l, nil
+}
+
+// SetPodIOLimits limits the IO of the Pod to the device in the io.max of the Pod's cgroup v2 under the cgroup root.
+// The limits are shared by all the containers of the Pod and are gone with the Pod's cgroup.
+func (s *Store) SetPodIOLimits(cgroupRoot, podUID, devicePath string, limits IOLimits) error {
+	podCgroup, err := findPodCgroup(cgroupRoot, podUID)
+	if err != nil {
+		return err
+	}
+
+	var stat unix.Stat_t
+	err = unix.Stat(devicePath, &stat)
+	if err != nil {
+		return fmt.Errorf("failed to stat the device %s: %w", devicePath, err)
+	}
+
+	entry := ioMaxEntry(unix.Major(uint64(stat.Rdev)), unix.Minor(uint64(stat.Rdev)), limits)
+	s.Log.Debug(fmt.Sprintf("[SetPodIOLimits] limiting the IO of the Pod %s to the device %s: %s", podUID, devicePath, entry))
+
+	err = os.WriteFile(filepath.Join(podCgroup, "io.max"), []byte(entry), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to set the io.max of the cgroup %s: %w", podCgroup, err)
+	}
+
+	return nil
+}
+
+// findPodCgroup returns the cgroup of the Pod created by kubelet either with the systemd cgroup driver, e.g.
+// kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice, or with the cgroupfs one,
+// e.g. kubepods/burstable/pod<uid>.
+func findPodCgroup(cgroupRoot, podUID string) (string, error) {
+	systemdUID := strings.ReplaceAll(podUID, "-", "_")
+
+	candidates := []string{
+		filepath.Join(cgroupRoot, "kubepods.slice", "kubepods-pod"+systemdUID+".slice"),
+		filepath.Join(cgroupRoot, "kubepods", "pod"+podUID),
+	}
+	for _, qosClass := range []string{"burstable", "besteffort"} {
+		candidates = append(candidates,
+			filepath.Join(cgroupRoot, "kubepods.slice", "kubepods-"+qosClass+".slice", "kubepods-"+qosClass+"-pod"+systemdUID+".slice"),
+			filepath.Join(cgroupRoot, "kubepods", qosClass, "pod"+podUID),
+		)
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("no cgroup of the Pod %s found under %s", podUID, cgroupRoot)
+}
+
+// ioMaxEntry returns the io.max entry of the device with the limits, the zero limits are written as max.
+func ioMaxEntry(major, minor uint32, limits IOLimits) string {
+	value := func(limit int64) string {
+		if limit == 0 {
+			return "max"
+		}
+		return strconv.FormatInt(limit, 10)
+	}
+
+	return fmt.Sprintf("%d:%d rbps=%s wbps=%s riops=%s wiops=%s", major, minor, value(limits.ReadBPS), value(limits.WriteBPS), value(limits.ReadIOPS), value(limits.WriteIOPS))
+}
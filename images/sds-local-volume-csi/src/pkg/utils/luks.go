@@ -0,0 +1,241 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"sds-local-volume-csi/internal"
+)
+
+// luksDiskFormat is the type blkid reports for the LUKS devices.
+const luksDiskFormat = "crypto_LUKS"
+
+// ParseEncryption returns the encryption mode of the volume from the StorageClass parameters or the volume context.
+// An empty string means the volume is not encrypted.
+func ParseEncryption(parameters map[string]string) (string, error) {
+	switch encryption := parameters[internal.EncryptionKey]; encryption {
+	case "", internal.EncryptionLUKS:
+		return encryption, nil
+	default:
+		return "", fmt.Errorf("%s must be %q, got %q", internal.EncryptionKey, internal.EncryptionLUKS, encryption)
+	}
+}
+
+// IsEncrypted reports whether the volume is encrypted by its volume context.
+func IsEncrypted(volumeContext map[string]string) bool {
+	return volumeContext[internal.EncryptionKey] == internal.EncryptionLUKS
+}
+
+// CheckSourceEncryption checks the volume is encrypted the same way as its source, the snapshot or the volume
+// it is created from. Otherwise either the encrypted data is exposed or the plain one is destroyed by the formatting.
+func CheckSourceEncryption(encryption string, sourceAnnotations map[string]string) error {
+	if sourceEncryption := sourceAnnotations[internal.EncryptionKey]; sourceEncryption != encryption {
+		return fmt.Errorf("the source has the encryption %q, but the volume is requested with the encryption %q", sourceEncryption, encryption)
+	}
+
+	return nil
+}
+
+// GetLUKSPassphrase returns the passphrase of the encrypted volume from the node secrets.
+func GetLUKSPassphrase(secrets map[string]string) (string, error) {
+	passphrase := secrets[internal.LUKSPassphraseKey]
+	if passphrase == "" {
+		return "", fmt.Errorf("the secret of the encrypted volume has no %s key", internal.LUKSPassphraseKey)
+	}
+
+	return passphrase, nil
+}
+
+// GetLUKSNewPassphrase returns the passphrase the key of the encrypted volume is rotated to from the rotation secret.
+func GetLUKSNewPassphrase(secrets map[string]string) (string, error) {
+	passphrase := secrets[internal.LUKSNewPassphraseKey]
+	if passphrase == "" {
+		return "", fmt.Errorf("the key rotation secret has no %s key", internal.LUKSNewPassphraseKey)
+	}
+
+	return passphrase, nil
+}
+
+// ParseSecretRef parses the <namespace>/<name> reference of a Secret.
+func ParseSecretRef(ref string) (namespace, name string, err error) {
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("the secret reference must be in the <namespace>/<name> format, got %q", ref)
+	}
+
+	return namespace, name, nil
+}
+
+// LUKSMapperName returns the name of the device mapper device the encrypted volume is opened as.
+func LUKSMapperName(volumeID string) string {
+	return internal.LUKSMapperPrefix + LLVNameForVolume(volumeID)
+}
+
+// LUKSDevicePath returns the path of the opened encrypted volume.
+func LUKSDevicePath(volumeID string) string {
+	return "/dev/mapper/" + LUKSMapperName(volumeID)
+}
+
+// OpenLUKS opens the encrypted device, formatting it with LUKS first if the device is empty, and returns the path
+// of the opened device. The device with any other data is never formatted.
+func (s *Store) OpenLUKS(devicePath, mapperName, passphrase string) (string, error) {
+	mapperPath := "/dev/mapper/" + mapperName
+	opened, err := s.PathExists(mapperPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if the device %s exists: %w", mapperPath, err)
+	}
+	if opened {
+		s.Log.Trace(fmt.Sprintf("[OpenLUKS] the device %s is already opened as %s", devicePath, mapperPath))
+		return mapperPath, nil
+	}
+
+	format, err := s.NodeStorage.GetDiskFormat(devicePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the format of the device %s: %w", devicePath, err)
+	}
+
+	switch format {
+	case "":
+		s.Log.Info(fmt.Sprintf("[OpenLUKS] formatting the device %s with LUKS", devicePath))
+		err = s.runCryptsetup(passphrase, "luksFormat", "--type", "luks2", "--batch-mode", "--key-file", "-", devicePath)
+		if err != nil {
+			return "", err
+		}
+	case luksDiskFormat:
+	default:
+		return "", fmt.Errorf("the device %s contains %s data, it is not encrypted with LUKS", devicePath, format)
+	}
+
+	s.Log.Info(fmt.Sprintf("[OpenLUKS] opening the device %s as %s", devicePath, mapperPath))
+	err = s.runCryptsetup(passphrase, "luksOpen", devicePath, mapperName, "--key-file", "-")
+	if err != nil {
+		return "", err
+	}
+
+	return mapperPath, nil
+}
+
+// CloseLUKS closes the opened encrypted device if it is open.
+func (s *Store) CloseLUKS(mapperName string) error {
+	opened, err := s.PathExists("/dev/mapper/" + mapperName)
+	if err != nil {
+		return fmt.Errorf("failed to check if the device %s is opened: %w", mapperName, err)
+	}
+	if !opened {
+		return nil
+	}
+
+	s.Log.Info(fmt.Sprintf("[CloseLUKS] closing the device %s", mapperName))
+	return s.runCryptsetup("", "luksClose", mapperName)
+}
+
+// ResizeLUKS grows the opened encrypted device to the size of the underlying LV. The passphrase is required
+// only if the volume key is not in the kernel keyring.
+func (s *Store) ResizeLUKS(mapperName, passphrase string) error {
+	args := []string{"resize", mapperName}
+	if passphrase != "" {
+		args = append(args, "--key-file", "-")
+	}
+
+	s.Log.Info(fmt.Sprintf("[ResizeLUKS] resizing the device %s", mapperName))
+	return s.runCryptsetup(passphrase, args...)
+}
+
+// ChangeLUKSKey replaces the passphrase of the encrypted device with the new one. The device already opened by the new
+// passphrase is left as is, so the interrupted rotation might be retried.
+func (s *Store) ChangeLUKSKey(devicePath, passphrase, newPassphrase string) error {
+	if s.runCryptsetup(newPassphrase, "open", "--test-passphrase", "--key-file", "-", devicePath) == nil {
+		s.Log.Info(fmt.Sprintf("[ChangeLUKSKey] the device %s is already opened by the new passphrase", devicePath))
+		return nil
+	}
+
+	// cryptsetup reads only one of the keys from stdin, the new one is passed in a file readable by root only
+	keyFile, err := os.CreateTemp("", "luks-key-")
+	if err != nil {
+		return fmt.Errorf("failed to create the key file: %w", err)
+	}
+	defer os.Remove(keyFile.Name())
+
+	_, err = keyFile.WriteString(newPassphrase)
+	if closeErr := keyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the key file: %w", err)
+	}
+
+	s.Log.Info(fmt.Sprintf("[ChangeLUKSKey] changing the passphrase of the device %s", devicePath))
+	return s.runCryptsetup(passphrase, "luksChangeKey", "--key-file", "-", devicePath, keyFile.Name())
+}
+
+// ReencryptLUKS re-encrypts the data of the device with a new volume key. The reencryption is done online if the device
+// is opened and is resumed from the point it stopped at if it was interrupted. The progress is reported to the callback
+// as the number of the bytes re-encrypted so far and the total size.
+func (s *Store) ReencryptLUKS(devicePath, passphrase string, progress func(done, total int64)) error {
+	cmd := s.NodeStorage.Exec.Command("cryptsetup", "reencrypt", "--key-file", "-", "--progress-json", "--progress-frequency", "30", devicePath)
+	cmd.SetStdin(strings.NewReader(passphrase))
+	stderr := &strings.Builder{}
+	cmd.SetStderr(stderr)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get the output of cryptsetup: %w", err)
+	}
+
+	s.Log.Info(fmt.Sprintf("[ReencryptLUKS] re-encrypting the device %s", devicePath))
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start cryptsetup reencrypt: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var p struct {
+			Bytes      int64 `json:"device_bytes,string"`
+			DeviceSize int64 `json:"device_size,string"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &p) == nil && p.DeviceSize > 0 {
+			progress(p.Bytes, p.DeviceSize)
+		}
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("cryptsetup reencrypt failed: %s: %w", stderr.String(), err)
+	}
+
+	return nil
+}
+
+// runCryptsetup runs cryptsetup passing the passphrase to its stdin, so it never appears in the process list.
+func (s *Store) runCryptsetup(passphrase string, args ...string) error {
+	cmd := s.NodeStorage.Exec.Command("cryptsetup", args...)
+	if passphrase != "" {
+		cmd.SetStdin(strings.NewReader(passphrase))
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cryptsetup %s failed: %s: %w", args[0], string(output), err)
+	}
+
+	return nil
+}
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -94,3 +97,390 @@ func TestNodeStoreManager(t *testing.T) {
 		})
 	})
 }
+
+func TestGetFSStats(t *testing.T) {
+	store := &Store{Log: &logger.Logger{}}
+
+	stats, err := store.GetFSStats(t.TempDir())
+	if assert.NoError(t, err) {
+		assert.Positive(t, stats.TotalBytes)
+		assert.Equal(t, stats.TotalInodes-stats.AvailableInodes, stats.UsedInodes)
+		assert.LessOrEqual(t, stats.AvailableBytes, stats.TotalBytes)
+	}
+
+	_, err = store.GetFSStats("/non/existent/path")
+	assert.Error(t, err)
+
+	isBlock, err := store.IsBlockDevice(t.TempDir())
+	assert.NoError(t, err)
+	assert.False(t, isBlock)
+}
+
+func TestGetMountDevice(t *testing.T) {
+	f := &mountutils.FakeMounter{}
+	f.MountPoints = []mountutils.MountPoint{
+		{
+			Device: "/dev/vg/lv",
+			Path:   "some-target",
+		},
+	}
+	store := &Store{
+		Log: &logger.Logger{},
+		NodeStorage: mountutils.SafeFormatAndMount{
+			Interface: f,
+		},
+	}
+
+	device, err := store.GetMountDevice("some-target")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/dev/vg/lv", device)
+	}
+
+	_, err = store.GetMountDevice("other-target")
+	assert.Error(t, err)
+}
+
+func TestIsBlockMounted(t *testing.T) {
+	f := &mountutils.FakeMounter{}
+	f.MountPoints = []mountutils.MountPoint{
+		{
+			Device: "udev",
+			Path:   "/var/lib/kubelet/plugins/kubernetes.io/csi/volumeDevices/publish/pvc-1/pod-1",
+		},
+	}
+	store := &Store{
+		Log: &logger.Logger{},
+		NodeStorage: mountutils.SafeFormatAndMount{
+			Interface: f,
+		},
+	}
+
+	mounted, err := isBlockMounted(store, "/var/lib/kubelet/plugins/kubernetes.io/csi/volumeDevices/publish/pvc-1/pod-1")
+	assert.NoError(t, err)
+	assert.True(t, mounted)
+
+	mounted, err = isBlockMounted(store, "/var/lib/kubelet/plugins/kubernetes.io/csi/volumeDevices/publish/pvc-1/pod-2")
+	assert.NoError(t, err)
+	assert.False(t, mounted)
+}
+
+func TestSetVolumeOwnership(t *testing.T) {
+	store := &Store{Log: &logger.Logger{}}
+
+	root := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "dir", "file"), []byte("data"), 0600))
+	assert.NoError(t, os.Symlink("dir/file", filepath.Join(root, "link")))
+
+	// the own group of the test process might be applied without the privileges
+	err := store.SetVolumeOwnership(root, int64(os.Getgid()), false, false)
+	if assert.NoError(t, err) {
+		info, err := os.Stat(filepath.Join(root, "dir"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.ModeDir|os.ModeSetgid|0770, info.Mode())
+		}
+
+		info, err = os.Stat(filepath.Join(root, "dir", "file"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0660), info.Mode())
+		}
+	}
+
+	assert.Error(t, store.SetVolumeOwnership("/non/existent/path", int64(os.Getgid()), false, false))
+
+	// the files are not walked if the root already matches
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "new-file"), []byte("data"), 0600))
+	err = store.SetVolumeOwnership(root, int64(os.Getgid()), false, true)
+	if assert.NoError(t, err) {
+		info, err := os.Stat(filepath.Join(root, "new-file"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0600), info.Mode())
+		}
+	}
+
+	// the root mismatch causes the walk
+	assert.NoError(t, os.Chmod(root, 0700))
+	err = store.SetVolumeOwnership(root, int64(os.Getgid()), false, true)
+	if assert.NoError(t, err) {
+		info, err := os.Stat(filepath.Join(root, "new-file"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0660), info.Mode())
+		}
+	}
+}
+
+func TestReadStagedVolumes(t *testing.T) {
+	store := &Store{Log: &logger.Logger{}}
+
+	pluginDir := t.TempDir()
+	writeVolData := func(dir, driverName, volumeHandle string) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(pluginDir, dir), 0750))
+		data := fmt.Sprintf(`{"driverName":%q,"volumeHandle":%q}`, driverName, volumeHandle)
+		assert.NoError(t, os.WriteFile(filepath.Join(pluginDir, dir, "vol_data.json"), []byte(data), 0640))
+	}
+	writeVolData("local.csi.storage.deckhouse.io/abc", "local.csi.storage.deckhouse.io", "pvc-1")
+	writeVolData("pv/pvc-2", "local.csi.storage.deckhouse.io", "pvc-2")
+	writeVolData("volumeDevices/pvc-3/data", "local.csi.storage.deckhouse.io", "pvc-3")
+	writeVolData("other.csi.example.com/def", "other.csi.example.com", "pvc-4")
+	assert.NoError(t, os.MkdirAll(filepath.Join(pluginDir, "pv", "invalid"), 0750))
+	assert.NoError(t, os.WriteFile(filepath.Join(pluginDir, "pv", "invalid", "vol_data.json"), []byte("{"), 0640))
+
+	volumes, err := store.readStagedVolumes(pluginDir, "local.csi.storage.deckhouse.io")
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []StagedVolume{
+			{VolumeID: "pvc-1", StagingTargetPath: filepath.Join(pluginDir, "local.csi.storage.deckhouse.io", "abc", "globalmount")},
+			{VolumeID: "pvc-2", StagingTargetPath: filepath.Join(pluginDir, "pv", "pvc-2", "globalmount")},
+			{VolumeID: "pvc-3", Block: true},
+		}, volumes)
+	}
+
+	volumes, err = store.readStagedVolumes(filepath.Join(pluginDir, "absent"), "local.csi.storage.deckhouse.io")
+	assert.NoError(t, err)
+	assert.Empty(t, volumes)
+}
+
+func TestOrphanedVolumeData(t *testing.T) {
+	store := &Store{Log: &logger.Logger{}}
+
+	volumeDir := filepath.Join(t.TempDir(), "local.csi.storage.deckhouse.io", "abc")
+	stagingPath := filepath.Join(volumeDir, "globalmount")
+	assert.NoError(t, os.MkdirAll(stagingPath, 0750))
+	data := `{"driverName":"local.csi.storage.deckhouse.io","volumeHandle":"pvc-1"}`
+	assert.NoError(t, os.WriteFile(filepath.Join(volumeDir, "vol_data.json"), []byte(data), 0640))
+
+	volumeID, err := store.GetStagedVolumeID(stagingPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "pvc-1", volumeID)
+
+	// the staging directory is removed by the unmount, the volume directory is kept while it is not empty
+	assert.Error(t, store.RemoveVolumeData(stagingPath))
+	assert.NoError(t, os.Remove(stagingPath))
+	assert.NoError(t, store.RemoveVolumeData(stagingPath))
+	assert.NoDirExists(t, volumeDir)
+	assert.NoError(t, store.RemoveVolumeData(stagingPath))
+
+	_, err = store.GetStagedVolumeID(stagingPath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDeviceMountTargets(t *testing.T) {
+	links := map[string]string{
+		"/dev/vg/lv":        "/dev/dm-1",
+		"/dev/mapper/vg-lv": "/dev/dm-1",
+		"/dev/vg/other":     "/dev/dm-2",
+	}
+	resolve := func(path string) string {
+		if resolved, ok := links[path]; ok {
+			return resolved
+		}
+		return path
+	}
+
+	mounts := []mountutils.MountInfo{
+		{Source: "/dev/mapper/vg-lv", MountPoint: "/staging", FsType: "ext4", Root: "/"},
+		{Source: "/dev/mapper/vg-lv", MountPoint: "/pod-1", FsType: "ext4", Root: "/"},
+		{Source: "/dev/vg/other", MountPoint: "/pod-2", FsType: "ext4", Root: "/"},
+		{Source: "udev", MountPoint: "/block-pod", FsType: "devtmpfs", Root: "/dm-1"},
+		{Source: "udev", MountPoint: "/dev", FsType: "devtmpfs", Root: "/"},
+	}
+
+	assert.Equal(t, []string{"/staging", "/pod-1", "/block-pod"}, deviceMountTargets(mounts, "/dev/vg/lv", resolve))
+	assert.Empty(t, deviceMountTargets(mounts, "/dev/vg/absent", resolve))
+}
+
+func TestParseVGVolumeLimit(t *testing.T) {
+	limit, err := parseVGVolumeLimit("  1044480   0\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(510), limit)
+
+	limit, err = parseVGVolumeLimit("  1044480   100\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), limit)
+
+	_, err = parseVGVolumeLimit("")
+	assert.Error(t, err)
+
+	_, err = parseVGVolumeLimit("  1044480   unknown\n")
+	assert.Error(t, err)
+}
+
+func TestDeviceMapperPath(t *testing.T) {
+	path, ok := deviceMapperPath("/dev/data/pvc-1")
+	assert.True(t, ok)
+	assert.Equal(t, "/dev/mapper/data-pvc--1", path)
+
+	path, ok = deviceMapperPath("/dev/vg-data/lv")
+	assert.True(t, ok)
+	assert.Equal(t, "/dev/mapper/vg--data-lv", path)
+
+	_, ok = deviceMapperPath("/dev/mapper/data-lv")
+	assert.False(t, ok)
+
+	_, ok = deviceMapperPath("/dev/sda")
+	assert.False(t, ok)
+}
+
+func TestIsSameDevice(t *testing.T) {
+	assert.True(t, isSameDevice("/dev/data/pvc-1", "/dev/data/pvc-1"))
+	assert.True(t, isSameDevice("/dev/mapper/data-pvc--1", "/dev/data/pvc-1"))
+	assert.False(t, isSameDevice("/dev/mapper/data-pvc--2", "/dev/data/pvc-1"))
+
+	dir := t.TempDir()
+	device := filepath.Join(dir, "dm-1")
+	link := filepath.Join(dir, "lv")
+	assert.NoError(t, os.WriteFile(device, nil, 0600))
+	assert.NoError(t, os.Symlink(device, link))
+	assert.True(t, isSameDevice(device, link))
+}
+
+func TestStagedVolumeCount(t *testing.T) {
+	mounts := []mountutils.MountInfo{
+		{MountPoint: "/var/lib/kubelet/plugins/kubernetes.io/csi/local.csi.storage.deckhouse.io/1a2b/globalmount"},
+		{MountPoint: "/var/lib/kubelet/plugins/kubernetes.io/csi/local.csi.storage.deckhouse.io/3c4d/globalmount"},
+		{MountPoint: "/var/lib/kubelet/plugins/kubernetes.io/csi/other.csi.example.com/5e6f/globalmount"},
+		{MountPoint: "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pvc-1/mount"},
+	}
+
+	assert.Equal(t, 2, stagedVolumeCount(mounts, "local.csi.storage.deckhouse.io"))
+	assert.Equal(t, 0, stagedVolumeCount(nil, "local.csi.storage.deckhouse.io"))
+	assert.Equal(t, []string{
+		"/var/lib/kubelet/plugins/kubernetes.io/csi/local.csi.storage.deckhouse.io/1a2b/globalmount",
+		"/var/lib/kubelet/plugins/kubernetes.io/csi/local.csi.storage.deckhouse.io/3c4d/globalmount",
+	}, stagingMountPoints(mounts, "local.csi.storage.deckhouse.io"))
+}
+
+func TestIsMountedAt(t *testing.T) {
+	target := t.TempDir()
+	f := &mountutils.FakeMounter{}
+	f.MountPoints = []mountutils.MountPoint{
+		{
+			Device: "/dev/mapper/vg-lv",
+			Path:   target,
+		},
+	}
+	store := &Store{
+		Log: &logger.Logger{},
+		NodeStorage: mountutils.SafeFormatAndMount{
+			Interface: f,
+		},
+	}
+
+	mounted, err := store.IsMountedAt("/dev/vg/lv", target)
+	if assert.NoError(t, err) {
+		assert.True(t, mounted)
+	}
+
+	mounted, err = store.IsMountedAt("/dev/vg/other", target)
+	if assert.NoError(t, err) {
+		assert.False(t, mounted)
+	}
+
+	mounted, err = store.IsMountedAt("/dev/vg/lv", filepath.Join(target, "absent"))
+	if assert.NoError(t, err) {
+		assert.False(t, mounted)
+	}
+}
+
+func TestHasDuplicateUUID(t *testing.T) {
+	uuids := map[string]string{
+		"/dev/vg/clone":         "1111",
+		"/dev/vg/source":        "1111",
+		"/dev/mapper/vg-source": "1111",
+		"/dev/mapper/vg-other":  "2222",
+	}
+	getUUID := func(devicePath string) (string, error) {
+		return uuids[devicePath], nil
+	}
+
+	mounts := []mountutils.MountInfo{
+		{Source: "/dev/mapper/vg-other", MountPoint: "/other", FsType: "xfs"},
+		{Source: "/dev/mapper/vg-source", MountPoint: "/source", FsType: "xfs"},
+	}
+
+	duplicate, err := hasDuplicateUUID(mounts, "/dev/vg/clone", "xfs", getUUID)
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+
+	// the device mounted itself is not a duplicate
+	duplicate, err = hasDuplicateUUID(mounts[1:], "/dev/vg/source", "xfs", getUUID)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = hasDuplicateUUID(mounts[:1], "/dev/vg/clone", "xfs", getUUID)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = hasDuplicateUUID(mounts, "/dev/vg/clone", "ext4", getUUID)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+}
+
+func TestWriteQueueTuning(t *testing.T) {
+	queueDir := t.TempDir()
+
+	err := writeQueueTuning(queueDir, BlockTuning{Scheduler: "none", NrRequests: "128"})
+	assert.NoError(t, err)
+
+	scheduler, err := os.ReadFile(filepath.Join(queueDir, "scheduler"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "none", string(scheduler))
+	}
+	nrRequests, err := os.ReadFile(filepath.Join(queueDir, "nr_requests"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "128", string(nrRequests))
+	}
+	_, err = os.Stat(filepath.Join(queueDir, "read_ahead_kb"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = writeQueueTuning(filepath.Join(queueDir, "absent"), BlockTuning{ReadAheadKB: "128"})
+	assert.Error(t, err)
+}
+
+func TestFindPodCgroup(t *testing.T) {
+	root := t.TempDir()
+	systemdCgroup := filepath.Join(root, "kubepods.slice", "kubepods-burstable.slice", "kubepods-burstable-pod1a2b_3c4d.slice")
+	cgroupfsCgroup := filepath.Join(root, "kubepods", "pod5e6f-7a8b")
+	assert.NoError(t, os.MkdirAll(systemdCgroup, 0755))
+	assert.NoError(t, os.MkdirAll(cgroupfsCgroup, 0755))
+
+	cgroup, err := findPodCgroup(root, "1a2b-3c4d")
+	if assert.NoError(t, err) {
+		assert.Equal(t, systemdCgroup, cgroup)
+	}
+
+	cgroup, err = findPodCgroup(root, "5e6f-7a8b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, cgroupfsCgroup, cgroup)
+	}
+
+	_, err = findPodCgroup(root, "absent")
+	assert.Error(t, err)
+}
+
+func TestIOMaxEntry(t *testing.T) {
+	assert.Equal(t, "253:3 rbps=104857600 wbps=max riops=max wiops=500", ioMaxEntry(253, 3, IOLimits{ReadBPS: 100 << 20, WriteIOPS: 500}))
+}
+
+func TestMountHealth(t *testing.T) {
+	devices := map[string]bool{"/dev/mapper/vg-lv": true, "/dev/dm-1": true}
+	exists := func(path string) bool {
+		return devices[path]
+	}
+
+	mounts := []mountutils.MountInfo{
+		{Source: "/dev/mapper/vg-lv", MountPoint: "/healthy", FsType: "ext4", Root: "/", SuperOptions: []string{"rw"}},
+		{Source: "/dev/mapper/vg-lv", MountPoint: "/published-ro", FsType: "ext4", Root: "/", MountOptions: []string{"ro"}, SuperOptions: []string{"rw"}},
+		{Source: "/dev/mapper/vg-lv", MountPoint: "/remounted-ro", FsType: "ext4", Root: "/", SuperOptions: []string{"ro", "errors=remount-ro"}},
+		{Source: "/dev/mapper/vg-gone", MountPoint: "/gone", FsType: "xfs", Root: "/", SuperOptions: []string{"rw"}},
+		{Source: "udev", MountPoint: "/block", FsType: "devtmpfs", Root: "/dm-1"},
+		{Source: "udev", MountPoint: "/block-gone", FsType: "devtmpfs", Root: "/dm-2"},
+	}
+
+	assert.Empty(t, mountHealth(mounts, "/healthy", exists))
+	assert.Empty(t, mountHealth(mounts, "/published-ro", exists))
+	assert.Contains(t, mountHealth(mounts, "/remounted-ro", exists), "read-only")
+	assert.Contains(t, mountHealth(mounts, "/gone", exists), "missing")
+	assert.Empty(t, mountHealth(mounts, "/block", exists))
+	assert.Contains(t, mountHealth(mounts, "/block-gone", exists), "missing")
+	assert.Contains(t, mountHealth(mounts, "/absent", exists), "not mounted")
+}
@@ -17,11 +17,19 @@ limitations under the License.
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"golang.org/x/sync/errgroup"
 	mountutils "k8s.io/mount-utils"
 	utilexec "k8s.io/utils/exec"
 
@@ -35,10 +43,54 @@ type NodeStoreManager interface {
 	NodePublishVolumeFS(source, devPath, target, fsType string, mountOpts []string) error
 	Unstage(target string) error
 	Unpublish(target string) error
+	ForceUnmount(target, escalation string) error
 	IsNotMountPoint(target string) (bool, error)
 	ResizeFS(target string) error
 	PathExists(path string) (bool, error)
 	NeedResize(devicePath string, deviceMountPath string) (bool, error)
+	IsBlockDevice(path string) (bool, error)
+	GetBlockSizeBytes(devicePath string) (int64, error)
+	GetFSStats(path string) (*FSStats, error)
+	SetVolumeOwnership(path string, gid int64, readOnly, onRootMismatch bool) error
+	GetDeviceMountTargets(devicePath string) ([]string, error)
+	CheckFS(devicePath, policy string) error
+	TrimFS(mountPoint string) error
+	EraseDevice(devicePath, mode string) error
+	FreezeFS(mountPoint string) error
+	ThawFS(mountPoint string) error
+	GetVGVolumeLimit(vgName string) (int64, error)
+	WaitForDevice(ctx context.Context, devicePath string) (string, error)
+	CheckDeviceIdentity(devicePath, vgName, lvName string) error
+	CheckDeviceFormat(devicePath, fsType string, force bool) error
+	HasDuplicateXFSUUID(devicePath string) (bool, error)
+	TuneBlockDevice(devicePath string, tuning BlockTuning) error
+	SetPodIOLimits(cgroupRoot, podUID, devicePath string, limits IOLimits) error
+	RegenerateXFSUUID(devicePath string) error
+	GetMountDevice(mountTarget string) (string, error)
+	CheckMountHealth(mountTarget string) (string, error)
+	IsMountedAt(devicePath, target string) (bool, error)
+	GetDiskFormat(devicePath string) (string, error)
+	GetStagedVolumeCount(driverName string) (int, error)
+	GetStagedVolumes(driverName string) ([]StagedVolume, error)
+	GetStagingMountPoints(driverName string) ([]string, error)
+	GetStagedVolumeID(stagingPath string) (string, error)
+	RemoveVolumeData(stagingPath string) error
+	ActivateLV(vgName, lvName string) error
+	OpenLUKS(devicePath, mapperName, passphrase string) (string, error)
+	CloseLUKS(mapperName string) error
+	ResizeLUKS(mapperName, passphrase string) error
+	ChangeLUKSKey(devicePath, passphrase, newPassphrase string) error
+	ReencryptLUKS(devicePath, passphrase string, progress func(done, total int64)) error
+}
+
+// FSStats is the capacity and inode usage of a mounted filesystem.
+type FSStats struct {
+	TotalBytes      int64
+	AvailableBytes  int64
+	UsedBytes       int64
+	TotalInodes     int64
+	AvailableInodes int64
+	UsedInodes      int64
 }
 
 type Store struct {
@@ -97,7 +149,17 @@ func (s *Store) NodeStageVolumeFS(source, target string, fsType string, mountOpt
 
 	isMountPoint, err := s.NodeStorage.IsMountPoint(target)
 	if err != nil {
-		return fmt.Errorf("[s.NodeStorage.IsMountPoint] unable to determine mount status of %s: %w", target, err)
+		if !mountutils.IsCorruptedMnt(err) {
+			return fmt.Errorf("[s.NodeStorage.IsMountPoint] unable to determine mount status of %s: %w", target, err)
+		}
+
+		// the mount left by the crashed node plugin, e.g. "transport endpoint is not connected"
+		s.Log.Warning(fmt.Sprintf("[NodeStageVolumeFS] the mount at %s is corrupted, unmounting it: %s", target, err.Error()))
+		err = s.NodeStorage.Unmount(target)
+		if err != nil {
+			return fmt.Errorf("failed to unmount the corrupted mount at %s: %w", target, err)
+		}
+		isMountPoint = false
 	}
 
 	s.Log.Trace("≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈ isMountPoint ≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈")
@@ -114,12 +176,17 @@ func (s *Store) NodeStageVolumeFS(source, target string, fsType string, mountOpt
 		}
 		s.Log.Trace(fmt.Sprintf("Found device mounted at %s: %s", target, mountedDevicePath))
 
-		if mountedDevicePath != source && mountedDevicePath != mapperSourcePath {
-			return fmt.Errorf("target %s is a mount point and is not mounted to source %s or %s", target, source, mapperSourcePath)
+		if isSameDevice(mountedDevicePath, source) {
+			s.Log.Trace(fmt.Sprintf("Target %s is a mount point and already mounted to source %s. Skipping FormatAndMount without any checks", target, source))
+			return nil
 		}
 
-		s.Log.Trace(fmt.Sprintf("Target %s is a mount point and already mounted to source %s. Skipping FormatAndMount without any checks", target, source))
-		return nil
+		// the stale mount of another device, e.g. left by the previous volume staged at the same path
+		s.Log.Warning(fmt.Sprintf("[NodeStageVolumeFS] target %s is mounted to %s instead of %s or %s, remounting it", target, mountedDevicePath, source, mapperSourcePath))
+		err = s.NodeStorage.Unmount(target)
+		if err != nil {
+			return fmt.Errorf("failed to unmount the stale mount of %s at %s: %w", mountedDevicePath, target, err)
+		}
 	}
 
 	s.Log.Trace("-----------------== start FormatAndMount ==---------------")
@@ -127,6 +194,16 @@ func (s *Store) NodeStageVolumeFS(source, target string, fsType string, mountOpt
 	if lvmType == internal.LVMTypeThin {
 		s.Log.Trace(fmt.Sprintf("LVM type is Thin. Thin pool name: %s", lvmThinPoolName))
 	}
+
+	// FormatAndMount passes the device to mkfs for the ext and xfs filesystems only, so btrfs is created beforehand
+	// and FormatAndMount just mounts it
+	if fsType == internal.FSTypeBtrfs {
+		err = s.formatBtrfs(source, formatOpts)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = s.NodeStorage.FormatAndMountSensitiveWithFormatOptions(source, target, fsType, mountOpts, nil, formatOpts)
 	if err != nil {
 		return fmt.Errorf("failed to FormatAndMount : %w", err)
@@ -137,6 +214,117 @@ func (s *Store) NodeStageVolumeFS(source, target string, fsType string, mountOpt
 	return nil
 }
 
+// formatBtrfs creates the btrfs filesystem on the device unless the device is already formatted.
+func (s *Store) formatBtrfs(source string, formatOpts []string) error {
+	existingFormat, err := s.NodeStorage.GetDiskFormat(source)
+	if err != nil {
+		return fmt.Errorf("failed to get the format of the device %s: %w", source, err)
+	}
+	if existingFormat != "" {
+		s.Log.Trace(fmt.Sprintf("Device %s is already formatted with %s", source, existingFormat))
+		return nil
+	}
+
+	args := append(slices.Clone(formatOpts), "-f", source)
+	s.Log.Info(fmt.Sprintf("Formatting device %s with btrfs, options: %v", source, args))
+	output, err := s.NodeStorage.Exec.Command("mkfs.btrfs", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to format the device %s with btrfs: %s: %w", source, string(output), err)
+	}
+
+	return nil
+}
+
+// CheckFS checks the filesystem of the device before it is mounted and, with the repair policy, repairs the errors
+// the check tool is able to fix. The device without a filesystem yet and the mounted one are not checked.
+// btrfs is only checked, as its repair tool is not safe to run unattended.
+func (s *Store) CheckFS(devicePath, policy string) error {
+	if policy == internal.FsckPolicyNone {
+		return nil
+	}
+
+	format, err := s.NodeStorage.GetDiskFormat(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to get the format of the device %s: %w", devicePath, err)
+	}
+	if format == "" {
+		return nil
+	}
+
+	targets, err := s.GetDeviceMountTargets(devicePath)
+	if err != nil {
+		return err
+	}
+	if len(targets) != 0 {
+		s.Log.Trace(fmt.Sprintf("[CheckFS] the device %s is mounted at %v, skip the check", devicePath, targets))
+		return nil
+	}
+
+	repair := policy == internal.FsckPolicyRepair
+	var cmd string
+	var args []string
+	switch format {
+	case "ext2", "ext3", internal.FSTypeExt4:
+		cmd, args = "e2fsck", []string{"-n", devicePath}
+		if repair {
+			args = []string{"-p", devicePath}
+		}
+	case internal.FSTypeXfs:
+		cmd, args = "xfs_repair", []string{"-n", devicePath}
+		if repair {
+			args = []string{devicePath}
+		}
+	case internal.FSTypeBtrfs:
+		cmd, args = "btrfs", []string{"check", "--readonly", devicePath}
+	default:
+		s.Log.Warning(fmt.Sprintf("[CheckFS] the filesystem %s of the device %s can not be checked", format, devicePath))
+		return nil
+	}
+
+	s.Log.Info(fmt.Sprintf("[CheckFS] checking the filesystem of the device %s: %s %v", devicePath, cmd, args))
+	output, err := s.NodeStorage.Exec.Command(cmd, args...).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	// e2fsck exits with 1 or 2 if the errors have been corrected
+	var exitErr utilexec.ExitError
+	if cmd == "e2fsck" && repair && errors.As(err, &exitErr) && (exitErr.ExitStatus() == 1 || exitErr.ExitStatus() == 2) {
+		s.Log.Warning(fmt.Sprintf("[CheckFS] the filesystem errors of the device %s have been repaired: %s", devicePath, string(output)))
+		return nil
+	}
+
+	return fmt.Errorf("the filesystem check of the device %s failed: %s: %w", devicePath, string(output), err)
+}
+
+// TrimFS discards the unused blocks of the filesystem mounted at the mount point.
+func (s *Store) TrimFS(mountPoint string) error {
+	output, err := s.NodeStorage.Exec.Command("fstrim", "-v", mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("fstrim of %s failed: %s: %w", mountPoint, string(output), err)
+	}
+
+	s.Log.Info(fmt.Sprintf("[TrimFS] %s", strings.TrimSpace(string(output))))
+	return nil
+}
+
+// EraseDevice erases the data of the unused device. The discard mode discards all the blocks of the device, so a thin LV
+// returns them to the thin pool, and the zero mode overwrites the whole device with zeros.
+func (s *Store) EraseDevice(devicePath, mode string) error {
+	args := []string{devicePath}
+	if mode == internal.SecureEraseZero {
+		args = []string{"--zeroout", devicePath}
+	}
+
+	s.Log.Info(fmt.Sprintf("[EraseDevice] erasing the device %s with the %s mode", devicePath, mode))
+	output, err := s.NodeStorage.Exec.Command("blkdiscard", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to erase the device %s: %s: %w", devicePath, string(output), err)
+	}
+
+	return nil
+}
+
 func (s *Store) NodePublishVolumeBlock(source, target string, mountOpts []string) error {
 	s.Log.Info(" ----== Start NodePublishVolumeBlock ==---- ")
 
@@ -157,7 +345,31 @@ func (s *Store) NodePublishVolumeBlock(source, target string, mountOpts []string
 	s.Log.Trace(info.Mode().String())
 	s.Log.Trace("≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈ MODE SOURCE  ≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈≈")
 
+	// the /dev/<vg>/<lv> link is resolved to the device mapper device, so the mount table refers to the same device
+	// whichever link was used
+	if mapperPath := toMapperPath(source); mapperPath != "" {
+		exists, err := s.PathExists(mapperPath)
+		if err != nil {
+			return fmt.Errorf("[NodePublishVolumeBlock] could not check if the device %s exists: %w", mapperPath, err)
+		}
+		if exists {
+			source = mapperPath
+		}
+	}
+
+	mounted, err := isBlockMounted(s, target)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		s.Log.Trace(fmt.Sprintf("[NodePublishVolumeBlock] target %s is already mounted. Skipping mount", target))
+		return nil
+	}
+
 	s.Log.Trace("-----------------== start Create File ==---------------")
+	if err := os.MkdirAll(filepath.Dir(target), os.FileMode(0750)); err != nil {
+		return fmt.Errorf("[NodePublishVolumeBlock] could not create the parent directory of the bind target %s: %w", target, err)
+	}
 	f, err := os.OpenFile(target, os.O_CREATE, os.FileMode(0644))
 	if err != nil {
 		if !os.IsExist(err) {
@@ -238,6 +450,23 @@ func (s *Store) Unstage(target string) error {
 	return err
 }
 
+// ForceUnmount unmounts the target with the escalation, either lazily or forcibly, when the regular unmount does not
+// finish because the filesystem is busy.
+func (s *Store) ForceUnmount(target, escalation string) error {
+	flag := "-l"
+	if escalation == internal.UnmountEscalationForce {
+		flag = "-f"
+	}
+
+	s.Log.Warning(fmt.Sprintf("[ForceUnmount] unmounting %s with umount %s", target, flag))
+	output, err := s.NodeStorage.Exec.Command("umount", flag, target).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("umount %s %s failed: %s: %w", flag, target, string(output), err)
+	}
+
+	return nil
+}
+
 func (s *Store) IsNotMountPoint(target string) (bool, error) {
 	notMounted, err := s.NodeStorage.IsMountPoint(target)
 	if err != nil {
@@ -277,6 +506,555 @@ func (s *Store) NeedResize(devicePath string, deviceMountPath string) (bool, err
 	return mountutils.NewResizeFs(s.NodeStorage.Exec).NeedResize(devicePath, deviceMountPath)
 }
 
+func (s *Store) GetMountDevice(mountTarget string) (string, error) {
+	devicePath, _, err := mountutils.GetDeviceNameFromMount(s.NodeStorage.Interface, mountTarget)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the device mounted at %s: %w", mountTarget, err)
+	}
+	if devicePath == "" {
+		return "", fmt.Errorf("no device is mounted at %s", mountTarget)
+	}
+
+	return devicePath, nil
+}
+
+// IsMountedAt reports whether the device is mounted at the target by any of its paths. The corrupted mount is reported
+// as not mounted, so it is recovered by the staging.
+func (s *Store) IsMountedAt(devicePath, target string) (bool, error) {
+	isMountPoint, err := s.NodeStorage.IsMountPoint(target)
+	if err != nil {
+		if os.IsNotExist(err) || mountutils.IsCorruptedMnt(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check if %s is a mount point: %w", target, err)
+	}
+	if !isMountPoint {
+		return false, nil
+	}
+
+	mountedDevicePath, _, err := mountutils.GetDeviceNameFromMount(s.NodeStorage.Interface, target)
+	if err != nil {
+		return false, fmt.Errorf("failed to find the device mounted at %s: %w", target, err)
+	}
+
+	return mountedDevicePath != "" && isSameDevice(mountedDevicePath, devicePath), nil
+}
+
+// GetDeviceMountTargets returns the paths the device is mounted at: the staging path and the bind mounts of it
+// for the filesystem volumes, and the bind mounts of the device node for the block ones. The mounts are read from
+// the kernel, so the publications of the volume are counted correctly after the plugin restart.
+func (s *Store) GetDeviceMountTargets(devicePath string) ([]string, error) {
+	mounts, err := mountutils.ParseMountInfo("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the mounts: %w", err)
+	}
+
+	return deviceMountTargets(mounts, devicePath, resolveDevicePath), nil
+}
+
+// deviceMountTargets returns the mount points of the device. The device is mounted by one of its paths,
+// e.g. /dev/vg/lv or /dev/mapper/vg-lv, so the paths are compared after resolving them by the resolve function.
+// A bind mount of the device node is reported by the kernel as a devtmpfs mount with the node as the root.
+func deviceMountTargets(mounts []mountutils.MountInfo, devicePath string, resolve func(string) string) []string {
+	device := resolve(devicePath)
+
+	var targets []string
+	for _, m := range mounts {
+		if resolve(m.Source) == device || (m.FsType == "devtmpfs" && "/dev"+m.Root == device) {
+			targets = append(targets, m.MountPoint)
+		}
+	}
+
+	return targets
+}
+
+// CheckMountHealth returns the problem of the volume mounted at the target seen by the kernel: the filesystem remounted
+// read-only, e.g. after an IO error, or the device gone from under the mount. An empty string means no problem is found.
+func (s *Store) CheckMountHealth(mountTarget string) (string, error) {
+	mounts, err := mountutils.ParseMountInfo("/proc/self/mountinfo")
+	if err != nil {
+		return "", fmt.Errorf("failed to read the mounts: %w", err)
+	}
+
+	return mountHealth(mounts, mountTarget, func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}), nil
+}
+
+// mountHealth returns the problem of the mount at the target. The device of the filesystem mount is its source, the one
+// of the block device bind mount is the device node under /dev the devtmpfs mount refers to by its root.
+func mountHealth(mounts []mountutils.MountInfo, mountTarget string, exists func(string) bool) string {
+	for _, m := range mounts {
+		if m.MountPoint != mountTarget {
+			continue
+		}
+
+		device := m.Source
+		if m.FsType == "devtmpfs" {
+			device = "/dev" + m.Root
+		}
+		if !exists(device) {
+			return fmt.Sprintf("the device %s of the volume is missing", device)
+		}
+
+		if m.FsType != "devtmpfs" && slices.Contains(m.SuperOptions, "ro") {
+			return fmt.Sprintf("the filesystem on the device %s is read-only, e.g. remounted after an IO error", device)
+		}
+
+		return ""
+	}
+
+	return fmt.Sprintf("the volume is not mounted at %s", mountTarget)
+}
+
+// GetDiskFormat returns the filesystem or the other data the device contains, an empty string means the device is empty.
+func (s *Store) GetDiskFormat(devicePath string) (string, error) {
+	return s.NodeStorage.GetDiskFormat(devicePath)
+}
+
+// GetStagedVolumeCount returns the number of the volumes of the driver staged on the node, i.e. mounted at
+// the staging paths kubelet creates for them: <kubelet dir>/plugins/kubernetes.io/csi/<driver name>/<hash>/globalmount.
+func (s *Store) GetStagedVolumeCount(driverName string) (int, error) {
+	mounts, err := mountutils.ParseMountInfo("/proc/self/mountinfo")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the mounts: %w", err)
+	}
+
+	return stagedVolumeCount(mounts, driverName), nil
+}
+
+func stagedVolumeCount(mounts []mountutils.MountInfo, driverName string) int {
+	return len(stagingMountPoints(mounts, driverName))
+}
+
+// GetStagingMountPoints returns the staging paths the volumes of the driver are mounted at on the node.
+func (s *Store) GetStagingMountPoints(driverName string) ([]string, error) {
+	mounts, err := mountutils.ParseMountInfo("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the mounts: %w", err)
+	}
+
+	return stagingMountPoints(mounts, driverName), nil
+}
+
+func stagingMountPoints(mounts []mountutils.MountInfo, driverName string) []string {
+	stagingDir := "/plugins/kubernetes.io/csi/" + driverName + "/"
+
+	var mountPoints []string
+	for _, m := range mounts {
+		if strings.Contains(m.MountPoint, stagingDir) && strings.HasSuffix(m.MountPoint, "/globalmount") {
+			mountPoints = append(mountPoints, m.MountPoint)
+		}
+	}
+
+	return mountPoints
+}
+
+// resolveDevicePath returns the path of the device node the path refers to, or the path itself
+// if it is not a link (e.g. is not a device path at all).
+func resolveDevicePath(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+
+	return resolved
+}
+
+// ErrDeviceNotReady is returned when the device of the volume has not appeared on the node in time.
+var ErrDeviceNotReady = errors.New("device is not ready")
+
+// WaitForDevice waits until the device of the LV appears on the node and returns its path. The /dev/<vg>/<lv> symlink
+// is created by udev after the device-mapper device, so the device-mapper path is accepted as well. The udev queue
+// is settled between the checks, which are retried with an exponential backoff until the context is done.
+func (s *Store) WaitForDevice(ctx context.Context, devicePath string) (string, error) {
+	paths := []string{devicePath}
+	if mapperPath, ok := deviceMapperPath(devicePath); ok {
+		paths = append(paths, mapperPath)
+	}
+
+	backoff := internal.DeviceWaitInitialBackoff
+	for attempt := 1; ; attempt++ {
+		for _, path := range paths {
+			ready, err := s.IsBlockDevice(path)
+			if err != nil && !os.IsNotExist(err) {
+				return "", fmt.Errorf("failed to check the device %s: %w", path, err)
+			}
+			if ready {
+				return path, nil
+			}
+		}
+
+		s.Log.Trace(fmt.Sprintf("[WaitForDevice] attempt %d, the device %s is not ready yet, retrying in %s", attempt, devicePath, backoff))
+		output, err := s.NodeStorage.Exec.CommandContext(ctx, "udevadm", "settle", fmt.Sprintf("--timeout=%d", int(internal.DeviceWaitMaxBackoff.Seconds()))).CombinedOutput()
+		if err != nil {
+			s.Log.Trace(fmt.Sprintf("[WaitForDevice] udevadm settle failed: %s: %s", string(output), err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w: %s has not appeared after %d attempts: %w", ErrDeviceNotReady, devicePath, attempt, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, internal.DeviceWaitMaxBackoff)
+	}
+}
+
+// deviceMapperPath returns the device-mapper path of the /dev/<vg>/<lv> device. The hyphens in the VG and LV names
+// are doubled in the device-mapper name.
+func deviceMapperPath(devicePath string) (string, bool) {
+	if _, _, ok := ParseLVMDevicePath(devicePath); !ok {
+		return "", false
+	}
+
+	return toMapperPath(devicePath), true
+}
+
+// CheckDeviceIdentity checks the device is the LV of the VG the volume is expected at. lvs reads the metadata
+// without the locks, so the check does not wait for the LVM operations running on the node.
+func (s *Store) CheckDeviceIdentity(devicePath, vgName, lvName string) error {
+	output, err := s.NodeStorage.Exec.Command("lvs", "--readonly", "--noheadings", "-o", "vg_name,lv_name", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to get the LV of the device %s: %s: %w", devicePath, string(output), err)
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 || fields[0] != vgName || fields[1] != lvName {
+		return fmt.Errorf("the device %s is not the LV %s/%s: lvs reports %q", devicePath, vgName, lvName, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// CheckDeviceFormat checks the device is either empty or formatted with the filesystem of the volume, so it is safe
+// to format or mount. With the force, the foreign signatures are wiped, and the device is formatted as an empty one.
+func (s *Store) CheckDeviceFormat(devicePath, fsType string, force bool) error {
+	format, err := s.NodeStorage.GetDiskFormat(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to get the format of the device %s: %w", devicePath, err)
+	}
+	if format == "" || format == fsType {
+		return nil
+	}
+
+	if !force {
+		return fmt.Errorf("the device %s bears a foreign signature %q, the filesystem %s is requested", devicePath, format, fsType)
+	}
+
+	s.Log.Warning(fmt.Sprintf("[CheckDeviceFormat] wiping the foreign signature %q of the device %s", format, devicePath))
+	output, err := s.NodeStorage.Exec.Command("wipefs", "--all", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to wipe the signatures of the device %s: %s: %w", devicePath, string(output), err)
+	}
+
+	return nil
+}
+
+// HasDuplicateXFSUUID reports whether the XFS filesystem of the device has the same UUID as another XFS filesystem
+// mounted on the node, e.g. the one of the volume it has been cloned or restored from.
+func (s *Store) HasDuplicateXFSUUID(devicePath string) (bool, error) {
+	mounts, err := mountutils.ParseMountInfo("/proc/self/mountinfo")
+	if err != nil {
+		return false, fmt.Errorf("failed to read the mounts: %w", err)
+	}
+
+	return hasDuplicateUUID(mounts, devicePath, internal.FSTypeXfs, s.getFSUUID)
+}
+
+// RegenerateXFSUUID assigns a new UUID to the unmounted XFS filesystem of the device. xfs_admin refuses to change
+// the filesystem with a dirty log, which has to be mounted once to replay it.
+func (s *Store) RegenerateXFSUUID(devicePath string) error {
+	s.Log.Info(fmt.Sprintf("[RegenerateXFSUUID] generating a new UUID of the filesystem on the device %s", devicePath))
+	output, err := s.NodeStorage.Exec.Command("xfs_admin", "-U", "generate", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to generate a new UUID of the filesystem on the device %s: %s: %w", devicePath, string(output), err)
+	}
+
+	return nil
+}
+
+// getFSUUID returns the UUID of the filesystem of the device, an empty string if it has none.
+func (s *Store) getFSUUID(devicePath string) (string, error) {
+	output, err := s.NodeStorage.Exec.Command("blkid", "-s", "UUID", "-o", "value", devicePath).CombinedOutput()
+	if err != nil {
+		// blkid exits with 2 if the device has no such tag
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitStatus() == 2 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get the filesystem UUID of the device %s: %s: %w", devicePath, string(output), err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// hasDuplicateUUID reports whether a filesystem of the type mounted from another device has the same UUID as the one
+// of the device. The UUIDs are looked up by the getUUID function once per mounted device.
+func hasDuplicateUUID(mounts []mountutils.MountInfo, devicePath, fsType string, getUUID func(string) (string, error)) (bool, error) {
+	uuid, err := getUUID(devicePath)
+	if err != nil {
+		return false, err
+	}
+	if uuid == "" {
+		return false, nil
+	}
+
+	checked := make(map[string]struct{})
+	for _, m := range mounts {
+		if m.FsType != fsType || isSameDevice(m.Source, devicePath) {
+			continue
+		}
+		if _, ok := checked[m.Source]; ok {
+			continue
+		}
+		checked[m.Source] = struct{}{}
+
+		mountedUUID, err := getUUID(m.Source)
+		if err != nil {
+			return false, err
+		}
+		if mountedUUID == uuid {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *Store) IsBlockDevice(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	return info.Mode()&os.ModeDevice == os.ModeDevice && info.Mode()&os.ModeCharDevice == 0, nil
+}
+
+func (s *Store) GetBlockSizeBytes(devicePath string) (int64, error) {
+	output, err := s.NodeStorage.Exec.Command("blockdev", "--getsize64", devicePath).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the size of the device %s: %s: %w", devicePath, string(output), err)
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the size %q of the device %s: %w", string(output), devicePath, err)
+	}
+
+	return size, nil
+}
+
+// FreezeFS suspends the writes to the filesystem mounted at the mount point and flushes it to the device, so
+// the snapshot of the device is consistent.
+func (s *Store) FreezeFS(mountPoint string) error {
+	output, err := s.NodeStorage.Exec.Command("fsfreeze", "--freeze", mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("fsfreeze --freeze of %s failed: %s: %w", mountPoint, string(output), err)
+	}
+
+	return nil
+}
+
+// ThawFS resumes the writes to the filesystem frozen by FreezeFS.
+func (s *Store) ThawFS(mountPoint string) error {
+	output, err := s.NodeStorage.Exec.Command("fsfreeze", "--unfreeze", mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("fsfreeze --unfreeze of %s failed: %s: %w", mountPoint, string(output), err)
+	}
+
+	return nil
+}
+
+// lvMetadataSize is the estimated size of the text metadata of a single LV, either thick or thin. LVM keeps both
+// the committed and the new copy of the VG metadata in the metadata area, so each copy takes up to a half of it.
+const lvMetadataSize = 1024
+
+// GetVGVolumeLimit returns the number of the LVs the VG might hold. It is either the max_lv limit of the VG or
+// the number of the LVs the metadata area fits, whichever is less.
+func (s *Store) GetVGVolumeLimit(vgName string) (int64, error) {
+	output, err := s.NodeStorage.Exec.Command("vgs", "--noheadings", "--units", "b", "--nosuffix", "-o", "vg_mda_size,max_lv", vgName).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the metadata limits of the VG %s: %s: %w", vgName, string(output), err)
+	}
+
+	return parseVGVolumeLimit(string(output))
+}
+
+// parseVGVolumeLimit parses the vg_mda_size and max_lv fields of the vgs output. The max_lv of 0 means no limit.
+func parseVGVolumeLimit(output string) (int64, error) {
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("unexpected vgs output %q", output)
+	}
+
+	mdaSize, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the metadata area size %q: %w", fields[0], err)
+	}
+	maxLV, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the max_lv %q: %w", fields[1], err)
+	}
+
+	limit := mdaSize / 2 / lvMetadataSize
+	if maxLV > 0 && maxLV < limit {
+		limit = maxLV
+	}
+
+	return limit, nil
+}
+
+func (s *Store) GetFSStats(path string) (*FSStats, error) {
+	var statfs syscall.Statfs_t
+	if err := syscall.Statfs(path, &statfs); err != nil {
+		return nil, fmt.Errorf("failed to statfs %s: %w", path, err)
+	}
+
+	blockSize := statfs.Bsize
+	return &FSStats{
+		TotalBytes:      int64(statfs.Blocks) * blockSize,
+		AvailableBytes:  int64(statfs.Bavail) * blockSize,
+		UsedBytes:       int64(statfs.Blocks-statfs.Bfree) * blockSize,
+		TotalInodes:     int64(statfs.Files),
+		AvailableInodes: int64(statfs.Ffree),
+		UsedInodes:      int64(statfs.Files - statfs.Ffree),
+	}, nil
+}
+
+// volumeOwnershipWorkers is the number of the files the ownership is changed for in parallel. The change is bound
+// by the filesystem metadata updates rather than by the CPU, so the workers wait for the IO most of the time.
+const volumeOwnershipWorkers = 16
+
+// SetVolumeOwnership gives the group the access to the files of the volume the same way kubelet applies the fsGroup
+// of a Pod: the files are owned by the group and are readable (and writable unless the volume is read-only)
+// by it, the directories also get the setgid bit, so the new files inherit the group.
+// On the root mismatch policy the files are not walked at all if the root directory of the volume already matches,
+// so a Pod using a volume with millions of files starts without waiting for the walk. The files are changed
+// by several workers in parallel, and the root directory is changed last, so an interrupted change is repeated
+// on the next publish.
+func (s *Store) SetVolumeOwnership(path string, gid int64, readOnly, onRootMismatch bool) error {
+	mask := os.FileMode(0660)
+	if readOnly {
+		mask = 0440
+	}
+
+	rootInfo, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if onRootMismatch && ownershipMatches(rootInfo, gid, mask) {
+		s.Log.Debug(fmt.Sprintf("[SetVolumeOwnership] the root of the volume at %s already has the group %d, skipping", path, gid))
+		return nil
+	}
+
+	s.Log.Debug(fmt.Sprintf("[SetVolumeOwnership] applying the group %d to the volume at %s", gid, path))
+	start := time.Now()
+
+	g, ctx := errgroup.WithContext(context.Background())
+	names := make(chan string, volumeOwnershipWorkers)
+	for range volumeOwnershipWorkers {
+		g.Go(func() error {
+			for name := range names {
+				if err := setFileOwnership(name, gid, mask); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		defer close(names)
+		return filepath.WalkDir(path, func(name string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if name == path {
+				return nil
+			}
+
+			select {
+			case names <- name:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	})
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	err = setFileOwnership(path, gid, mask)
+	if err != nil {
+		return err
+	}
+
+	s.Log.Debug(fmt.Sprintf("[SetVolumeOwnership] the group %d is applied to the volume at %s in %s", gid, path, time.Since(start)))
+	return nil
+}
+
+// setFileOwnership gives the group the access to the file, the directory also gets the setgid bit.
+func setFileOwnership(name string, gid int64, mask os.FileMode) error {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Lchown(name, -1, int(gid)); err != nil {
+		return fmt.Errorf("failed to change the group of %s: %w", name, err)
+	}
+
+	// the symlinks have no permissions of their own
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	fileMask := ownershipMask(info, mask)
+	if info.Mode()&fileMask == fileMask {
+		return nil
+	}
+
+	if err := os.Chmod(name, info.Mode()|fileMask); err != nil {
+		return fmt.Errorf("failed to change the permissions of %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// ownershipMask returns the permissions the group gets for the file, the directories are also searchable
+// and have the setgid bit.
+func ownershipMask(info os.FileInfo, mask os.FileMode) os.FileMode {
+	if info.IsDir() {
+		return mask | os.ModeSetgid | 0110
+	}
+
+	return mask
+}
+
+// ownershipMatches reports whether the file is owned by the group and has the group permissions already.
+func ownershipMatches(info os.FileInfo, gid int64, mask os.FileMode) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int64(stat.Gid) != gid {
+		return false
+	}
+
+	fileMask := ownershipMask(info, mask)
+	return info.Mode()&fileMask == fileMask
+}
+
+// isSameDevice reports whether the mounted device is the source one, referred either by the same path, by its
+// device-mapper path or by a symlink to the same device.
+func isSameDevice(mountedDevicePath, source string) bool {
+	if mountedDevicePath == source || mountedDevicePath == toMapperPath(source) {
+		return true
+	}
+
+	return resolveDevicePath(mountedDevicePath) == resolveDevicePath(source)
+}
+
 func toMapperPath(devPath string) string {
 	if !strings.HasPrefix(devPath, "/dev/") {
 		return ""
@@ -288,6 +1066,23 @@ func toMapperPath(devPath string) string {
 	return "/dev/mapper/" + mapperPath
 }
 
+// isBlockMounted reports whether the target is bind mounted. The mount table refers to the bind mounts of the block
+// devices by the devtmpfs source, so the mounted device itself can not be checked.
+func isBlockMounted(s *Store, target string) (bool, error) {
+	mntInfo, err := s.NodeStorage.Interface.List()
+	if err != nil {
+		return false, fmt.Errorf("[isBlockMounted] failed to list mounts: %w", err)
+	}
+
+	for _, m := range mntInfo {
+		if m.Path == target {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func checkMount(s *Store, devPath, target string, mountOpts []string) error {
 	mntInfo, err := s.NodeStorage.Interface.List()
 	if err != nil {
@@ -0,0 +1,188 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-csi/internal"
+)
+
+// RawDeviceFilter selects the BlockDevices the raw device volumes of a storage class might be provisioned on.
+type RawDeviceFilter struct {
+	Selector labels.Selector
+	MinSize  int64
+	// MaxSize is 0 if the size of the devices is not limited
+	MaxSize int64
+}
+
+// IsRawDeviceVolume reports if the volume takes a whole BlockDevice instead of an LV.
+func IsRawDeviceVolume(volumeContext map[string]string) bool {
+	return volumeContext[internal.TypeKey] == internal.RawType
+}
+
+// ParseRawDeviceFilter parses the BlockDevice selector and the size limits from the StorageClass parameters.
+func ParseRawDeviceFilter(parameters map[string]string) (RawDeviceFilter, error) {
+	filter := RawDeviceFilter{Selector: labels.Everything()}
+
+	if value := parameters[internal.RawDeviceSelectorKey]; value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return filter, fmt.Errorf("unable to parse %s: %w", internal.RawDeviceSelectorKey, err)
+		}
+		filter.Selector = selector
+	}
+
+	for _, size := range []struct {
+		key   string
+		value *int64
+	}{
+		{key: internal.RawDeviceMinSizeKey, value: &filter.MinSize},
+		{key: internal.RawDeviceMaxSizeKey, value: &filter.MaxSize},
+	} {
+		value := parameters[size.key]
+		if value == "" {
+			continue
+		}
+
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return filter, fmt.Errorf("unable to parse %s: %w", size.key, err)
+		}
+		if q.Sign() <= 0 {
+			return filter, fmt.Errorf("%s must be positive, got %s", size.key, value)
+		}
+		*size.value = q.Value()
+	}
+
+	if filter.MaxSize > 0 && filter.MinSize > filter.MaxSize {
+		return filter, fmt.Errorf("%s %s is greater than %s %s", internal.RawDeviceMinSizeKey, parameters[internal.RawDeviceMinSizeKey], internal.RawDeviceMaxSizeKey, parameters[internal.RawDeviceMaxSizeKey])
+	}
+
+	return filter, nil
+}
+
+// SelectRawDevice selects the BlockDevice for a raw device volume: the smallest consumable device matching the filter
+// which fits the required size and is not claimed by another volume. The nodes are tried in the order of preference,
+// the devices of any node are allowed if no nodes are given. It returns nil if no device fits.
+func SelectRawDevice(devices []snc.BlockDevice, filter RawDeviceFilter, requiredBytes, limitBytes int64, nodes []string, claimed map[string]struct{}) *snc.BlockDevice {
+	var candidates []*snc.BlockDevice
+	for i := range devices {
+		device := &devices[i]
+		size := device.Status.Size.Value()
+
+		if !device.Status.Consumable || device.Status.NodeName == "" || device.Status.Path == "" {
+			continue
+		}
+		if _, ok := claimed[device.Name]; ok {
+			continue
+		}
+		if !filter.Selector.Matches(labels.Set(device.Labels)) {
+			continue
+		}
+		if size < requiredBytes || size < filter.MinSize || (filter.MaxSize > 0 && size > filter.MaxSize) || (limitBytes > 0 && size > limitBytes) {
+			continue
+		}
+		if len(nodes) != 0 && !slices.Contains(nodes, device.Status.NodeName) {
+			continue
+		}
+
+		candidates = append(candidates, device)
+	}
+
+	slices.SortFunc(candidates, func(a, b *snc.BlockDevice) int {
+		if len(nodes) != 0 {
+			if byNode := slices.Index(nodes, a.Status.NodeName) - slices.Index(nodes, b.Status.NodeName); byNode != 0 {
+				return byNode
+			}
+		}
+		if bySize := a.Status.Size.Cmp(b.Status.Size); bySize != 0 {
+			return bySize
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	return candidates[0]
+}
+
+// GetRawDevicePVs returns the PersistentVolumes of the driver which take BlockDevices sorted by their volume handles.
+func GetRawDevicePVs(ctx context.Context, kc client.Client, driverName string) ([]corev1.PersistentVolume, error) {
+	pvs := &corev1.PersistentVolumeList{}
+	err := kc.List(ctx, pvs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the PersistentVolumes: %w", err)
+	}
+
+	rawPVs := make([]corev1.PersistentVolume, 0)
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName || pv.Spec.CSI.VolumeAttributes[internal.RawDeviceNameKey] == "" {
+			continue
+		}
+		rawPVs = append(rawPVs, pv)
+	}
+
+	slices.SortFunc(rawPVs, func(a, b corev1.PersistentVolume) int {
+		return strings.Compare(a.Spec.CSI.VolumeHandle, b.Spec.CSI.VolumeHandle)
+	})
+
+	return rawPVs, nil
+}
+
+// GetRawDevicePV returns the raw device PersistentVolume of the volume or nil if there is none, e.g. the volume is
+// an LV one.
+func GetRawDevicePV(ctx context.Context, kc client.Client, driverName, volumeID string) (*corev1.PersistentVolume, error) {
+	pvs, err := GetRawDevicePVs(ctx, kc, driverName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pvs {
+		if pvs[i].Spec.CSI.VolumeHandle == volumeID {
+			return &pvs[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetClaimedRawDevices returns the names of the BlockDevices taken by the raw device PersistentVolumes of the driver.
+func GetClaimedRawDevices(ctx context.Context, kc client.Client, driverName string) (map[string]struct{}, error) {
+	pvs, err := GetRawDevicePVs(ctx, kc, driverName)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := make(map[string]struct{}, len(pvs))
+	for _, pv := range pvs {
+		claimed[pv.Spec.CSI.VolumeAttributes[internal.RawDeviceNameKey]] = struct{}{}
+	}
+
+	return claimed, nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sds-local-volume-csi/internal"
+)
+
+// StagedVolume is a volume of the driver kubelet has staged on the node. kubelet keeps the data of the volume next to
+// its staging path until the volume is unstaged, so the data outlives the node reboot, unlike the mounts.
+type StagedVolume struct {
+	VolumeID string
+	// StagingTargetPath is the path the filesystem volume is mounted at, it is empty for the block volume
+	StagingTargetPath string
+	Block             bool
+}
+
+// GetStagedVolumes returns the volumes of the driver kubelet has staged on the node by the data kubelet keeps for them.
+func (s *Store) GetStagedVolumes(driverName string) ([]StagedVolume, error) {
+	return s.readStagedVolumes(internal.KubeletCSIPluginDir, driverName)
+}
+
+// readStagedVolumes reads the data of the staged volumes in the kubelet's CSI plugin directory. The data of
+// a filesystem volume is kept next to its globalmount staging path, either in <driver name>/<hash> or in pv/<PV name>
+// on the older kubelets, and the one of a block volume is kept in volumeDevices/<PV name>/data.
+func (s *Store) readStagedVolumes(pluginDir, driverName string) ([]StagedVolume, error) {
+	var volumes []StagedVolume
+	for _, pattern := range []struct {
+		glob  string
+		block bool
+	}{
+		{glob: filepath.Join("*", "*", volumeDataFileName)},
+		{glob: filepath.Join("volumeDevices", "*", "data", volumeDataFileName), block: true},
+	} {
+		files, err := filepath.Glob(filepath.Join(pluginDir, pattern.glob))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the volume data in %s: %w", pluginDir, err)
+		}
+
+		for _, file := range files {
+			volData, err := readVolumeData(file)
+			if err != nil {
+				// the volume is unstaged meanwhile
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				s.Log.Warning(fmt.Sprintf("[readStagedVolumes] skipping the volume data %s: %s", file, err.Error()))
+				continue
+			}
+			if volData.DriverName != driverName {
+				continue
+			}
+
+			volume := StagedVolume{VolumeID: volData.VolumeHandle, Block: pattern.block}
+			if !pattern.block {
+				volume.StagingTargetPath = filepath.Join(filepath.Dir(file), "globalmount")
+			}
+			volumes = append(volumes, volume)
+		}
+	}
+
+	return volumes, nil
+}
+
+// GetStagedVolumeID returns the ID of the volume staged at the path by the data kubelet keeps next to it.
+func (s *Store) GetStagedVolumeID(stagingPath string) (string, error) {
+	volData, err := readVolumeData(filepath.Join(filepath.Dir(stagingPath), volumeDataFileName))
+	if err != nil {
+		return "", err
+	}
+
+	return volData.VolumeHandle, nil
+}
+
+// RemoveVolumeData removes the data kubelet keeps for the volume staged at the unmounted path and the directory of
+// the volume the same way kubelet does on the unstage. The directory with anything else left in it is kept.
+func (s *Store) RemoveVolumeData(stagingPath string) error {
+	dir := filepath.Dir(stagingPath)
+	for _, path := range []string{filepath.Join(dir, volumeDataFileName), dir} {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// volumeData is the data kubelet keeps for a staged volume.
+type volumeData struct {
+	DriverName   string `json:"driverName"`
+	VolumeHandle string `json:"volumeHandle"`
+}
+
+// volumeDataFileName is the name of the file kubelet keeps the data of a staged volume in.
+const volumeDataFileName = "vol_data.json"
+
+func readVolumeData(file string) (volumeData, error) {
+	var volData volumeData
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return volData, fmt.Errorf("failed to read the volume data: %w", err)
+	}
+
+	err = json.Unmarshal(data, &volData)
+	if err != nil {
+		return volData, fmt.Errorf("failed to parse the volume data: %w", err)
+	}
+	if volData.VolumeHandle == "" {
+		return volData, fmt.Errorf("the volume data has no volumeHandle")
+	}
+
+	return volData, nil
+}
+
+// ActivateLV activates the LV, so its device appears on the node. The LVs are left inactive after the node reboot
+// if the autoactivation of their VG is disabled or fails, the thin pool of a thin LV is activated together with it.
+func (s *Store) ActivateLV(vgName, lvName string) error {
+	s.Log.Info(fmt.Sprintf("[ActivateLV] activating the LV %s/%s", vgName, lvName))
+	output, err := s.NodeStorage.Exec.Command("lvchange", "--activate", "y", vgName+"/"+lvName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to activate the LV %s/%s: %s: %w", vgName, lvName, string(output), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/staticvolume"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+
+	"sds-local-volume-csi/internal"
+)
+
+// LLVNameForVolume returns the name of the LVMLogicalVolume of the volume, either the dynamically provisioned or the
+// statically provisioned and adopted one.
+func LLVNameForVolume(volumeID string) string {
+	if vgName, lvName, ok := staticvolume.ParseVolumeHandle(volumeID); ok {
+		return staticvolume.LLVName(vgName, lvName)
+	}
+
+	return volumeID
+}
+
+// VolumeIDForLLV returns the ID of the volume of the LVMLogicalVolume: the volumeHandle of the statically provisioned
+// PV the LVMLogicalVolume adopts, or the name of the LVMLogicalVolume of the dynamically provisioned volume.
+func VolumeIDForLLV(llv *snc.LVMLogicalVolume) string {
+	if volumeHandle := llv.Annotations[staticvolume.VolumeHandleAnnotationKey]; volumeHandle != "" {
+		return volumeHandle
+	}
+
+	return llv.Name
+}
+
+// GetVolumeDevicePath returns the path of the volume's device on the node. The static volumeHandle holds the VG and LV
+// names itself, otherwise the VG name is taken from the volume context and the LV is named after the volume unless
+// the context overrides it (e.g. for a manually created PV of an existing LVMLogicalVolume). The raw device volume
+// has the path of its BlockDevice in the volume context.
+func GetVolumeDevicePath(volumeID string, volumeContext map[string]string) (string, error) {
+	if IsRawDeviceVolume(volumeContext) {
+		devPath := volumeContext[internal.RawDevicePathKey]
+		if devPath == "" {
+			return "", fmt.Errorf("raw device path cannot be empty")
+		}
+		return devPath, nil
+	}
+
+	if vgName, lvName, ok := staticvolume.ParseVolumeHandle(volumeID); ok {
+		return fmt.Sprintf("/dev/%s/%s", vgName, lvName), nil
+	}
+
+	vgName, ok := volumeContext[internal.VGNameKey]
+	if !ok || vgName == "" {
+		return "", fmt.Errorf("volume group name cannot be empty")
+	}
+
+	lvName := volumeID
+	if name, ok := volumeContext[internal.LVNameKey]; ok && name != "" {
+		lvName = name
+	}
+
+	return fmt.Sprintf("/dev/%s/%s", vgName, lvName), nil
+}
+
+// ParseLVMDevicePath parses the VG and LV names of the /dev/<vg>/<lv> device path.
+func ParseLVMDevicePath(devicePath string) (vgName, lvName string, ok bool) {
+	rest, found := strings.CutPrefix(devicePath, "/dev/")
+	if !found {
+		return "", "", false
+	}
+
+	vgName, lvName, ok = staticvolume.ParseVolumeHandle(rest)
+	if !ok || vgName == "mapper" {
+		return "", "", false
+	}
+
+	return vgName, lvName, true
+}
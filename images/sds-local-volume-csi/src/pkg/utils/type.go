@@ -21,6 +21,8 @@ type VolumeGroup struct {
 	Thin struct {
 		PoolName string `yaml:"poolName"`
 	} `yaml:"thin"`
+	// Priority is used by the priority LVMVolumeGroup selection policy. The greater value wins.
+	Priority int `yaml:"priority,omitempty"`
 }
 
 type LVMVolumeGroups []VolumeGroup
@@ -0,0 +1,173 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sds-local-volume-csi/pkg/logger"
+)
+
+const volumeLeasePrefix = "sds-local-volume-csi-"
+
+// ErrVolumeLeaseHeld is returned when another controller plugin replica is processing the volume.
+var ErrVolumeLeaseHeld = errors.New("volume lease is held by another replica")
+
+// VolumeLeases serialize the controller operations on the same volume between the controller plugin replicas,
+// so they do not race each other. Every volume has its own Lease resource which is held while the operation lasts.
+type VolumeLeases struct {
+	cl        client.Client
+	log       *logger.Logger
+	namespace string
+	holder    string
+	duration  time.Duration
+}
+
+func NewVolumeLeases(cl client.Client, log *logger.Logger, namespace, holder string, duration time.Duration) *VolumeLeases {
+	return &VolumeLeases{
+		cl:        cl,
+		log:       log,
+		namespace: namespace,
+		holder:    holder,
+		duration:  duration,
+	}
+}
+
+// Acquire takes the lease of the volume and keeps renewing it until the returned release function is called.
+// ErrVolumeLeaseHeld is returned if the lease is held by another replica and has not expired yet.
+func (l *VolumeLeases) Acquire(ctx context.Context, volumeID string) (func(), error) {
+	name := volumeLeaseName(volumeID)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease := &coordinationv1.Lease{}
+	err := l.cl.Get(ctx, client.ObjectKey{Namespace: l.namespace, Name: name}, lease)
+	switch {
+	case kerrors.IsNotFound(err):
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   l.namespace,
+				Annotations: map[string]string{volumeLeasePrefix + "volume-id": volumeID},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(l.holder),
+				LeaseDurationSeconds: ptr.To(int32(l.duration.Seconds())),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		err = l.cl.Create(ctx, lease)
+		if kerrors.IsAlreadyExists(err) {
+			return nil, ErrVolumeLeaseHeld
+		}
+		if err != nil {
+			return nil, fmt.Errorf("create lease %s: %w", name, err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("get lease %s: %w", name, err)
+	default:
+		if ptr.Deref(lease.Spec.HolderIdentity, "") != l.holder && !isLeaseExpired(lease, now.Time) {
+			return nil, ErrVolumeLeaseHeld
+		}
+
+		lease.Spec.HolderIdentity = ptr.To(l.holder)
+		lease.Spec.LeaseDurationSeconds = ptr.To(int32(l.duration.Seconds()))
+		lease.Spec.AcquireTime = &now
+		lease.Spec.RenewTime = &now
+		err = l.cl.Update(ctx, lease)
+		if kerrors.IsConflict(err) {
+			return nil, ErrVolumeLeaseHeld
+		}
+		if err != nil {
+			return nil, fmt.Errorf("update lease %s: %w", name, err)
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.renew(lease, stop)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+			l.release(lease)
+		})
+	}, nil
+}
+
+// renew keeps the lease alive until the stop channel is closed. The lease object is updated in place,
+// so it has the actual resource version for the release.
+func (l *VolumeLeases) renew(lease *coordinationv1.Lease, stop <-chan struct{}) {
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			now := metav1.NewMicroTime(time.Now())
+			lease.Spec.RenewTime = &now
+			if err := l.cl.Update(context.Background(), lease); err != nil {
+				l.log.Warning(fmt.Sprintf("[VolumeLeases] unable to renew the lease %s: %s", lease.Name, err.Error()))
+			}
+		}
+	}
+}
+
+// release deletes the lease unless it has been taken over by another replica in the meantime.
+func (l *VolumeLeases) release(lease *coordinationv1.Lease) {
+	err := l.cl.Delete(context.Background(), lease, client.Preconditions{ResourceVersion: ptr.To(lease.ResourceVersion)})
+	if err != nil && !kerrors.IsNotFound(err) && !kerrors.IsConflict(err) {
+		l.log.Warning(fmt.Sprintf("[VolumeLeases] unable to release the lease %s: %s", lease.Name, err.Error()))
+	}
+}
+
+func isLeaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	return lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
+
+// volumeLeaseName returns the name of the volume lease. The volume ID is hashed if it is not a valid resource name.
+func volumeLeaseName(volumeID string) string {
+	name := volumeLeasePrefix + volumeID
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s%x", volumeLeasePrefix, sha256.Sum256([]byte(volumeID)))
+}
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	slv "github.com/deckhouse/sds-local-volume/api/v1alpha1"
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/stalelvg"
 	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
 	"github.com/spf13/cobra"
 	v1 "k8s.io/api/core/v1"
@@ -62,6 +63,10 @@ type Config struct {
 	CertFile               string  `json:"cert-file"`
 	KeyFile                string  `json:"key-file"`
 	PVCExpiredDurationSec  int     `json:"pvc-expired-duration-sec"`
+	// StaleLVGThresholdSec is the LVMVolumeGroup status age after which its capacity is considered stale. 0 disables the check.
+	StaleLVGThresholdSec        int    `json:"stale-lvg-threshold-sec"`
+	StaleLVGPolicy              string `json:"stale-lvg-policy"`
+	StaleLVGSafetyMarginPercent int    `json:"stale-lvg-safety-margin-percent"`
 }
 
 var cfgFilePath string
@@ -74,13 +79,15 @@ var resourcesSchemeFuncs = []func(*runtime.Scheme) error{
 }
 
 var config = &Config{
-	ListenAddr:            defaultListenAddr,
-	DefaultDivisor:        defaultDivisor,
-	LogLevel:              "2",
-	CacheSize:             defaultCacheSize,
-	CertFile:              defaultcertFile,
-	KeyFile:               defaultkeyFile,
-	PVCExpiredDurationSec: cache.DefaultPVCExpiredDurationSec,
+	ListenAddr:                  defaultListenAddr,
+	DefaultDivisor:              defaultDivisor,
+	LogLevel:                    "2",
+	CacheSize:                   defaultCacheSize,
+	CertFile:                    defaultcertFile,
+	KeyFile:                     defaultkeyFile,
+	PVCExpiredDurationSec:       cache.DefaultPVCExpiredDurationSec,
+	StaleLVGPolicy:              stalelvg.PolicySkip,
+	StaleLVGSafetyMarginPercent: 20,
 }
 
 var rootCmd = &cobra.Command{
@@ -172,7 +179,17 @@ func subMain(ctx context.Context) error {
 	schedulerCache := cache.NewCache(*log, config.PVCExpiredDurationSec)
 	log.Info("[subMain] scheduler cache was initialized")
 
-	h, err := scheduler.NewHandler(ctx, mgr.GetClient(), *log, schedulerCache, config.DefaultDivisor)
+	staleLVGPolicy := stalelvg.Policy{
+		Threshold:           time.Duration(config.StaleLVGThresholdSec) * time.Second,
+		Action:              config.StaleLVGPolicy,
+		SafetyMarginPercent: config.StaleLVGSafetyMarginPercent,
+	}
+	if err = staleLVGPolicy.Validate(); err != nil {
+		log.Error(err, "[subMain] invalid configuration")
+		return err
+	}
+
+	h, err := scheduler.NewHandler(ctx, mgr.GetClient(), *log, schedulerCache, config.DefaultDivisor, staleLVGPolicy)
 	if err != nil {
 		log.Error(err, "[subMain] unable to create http.Handler of the scheduler extender")
 		return err
@@ -3,9 +3,14 @@ package consts
 const (
 	SdsLocalVolumeProvisioner = "local.csi.storage.deckhouse.io"
 
+	TypeParamKey            = "local.csi.storage.deckhouse.io/type"
 	LvmTypeParamKey         = "local.csi.storage.deckhouse.io/lvm-type"
 	LVMVolumeGroupsParamKey = "local.csi.storage.deckhouse.io/lvm-volume-groups"
 
 	Thick = "Thick"
 	Thin  = "Thin"
+
+	// RawType is the type of the storage classes of the raw device volumes, which take the whole BlockDevices
+	// instead of the LVMVolumeGroups space
+	RawType = "raw"
 )
@@ -23,7 +23,9 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/stalelvg"
 	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/storage/v1"
@@ -146,7 +148,7 @@ func (s *scheduler) filter(w http.ResponseWriter, r *http.Request) {
 	s.log.Debug(fmt.Sprintf("[filter] successfully extracted the PVC requested sizes of a Pod %s/%s", inputData.Pod.Namespace, inputData.Pod.Name))
 
 	s.log.Debug(fmt.Sprintf("[filter] starts to filter the nodes from the request for a Pod %s/%s", inputData.Pod.Namespace, inputData.Pod.Name))
-	filteredNodes, err := filterNodes(s.log, s.cache, &nodeNames, inputData.Pod, managedPVCs, scs, pvcRequests)
+	filteredNodes, err := filterNodes(s.log, s.cache, &nodeNames, inputData.Pod, managedPVCs, scs, pvcRequests, s.staleLVGPolicy)
 	if err != nil {
 		s.log.Error(err, "[filter] unable to filter the nodes")
 		http.Error(w, "bad request", http.StatusBadRequest)
@@ -185,6 +187,10 @@ func filterNotManagedPVC(log logger.Logger, pvcs map[string]*corev1.PersistentVo
 			log.Debug(fmt.Sprintf("[filterNotManagedPVC] filter out PVC %s/%s due to used Storage class %s is not managed by sds-local-volume-provisioner", pvc.Name, pvc.Namespace, sc.Name))
 			continue
 		}
+		if sc.Parameters[consts.TypeParamKey] == consts.RawType {
+			log.Debug(fmt.Sprintf("[filterNotManagedPVC] filter out PVC %s/%s due to used Storage class %s provisions raw devices, which take no LVMVolumeGroup space", pvc.Name, pvc.Namespace, sc.Name))
+			continue
+		}
 
 		filteredPVCs[pvc.Name] = pvc
 	}
@@ -200,6 +206,12 @@ func populateCache(log logger.Logger, nodeNames *[]string, pod *corev1.Pod, sche
 				lvgNamesForTheNode := schedulerCache.GetLVGNamesByNodeName(nodeName)
 				log.Trace(fmt.Sprintf("[populateCache] LVMVolumeGroups from cache for the node %s: %v", nodeName, lvgNamesForTheNode))
 				pvc := pvcs[volume.PersistentVolumeClaim.ClaimName]
+				// the space of a populated PVC is reserved by its prime PVC when the populator's Pod is scheduled,
+				// otherwise it would be reserved twice on the selected node and the population might never start
+				if isPopulatedPVC(pvc) {
+					log.Debug(fmt.Sprintf("[populateCache] PVC %s/%s is filled by a volume populator, its space will be reserved by the prime PVC", pvc.Namespace, pvc.Name))
+					continue
+				}
 				sc := scs[*pvc.Spec.StorageClassName]
 
 				lvgsForPVC, err := ExtractLVGsFromSC(sc)
@@ -308,6 +320,7 @@ func filterNodes(
 	pvcs map[string]*corev1.PersistentVolumeClaim,
 	scs map[string]*v1.StorageClass,
 	pvcRequests map[string]PVCRequest,
+	staleLVGPolicy stalelvg.Policy,
 ) (*ExtenderFilterResult, error) {
 	// Param "pvcRequests" is a total amount of the pvcRequests space (both Thick and Thin) for Pod (i.e. from every PVC)
 	if len(pvcRequests) == 0 {
@@ -316,10 +329,13 @@ func filterNodes(
 		}, nil
 	}
 
-	lvgs := schedulerCache.GetAllLVG()
+	lvgs, staleLVGsByNode := applyStaleLVGPolicy(schedulerCache.GetAllLVG(), staleLVGPolicy, time.Now())
 	for _, lvg := range lvgs {
 		log.Trace(fmt.Sprintf("[filterNodes] LVMVolumeGroup %s in the cache", lvg.Name))
 	}
+	for nodeName, staleLVGs := range staleLVGsByNode {
+		log.Warning(fmt.Sprintf("[filterNodes] capacity data of the LVMVolumeGroups %v on the node %s is stale, the policy %s is applied", staleLVGs, nodeName, staleLVGPolicy.Action))
+	}
 
 	log.Debug(fmt.Sprintf("[filterNodes] starts to get LVMVolumeGroups for Storage Classes for a Pod %s/%s", pod.Namespace, pod.Name))
 	scLVGs, err := GetSortedLVGsFromStorageClasses(scs)
@@ -408,7 +424,11 @@ func filterNodes(
 			if _, common := commonNodes[nodeName]; !common {
 				log.Debug(fmt.Sprintf("[filterNodes] node %s is not common for used Storage Classes %+v", nodeName, scs))
 				failedNodesMapMtx.Lock()
-				result.FailedNodes[nodeName] = fmt.Sprintf("node %s is not common for used Storage Classes", nodeName)
+				if staleLVGs, stale := staleLVGsByNode[nodeName]; stale {
+					result.FailedNodes[nodeName] = fmt.Sprintf("capacity data of the LVMVolumeGroups %v on the node %s is stale", staleLVGs, nodeName)
+				} else {
+					result.FailedNodes[nodeName] = fmt.Sprintf("node %s is not common for used Storage Classes", nodeName)
+				}
 				failedNodesMapMtx.Unlock()
 				return
 			}
@@ -484,7 +504,11 @@ func filterNodes(
 
 			if !hasEnoughSpace {
 				failedNodesMapMtx.Lock()
-				result.FailedNodes[nodeName] = "not enough space"
+				if staleLVGs, stale := staleLVGsByNode[nodeName]; stale {
+					result.FailedNodes[nodeName] = fmt.Sprintf("not enough space (capacity data of the LVMVolumeGroups %v is stale, safety margin applied)", staleLVGs)
+				} else {
+					result.FailedNodes[nodeName] = "not enough space"
+				}
 				failedNodesMapMtx.Unlock()
 				return
 			}
@@ -18,6 +18,7 @@ func TestFilter(t *testing.T) {
 		sc1 := "sc1"
 		sc2 := "sc2"
 		sc3 := "sc3"
+		sc4 := "sc4"
 		scs := map[string]*v12.StorageClass{
 			sc1: {
 				ObjectMeta: metav1.ObjectMeta{
@@ -36,6 +37,13 @@ func TestFilter(t *testing.T) {
 					Name: sc3,
 				},
 			},
+			sc4: {
+				ObjectMeta: metav1.ObjectMeta{
+					Name: sc4,
+				},
+				Provisioner: consts.SdsLocalVolumeProvisioner,
+				Parameters:  map[string]string{consts.TypeParamKey: consts.RawType},
+			},
 		}
 		pvcs := map[string]*v1.PersistentVolumeClaim{
 			"first": {
@@ -62,6 +70,14 @@ func TestFilter(t *testing.T) {
 					StorageClassName: &sc3,
 				},
 			},
+			"fourth": {
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "fourth",
+				},
+				Spec: v1.PersistentVolumeClaimSpec{
+					StorageClassName: &sc4,
+				},
+			},
 		}
 
 		filtered := filterNotManagedPVC(log, pvcs, scs)
@@ -73,6 +89,8 @@ func TestFilter(t *testing.T) {
 			assert.True(t, ok)
 			_, ok = filtered["third"]
 			assert.False(t, ok)
+			_, ok = filtered["fourth"]
+			assert.False(t, ok)
 		}
 	})
 }
@@ -19,7 +19,10 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/stalelvg"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -30,8 +33,58 @@ import (
 const (
 	annotationBetaStorageProvisioner = "volume.beta.kubernetes.io/storage-provisioner"
 	annotationStorageProvisioner     = "volume.kubernetes.io/storage-provisioner"
+
+	snapshotAPIGroup = "snapshot.storage.k8s.io"
 )
 
+// isPopulatedPVC returns true if the PVC is filled by a volume populator, i.e. its dataSourceRef points to a custom
+// resource rather than to a PVC or a VolumeSnapshot. Such a PVC is not provisioned by the driver directly: the populator
+// creates a prime PVC on the selected node, fills it and then rebinds its PV to the original PVC.
+func isPopulatedPVC(pvc *corev1.PersistentVolumeClaim) bool {
+	ref := pvc.Spec.DataSourceRef
+	if ref == nil {
+		return false
+	}
+
+	apiGroup := ""
+	if ref.APIGroup != nil {
+		apiGroup = *ref.APIGroup
+	}
+
+	switch {
+	case apiGroup == "" && ref.Kind == "PersistentVolumeClaim":
+		return false
+	case apiGroup == snapshotAPIGroup && ref.Kind == "VolumeSnapshot":
+		return false
+	default:
+		return true
+	}
+}
+
+// applyStaleLVGPolicy returns the LVMVolumeGroups with the policy applied to the stale ones and the names of the stale
+// LVMVolumeGroups sorted by the node names. The LVMVolumeGroups from the cache are never modified.
+func applyStaleLVGPolicy(lvgs map[string]*snc.LVMVolumeGroup, policy stalelvg.Policy, now time.Time) (map[string]*snc.LVMVolumeGroup, map[string][]string) {
+	if policy.Threshold == 0 {
+		return lvgs, nil
+	}
+
+	result := make(map[string]*snc.LVMVolumeGroup, len(lvgs))
+	staleByNode := make(map[string][]string)
+	for name, lvg := range lvgs {
+		applied, stale := policy.Apply(lvg, now)
+		if stale {
+			for _, node := range lvg.Status.Nodes {
+				staleByNode[node.Name] = append(staleByNode[node.Name], lvg.Name)
+			}
+		}
+		if applied != nil {
+			result[name] = applied
+		}
+	}
+
+	return result, staleByNode
+}
+
 func shouldProcessPod(ctx context.Context, cl client.Client, log logger.Logger, pod *corev1.Pod, targetProvisioner string) (bool, error) {
 	log.Trace(fmt.Sprintf("[ShouldProcessPod] targetProvisioner=%s, pod: %+v", targetProvisioner, pod))
 	var discoveredProvisioner string
@@ -19,9 +19,13 @@ package scheduler
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/stalelvg"
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -239,6 +243,85 @@ func TestShouldProcessPod(t *testing.T) {
 	}
 }
 
+func TestApplyStaleLVGPolicy(t *testing.T) {
+	now := time.Now()
+	newLVG := func(name, node string, updated time.Time) *snc.LVMVolumeGroup {
+		return &snc.LVMVolumeGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: snc.LVMVolumeGroupStatus{
+				Conditions: []metav1.Condition{
+					{Type: "Ready", Status: metav1.ConditionTrue, LastTransitionTime: metav1.NewTime(updated)},
+				},
+				Nodes:  []snc.LVMVolumeGroupNode{{Name: node}},
+				VGFree: resource.MustParse("10Gi"),
+				ThinPools: []snc.LVMVolumeGroupThinPoolStatus{
+					{Name: "tp", AvailableSpace: resource.MustParse("10Gi")},
+				},
+			},
+		}
+	}
+	lvgs := map[string]*snc.LVMVolumeGroup{
+		"fresh": newLVG("fresh", "node1", now.Add(-time.Minute)),
+		"stale": newLVG("stale", "node2", now.Add(-time.Hour)),
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		result, stale := applyStaleLVGPolicy(lvgs, stalelvg.Policy{Action: stalelvg.PolicySkip}, now)
+		if len(result) != 2 || len(stale) != 0 {
+			t.Fatalf("expected all LVMVolumeGroups to be used, got %d used and %v stale", len(result), stale)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		result, stale := applyStaleLVGPolicy(lvgs, stalelvg.Policy{Threshold: 10 * time.Minute, Action: stalelvg.PolicySkip}, now)
+		if _, ok := result["stale"]; ok {
+			t.Fatalf("expected the stale LVMVolumeGroup to be skipped")
+		}
+		if _, ok := result["fresh"]; !ok {
+			t.Fatalf("expected the fresh LVMVolumeGroup to be used")
+		}
+		if len(stale["node2"]) != 1 {
+			t.Errorf("expected the stale LVMVolumeGroup to be recorded for node2, got %v", stale)
+		}
+	})
+
+	t.Run("safety margin", func(t *testing.T) {
+		result, _ := applyStaleLVGPolicy(lvgs, stalelvg.Policy{Threshold: 10 * time.Minute, Action: stalelvg.PolicySafetyMargin, SafetyMarginPercent: 50}, now)
+		expected := resource.MustParse("5Gi")
+		if result["stale"].Status.VGFree.Value() != expected.Value() {
+			t.Errorf("expected VGFree %s, got %s", expected.String(), result["stale"].Status.VGFree.String())
+		}
+		if result["stale"].Status.ThinPools[0].AvailableSpace.Value() != expected.Value() {
+			t.Errorf("expected thin pool available space %s, got %s", expected.String(), result["stale"].Status.ThinPools[0].AvailableSpace.String())
+		}
+		if lvgs["stale"].Status.VGFree.Value() == expected.Value() || lvgs["stale"].Status.ThinPools[0].AvailableSpace.Value() == expected.Value() {
+			t.Errorf("the cached LVMVolumeGroup must not be modified")
+		}
+	})
+}
+
+func TestIsPopulatedPVC(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ref      *corev1.TypedObjectReference
+		expected bool
+	}{
+		{name: "no data source", expected: false},
+		{name: "PVC clone", ref: &corev1.TypedObjectReference{Kind: "PersistentVolumeClaim", Name: "src"}, expected: false},
+		{name: "snapshot", ref: &corev1.TypedObjectReference{APIGroup: stringPtr("snapshot.storage.k8s.io"), Kind: "VolumeSnapshot", Name: "snap"}, expected: false},
+		{name: "populator", ref: &corev1.TypedObjectReference{APIGroup: stringPtr("hello.example.com"), Kind: "Hello", Name: "data"}, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pvc := &corev1.PersistentVolumeClaim{Spec: corev1.PersistentVolumeClaimSpec{DataSourceRef: tc.ref}}
+			if result := isPopulatedPVC(pvc); result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/deckhouse/sds-local-volume/lib/go/common/pkg/stalelvg"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -35,6 +36,7 @@ type scheduler struct {
 	ctx            context.Context
 	cache          *cache.Cache
 	requestCount   int
+	staleLVGPolicy stalelvg.Policy
 }
 
 func (s *scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -65,13 +67,14 @@ func (s *scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // NewHandler return new http.Handler of the scheduler extender
-func NewHandler(ctx context.Context, cl client.Client, log logger.Logger, lvgCache *cache.Cache, defaultDiv float64) (http.Handler, error) {
+func NewHandler(ctx context.Context, cl client.Client, log logger.Logger, lvgCache *cache.Cache, defaultDiv float64, staleLVGPolicy stalelvg.Policy) (http.Handler, error) {
 	return &scheduler{
 		defaultDivisor: defaultDiv,
 		log:            log,
 		client:         cl,
 		ctx:            ctx,
 		cache:          lvgCache,
+		staleLVGPolicy: staleLVGPolicy,
 	}, nil
 }
 
@@ -46,6 +46,11 @@ func LSCValidate(ctx context.Context, _ *model.AdmissionReview, obj metav1.Objec
 		return &kwhvalidating.ValidatorResult{}, nil
 	}
 
+	// the raw device LocalStorageClass has no LVM settings to validate, its settings are validated by the CRD and the controller
+	if lsc.Spec.LVM == nil {
+		return &kwhvalidating.ValidatorResult{Valid: true}, nil
+	}
+
 	cl, err := NewKubeClient("")
 	if err != nil {
 		klog.Fatal(err)
@@ -97,7 +102,8 @@ func LSCValidate(ctx context.Context, _ *model.AdmissionReview, obj metav1.Objec
 
 	thinExists, thickExists := len(thinNames) > 0, len(thickNames) > 0
 
-	if thinExists {
+	// the LVMVolumeGroups selected by labels are not listed, so the thin pools support is enabled by the type as well
+	if thinExists || lsc.Spec.LVM.Type == "Thin" {
 		ctx := context.Background()
 		cl, err := NewKubeClient("")
 		if err != nil {
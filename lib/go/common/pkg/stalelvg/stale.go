@@ -0,0 +1,111 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stalelvg
+
+import (
+	"fmt"
+	"time"
+
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	PolicySkip         = "Skip"
+	PolicySafetyMargin = "SafetyMargin"
+)
+
+// Policy describes how to treat LVMVolumeGroups whose status has not been updated for too long
+// (e.g. the agent on the node is down), so their capacity can not be trusted.
+type Policy struct {
+	// Threshold is the status age after which the capacity is considered stale. Zero disables the check.
+	Threshold time.Duration
+	// Action is either PolicySkip (do not use such LVMVolumeGroups at all) or
+	// PolicySafetyMargin (use the last known free space reduced by SafetyMarginPercent).
+	Action              string
+	SafetyMarginPercent int
+}
+
+func (p Policy) Validate() error {
+	switch p.Action {
+	case PolicySkip, PolicySafetyMargin:
+	default:
+		return fmt.Errorf("unsupported stale LVMVolumeGroup policy %q, supported: %s, %s", p.Action, PolicySkip, PolicySafetyMargin)
+	}
+
+	if p.SafetyMarginPercent < 0 || p.SafetyMarginPercent > 100 {
+		return fmt.Errorf("safety margin must be in range [0, 100], got %d", p.SafetyMarginPercent)
+	}
+
+	if p.Threshold < 0 {
+		return fmt.Errorf("threshold can not be negative, got %s", p.Threshold)
+	}
+
+	return nil
+}
+
+// StatusUpdateTime returns the latest LastTransitionTime of the LVMVolumeGroup's conditions, which the agent sets
+// whenever it updates the status, and false if the LVMVolumeGroup has no conditions yet.
+func StatusUpdateTime(lvg *snc.LVMVolumeGroup) (time.Time, bool) {
+	var updated time.Time
+	for _, c := range lvg.Status.Conditions {
+		if c.LastTransitionTime.After(updated) {
+			updated = c.LastTransitionTime.Time
+		}
+	}
+
+	return updated, !updated.IsZero()
+}
+
+// IsStale reports if the capacity data of the LVMVolumeGroup is older than the threshold. The LVMVolumeGroup without
+// the conditions has never been reported by the agent, so it is stale too.
+func (p Policy) IsStale(lvg *snc.LVMVolumeGroup, now time.Time) bool {
+	if p.Threshold == 0 {
+		return false
+	}
+
+	updated, ok := StatusUpdateTime(lvg)
+	return !ok || now.Sub(updated) > p.Threshold
+}
+
+// Apply returns the LVMVolumeGroup to take the capacity from and whether its capacity data is stale. The fresh
+// LVMVolumeGroup is returned as is, the stale one is either skipped (nil is returned) or returned as a copy with
+// the free space reduced by the safety margin, so the cached objects are never modified.
+func (p Policy) Apply(lvg *snc.LVMVolumeGroup, now time.Time) (*snc.LVMVolumeGroup, bool) {
+	if !p.IsStale(lvg, now) {
+		return lvg, false
+	}
+
+	if p.Action == PolicySkip {
+		return nil, true
+	}
+
+	// the DeepCopy of the LVMVolumeGroup copies its metadata only, so the thin pools slice is copied explicitly
+	adjusted := lvg.DeepCopy()
+	adjusted.Status.VGFree = reduceByPercent(adjusted.Status.VGFree, p.SafetyMarginPercent)
+	adjusted.Status.ThinPools = make([]snc.LVMVolumeGroupThinPoolStatus, 0, len(lvg.Status.ThinPools))
+	for _, tp := range lvg.Status.ThinPools {
+		tp.AvailableSpace = reduceByPercent(tp.AvailableSpace, p.SafetyMarginPercent)
+		adjusted.Status.ThinPools = append(adjusted.Status.ThinPools, tp)
+	}
+
+	return adjusted, true
+}
+
+func reduceByPercent(q resource.Quantity, percent int) resource.Quantity {
+	return *resource.NewQuantity(q.Value()-q.Value()*int64(percent)/100, resource.BinarySI)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stalelvg
+
+import (
+	"testing"
+	"time"
+
+	snc "github.com/deckhouse/sds-node-configurator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newLVG(conditionTimes ...time.Time) *snc.LVMVolumeGroup {
+	lvg := &snc.LVMVolumeGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "vg-1"},
+		Status: snc.LVMVolumeGroupStatus{
+			VGFree: resource.MustParse("10Gi"),
+			ThinPools: []snc.LVMVolumeGroupThinPoolStatus{
+				{Name: "tp", AvailableSpace: resource.MustParse("10Gi")},
+			},
+		},
+	}
+	for i, t := range conditionTimes {
+		lvg.Status.Conditions = append(lvg.Status.Conditions, metav1.Condition{
+			Type:               string(rune('A' + i)),
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(t),
+		})
+	}
+
+	return lvg
+}
+
+func TestPolicyIsStale(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	threshold := 10 * time.Minute
+
+	for _, tc := range []struct {
+		name      string
+		threshold time.Duration
+		lvg       *snc.LVMVolumeGroup
+		stale     bool
+	}{
+		{name: "disabled", threshold: 0, lvg: newLVG(now.Add(-time.Hour))},
+		{name: "disabled without conditions", threshold: 0, lvg: newLVG()},
+		{name: "fresh", threshold: threshold, lvg: newLVG(now.Add(-time.Minute))},
+		{name: "exactly at the threshold", threshold: threshold, lvg: newLVG(now.Add(-threshold))},
+		{name: "just over the threshold", threshold: threshold, lvg: newLVG(now.Add(-threshold - time.Nanosecond)), stale: true},
+		{name: "latest condition counts", threshold: threshold, lvg: newLVG(now.Add(-time.Hour), now.Add(-time.Minute))},
+		{name: "all conditions are old", threshold: threshold, lvg: newLVG(now.Add(-time.Hour), now.Add(-2*time.Hour)), stale: true},
+		{name: "no conditions", threshold: threshold, lvg: newLVG(), stale: true},
+		{name: "updated in the future", threshold: threshold, lvg: newLVG(now.Add(time.Minute))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if stale := (Policy{Threshold: tc.threshold, Action: PolicySkip}).IsStale(tc.lvg, now); stale != tc.stale {
+				t.Errorf("expected stale %t, got %t", tc.stale, stale)
+			}
+		})
+	}
+}
+
+func TestPolicyApply(t *testing.T) {
+	now := time.Now()
+	threshold := 10 * time.Minute
+
+	t.Run("fresh", func(t *testing.T) {
+		lvg := newLVG(now)
+		result, stale := Policy{Threshold: threshold, Action: PolicySkip}.Apply(lvg, now)
+		if stale || result != lvg {
+			t.Errorf("expected the fresh LVMVolumeGroup to be used as is, got %v, stale %t", result, stale)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		result, stale := Policy{Threshold: threshold, Action: PolicySkip}.Apply(newLVG(now.Add(-time.Hour)), now)
+		if !stale || result != nil {
+			t.Errorf("expected the stale LVMVolumeGroup to be skipped, got %v, stale %t", result, stale)
+		}
+	})
+
+	for _, tc := range []struct {
+		percent  int
+		expected string
+	}{
+		{percent: 0, expected: "10Gi"},
+		{percent: 50, expected: "5Gi"},
+		{percent: 100, expected: "0"},
+	} {
+		t.Run("safety margin "+tc.expected, func(t *testing.T) {
+			lvg := newLVG(now.Add(-time.Hour))
+			result, stale := Policy{Threshold: threshold, Action: PolicySafetyMargin, SafetyMarginPercent: tc.percent}.Apply(lvg, now)
+			if !stale || result == nil {
+				t.Fatalf("expected the stale LVMVolumeGroup to be used with the safety margin, got %v, stale %t", result, stale)
+			}
+
+			expected := resource.MustParse(tc.expected)
+			if result.Status.VGFree.Value() != expected.Value() {
+				t.Errorf("expected VGFree %s, got %s", expected.String(), result.Status.VGFree.String())
+			}
+			if result.Status.ThinPools[0].AvailableSpace.Value() != expected.Value() {
+				t.Errorf("expected thin pool available space %s, got %s", expected.String(), result.Status.ThinPools[0].AvailableSpace.String())
+			}
+			if lvg.Status.VGFree.String() != "10Gi" || lvg.Status.ThinPools[0].AvailableSpace.String() != "10Gi" {
+				t.Errorf("the original LVMVolumeGroup must not be modified")
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		policy Policy
+		valid  bool
+	}{
+		{policy: Policy{Action: PolicySkip}, valid: true},
+		{policy: Policy{Action: PolicySafetyMargin, SafetyMarginPercent: 100, Threshold: time.Minute}, valid: true},
+		{policy: Policy{Action: "Ignore"}},
+		{policy: Policy{Action: PolicySafetyMargin, SafetyMarginPercent: 101}},
+		{policy: Policy{Action: PolicySafetyMargin, SafetyMarginPercent: -1}},
+		{policy: Policy{Action: PolicySkip, Threshold: -time.Second}},
+	} {
+		if err := tc.policy.Validate(); (err == nil) != tc.valid {
+			t.Errorf("policy %+v: expected valid %t, got error %v", tc.policy, tc.valid, err)
+		}
+	}
+}
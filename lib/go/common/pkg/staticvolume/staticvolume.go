@@ -0,0 +1,52 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package staticvolume
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// LLVNamePrefix is the name prefix of the LVMLogicalVolumes adopting the LVs of the statically provisioned PVs.
+	LLVNamePrefix = "static-"
+	// AdoptedPVAnnotationKey is the annotation of the adopting LVMLogicalVolume with the name of the PV.
+	AdoptedPVAnnotationKey = "local.csi.storage.deckhouse.io/adopted-pv"
+	// VolumeHandleAnnotationKey is the annotation of the adopting LVMLogicalVolume with the volumeHandle of the PV,
+	// which is the ID the CSI driver reports the volume by.
+	VolumeHandleAnnotationKey = "local.csi.storage.deckhouse.io/volume-handle"
+)
+
+// ParseVolumeHandle parses the volumeHandle of a statically provisioned PV in the <vg name>/<lv name> format.
+// The dynamically provisioned volumes are named after their LVMLogicalVolumes, which never contain a slash.
+func ParseVolumeHandle(volumeHandle string) (vgName, lvName string, ok bool) {
+	vgName, lvName, found := strings.Cut(volumeHandle, "/")
+	if !found || vgName == "" || lvName == "" || strings.Contains(lvName, "/") {
+		return "", "", false
+	}
+
+	return vgName, lvName, true
+}
+
+// LLVName returns the name of the LVMLogicalVolume which adopts the LV of a statically provisioned PV. The controller
+// creates the LVMLogicalVolume and the CSI driver looks it up by this name. The VG and LV names might contain
+// characters not allowed in the resource names, so they are hashed.
+func LLVName(vgName, lvName string) string {
+	sum := sha256.Sum256([]byte(vgName + "/" + lvName))
+	return LLVNamePrefix + hex.EncodeToString(sum[:])[:32]
+}
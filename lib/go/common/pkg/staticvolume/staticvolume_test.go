@@ -0,0 +1,40 @@
+/*
+Copyright 2025 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package staticvolume
+
+import "testing"
+
+func TestParseVolumeHandle(t *testing.T) {
+	vgName, lvName, ok := ParseVolumeHandle("data/lv_01")
+	if !ok || vgName != "data" || lvName != "lv_01" {
+		t.Fatalf("unexpected result: %q, %q, %t", vgName, lvName, ok)
+	}
+
+	for _, volumeHandle := range []string{"pvc-1", "/lv", "vg/", "vg/lv/extra"} {
+		if _, _, ok := ParseVolumeHandle(volumeHandle); ok {
+			t.Errorf("%q must not be parsed as a static volume handle", volumeHandle)
+		}
+	}
+}
+
+// The name is persisted in the cluster by the controller and looked up by the CSI driver, so it must never change.
+func TestLLVName(t *testing.T) {
+	const expected = "static-1c9061d94d7974fc5df2e9affb27df19"
+	if name := LLVName("data", "lv_01"); name != expected {
+		t.Errorf("expected %s, got %s", expected, name)
+	}
+}